@@ -3,7 +3,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/binaries"
@@ -12,6 +15,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// assumeYesEnv, when true, answers yes to confirmations like --yes.
+const assumeYesEnv = "DNSTC_ASSUME_YES"
+
 // BuildCobraCommand builds a Cobra command from an action.
 func BuildCobraCommand(action *actions.Action) *cobra.Command {
 	cmd := &cobra.Command{
@@ -101,6 +107,19 @@ func BuildCobraCommand(action *actions.Action) *cobra.Command {
 			IsInteractive: false,
 		}
 
+		// Actions with a json input of their own format it themselves
+		verbosity := verbosityOf(cmd)
+		var jsonOut *handlers.JSONOutput
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON && !hasInput(action, "json") {
+			jsonOut = handlers.NewJSONOutput()
+			jsonOut.SetVerbosity(verbosity)
+			ctx.Output = jsonOut
+		} else {
+			out := handlers.NewTUIOutput()
+			out.SetVerbosity(verbosity)
+			ctx.Output = out
+		}
+
 		// Load config
 		cfg, _ := config.Load()
 		ctx.Config = cfg
@@ -110,7 +129,7 @@ func BuildCobraCommand(action *actions.Action) *cobra.Command {
 			tagVal, _ := cmd.Flags().GetString("tag")
 			ctx.Values["tag"] = tagVal
 			if action.Args.Required && tagVal == "" {
-				return fmt.Errorf("--tag/-t is required\n\nUsage: %s", cmd.UseLine())
+				return actions.NewCodedError(actions.CodeUsage, "--tag/-t is required", "Usage: "+cmd.UseLine())
 			}
 		}
 
@@ -132,22 +151,28 @@ func BuildCobraCommand(action *actions.Action) *cobra.Command {
 			}
 		}
 
-		// Handle confirmation flag
+		// Handle confirmation flag; --yes confirms too, as does it for
+		// actions with a yes input of their own, such as update
+		yes := assumeYes(cmd)
 		if action.Confirm != nil && action.Confirm.ForceFlag != "" {
 			force, _ := cmd.Flags().GetBool(action.Confirm.ForceFlag)
-			ctx.Values[action.Confirm.ForceFlag] = force
+			ctx.Values[action.Confirm.ForceFlag] = force || yes
+		}
+		if yes && hasInput(action, "yes") {
+			ctx.Values["yes"] = true
 		}
 
 		// Require non-tag arguments in CLI mode
 		if action.Args != nil && action.Args.Name != "tag" && action.Args.Required && len(args) == 0 {
-			return fmt.Errorf("%s is required\n\nUsage: %s", action.Args.Name, cmd.UseLine())
+			return actions.NewCodedError(actions.CodeUsage, action.Args.Name+" is required", "Usage: "+cmd.UseLine())
 		}
 
 		// Handle confirmation — require --force in CLI mode
 		if action.Confirm != nil {
 			force := ctx.GetBool(action.Confirm.ForceFlag)
-			if !force {
-				return fmt.Errorf("%s\n\nUse --force to confirm", action.Confirm.Message)
+			skip := action.Confirm.SkipFlag != "" && ctx.GetBool(action.Confirm.SkipFlag)
+			if !force && !skip {
+				return actions.NewCodedError(actions.CodeUsage, action.Confirm.Message, "Use --force or --yes to confirm")
 			}
 		}
 
@@ -155,16 +180,66 @@ func BuildCobraCommand(action *actions.Action) *cobra.Command {
 			return fmt.Errorf("no handler for action %s", action.ID)
 		}
 
-		return action.Handler(ctx)
+		// Arguments are valid; handler errors shouldn't print usage
+		cmd.SilenceUsage = true
+		started := time.Now()
+		err := action.Handler(ctx)
+		ctx.Output.Debug(fmt.Sprintf("%s finished in %s", cmd.CommandPath(), time.Since(started).Round(time.Millisecond)))
+		if jsonOut != nil {
+			jsonOut.Emit(os.Stdout, err)
+			return actions.Reported(err)
+		}
+		return err
 	}
 
 	return cmd
 }
 
+// verbosityOf returns the verbosity asked for with --quiet or --verbose and
+// sets the log level to match: warnings only when quiet, debug when verbose.
+func verbosityOf(cmd *cobra.Command) actions.Verbosity {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	switch {
+	case quiet:
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+		return actions.VerbosityQuiet
+	case verbose:
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		return actions.VerbosityVerbose
+	}
+	return actions.VerbosityNormal
+}
+
+// assumeYes reports whether confirmations are answered by --yes or
+// DNSTC_ASSUME_YES.
+func assumeYes(cmd *cobra.Command) bool {
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return true
+	}
+	yes, _ := strconv.ParseBool(os.Getenv(assumeYesEnv))
+	return yes
+}
+
+// hasInput reports whether the action has an input with the given name.
+func hasInput(action *actions.Action, name string) bool {
+	for _, input := range action.Inputs {
+		if input.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // requireInstall checks that binaries are installed, returning a user-friendly error if not.
 func requireInstall() error {
 	if !binaries.AreInstalled() {
-		return fmt.Errorf("binaries not installed — run 'dnstc install' first")
+		return &actions.ActionError{
+			Message: "binaries not installed",
+			Hint:    "Run 'dnstc install' first",
+			Err:     actions.ErrNotInstalled,
+			Code:    actions.CodeNotInstalled,
+		}
 	}
 	return nil
 }
@@ -1,20 +1,31 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/binaries"
 	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/disk"
 	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/handover"
 	"github.com/net2share/dnstc/internal/ipc"
+	"github.com/net2share/dnstc/internal/port"
+	"github.com/net2share/dnstc/internal/process"
 	"github.com/spf13/cobra"
 )
 
@@ -23,71 +34,232 @@ var daemonCmd = &cobra.Command{
 	Short: "Manage the background daemon",
 }
 
-// daemonRunCmd is the hidden foreground process used by systemd ExecStart.
+// daemonRunCmd is the hidden foreground process run by the systemd unit and
+// the Windows service.
 var daemonRunCmd = &cobra.Command{
 	Use:    "run",
 	Short:  "Run the daemon in the foreground",
 	Hidden: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if !binaries.AreInstalled() {
-			return fmt.Errorf("binaries not installed — run 'dnstc install' first")
+		// Started by the Windows service control manager
+		if handled, err := runAsService(func(stop <-chan struct{}) error {
+			return runDaemon(cmd, stop)
+		}); handled {
+			return err
 		}
+		return runDaemon(cmd, nil)
+	},
+}
+
+// runDaemon runs the daemon until a signal, a shutdown request over IPC or
+// stop is closed. stop may be nil.
+func runDaemon(cmd *cobra.Command, stop <-chan struct{}) error {
+	if !binaries.AreInstalled() {
+		return actions.NewCodedError(actions.CodeNotInstalled, "binaries not installed", "Run 'dnstc install' first")
+	}
 
-		// Check for existing daemon via IPC
+	// Started by 'daemon upgrade': we inherit the previous daemon's sockets
+	inherited, upgraded := handover.FromEnv()
+
+	// Check for existing daemon via IPC. After an upgrade the socket is our own.
+	if !upgraded {
 		if running, client := ipc.DetectDaemon(); running {
 			client.Close()
 			return fmt.Errorf("daemon is already running (socket: %s)", config.SocketPath())
 		}
+	}
 
-		// Load config
-		config.MigrateConfigIfNeeded()
-		cfg, err := config.LoadOrDefault()
-		if err != nil {
-			return fmt.Errorf("failed to load config: %w", err)
-		}
-
-		// Create engine — stop any orphan processes from a previous session
-		eng := engine.New(cfg)
-		eng.Stop()
-		engine.Set(eng)
-		defer engine.Set(nil)
+	// Load config
+	config.MigrateConfigIfNeeded()
+	provision()
+	cfg, err := config.LoadOrDefault()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if _, err := config.LoadPolicy(); err != nil {
+		return err
+	}
 
-		// Start IPC server first so clients can connect immediately
-		socketPath := config.SocketPath()
-		srv := ipc.NewServer(socketPath, Version, eng)
-		if err := srv.Start(); err != nil {
-			return fmt.Errorf("failed to start IPC server: %w", err)
+	// Create engine — reattach tunnel processes left by a previous session
+	// (e.g. across an upgrade) and stop any that no longer match the config
+	eng := engine.New(cfg)
+	if noAdopt, _ := cmd.Flags().GetBool("no-adopt"); noAdopt && !upgraded {
+		eng.Stop(context.Background())
+	} else if adopted := eng.AdoptOrphans(); len(adopted) > 0 {
+		fmt.Printf("Adopted %d running tunnel(s) from previous session\n", len(adopted))
+	}
+	if upgraded && inherited.Gateway > 0 {
+		if ln, err := handover.Listener(inherited.Gateway, "gateway"); err == nil {
+			eng.InheritGateway(ln, inherited.RelayConns())
+		} else {
+			fmt.Printf("Warning: failed to inherit gateway listener: %v\n", err)
 		}
-		defer srv.Stop()
+	}
+	engine.Set(eng)
+	defer engine.Set(nil)
+
+	// Start IPC server first so clients can connect immediately
+	socketPath := config.SocketPath()
+	srv := ipc.NewServer(socketPath, Version, eng)
+	if err := startIPCServer(srv, inherited); err != nil {
+		return err
+	}
+	defer srv.Stop()
 
-		// Auto-start tunnels so they come up after reboot
-		if err := eng.Start(); err != nil {
-			fmt.Printf("Warning: failed to auto-start tunnels: %v\n", err)
-		}
+	// Auto-start tunnels so they come up after reboot
+	if err := eng.Start(context.Background()); err != nil {
+		fmt.Printf("Warning: failed to auto-start tunnels: %v\n", err)
+	}
 
-		fmt.Printf("Daemon ready (socket: %s)\n", socketPath)
+	fmt.Printf("Daemon ready (socket: %s)\n", socketPath)
 
-		// Wait for signal or shutdown request
-		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	// Wait for signal or shutdown request
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
+wait:
+	for {
 		select {
 		case <-sig:
+			break wait
+		case <-hup:
+			fmt.Println("Reloading config...")
+			if err := eng.ReloadConfig(context.Background()); err != nil {
+				fmt.Printf("Warning: config reload failed, keeping current config: %v\n", err)
+			}
 		case <-srv.ShutdownCh:
+			break wait
+		case <-stop:
+			break wait
+		case binary := <-srv.UpgradeCh:
+			fmt.Printf("Upgrading daemon to %s...\n", binary)
+			err := execUpgrade(eng, srv, binary) // only returns on failure
+			fmt.Printf("Warning: upgrade failed, continuing with current binary: %v\n", err)
 		}
+	}
 
-		fmt.Println("\nShutting down...")
-		eng.Stop()
-		fmt.Println("Stopped.")
+	fmt.Println("\nShutting down...")
+	eng.Stop(context.Background())
+	fmt.Println("Stopped.")
 
-		return nil
+	return nil
+}
+
+// startIPCServer starts the IPC server, on the inherited socket after an upgrade.
+func startIPCServer(srv *ipc.Server, inherited *handover.State) error {
+	if inherited != nil && inherited.IPC > 0 {
+		ln, err := handover.Listener(inherited.IPC, "ipc")
+		if err == nil {
+			srv.StartWithListener(ln)
+			return nil
+		}
+		fmt.Printf("Warning: failed to inherit IPC socket: %v\n", err)
+	}
+	if err := srv.Start(); err != nil {
+		return fmt.Errorf("failed to start IPC server: %w", err)
+	}
+	return nil
+}
+
+// execUpgrade hands the daemon's sockets over to binary and execs it in place
+// of the current process. On failure it restores the gateway and returns the error.
+func execUpgrade(eng *engine.Engine, srv *ipc.Server, binary string) error {
+	ipcFile, err := srv.ListenerFile()
+	if err != nil {
+		return err
+	}
+	gwFile, relays, err := eng.PrepareHandover()
+	if err != nil {
+		ipcFile.Close()
+		eng.Start(context.Background())
+		return err
+	}
+
+	files := &handover.Files{Gateway: gwFile, IPC: ipcFile, Relays: relays}
+	execErr := handover.Exec(binary, files)
+
+	// Still here: resume in this process
+	ln, conns, err := files.RestoreGateway()
+	if err == nil && ln != nil {
+		eng.InheritGateway(ln, conns)
+	}
+	if err := eng.Start(context.Background()); err != nil {
+		fmt.Printf("Warning: failed to restart tunnels: %v\n", err)
+	}
+	return execErr
+}
+
+var daemonUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Restart the daemon on the installed binary without dropping connections",
+	Long: `Restart the running daemon on the current dnstc binary (e.g. after 'dnstc update').
+
+The daemon re-executes itself in place and hands over the gateway listener,
+open gateway connections and tunnel processes, so clients stay connected.
+SSH backend tunnels are reconnected because their SSH session lives in the daemon.
+
+Not supported on Windows. Outside Linux, where a process's command line
+can't be read back, a tunnel process is kept if its PID is still alive and
+the command it was started with matches the config.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		running, client := ipc.DetectDaemon()
+		if !running {
+			return actions.NewCodedError(actions.CodeDaemonUnreachable, "no daemon running", "")
+		}
+		before, _ := client.Ping(context.Background())
+
+		binary, err := os.Executable()
+		if err != nil {
+			client.Close()
+			return fmt.Errorf("failed to locate dnstc binary: %w", err)
+		}
+
+		fmt.Println("Upgrading daemon...")
+		err = client.Upgrade(context.Background(), binary)
+		client.Close()
+		if err != nil {
+			return fmt.Errorf("upgrade failed: %w", err)
+		}
+
+		// The socket stays open across the exec; wait for the new binary to answer
+		deadline := time.Now().Add(15 * time.Second)
+		for time.Now().Before(deadline) {
+			time.Sleep(300 * time.Millisecond)
+			running, client := ipc.DetectDaemon()
+			if !running {
+				continue
+			}
+			after, err := client.Ping(context.Background())
+			client.Close()
+			if err != nil || (before != nil && after.Started.Equal(before.Started)) {
+				continue // old daemon hasn't exec'd yet
+			}
+			if before != nil && before.Version != after.Version {
+				fmt.Printf("Daemon upgraded: %s → %s\n", before.Version, after.Version)
+			} else {
+				fmt.Printf("Daemon restarted (version %s)\n", after.Version)
+			}
+			return nil
+		}
+		return fmt.Errorf("daemon did not come back within 15s — check 'journalctl -u dnstc'")
 	},
 }
 
 var daemonStartCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start the daemon and tunnels",
+	Long: `Start the daemon and tunnels.
+
+With --gateway, only the gateway of a running daemon is started again after
+'dnstc daemon stop --gateway'. Otherwise a gateway stopped that way stays
+down while the tunnels start.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if gw, _ := cmd.Flags().GetBool("gateway"); gw {
+			return startGateway()
+		}
+
 		// If daemon already running, start tunnels via IPC
 		if running, client := ipc.DetectDaemon(); running {
 			return startTunnels(client)
@@ -101,60 +273,133 @@ var daemonStartCmd = &cobra.Command{
 					return fmt.Errorf("failed to start service: %w", err)
 				}
 
-				// Poll IPC for readiness
-				deadline := time.Now().Add(10 * time.Second)
-				for time.Now().Before(deadline) {
-					time.Sleep(200 * time.Millisecond)
-					if running, client := ipc.DetectDaemon(); running {
-						return startTunnels(client)
-					}
-				}
-				return fmt.Errorf("daemon did not become ready within 10s — check 'journalctl -u dnstc'")
+				return waitForDaemon("check 'journalctl -u dnstc'")
+			}
+		}
+
+		// Windows service registered by 'dnstc setup'
+		if runtime.GOOS == "windows" && windowsServiceInstalled() {
+			fmt.Println("Starting service...")
+			if err := startWindowsService(); err != nil {
+				return fmt.Errorf("failed to start service (run as administrator): %w", err)
 			}
+			return waitForDaemon("check the dnstc service in the Services console")
 		}
 
-		return fmt.Errorf("no daemon running — start with 'dnstc daemon run' or install the service with 'sudo dnstc daemon enable'")
+		if runtime.GOOS == "windows" {
+			return actions.NewCodedError(actions.CodeDaemonUnreachable, "no daemon running",
+				"Start with 'dnstc daemon run', or register the service with 'dnstc setup' as administrator")
+		}
+		return actions.NewCodedError(actions.CodeDaemonUnreachable, "no daemon running",
+			"Start with 'dnstc daemon run', or install the service with 'sudo dnstc daemon enable'")
 	},
 }
 
+// waitForDaemon polls IPC until a just-started service answers, then starts
+// its tunnels. hint tells where to look if it doesn't come up.
+func waitForDaemon(hint string) error {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		if running, client := ipc.DetectDaemon(); running {
+			return startTunnels(client)
+		}
+	}
+	return fmt.Errorf("daemon did not become ready within 10s — %s", hint)
+}
+
 // startTunnels starts tunnels on a connected daemon and prints status.
 func startTunnels(client *ipc.Client) error {
 	defer client.Close()
 
-	cfg := client.GetConfig()
+	cfg := client.GetConfig(context.Background())
 	if len(cfg.Tunnels) == 0 {
 		fmt.Println("Daemon running (no tunnels configured)")
 		return nil
 	}
 
-	if err := client.Start(); err != nil {
+	if err := client.Start(context.Background()); err != nil {
 		return fmt.Errorf("failed to start tunnels: %w", err)
 	}
 
-	status := client.Status()
+	status := client.Status(context.Background())
 	runCount := 0
 	for _, ts := range status.Tunnels {
 		if ts.Running {
 			runCount++
 			fmt.Printf("  tunnel %s running on :%d\n", ts.Tag, ts.Port)
+		} else if ts.Error != "" {
+			fmt.Printf("  tunnel %s failed: %s\n", ts.Tag, ts.Error)
 		}
 	}
 	if status.GatewayAddr != "" {
 		fmt.Printf("  gateway: %s\n", status.GatewayAddr)
+	} else if status.GatewayHeld {
+		fmt.Println("  gateway: stopped (start it with 'dnstc daemon start --gateway')")
+	}
+	if notice := status.GatewayNotice(); notice != "" {
+		fmt.Printf("  Warning: %s\n", notice)
+	}
+	if notice := status.PanicNotice(); notice != "" {
+		fmt.Printf("  Warning: %s\n", notice)
+	}
+	if notice := status.StandbyNotice(); notice != "" {
+		fmt.Printf("  Warning: %s\n", notice)
+	}
+	for _, ts := range status.Tunnels {
+		if notice := ts.FallbackNotice(); notice != "" {
+			fmt.Printf("  Warning: %s\n", notice)
+		}
+	}
+	// SOCKS clients often default to 1080; say who answers there if not us
+	if _, gwPort, _ := net.SplitHostPort(status.GatewayAddr); gwPort != "1080" && !port.IsAvailable(1080) {
+		fmt.Printf("  Note: port 1080 is used by %s, not dnstc; clients must use the gateway address above\n", port.FindOwner(1080))
 	}
 	fmt.Printf("Started (%d tunnel(s) running)\n", runCount)
 	return nil
 }
 
+// startGateway starts the gateway of a running daemon.
+func startGateway() error {
+	running, client := ipc.DetectDaemon()
+	if !running {
+		return actions.NewCodedError(actions.CodeDaemonUnreachable, "no daemon running", "Start it with 'dnstc daemon start'")
+	}
+	defer client.Close()
+
+	if err := client.StartGateway(context.Background()); err != nil {
+		return fmt.Errorf("failed to start gateway: %w", err)
+	}
+	if addr := client.Status(context.Background()).GatewayAddr; addr != "" {
+		fmt.Printf("Gateway listening on %s\n", addr)
+	} else {
+		fmt.Println("Gateway started")
+	}
+	return nil
+}
+
 var daemonStopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop the daemon",
+	Long: `Stop the daemon, its tunnels and the gateway.
+
+With --gateway, only the gateway and extra listeners stop: the tunnels keep
+their sessions and stay reachable on their own SOCKS ports, and nothing else
+is proxied. The gateway stays down until 'dnstc daemon start --gateway' or
+the daemon restarts. With --tunnels, only the tunnels stop and the gateway
+keeps its address; 'dnstc daemon start' starts them again.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		gw, _ := cmd.Flags().GetBool("gateway")
+		tunnels, _ := cmd.Flags().GetBool("tunnels")
+		if gw || tunnels {
+			return stopPart(gw)
+		}
+
 		// Try IPC shutdown first (daemon exits cleanly, Restart=on-failure won't restart)
 		if running, client := ipc.DetectDaemon(); running {
 			fmt.Println("Stopping daemon...")
-			client.Stop()
-			client.Shutdown()
+			client.Stop(context.Background())
+			client.Shutdown(context.Background())
 			client.Close()
 			fmt.Println("Stopped.")
 			return nil
@@ -171,61 +416,227 @@ var daemonStopCmd = &cobra.Command{
 		}
 
 		fmt.Println("Nothing is running.")
+		if orphans, _ := process.Orphans(config.StatePath()); len(orphans) > 0 {
+			fmt.Printf("%d tunnel process(es) left by a previous daemon are still running.\n", len(orphans))
+			fmt.Println("Stop them with: dnstc cleanup --force")
+		}
 		return nil
 	},
 }
 
+// stopPart stops the gateway or the tunnels of a running daemon, leaving the
+// other running.
+func stopPart(gateway bool) error {
+	running, client := ipc.DetectDaemon()
+	if !running {
+		return actions.NewCodedError(actions.CodeDaemonUnreachable, "no daemon running", "")
+	}
+	defer client.Close()
+
+	if !gateway {
+		if err := client.StopTunnels(context.Background()); err != nil {
+			return fmt.Errorf("failed to stop tunnels: %w", err)
+		}
+		fmt.Println("Tunnels stopped.")
+		if addr := client.Status(context.Background()).GatewayAddr; addr != "" {
+			fmt.Printf("Gateway still listening on %s\n", addr)
+		}
+		return nil
+	}
+
+	if err := client.StopGateway(context.Background()); err != nil {
+		return fmt.Errorf("failed to stop gateway: %w", err)
+	}
+	fmt.Println("Gateway stopped.")
+	status := client.Status(context.Background())
+	tags := slices.Sorted(maps.Keys(status.Tunnels))
+	for _, tag := range tags {
+		if ts := status.Tunnels[tag]; ts.Running {
+			fmt.Printf("  tunnel %s still running on :%d\n", tag, ts.Port)
+		}
+	}
+	return nil
+}
+
+// Exit statuses of daemon status, following the LSB init script conventions.
+const (
+	statusExitRunning      = 0
+	statusExitOrphaned     = 1 // daemon down, tunnel processes left running
+	statusExitStopped      = 3
+	statusExitUnresponsive = 4 // service active but not answering IPC
+)
+
+// daemonStatus is the output of daemon status --json.
+type daemonStatus struct {
+	State    string                 `json:"state"` // running, orphaned, stopped or unresponsive
+	Status   *engine.Status         `json:"status,omitempty"`
+	Orphans  []process.ProcessInfo  `json:"orphans,omitempty"`
+	Service  string                 `json:"service,omitempty"` // active, inactive or not-installed (Linux only)
+	Binaries []binaries.VersionInfo `json:"binaries,omitempty"`
+	Disk     []disk.Usage           `json:"disk,omitempty"` // measured here while the daemon is not running
+}
+
 var daemonStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show daemon status",
+	Long: `Show daemon status.
+
+Exits with 0 if the daemon is running, 1 if it is not but tunnel processes
+it started are still running, 3 if nothing is running and 4 if the service
+is active but the daemon does not respond.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Try IPC for detailed status
-		if running, client := ipc.DetectDaemon(); running {
-			status := client.Status()
-			client.Close()
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		ds, code := getDaemonStatus()
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(ds)
+		} else {
+			printDaemonStatus(ds)
+		}
+		if code != statusExitRunning {
+			os.Exit(code)
+		}
+		return nil
+	},
+}
 
-			runCount := 0
-			for _, ts := range status.Tunnels {
-				if ts.Running {
-					runCount++
-				}
+// getDaemonStatus gathers the daemon status and the exit status reporting it.
+func getDaemonStatus() (*daemonStatus, int) {
+	ds := &daemonStatus{}
+	if runtime.GOOS == "linux" {
+		switch {
+		case isServiceActive():
+			ds.Service = "active"
+		case isServiceInstalled():
+			ds.Service = "inactive"
+		default:
+			ds.Service = "not-installed"
+		}
+	}
+
+	if running, client := ipc.DetectDaemon(); running {
+		ds.State = "running"
+		ds.Status = client.Status(context.Background())
+		client.Close()
+		if binaries.AreInstalled() {
+			ds.Binaries = binaries.Versions()
+		}
+		return ds, statusExitRunning
+	}
+
+	ds.Orphans, _ = process.Orphans(config.StatePath())
+	if cfg, err := config.Load(); err == nil {
+		ds.Disk = disk.Measure(cfg.Disk)
+	}
+	switch {
+	case ds.Service == "active":
+		ds.State = "unresponsive"
+		return ds, statusExitUnresponsive
+	case len(ds.Orphans) > 0:
+		ds.State = "orphaned"
+		return ds, statusExitOrphaned
+	}
+	ds.State = "stopped"
+	return ds, statusExitStopped
+}
+
+// printDaemonStatus prints ds for a person to read.
+func printDaemonStatus(ds *daemonStatus) {
+	switch ds.State {
+	case "running":
+		status := ds.Status
+		runCount := 0
+		for _, ts := range status.Tunnels {
+			if ts.Running {
+				runCount++
 			}
+		}
 
-			fmt.Printf("Daemon running — %d/%d tunnel(s) active\n", runCount, len(status.Tunnels))
-			for _, ts := range status.Tunnels {
-				state := "stopped"
-				if ts.Running {
-					state = fmt.Sprintf("running :%d", ts.Port)
-				}
-				active := ""
-				if ts.Active {
-					active = " [active]"
-				}
-				fmt.Printf("  %s: %s%s\n", ts.Tag, state, active)
+		fmt.Printf("Daemon running — %d/%d tunnel(s) active\n", runCount, len(status.Tunnels))
+		for _, ts := range status.Tunnels {
+			state := "stopped"
+			switch {
+			case ts.Running && !ts.Ready:
+				state = fmt.Sprintf("starting :%d", ts.Port)
+			case ts.Running:
+				state = fmt.Sprintf("running :%d", ts.Port)
+			case ts.Error != "":
+				state = "failed: " + ts.Error
 			}
-			if status.GatewayAddr != "" {
-				fmt.Printf("Gateway: %s\n", status.GatewayAddr)
+			active := ""
+			if ts.Active && status.ActiveOverride {
+				active = " [active until restart]"
+			} else if ts.Active {
+				active = " [active]"
+			} else if ts.Standby {
+				active = " [standby]"
 			}
-			return nil
+			fmt.Printf("  %s: %s%s\n", ts.Tag, state, active)
 		}
-
-		// No IPC — check systemd service state
-		if runtime.GOOS == "linux" {
-			if isServiceActive() {
-				fmt.Println("Service is active but IPC is not responding.")
-				fmt.Println("Check logs: journalctl -u dnstc")
-				return nil
+		if status.GatewayAddr != "" {
+			fmt.Printf("Gateway: %s\n", status.GatewayAddr)
+		} else if status.GatewayHeld {
+			fmt.Println("Gateway: stopped (start it with 'dnstc daemon start --gateway')")
+		}
+		if status.Refused > 0 {
+			fmt.Printf("Refused: %d connection(s) while the tunnel was saturated\n", status.Refused)
+		}
+		if notice := status.GatewayNotice(); notice != "" {
+			fmt.Printf("Warning: %s\n", notice)
+		}
+		if notice := status.PanicNotice(); notice != "" {
+			fmt.Printf("Warning: %s\n", notice)
+		}
+		if notice := status.StandbyNotice(); notice != "" {
+			fmt.Printf("Warning: %s\n", notice)
+		}
+		for _, ts := range status.Tunnels {
+			if notice := ts.FallbackNotice(); notice != "" {
+				fmt.Printf("Warning: %s\n", notice)
 			}
-			if _, err := os.Stat(systemdUnitPath); os.IsNotExist(err) {
-				fmt.Println("No daemon running.")
-				fmt.Println("Install the service: sudo dnstc daemon enable")
-				return nil
+		}
+		for _, l := range status.Listeners {
+			fmt.Printf("Listener: %s → %s\n", l.Addr, l.Via)
+		}
+		if len(ds.Binaries) > 0 {
+			fmt.Println("Binaries:")
+			for _, v := range ds.Binaries {
+				fmt.Printf("  %s\n", v.FormatVersion())
 			}
 		}
-
+		printDiskUsage(status.Disk)
+		return
+	case "unresponsive":
+		fmt.Println("Service is active but IPC is not responding.")
+		fmt.Println("Check logs: journalctl -u dnstc")
+	default:
 		fmt.Println("No daemon running.")
-		return nil
-	},
+	}
+
+	if len(ds.Orphans) > 0 {
+		fmt.Printf("%d tunnel process(es) left by a previous daemon are still running:\n", len(ds.Orphans))
+		for _, p := range ds.Orphans {
+			fmt.Printf("  %s: pid %d\n", strings.TrimPrefix(p.Name, "tunnel-"), p.PID)
+		}
+		fmt.Println("Start the daemon to adopt them (dnstc daemon start) or stop them (dnstc cleanup --force)")
+	} else if ds.Service == "not-installed" {
+		fmt.Println("Install the service: sudo dnstc daemon enable")
+	}
+	printDiskUsage(ds.Disk)
+}
+
+// printDiskUsage prints the space taken up by dnstc's logs, download
+// leftovers and backups, if it was measured.
+func printDiskUsage(usage []disk.Usage) {
+	if len(usage) == 0 {
+		return
+	}
+	parts := make([]string, len(usage))
+	for i, u := range usage {
+		parts[i] = u.String()
+	}
+	fmt.Printf("Disk: %s\n", strings.Join(parts, ", "))
 }
 
 const systemdUnit = `[Unit]
@@ -237,8 +648,15 @@ Wants=network-online.target
 Type=simple
 User=%s
 ExecStart=%s daemon run
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=on-failure
 RestartSec=5
+# Tunnel processes survive a daemon crash and are adopted on restart;
+# a normal stop still shuts them down from the daemon itself.
+KillMode=process
+# Lets the daemon put tunnels in cgroups of their own for limits.memory_mb
+# and limits.cpu_percent.
+Delegate=cpu memory
 
 [Install]
 WantedBy=multi-user.target
@@ -337,11 +755,24 @@ func isServiceActive() bool {
 	return exec.Command("systemctl", "is-active", "--quiet", systemdServiceName).Run() == nil
 }
 
+func isServiceInstalled() bool {
+	_, err := os.Stat(systemdUnitPath)
+	return err == nil
+}
+
 func init() {
+	daemonStatusCmd.Flags().Bool("json", false, "Output as JSON")
+	daemonStartCmd.Flags().Bool("gateway", false, "Only start the gateway again, after 'daemon stop --gateway'")
+	daemonStopCmd.Flags().Bool("gateway", false, "Only stop the gateway; tunnels keep running on their own ports")
+	daemonStopCmd.Flags().Bool("tunnels", false, "Only stop the tunnels; the gateway keeps listening")
+	daemonStopCmd.MarkFlagsMutuallyExclusive("gateway", "tunnels")
+	daemonRunCmd.Flags().Bool("no-adopt", false, "Stop tunnel processes left by a previous daemon instead of adopting them")
+
 	daemonCmd.AddCommand(daemonRunCmd)
 	daemonCmd.AddCommand(daemonStartCmd)
 	daemonCmd.AddCommand(daemonStopCmd)
 	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonUpgradeCmd)
 	daemonCmd.AddCommand(daemonEnableCmd)
 	daemonCmd.AddCommand(daemonDisableCmd)
 	rootCmd.AddCommand(daemonCmd)
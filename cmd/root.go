@@ -2,13 +2,17 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 
+	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/engine"
 	"github.com/net2share/dnstc/internal/handlers"
 	"github.com/net2share/dnstc/internal/ipc"
 	"github.com/net2share/dnstc/internal/menu"
+	"github.com/net2share/dnstc/internal/selftest"
 	"github.com/net2share/go-corelib/tui"
 	"github.com/spf13/cobra"
 )
@@ -26,12 +30,13 @@ var rootCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		menu.Version = Version
 		menu.BuildTime = BuildTime
+		config.MigrateConfigIfNeeded()
+		provision()
+
 		tui.SetAppInfo("dnstc", Version, BuildTime)
 		tui.BeginSession()
 		defer tui.EndSession()
 
-		config.MigrateConfigIfNeeded()
-
 		// Try to connect to existing daemon
 		if running, client := ipc.DetectDaemon(); running {
 			engine.Set(client)
@@ -50,16 +55,60 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.Version = Version
+	// Errors are printed by Execute, as JSON with --json
+	rootCmd.SilenceErrors = true
+	rootCmd.PersistentFlags().Bool("json", false, "Output as JSON")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Show only results, warnings and errors")
+	rootCmd.PersistentFlags().Bool("verbose", false, "Also show transport command lines, daemon calls and timings")
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "Answer yes to confirmations (or set "+assumeYesEnv+"=1)")
+	rootCmd.PersistentFlags().Bool("portable", false, "Keep config, binaries and state next to the executable (or create "+config.PortableMarker+" there)")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return actions.NewCodedError(actions.CodeUsage, err.Error(), "")
+	})
+
+	// Paths are first used once a command runs, after flags are parsed
+	cobra.OnInitialize(func() {
+		if portable, _ := rootCmd.PersistentFlags().GetBool("portable"); portable {
+			config.SetPortable(true)
+		}
+	})
 
 	// Register all action-based commands
 	RegisterActionsWithRoot(rootCmd)
 }
 
+// provision applies a first-boot provisioning file, if there is one.
+func provision() {
+	path, err := handlers.Provision()
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: provisioning failed: %v\n", err)
+	case path != "":
+		fmt.Printf("Applied provisioning file %s\n", path)
+	}
+}
+
 // Execute runs the root command.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	// The self-test runs this executable as its mock transport
+	if selftest.IsTransport() {
+		os.Exit(selftest.RunTransport(os.Args[1:]))
+	}
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
+	}
+	if actions.IsReported(err) {
+		os.Exit(actions.ExitCode(err))
+	}
+	if f := cmd.Flags().Lookup("json"); f != nil && f.Value.String() == "true" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]actions.ErrorJSON{"error": actions.NewErrorJSON(err)})
+	} else {
+		fmt.Fprintln(os.Stderr, actions.FormatError(err, "Error: ", handlers.TerminalWidth()))
 	}
+	os.Exit(actions.ExitCode(err))
 }
 
 // SetVersionInfo sets version information for the CLI.
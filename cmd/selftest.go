@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/net2share/dnstc/internal/selftest"
+	"github.com/spf13/cobra"
+)
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check that this installation can run tunnels",
+	Long: `Run the engine, gateway and a tunnel process end to end against an
+in-process mock DNS server and a mock transport, without any real server.
+
+Uses a temporary config directory; the daemon, your config and installed
+binaries are not touched. Exits non-zero if any step fails.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return selftest.Run(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+}
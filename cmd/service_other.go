@@ -0,0 +1,21 @@
+//go:build !windows
+
+package cmd
+
+import "fmt"
+
+// runAsService reports false: only Windows has a service control manager
+// that needs a handler.
+func runAsService(run func(stop <-chan struct{}) error) (bool, error) {
+	return false, nil
+}
+
+// windowsServiceInstalled reports whether the dnstc Windows service is registered.
+func windowsServiceInstalled() bool {
+	return false
+}
+
+// startWindowsService starts the registered dnstc Windows service.
+func startWindowsService() error {
+	return fmt.Errorf("windows services are not supported on this platform")
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// windowsServiceName is the name the daemon is registered under by 'dnstc setup'.
+const windowsServiceName = "dnstc"
+
+// runAsService runs the daemon under the service control manager if this
+// process was started by it, and reports whether it was.
+func runAsService(run func(stop <-chan struct{}) error) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, nil
+	}
+	return true, svc.Run(windowsServiceName, &daemonService{run: run})
+}
+
+// daemonService adapts the daemon to service control requests.
+type daemonService struct {
+	run func(stop <-chan struct{}) error
+}
+
+func (s *daemonService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- s.run(stop) }()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			// Stopped over IPC, or failed to start
+			if err != nil {
+				return false, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				close(stop)
+				if err := <-done; err != nil {
+					return false, 1
+				}
+				return false, 0
+			}
+		}
+	}
+}
+
+// windowsServiceInstalled reports whether the dnstc Windows service is
+// registered. It only needs the rights every user has.
+func windowsServiceInstalled() bool {
+	scm, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		return false
+	}
+	defer windows.CloseServiceHandle(scm)
+	name, _ := windows.UTF16PtrFromString(windowsServiceName)
+	h, err := windows.OpenService(scm, name, windows.SERVICE_QUERY_STATUS)
+	if err != nil {
+		return false
+	}
+	windows.CloseServiceHandle(h)
+	return true
+}
+
+// startWindowsService starts the registered dnstc Windows service.
+func startWindowsService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windowsServiceName)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Start()
+}
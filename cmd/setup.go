@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Install dnstc for the current user and register the service (Windows)",
+	Long: `Install dnstc on Windows:
+
+  1. copy dnstc.exe to %LOCALAPPDATA%\Programs\dnstc
+  2. add that folder to the user PATH
+  3. create a Start Menu shortcut that opens the interactive menu
+  4. register the dnstc service, started at boot (administrator prompt only)
+
+The service runs with your APPDATA, so it uses the same config and binaries
+as the dnstc command. Run it again after downloading a new dnstc.exe to
+update the installed copy. On Linux and macOS, use the install script and
+'sudo dnstc daemon enable' instead.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		noService, _ := cmd.Flags().GetBool("no-service")
+		return runSetup(noService)
+	},
+}
+
+func init() {
+	setupCmd.Flags().Bool("no-service", false, "Do not register the service")
+	rootCmd.AddCommand(setupCmd)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package cmd
+
+import "fmt"
+
+func runSetup(noService bool) error {
+	return fmt.Errorf("setup is only needed on Windows; on Linux and macOS use the install script, then 'sudo dnstc daemon enable' for the service")
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func runSetup(noService bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine binary path: %w", err)
+	}
+	dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "Programs", "dnstc")
+	target := filepath.Join(dir, "dnstc.exe")
+
+	fmt.Println("[1/4] Installing dnstc.exe...")
+	if strings.EqualFold(filepath.Clean(exe), target) {
+		fmt.Printf("  Already running from %s\n", target)
+	} else {
+		if err := installExecutable(exe, target); err != nil {
+			return err
+		}
+		fmt.Printf("  Copied to %s\n", target)
+	}
+
+	fmt.Println("[2/4] Adding to PATH...")
+	added, err := addToUserPath(dir)
+	switch {
+	case err != nil:
+		fmt.Printf("  Warning: failed to update PATH: %v\n", err)
+	case added:
+		fmt.Printf("  Added %s to the user PATH; open a new terminal to use it\n", dir)
+	default:
+		fmt.Println("  Already in PATH")
+	}
+
+	fmt.Println("[3/4] Creating Start Menu shortcut...")
+	link := filepath.Join(os.Getenv("APPDATA"), "Microsoft", "Windows", "Start Menu", "Programs", "dnstc.lnk")
+	if err := createShortcut(link, target); err != nil {
+		fmt.Printf("  Warning: failed to create shortcut: %v\n", err)
+	} else {
+		fmt.Printf("  %s\n", link)
+	}
+
+	fmt.Println("[4/4] Registering service...")
+	switch {
+	case noService:
+		fmt.Println("  Skipped (--no-service)")
+	case !windows.GetCurrentProcessToken().IsElevated():
+		fmt.Println("  Skipped: run 'dnstc setup' from an administrator prompt to register the service")
+	default:
+		if err := installService(target); err != nil {
+			return fmt.Errorf("failed to register service: %w", err)
+		}
+		fmt.Println("  Service registered and set to start at boot")
+	}
+
+	fmt.Println()
+	fmt.Println("Setup complete. Next: dnstc install, then dnstc tunnel add")
+	return nil
+}
+
+// installExecutable copies src to target. A running target (e.g. the service)
+// can't be overwritten but can be renamed, so the old copy is moved aside.
+func installExecutable(src, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(target); err == nil {
+		old := target + ".old"
+		os.Remove(old)
+		if err := os.Rename(target, old); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", target, err)
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// addToUserPath appends dir to the user's PATH unless it is already there,
+// and tells running programs (Explorer) that the environment changed.
+func addToUserPath(dir string) (bool, error) {
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, "Environment", registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return false, err
+	}
+	defer k.Close()
+
+	cur, _, err := k.GetStringValue("Path")
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return false, err
+	}
+	for _, p := range strings.Split(cur, ";") {
+		if strings.EqualFold(filepath.Clean(os.ExpandEnv(p)), dir) {
+			return false, nil
+		}
+	}
+
+	if cur != "" && !strings.HasSuffix(cur, ";") {
+		cur += ";"
+	}
+	if err := k.SetExpandStringValue("Path", cur+dir); err != nil {
+		return false, err
+	}
+
+	const (
+		hwndBroadcast   = 0xffff
+		wmSettingChange = 0x001a
+		smtoAbortIfHung = 0x0002
+	)
+	env, _ := windows.UTF16PtrFromString("Environment")
+	windows.NewLazySystemDLL("user32.dll").NewProc("SendMessageTimeoutW").Call(
+		hwndBroadcast, wmSettingChange, 0, uintptr(unsafe.Pointer(env)), smtoAbortIfHung, 5000, 0)
+	return true, nil
+}
+
+// createShortcut creates a .lnk file pointing at target through the
+// WScript.Shell COM object, which every Windows version ships.
+func createShortcut(link, target string) error {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	script := fmt.Sprintf(
+		"$s = (New-Object -ComObject WScript.Shell).CreateShortcut(%s); $s.TargetPath = %s; $s.WorkingDirectory = %s; $s.Description = 'DNS Tunnel Client'; $s.Save()",
+		quote(link), quote(target), quote(filepath.Dir(target)))
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// installService registers (or updates) the dnstc service to run
+// 'dnstc daemon run' at boot and restart it if it crashes.
+func installService(binary string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(windowsServiceName)
+	if err == nil {
+		cfg, err := s.Config()
+		if err != nil {
+			s.Close()
+			return err
+		}
+		cfg.BinaryPathName = fmt.Sprintf(`"%s" daemon run`, binary)
+		cfg.StartType = mgr.StartAutomatic
+		if err := s.UpdateConfig(cfg); err != nil {
+			s.Close()
+			return err
+		}
+	} else {
+		s, err = m.CreateService(windowsServiceName, binary, mgr.Config{
+			DisplayName: "DNS Tunnel Client",
+			Description: "Runs dnstc tunnels and the local SOCKS gateway",
+			StartType:   mgr.StartAutomatic,
+		}, "daemon", "run")
+		if err != nil {
+			return err
+		}
+	}
+	defer s.Close()
+
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	}, 24*60*60); err != nil {
+		return err
+	}
+
+	// Point the service at this user's config and binaries instead of the
+	// LocalSystem profile
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+windowsServiceName, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.SetStringsValue("Environment", []string{
+		"APPDATA=" + os.Getenv("APPDATA"),
+		"LOCALAPPDATA=" + os.Getenv("LOCALAPPDATA"),
+		"USERPROFILE=" + os.Getenv("USERPROFILE"),
+	})
+}
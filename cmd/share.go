@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/spf13/cobra"
+)
+
+// newShareCmd builds 'dnstc share <tag>', a shorthand for 'dnstc tunnel share -t <tag>'.
+func newShareCmd() *cobra.Command {
+	cmd := BuildCobraCommand(actions.Get(actions.ActionTunnelShare))
+	cmd.Use = "share <tag>"
+	cmd.Short += " (alias of 'tunnel share')"
+	cmd.Args = cobra.MaximumNArgs(1)
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 && !cmd.Flags().Changed("tag") {
+			cmd.Flags().Set("tag", args[0])
+		}
+		return run(cmd, args)
+	}
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newShareCmd())
+}
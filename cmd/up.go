@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/clientcfg"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/handlers"
+	"github.com/net2share/dnstc/internal/ipc"
+	"github.com/net2share/dnstc/internal/port"
+	"github.com/net2share/dnstc/internal/transport"
+	"github.com/spf13/cobra"
+)
+
+// upEnvTag is the tag of the tunnel built from the environment.
+const upEnvTag = "env"
+
+var upCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Run tunnels in the foreground with JSON logs (for containers)",
+	Long: `Run the engine in the foreground, logging JSON to stdout, until SIGINT or SIGTERM.
+
+With --config-from-env, a single tunnel is built from environment variables
+instead of the config file, and nothing is written to the config file:
+
+  DNSTC_URL             dnstm:// URL (takes precedence over the variables below)
+  DNSTC_TRANSPORT       slipstream or dnstt
+  DNSTC_BACKEND         socks, ssh or shadowsocks
+  DNSTC_DOMAIN          tunnel domain
+  DNSTC_DNSTT_PUBKEY    DNSTT server public key
+  DNSTC_SLIPSTREAM_CERT path to Slipstream certificate
+  DNSTC_SS_SERVER       Shadowsocks server (default 127.0.0.1:8388)
+  DNSTC_SS_PASSWORD     Shadowsocks password
+  DNSTC_SS_METHOD       Shadowsocks method (default aes-256-gcm)
+  DNSTC_SSH_USER        SSH user
+  DNSTC_SSH_PASSWORD    SSH password
+  DNSTC_SSH_KEY         path to SSH private key
+  DNSTC_RESOLVER        DNS resolver (default 1.1.1.1:53)
+  DNSTC_LISTEN          gateway listen address (same as --listen)
+
+The IPC socket is served as usual, so 'dnstc healthcheck' works inside the container.
+Without --config-from-env, SIGHUP reloads the config file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+		fromEnv, _ := cmd.Flags().GetBool("config-from-env")
+		listen, _ := cmd.Flags().GetString("listen")
+		if listen == "" {
+			listen = os.Getenv("DNSTC_LISTEN")
+		}
+
+		var cfg *config.Config
+		var err error
+		if fromEnv {
+			var dir string
+			cfg, dir, err = configFromEnv()
+			if dir != "" {
+				// Holds the certificate and SSH key from DNSTC_URL
+				defer os.RemoveAll(dir)
+			}
+		} else {
+			config.MigrateConfigIfNeeded()
+			if path, err := handlers.Provision(); err != nil {
+				slog.Warn("provisioning failed", "error", err)
+			} else if path != "" {
+				slog.Info("applied provisioning file", "path", path)
+			}
+			cfg, err = config.LoadOrDefault()
+		}
+		if err == nil {
+			_, err = config.LoadPolicy()
+		}
+		if err != nil {
+			slog.Error("invalid configuration", "error", err)
+			return err
+		}
+		if listen != "" {
+			cfg.Listen.SOCKS = listen
+		}
+		if len(cfg.Tunnels) == 0 {
+			err := actions.NewCodedError(actions.CodeNoTunnels, "no tunnels configured", "")
+			slog.Error("invalid configuration", "error", err)
+			return err
+		}
+
+		if missing := missingBinaries(cfg.Tunnels); len(missing) > 0 {
+			err := actions.NewCodedError(actions.CodeNotInstalled,
+				fmt.Sprintf("binaries not installed: %s", strings.Join(missing, ", ")), "Run 'dnstc install'")
+			slog.Error("missing binaries", "binaries", missing)
+			return err
+		}
+
+		if running, client := ipc.DetectDaemon(); running {
+			client.Close()
+			err := fmt.Errorf("daemon is already running (socket: %s)", config.SocketPath())
+			slog.Error("already running", "socket", config.SocketPath())
+			return err
+		}
+
+		eng := engine.New(cfg)
+		eng.Stop(context.Background()) // orphans from a previous run in this container
+		engine.Set(eng)
+		defer engine.Set(nil)
+
+		srv := ipc.NewServer(config.SocketPath(), Version, eng)
+		if err := os.MkdirAll(config.ConfigDir(), 0755); err != nil {
+			slog.Warn("IPC server not available", "error", err)
+		} else if err := srv.Start(); err != nil {
+			slog.Warn("IPC server not available", "error", err)
+		} else {
+			defer srv.Stop()
+		}
+
+		if err := eng.Start(context.Background()); err != nil {
+			slog.Error("failed to start", "error", err)
+			return err
+		}
+
+		status := eng.Status(context.Background())
+		for _, tc := range cfg.Tunnels {
+			slog.Info("tunnel configured", "tag", tc.Tag, "transport", tc.Transport, "backend", tc.Backend,
+				"domain", tc.Domain, "port", tc.Port, "active", tc.Tag == cfg.Route.Active)
+		}
+		slog.Info("gateway listening", "addr", status.GatewayAddr, "version", Version)
+		for _, l := range status.Listeners {
+			slog.Info("listener pinned to tunnel", "addr", l.Addr, "via", l.Via)
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+
+		var received os.Signal
+	wait:
+		for {
+			select {
+			case received = <-sig:
+				break wait
+			case <-srv.ShutdownCh:
+				break wait
+			case <-hup:
+				if fromEnv {
+					slog.Info("ignoring SIGHUP: config comes from the environment")
+					continue
+				}
+				slog.Info("reloading config")
+				if err := reloadUpConfig(eng, listen); err != nil {
+					slog.Warn("config reload failed, keeping current config", "error", err)
+				}
+			}
+		}
+
+		attrs := []any{}
+		if received != nil {
+			attrs = append(attrs, "signal", received.String())
+		}
+		slog.Info("shutting down", attrs...)
+		eng.Stop(context.Background())
+		slog.Info("stopped")
+		return nil
+	},
+}
+
+// reloadUpConfig re-reads the config file, keeps the listen override and
+// applies it to the running engine.
+func reloadUpConfig(eng *engine.Engine, listen string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if listen != "" {
+		cfg.Listen.SOCKS = listen
+	}
+	return eng.ApplyConfig(context.Background(), cfg)
+}
+
+// configFromEnv builds an in-memory config with a single tunnel from the
+// environment. It also returns the temporary directory that files embedded in
+// DNSTC_URL were written to, if any, for the caller to remove on exit.
+func configFromEnv() (cfg *config.Config, dir string, err error) {
+	localPort, err := port.GetAvailable()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find available port: %w", err)
+	}
+
+	var tc config.TunnelConfig
+	var cc *clientcfg.ClientConfig
+	if url := os.Getenv("DNSTC_URL"); url != "" {
+		if cc, err = clientcfg.Decode(url); err != nil {
+			return nil, "", fmt.Errorf("DNSTC_URL: %w", err)
+		}
+		if dir, err = os.MkdirTemp("", "dnstc-up-"); err != nil {
+			return nil, "", err
+		}
+		if tc, err = handlers.TunnelFromClientConfig(cc, upEnvTag, localPort, dir); err != nil {
+			return nil, dir, err
+		}
+	} else {
+		tc = config.TunnelConfig{
+			Tag:       upEnvTag,
+			Transport: config.TransportType(os.Getenv("DNSTC_TRANSPORT")),
+			Backend:   config.BackendType(os.Getenv("DNSTC_BACKEND")),
+			Domain:    os.Getenv("DNSTC_DOMAIN"),
+			Port:      localPort,
+		}
+		if v := os.Getenv("DNSTC_DNSTT_PUBKEY"); v != "" {
+			tc.DNSTT = &config.DNSTTConfig{Pubkey: v}
+		}
+		if v := os.Getenv("DNSTC_SLIPSTREAM_CERT"); v != "" {
+			tc.Slipstream = &config.SlipstreamConfig{Cert: v}
+		}
+		if tc.Backend == config.BackendShadowsocks {
+			tc.Shadowsocks = &config.ShadowsocksConfig{
+				Server:   envOr("DNSTC_SS_SERVER", "127.0.0.1:8388"),
+				Password: os.Getenv("DNSTC_SS_PASSWORD"),
+				Method:   os.Getenv("DNSTC_SS_METHOD"),
+			}
+		}
+		if tc.Backend == config.BackendSSH {
+			tc.SSH = &config.SSHConfig{
+				User:     os.Getenv("DNSTC_SSH_USER"),
+				Password: os.Getenv("DNSTC_SSH_PASSWORD"),
+				Key:      os.Getenv("DNSTC_SSH_KEY"),
+			}
+		}
+	}
+	if v := os.Getenv("DNSTC_RESOLVER"); v != "" {
+		tc.Resolver = v
+	}
+
+	cfg = config.Default()
+	cfg.Tunnels = []config.TunnelConfig{tc}
+	cfg.Route.Active = tc.Tag
+	if cc != nil {
+		if err := handlers.MergeDoH(cfg, cc); err != nil {
+			return nil, dir, err
+		}
+	}
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, dir, err
+	}
+	if t, err := transport.Get(tc.Transport); err == nil {
+		if err := t.ValidateConfig(&cfg.Tunnels[0]); err != nil {
+			return nil, dir, err
+		}
+	}
+	return cfg, dir, nil
+}
+
+// missingBinaries returns the required binaries that are not installed.
+func missingBinaries(tunnels []config.TunnelConfig) []string {
+	defs := binaries.Defs()
+	var missing []string
+	for _, name := range transport.RequiredBinariesFor(tunnels) {
+		if !binaries.IsInstalled(defs[name]) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func init() {
+	upCmd.Flags().Bool("config-from-env", false, "Build a single tunnel from DNSTC_* environment variables")
+	upCmd.Flags().String("listen", "", "Gateway listen address (e.g. 0.0.0.0:1080)")
+	rootCmd.AddCommand(upCmd)
+}
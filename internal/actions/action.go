@@ -53,10 +53,12 @@ type InputField struct {
 
 // ConfirmConfig defines confirmation settings for an action.
 type ConfirmConfig struct {
-	Message     string
-	Description string
-	DefaultNo   bool
-	ForceFlag   string
+	Message         string
+	Description     string
+	DescriptionFunc func(ctx *Context) string // overrides Description in the TUI
+	DefaultNo       bool
+	ForceFlag       string
+	SkipFlag        string // bool input that makes confirmation unnecessary, e.g. a dry run
 }
 
 // ArgsSpec defines the positional arguments for an action.
@@ -25,17 +25,28 @@ func init() {
 		Parent:    ActionConfig,
 		Use:       "show",
 		Short:     "Show current configuration",
-		Long:      "Display the current configuration",
+		Long:      "Display the current configuration. Passwords are redacted unless --reveal is given.",
 		MenuLabel: "Show",
+		Inputs: []InputField{
+			{
+				Name:  "reveal",
+				Label: "Show passwords in clear text",
+				Type:  InputTypeBool,
+			},
+		},
 	})
 
 	// config edit
 	Register(&Action{
-		ID:        ActionConfigEdit,
-		Parent:    ActionConfig,
-		Use:       "edit",
-		Short:     "Edit configuration",
-		Long:      "Open configuration in editor",
+		ID:     ActionConfigEdit,
+		Parent: ActionConfig,
+		Use:    "edit",
+		Short:  "Edit configuration",
+		Long: `Open a copy of the configuration in $EDITOR.
+
+When the editor exits the copy is validated. On errors the problem is shown
+and the editor re-opened; the config is only replaced once it is valid, and
+a running daemon then reloads it.`,
 		MenuLabel: "Edit",
 	})
 
@@ -78,7 +89,7 @@ func init() {
 						}
 					}
 					if !port.IsAvailable(p) {
-						return fmt.Errorf("port %d is already in use", p)
+						return fmt.Errorf("port %d is already in use by %s", p, port.FindOwner(p))
 					}
 					return nil
 				},
@@ -0,0 +1,90 @@
+package actions
+
+func init() {
+	Register(&Action{
+		ID:    ActionLeakTest,
+		Use:   "leaktest",
+		Short: "Check for DNS leaks",
+		Long: `Check which resolvers external services see for DNS queries made directly
+and through the gateway.
+
+Verifies that hostname resolution works through the tunnel and reports whether
+applications that resolve hostnames locally would leak queries outside it.`,
+		MenuLabel:       "DNS Leak Test",
+		RequiresInstall: true,
+	})
+
+	Register(&Action{
+		ID:    ActionHealthcheck,
+		Use:   "healthcheck",
+		Short: "Check daemon and tunnel health for monitoring",
+		Long: `Check that the daemon is running and that the active tunnel (or the one
+given with --tag) passes an end-to-end probe. Intended for Docker HEALTHCHECK,
+Nagios and cron.
+
+Exit codes:
+  0  healthy
+  2  daemon not running
+  3  tunnel not found or no active tunnel
+  4  tunnel not running
+  5  end-to-end probe failed`,
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag (default: active tunnel)",
+		},
+	})
+
+	Register(&Action{
+		ID:    ActionWidget,
+		Use:   "widget",
+		Short: "Print a one-line status for status bars",
+		Long: `Print a one-line summary of the active (or given) tunnel for status bars such
+as i3blocks, waybar and tmux: a state icon, the tunnel, its last probe RTT and
+the current upload and download rate through the gateway.
+
+The status is read from status_file when it is set, otherwise from the daemon
+with a short timeout, so a busy daemon never stalls the bar. With --json it
+prints waybar's custom module format (text, tooltip and class, which is one
+of connected, degraded, disconnected or stopped). It always exits with 0.`,
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag (default: active tunnel)",
+		},
+		Inputs: []InputField{
+			{
+				Name:  "json",
+				Label: "Output as waybar JSON",
+				Type:  InputTypeBool,
+			},
+		},
+	})
+	Register(&Action{
+		ID:    ActionReport,
+		Use:   "report",
+		Short: "Gather a diagnostic bundle for bug reports",
+		Long: `Gather what is needed to look into a problem into a single .tar.gz archive
+that can be attached to an issue: the configuration with secrets redacted, the
+daemon status, binary versions, OS information, the tail of each tunnel's log
+and the daemon's most recent log lines (from journald, where it runs as a
+systemd service).
+
+Secrets from the configuration are also masked wherever they appear in the
+logs. Review the archive before sharing it all the same.`,
+		Inputs: []InputField{
+			{
+				Name:        "output",
+				Label:       "Archive path",
+				ShortFlag:   'o',
+				Type:        InputTypeText,
+				Description: "Where to write the archive (default: dnstc-report-<time>.tar.gz)",
+			},
+			{
+				Name:        "events",
+				Label:       "Daemon log lines",
+				Type:        InputTypeNumber,
+				Default:     "500",
+				Description: "Number of recent daemon log lines to include",
+			},
+		},
+	})
+}
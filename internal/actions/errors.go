@@ -1,8 +1,13 @@
 package actions
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/mattn/go-runewidth"
 )
 
 // Common errors for action handling.
@@ -14,17 +19,59 @@ var (
 	ErrNoTunnels      = errors.New("no tunnels configured")
 )
 
+// Code is a stable, machine-readable error category. Scripts branch on it
+// (or on the matching exit status) instead of parsing messages, so existing
+// values must not change.
+type Code string
+
+// Error categories and their process exit statuses.
+const (
+	CodeGeneric           Code = "error"              // 1
+	CodeUsage             Code = "usage"              // 2
+	CodeNotInstalled      Code = "not-installed"      // 3
+	CodeNoTunnels         Code = "no-tunnels"         // 4
+	CodeTunnelNotFound    Code = "tunnel-not-found"   // 5
+	CodeTunnelExists      Code = "tunnel-exists"      // 6
+	CodeDaemonUnreachable Code = "daemon-unreachable" // 7
+	CodePortInUse         Code = "port-in-use"        // 8
+	CodeAuthFailed        Code = "auth-failed"        // 9
+	CodeInvalidConfig     Code = "invalid-config"     // 10
+	CodeCancelled         Code = "cancelled"          // 130
+)
+
+var codeExitStatus = map[Code]int{
+	CodeGeneric:           1,
+	CodeUsage:             2,
+	CodeNotInstalled:      3,
+	CodeNoTunnels:         4,
+	CodeTunnelNotFound:    5,
+	CodeTunnelExists:      6,
+	CodeDaemonUnreachable: 7,
+	CodePortInUse:         8,
+	CodeAuthFailed:        9,
+	CodeInvalidConfig:     10,
+	CodeCancelled:         130,
+}
+
+// ExitStatus returns the process exit status for the category.
+func (c Code) ExitStatus() int {
+	if status, ok := codeExitStatus[c]; ok {
+		return status
+	}
+	return 1
+}
+
 // ActionError represents a structured error with a hint.
 type ActionError struct {
-	Message string
-	Hint    string
-	Err     error
+	Message  string
+	Hint     string
+	Err      error
+	Code     Code // error category; empty means it is derived from Err
+	ExitCode int  // process exit status in CLI mode; 0 means the one of the category
 }
 
+// Error returns the message only; the hint is rendered apart by FormatError.
 func (e *ActionError) Error() string {
-	if e.Hint != "" {
-		return fmt.Sprintf("%s\n%s", e.Message, e.Hint)
-	}
 	return e.Message
 }
 
@@ -37,17 +84,160 @@ func NewActionError(message, hint string) *ActionError {
 	return &ActionError{Message: message, Hint: hint}
 }
 
+// NewCodedError creates a new ActionError with an error category.
+func NewCodedError(code Code, message, hint string) *ActionError {
+	return &ActionError{Message: message, Hint: hint, Code: code}
+}
+
 // WrapError wraps an error with a message and hint.
 func WrapError(err error, message, hint string) *ActionError {
 	return &ActionError{Message: message, Hint: hint, Err: err}
 }
 
+// ExitCode returns the process exit status for an error returned by a handler.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var ae *ActionError
+	if errors.As(err, &ae) && ae.ExitCode != 0 {
+		return ae.ExitCode
+	}
+	return CodeOf(err).ExitStatus()
+}
+
+// CodeOf returns the category of err: the Code of the outermost ActionError
+// that has one, else one derived from well-known causes. Errors from the
+// daemon arrive over IPC as text, so ports in use and SSH authentication
+// failures are also recognized by their message.
+func CodeOf(err error) Code {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if ae, ok := e.(*ActionError); ok && ae.Code != "" {
+			return ae.Code
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	msg := err.Error()
+	switch {
+	case errors.Is(err, ErrCancelled):
+		return CodeCancelled
+	case errors.Is(err, ErrNotInstalled):
+		return CodeNotInstalled
+	case errors.Is(err, ErrNoTunnels):
+		return CodeNoTunnels
+	case errors.Is(err, ErrTunnelNotFound):
+		return CodeTunnelNotFound
+	case errors.Is(err, ErrTunnelExists):
+		return CodeTunnelExists
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return CodeInvalidConfig
+	case errors.Is(err, syscall.EADDRINUSE), strings.Contains(msg, "already in use"):
+		return CodePortInUse
+	case strings.Contains(msg, "unable to authenticate"):
+		return CodeAuthFailed
+	}
+	return CodeGeneric
+}
+
+// reportedError is an error the command has already shown, e.g. in its JSON
+// result, so that only the exit status remains to be set.
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string { return e.err.Error() }
+func (e *reportedError) Unwrap() error { return e.err }
+
+// Reported marks err as already shown to the user.
+func Reported(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &reportedError{err: err}
+}
+
+// IsReported reports whether err was marked with Reported.
+func IsReported(err error) bool {
+	var re *reportedError
+	return errors.As(err, &re)
+}
+
+// ErrorJSON is how a failed command reports its error with --json.
+type ErrorJSON struct {
+	Code     Code   `json:"code"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// NewErrorJSON describes err for --json output.
+func NewErrorJSON(err error) ErrorJSON {
+	msg, hint := SplitError(err)
+	return ErrorJSON{Code: CodeOf(err), Message: msg, Hint: hint, ExitCode: ExitCode(err)}
+}
+
+// SplitError returns the message of err and the hint of the ActionError it
+// wraps, if any.
+func SplitError(err error) (message, hint string) {
+	var ae *ActionError
+	if errors.As(err, &ae) {
+		hint = ae.Hint
+	}
+	return err.Error(), hint
+}
+
+// FormatError renders err for display: prefix and the message, then the hint
+// on a line of its own, each word-wrapped to width columns if width > 0.
+// The CLI prints it with an "Error: " prefix, the TUI in an error dialog.
+func FormatError(err error, prefix string, width int) string {
+	msg, hint := SplitError(err)
+	text := wrapText(prefix+msg, width)
+	if hint != "" {
+		text += "\n" + wrapText(hint, width)
+	}
+	return text
+}
+
+// wrapText word-wraps each line of s to width display columns, indenting
+// continuation lines by two spaces. Words longer than a line are kept whole.
+func wrapText(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		cur, curWidth := "", 0
+		for _, word := range strings.Fields(line) {
+			w := runewidth.StringWidth(word)
+			if curWidth > 0 && curWidth+1+w > width {
+				out = append(out, cur)
+				cur, curWidth = "  "+word, 2+w
+				continue
+			}
+			if curWidth > 0 {
+				cur += " "
+				curWidth++
+			} else if indent := len(line) - len(strings.TrimLeft(line, " ")); indent > 0 {
+				// Keep the indentation of pre-formatted lines such as usage
+				cur, curWidth = line[:indent], indent
+			}
+			cur += word
+			curWidth += w
+		}
+		out = append(out, cur)
+	}
+	return strings.Join(out, "\n")
+}
+
 // TunnelNotFoundError creates a tunnel not found error.
 func TunnelNotFoundError(tag string) *ActionError {
 	return &ActionError{
 		Message: fmt.Sprintf("tunnel '%s' not found", tag),
 		Hint:    "Use 'dnstc tunnel list' to see available tunnels",
 		Err:     ErrTunnelNotFound,
+		Code:    CodeTunnelNotFound,
 	}
 }
 
@@ -57,6 +247,7 @@ func TunnelExistsError(tag string) *ActionError {
 		Message: fmt.Sprintf("tunnel '%s' already exists", tag),
 		Hint:    "Choose a different tag or remove the existing tunnel",
 		Err:     ErrTunnelExists,
+		Code:    CodeTunnelExists,
 	}
 }
 
@@ -66,5 +257,6 @@ func NoTunnelsError() *ActionError {
 		Message: "no tunnels configured",
 		Hint:    "Use 'dnstc tunnel add' to create one",
 		Err:     ErrNoTunnels,
+		Code:    CodeNoTunnels,
 	}
 }
@@ -7,9 +7,16 @@ const (
 	ActionTunnelList     = "tunnel.list"
 	ActionTunnelAdd      = "tunnel.add"
 	ActionTunnelImport   = "tunnel.import"
+	ActionTunnelExport   = "tunnel.export"
+	ActionTunnelShare    = "tunnel.share"
 	ActionTunnelRemove   = "tunnel.remove"
 	ActionTunnelStatus   = "tunnel.status"
 	ActionTunnelActivate = "tunnel.activate"
+	ActionTunnelStandby  = "tunnel.standby"
+	ActionTunnelPreset   = "tunnel.preset"
+	ActionTunnelMove     = "tunnel.move"
+	ActionTunnelTest     = "tunnel.test"
+	ActionTunnelCheck    = "tunnel.test-config"
 
 	// Config actions
 	ActionConfig            = "config"
@@ -17,8 +24,32 @@ const (
 	ActionConfigEdit        = "config.edit"
 	ActionConfigGatewayPort = "config.gateway-port"
 
+	// Secrets actions
+	ActionSecrets        = "secrets"
+	ActionSecretsList    = "secrets.list"
+	ActionSecretsStore   = "secrets.store"
+	ActionSecretsRestore = "secrets.restore"
+
+	// Resolver actions
+	ActionResolver       = "resolver"
+	ActionResolverImport = "resolver.import"
+	ActionResolverMove   = "resolver.move"
+	ActionResolverDoH    = "resolver.doh"
+
+	// Diagnostic actions
+	ActionLeakTest    = "leaktest"
+	ActionHealthcheck = "healthcheck"
+	ActionWidget      = "widget"
+	ActionReport      = "report"
+
+	// Log actions
+	ActionLogs      = "logs"
+	ActionLogsClear = "logs.clear"
+
 	// System actions
-	ActionInstall   = "install"
-	ActionUpdate    = "update"
-	ActionUninstall = "uninstall"
+	ActionInstall       = "install"
+	ActionInstallVerify = "install.verify"
+	ActionUpdate        = "update"
+	ActionCleanup       = "cleanup"
+	ActionUninstall     = "uninstall"
 )
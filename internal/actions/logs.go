@@ -0,0 +1,37 @@
+package actions
+
+func init() {
+	Register(&Action{
+		ID:    ActionLogs,
+		Use:   "logs",
+		Short: "Manage tunnel logs",
+		Long: `Manage the logs the tunnels' transport processes write to the logs directory
+under the config directory.`,
+		MenuLabel: "Logs",
+		IsSubmenu: true,
+	})
+
+	Register(&Action{
+		ID:     ActionLogsClear,
+		Parent: ActionLogs,
+		Use:    "clear",
+		Short:  "Truncate the tunnel logs without restarting anything",
+		Long: `Truncate the tunnel logs in place. The transports keep writing to them at the
+new end, so neither the daemon nor the tunnels restart, which suits
+long-running daemons on routers with little flash storage.
+
+When the daemon is running it clears the logs itself, so they can be cleared
+without the permissions of the user it runs as. With --keep, each log is
+copied to <name>.log.1 first, replacing the previous copy; otherwise the
+previous copies are removed too.`,
+		MenuLabel: "Clear",
+		Inputs: []InputField{
+			{
+				Name:        "keep",
+				Label:       "Keep a copy of each log",
+				Type:        InputTypeBool,
+				Description: "Keep the old content as <name>.log.1",
+			},
+		},
+	})
+}
@@ -1,9 +1,20 @@
 package actions
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/net2share/dnstc/internal/clientcfg"
 	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/probe"
+	"github.com/net2share/dnstc/internal/resolvers"
+	"github.com/net2share/dnstc/internal/sshtunnel"
 )
 
 // TransportOptions returns the available transport options.
@@ -94,6 +105,204 @@ func ValidatePubkey(value string) error {
 	return nil
 }
 
+// SSH authentication methods offered by the interactive tunnel add.
+const (
+	SSHAuthPassword = "password"
+	SSHAuthKeyFile  = "key-file"
+	SSHAuthKeyPaste = "key-paste"
+)
+
+// SSHAuthOptions returns the SSH authentication method options.
+func SSHAuthOptions() []SelectOption {
+	return []SelectOption{
+		{Label: "Private key file", Value: SSHAuthKeyFile, Recommended: true},
+		{Label: "Paste private key", Value: SSHAuthKeyPaste},
+		{Label: "Password", Value: SSHAuthPassword},
+	}
+}
+
+// ValidateSSHKeyFile validates that a path holds an SSH private key. Encrypted
+// keys pass; their passphrase is checked by ValidateSSHPassphrase.
+func ValidateSSHKeyFile(value string) error {
+	if err := sshtunnel.CheckKeyFile(value, ""); err != nil && !errors.Is(err, sshtunnel.ErrPassphraseRequired) {
+		return NewActionError(fmt.Sprintf("invalid SSH key: %v", err), "")
+	}
+	return nil
+}
+
+// ValidateSSHKeyData validates a pasted SSH private key.
+func ValidateSSHKeyData(value string) error {
+	if err := sshtunnel.CheckKey(sshtunnel.NormalizeKey(value), ""); err != nil && !errors.Is(err, sshtunnel.ErrPassphraseRequired) {
+		return NewActionError(fmt.Sprintf("invalid SSH key: %v", err), "")
+	}
+	return nil
+}
+
+// ValidateSSHPassphrase checks the passphrase against the key entered earlier.
+func ValidateSSHPassphrase(ctx *Context, value string) error {
+	if err := sshtunnel.CheckKey(sshKeyData(ctx), value); err != nil {
+		return NewActionError(fmt.Sprintf("invalid SSH key: %v", err), "")
+	}
+	return nil
+}
+
+// sshKeyEncrypted reports whether the SSH key entered so far needs a passphrase.
+func sshKeyEncrypted(ctx *Context) bool {
+	return errors.Is(sshtunnel.CheckKey(sshKeyData(ctx), ""), sshtunnel.ErrPassphraseRequired)
+}
+
+// sshKeyData returns the pasted SSH key, or the contents of the key file.
+func sshKeyData(ctx *Context) []byte {
+	if data := ctx.GetString("ssh-key-data"); data != "" {
+		return sshtunnel.NormalizeKey(data)
+	}
+	data, _ := os.ReadFile(ctx.GetString("ssh-key"))
+	return data
+}
+
+// SecretStoreOptions returns where to keep passwords entered in the TUI.
+func SecretStoreOptions() []SelectOption {
+	return []SelectOption{
+		{Label: "OS keyring", Value: SecretStoreKeyring, Recommended: true},
+		{Label: "Config file", Value: SecretStoreConfig},
+	}
+}
+
+// Secret storage choices.
+const (
+	SecretStoreKeyring = "keyring"
+	SecretStoreConfig  = "config"
+)
+
+// ValidateImportURL validates a dnstm:// or ss:// URL.
+func ValidateImportURL(value string) error {
+	if !clientcfg.IsURL(value) {
+		return NewActionError("expected a dnstm:// or ss:// URL", "")
+	}
+	if _, err := clientcfg.Parse(value); err != nil {
+		return NewActionError(err.Error(), "")
+	}
+	return nil
+}
+
+// ImportTag returns the tag an imported tunnel gets by default: the one in
+// the URL, or a generated one if the URL has none.
+func ImportTag(cc *clientcfg.ClientConfig, tunnels []config.TunnelConfig) string {
+	if cc.Tag == "" {
+		return config.GenerateUniqueTag(tunnels)
+	}
+	return config.NormalizeTag(cc.Tag)
+}
+
+// ImportFiles returns the files written next to the config when importing cc as tag.
+func ImportFiles(cc *clientcfg.ClientConfig, tag string) []string {
+	var files []string
+	if cc.Transport.Type == string(config.TransportSlipstream) && cc.Transport.Cert != "" {
+		files = append(files, filepath.Join(config.ConfigDir(), tag+".cert.pem"))
+	}
+	if cc.Backend.Type == string(config.BackendSSH) && cc.Backend.Key != "" {
+		files = append(files, filepath.Join(config.ConfigDir(), tag+".key.pem"))
+	}
+	return files
+}
+
+// importConflict returns the default import tag if a tunnel with it exists.
+func importConflict(ctx *Context) (string, bool) {
+	cc, err := clientcfg.Parse(ctx.GetString("url"))
+	if err != nil {
+		return "", false
+	}
+	tunnels := contextTunnels(ctx)
+	tag := ImportTag(cc, tunnels)
+	for _, t := range tunnels {
+		if t.Tag == tag {
+			return tag, true
+		}
+	}
+	return tag, false
+}
+
+// ImportPreview describes the tunnel in the URL held in the "url" value.
+func ImportPreview(ctx *Context) string {
+	cc, err := clientcfg.Parse(ctx.GetString("url"))
+	if err != nil {
+		return err.Error()
+	}
+	tag, conflict := importConflict(ctx)
+	tagLabel := tag
+	if cc.Tag == "" {
+		// A generated tag changes on every call; don't promise one.
+		tag, tagLabel = "<tag>", "generated"
+	}
+	lines := []string{
+		fmt.Sprintf("Tag: %s", tagLabel),
+		fmt.Sprintf("Transport: %s", config.GetTransportTypeDisplayName(config.TransportType(cc.Transport.Type))),
+		fmt.Sprintf("Backend: %s", config.GetBackendTypeDisplayName(config.BackendType(cc.Backend.Type))),
+		fmt.Sprintf("Domain: %s", cc.Transport.Domain),
+	}
+	if len(cc.Transport.Fallbacks) > 0 {
+		lines = append(lines, fmt.Sprintf("Fallback domains: %s", strings.Join(cc.Transport.Fallbacks, ", ")))
+	}
+	if len(cc.Resolvers) > 0 {
+		lines = append(lines, fmt.Sprintf("Resolver: %s", cc.Resolvers[0]))
+	}
+	if len(cc.Resolvers) > 1 {
+		lines = append(lines, fmt.Sprintf("Fallback resolvers: %s", strings.Join(cc.Resolvers[1:], ", ")))
+	}
+	if cc.Port != 0 {
+		lines = append(lines, fmt.Sprintf("Preferred port: %d", cc.Port))
+	}
+	for _, f := range ImportFiles(cc, tag) {
+		lines = append(lines, fmt.Sprintf("Writes: %s", f))
+	}
+	if conflict {
+		lines = append(lines, "", fmt.Sprintf("%s A tunnel named '%s' already exists.", SymbolWarning, tag))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ImportChoiceOptions offers to import the previewed tunnel, or to overwrite
+// or rename it when its tag is taken.
+func ImportChoiceOptions(ctx *Context) []SelectOption {
+	if tag, conflict := importConflict(ctx); conflict {
+		return []SelectOption{
+			{Label: fmt.Sprintf("Overwrite '%s'", tag), Value: ImportChoiceOverwrite},
+			{Label: "Import under a new tag", Value: ImportChoiceRename, Recommended: true},
+			{Label: "Cancel", Value: ImportChoiceCancel},
+		}
+	}
+	return []SelectOption{
+		{Label: "Import", Value: ImportChoiceImport},
+		{Label: "Cancel", Value: ImportChoiceCancel},
+	}
+}
+
+// ValidateNewTag validates a tag for a new tunnel.
+func ValidateNewTag(ctx *Context, value string) error {
+	tag := config.NormalizeTag(value)
+	if err := config.ValidateTag(tag); err != nil {
+		return NewActionError(fmt.Sprintf("invalid tag: %v", err), "")
+	}
+	for _, t := range contextTunnels(ctx) {
+		if t.Tag == tag {
+			return TunnelExistsError(tag)
+		}
+	}
+	return nil
+}
+
+// contextTunnels returns the configured tunnels, loading the config if needed.
+func contextTunnels(ctx *Context) []config.TunnelConfig {
+	cfg := ctx.Config
+	if cfg == nil {
+		cfg, _ = config.Load()
+	}
+	if cfg == nil {
+		return nil
+	}
+	return cfg.Tunnels
+}
+
 // TunnelPicker provides interactive tunnel selection.
 func TunnelPicker(ctx *Context) (string, error) {
 	cfg := ctx.Config
@@ -154,9 +363,48 @@ func RunningTunnelPicker(ctx *Context) (string, error) {
 	}
 
 	if len(options) == 0 {
-		return "", NewActionError("no running tunnels", "Connect first with 'dnstc up' or use the TUI")
+		return "", NewCodedError(CodeDaemonUnreachable, "no running tunnels", "Connect first with 'dnstc up' or use the TUI")
 	}
 
 	ctx.Set("_picker_options", options)
 	return "", nil
 }
+
+// resolverProbeTimeout bounds the live probe of each resolver in the picker.
+const resolverProbeTimeout = 3 * time.Second
+
+// ResolverOptions live-probes the curated public resolvers against the domain
+// in context and returns them fastest first, with unreachable ones last.
+func ResolverOptions(ctx *Context) []SelectOption {
+	servers := make([]string, len(resolvers.Global))
+	for i, r := range resolvers.Global {
+		servers[i] = r.Addr
+	}
+	results := probe.ProbeResolvers(servers, ctx.GetString("domain"), resolverProbeTimeout)
+
+	type ranked struct {
+		opt SelectOption
+		rtt time.Duration
+	}
+	var reachable, unreachable []ranked
+	for i, res := range results {
+		r := resolvers.Global[i]
+		opt := SelectOption{Value: r.Addr}
+		if res.Err != nil {
+			opt.Label = fmt.Sprintf("%s (%s) — unreachable", r.Name, r.Addr)
+			opt.Description = res.Err.Error()
+			unreachable = append(unreachable, ranked{opt: opt})
+			continue
+		}
+		opt.Label = fmt.Sprintf("%s (%s) — %dms", r.Name, r.Addr, res.RTT.Milliseconds())
+		reachable = append(reachable, ranked{opt: opt, rtt: res.RTT})
+	}
+	slices.SortFunc(reachable, func(a, b ranked) int { return cmp.Compare(a.rtt, b.rtt) })
+
+	var opts []SelectOption
+	for i, r := range append(reachable, unreachable...) {
+		r.opt.Recommended = i == 0 && len(reachable) > 0
+		opts = append(opts, r.opt)
+	}
+	return opts
+}
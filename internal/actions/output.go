@@ -23,12 +23,28 @@ type OutputWriter interface {
 
 	ShowInfo(cfg InfoConfig) error
 
+	// Debug shows details only wanted with --verbose, such as timings.
+	Debug(msg string)
+
 	BeginProgress(title string)
 	EndProgress()
 	DismissProgress()
 	IsProgressActive() bool
 }
 
+// Verbosity is how much a command reports.
+type Verbosity int
+
+const (
+	// VerbosityQuiet shows only results, warnings and errors: no progress,
+	// status or success messages.
+	VerbosityQuiet Verbosity = iota - 1
+	VerbosityNormal
+	// VerbosityVerbose adds Debug messages, and the log shows the transport
+	// command lines and daemon calls.
+	VerbosityVerbose
+)
+
 // InfoConfig configures an info display.
 type InfoConfig struct {
 	Title       string
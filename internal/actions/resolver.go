@@ -0,0 +1,181 @@
+package actions
+
+import (
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/resolvers"
+)
+
+func init() {
+	Register(&Action{
+		ID:              ActionResolver,
+		Use:             "resolver",
+		Short:           "Manage the global DNS resolvers",
+		Long:            "Manage the DNS resolvers tunnels use unless they set their own",
+		MenuLabel:       "Resolvers",
+		IsSubmenu:       true,
+		RequiresInstall: true,
+	})
+
+	Register(&Action{
+		ID:     ActionResolverImport,
+		Parent: ActionResolver,
+		Use:    "import",
+		Short:  "Add the fastest public resolvers for a region",
+		Long: `Benchmark a curated list of public resolvers for a region against a tunnel
+domain and put the fastest that answer at the front of the global resolvers.
+The resolvers already configured are kept after them.
+
+Regions:
+  global  anycast resolvers (Cloudflare, Google, Quad9, ...)
+  ir      resolvers hosted in Iran, then the global ones
+  ru      resolvers hosted in Russia, then the global ones
+  cn      resolvers hosted in China, then the global ones
+
+The domain defaults to that of the active tunnel (or the one given with
+--tag). Each resolver is asked for a random name under it, so only resolvers
+that actually reach the tunnel's server count.`,
+		MenuLabel: "Import",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel whose domain to benchmark against (default: active tunnel)",
+		},
+		Inputs: []InputField{
+			{
+				Name:        "region",
+				Label:       "Region",
+				Type:        InputTypeSelect,
+				Required:    true,
+				Options:     regionOptions(),
+				Description: "Region to pick resolvers for (global, ir, ru, cn)",
+			},
+			{
+				Name:        "domain",
+				Label:       "Domain",
+				ShortFlag:   'd',
+				Type:        InputTypeText,
+				Description: "Tunnel domain to benchmark against (default: the tunnel's)",
+				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
+			},
+			{
+				Name:        "count",
+				Label:       "Resolvers to add",
+				ShortFlag:   'n',
+				Type:        InputTypeNumber,
+				Default:     "3",
+				Description: "How many of the fastest resolvers to add",
+				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
+			},
+		},
+	})
+
+	Register(&Action{
+		ID:     ActionResolverMove,
+		Parent: ActionResolver,
+		Use:    "move",
+		Short:  "Move a resolver up or down the list",
+		Long: `Move a global resolver one place up or down the list. Tunnels without a
+resolver of their own use the first one.`,
+		MenuLabel: "Move",
+		Args: &ArgsSpec{
+			Name:        "resolver",
+			Description: "Resolver address (host:port)",
+			Required:    true,
+		},
+		Inputs: moveInputs,
+	})
+
+	Register(&Action{
+		ID:     ActionResolverDoH,
+		Parent: ActionResolver,
+		Use:    "doh",
+		Short:  "Add or replace a DNS-over-HTTPS upstream",
+		Long: `Add a DNS-over-HTTPS upstream, or replace the one of the same name. Tunnels
+use it as the resolver "doh:<name>", through a local forwarder run by the
+daemon.
+
+Where the resolver's name is blocked by SNI, --sni sends another server name
+in the TLS handshake (a front on the same CDN) and --ip connects to a pinned
+address instead of resolving the URL's host. The upstream is probed with a
+query for a name under a tunnel domain first, and nothing is saved unless it
+answers.`,
+		MenuLabel: "DoH Upstream",
+		Args: &ArgsSpec{
+			Name:        "name",
+			Description: "Name of the upstream",
+			Required:    true,
+		},
+		Inputs: []InputField{
+			{
+				Name:        "url",
+				Label:       "URL",
+				Type:        InputTypeText,
+				Required:    true,
+				Placeholder: "https://dns.google/dns-query",
+				Description: "DoH endpoint URL",
+			},
+			{
+				Name:        "sni",
+				Label:       "SNI override",
+				Type:        InputTypeText,
+				Description: "TLS server name to send instead of the URL's host",
+			},
+			{
+				Name:        "ip",
+				Label:       "IP pin",
+				Type:        InputTypeText,
+				Description: "Address to connect to instead of resolving the URL's host",
+			},
+			{
+				Name:        "tag",
+				Label:       "Tunnel",
+				ShortFlag:   't',
+				Type:        InputTypeText,
+				Description: "Tunnel whose domain to probe with (default: active tunnel)",
+				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
+			},
+			{
+				Name:        "domain",
+				Label:       "Domain",
+				ShortFlag:   'd',
+				Type:        InputTypeText,
+				Description: "Domain to probe with (default: the tunnel's)",
+				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
+			},
+			{
+				Name:        "use",
+				Label:       "Make it the global resolver",
+				Type:        InputTypeBool,
+				Description: "Put the upstream at the front of the global resolvers",
+			},
+		},
+	})
+}
+
+// moveInputs are the inputs of the actions that reorder a list.
+var moveInputs = []InputField{
+	{
+		Name:  "up",
+		Label: "Move up one place",
+		Type:  InputTypeBool,
+	},
+	{
+		Name:  "down",
+		Label: "Move down one place",
+		Type:  InputTypeBool,
+	},
+}
+
+// regionOptions returns the regions with a curated resolver list.
+func regionOptions() []SelectOption {
+	var opts []SelectOption
+	for _, r := range resolvers.Regions {
+		list, _ := resolvers.ForRegion(r.ID)
+		opts = append(opts, SelectOption{
+			Label:       fmt.Sprintf("%s (%s)", r.Name, r.ID),
+			Value:       r.ID,
+			Description: fmt.Sprintf("%d resolvers", len(list)),
+		})
+	}
+	return opts
+}
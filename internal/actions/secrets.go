@@ -0,0 +1,51 @@
+package actions
+
+func init() {
+	Register(&Action{
+		ID:    ActionSecrets,
+		Use:   "secrets",
+		Short: "Manage credentials stored in the OS keyring",
+		Long: `Manage tunnel passwords and SSH key passphrases kept in the OS keyring
+(Secret Service on Linux, Keychain on macOS, Credential Manager on Windows).
+
+Secrets in the keyring appear in the config as "keyring:<tag>/<field>" and are
+read when the tunnel starts.`,
+		MenuLabel: "Secrets",
+		IsSubmenu: true,
+	})
+
+	Register(&Action{
+		ID:        ActionSecretsList,
+		Parent:    ActionSecrets,
+		Use:       "list",
+		Short:     "Show where each tunnel credential is stored",
+		Long:      "Show whether each tunnel credential is kept in the config file or in the OS keyring, and whether keyring entries can be read",
+		MenuLabel: "List",
+	})
+
+	Register(&Action{
+		ID:        ActionSecretsStore,
+		Parent:    ActionSecrets,
+		Use:       "store",
+		Short:     "Move credentials from the config file into the OS keyring",
+		Long:      "Move the passwords and key passphrases of a tunnel (or of all tunnels if no tag is given) from the config file into the OS keyring",
+		MenuLabel: "Store",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag (default: all tunnels)",
+		},
+	})
+
+	Register(&Action{
+		ID:        ActionSecretsRestore,
+		Parent:    ActionSecrets,
+		Use:       "restore",
+		Short:     "Move credentials from the OS keyring back into the config file",
+		Long:      "Move the keyring credentials of a tunnel (or of all tunnels if no tag is given) back into the config file and delete them from the keyring",
+		MenuLabel: "Restore",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag (default: all tunnels)",
+		},
+	})
+}
@@ -1,19 +1,88 @@
 package actions
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/net2share/dnstc/internal/transport"
+)
+
 func init() {
 	Register(&Action{
-		ID:        ActionInstall,
-		Use:       "install",
-		Short:     "Install required binaries",
-		Long:      "Download and install all required transport binaries",
+		ID:    ActionInstall,
+		Use:   "install",
+		Short: "Install required binaries",
+		Long: `Download and install the transport binaries required by the configured tunnels.
+
+Binaries not needed by any configured tunnel are skipped unless --all is given.
+Missing binaries are also installed automatically when a tunnel is added.
+
+With --system (as root), binaries go to /usr/local/bin for all users instead
+of the per-user bin directory. dnstc records which ones it installed there, so
+update and uninstall never touch binaries from a package manager.`,
 		MenuLabel: "Install Binaries",
+		Inputs: []InputField{
+			{
+				Name:  "all",
+				Label: "Also install binaries not required by configured tunnels",
+				Type:  InputTypeBool,
+			},
+			{
+				Name:  "system",
+				Label: "Install into /usr/local/bin for all users (requires root)",
+				Type:  InputTypeBool,
+			},
+			{
+				Name:            "extras",
+				Label:           "Optional Binaries",
+				Type:            InputTypeSelect,
+				Required:        true,
+				InteractiveOnly: true,
+				Options: []SelectOption{
+					{Label: "Only required", Value: "required", Recommended: true},
+					{Label: "Install all", Value: "all"},
+				},
+				ShowIf: func(ctx *Context) bool {
+					return len(optionalBinaries(ctx)) > 0
+				},
+				DescriptionFunc: func(ctx *Context) string {
+					return fmt.Sprintf("Not required by any configured tunnel: %s\nThey will be installed automatically when a tunnel needs them.",
+						strings.Join(optionalBinaries(ctx), ", "))
+				},
+			},
+		},
+	})
+
+	Register(&Action{
+		ID:     ActionInstallVerify,
+		Parent: ActionInstall,
+		Use:    "verify",
+		Short:  "Verify installed binaries",
+		Long: `Re-compute checksums of installed binaries and compare them against
+the checksums recorded at install time and the upstream checksum files.
+
+Tampered or partially-downloaded binaries are reported. Use --repair to
+re-download them.`,
+		MenuLabel:       "Verify Binaries",
+		RequiresInstall: true,
+		Inputs: []InputField{
+			{
+				Name:  "repair",
+				Label: "Re-download binaries that fail verification",
+				Type:  InputTypeBool,
+			},
+		},
 	})
 
 	Register(&Action{
-		ID:              ActionUpdate,
-		Use:             "update",
-		Short:           "Check for and apply updates",
-		Long:            "Check for updates to dnstc and transport binaries",
+		ID:    ActionUpdate,
+		Use:   "update",
+		Short: "Check for and apply updates",
+		Long: `Check for updates to dnstc and transport binaries.
+
+The release notes of each available update are shown first. Updates are
+only installed with --yes, so they can be reviewed before downloading
+anything over a slow or fragile connection.`,
 		MenuLabel:       "Check Updates",
 		RequiresInstall: true,
 		Inputs: []InputField{
@@ -32,6 +101,42 @@ func init() {
 				Label: "Update binaries only",
 				Type:  InputTypeBool,
 			},
+			{
+				Name:  "yes",
+				Label: "Install updates without asking",
+				Type:  InputTypeBool,
+			},
+		},
+	})
+
+	Register(&Action{
+		ID:    ActionCleanup,
+		Use:   "cleanup",
+		Short: "Remove leftovers of crashed or interrupted runs",
+		Long: `Remove what a crashed daemon or an interrupted command left behind.
+
+This will:
+  - Stop tunnel processes left running by a daemon that exited uncleanly
+  - Remove a stale IPC socket and stale entries of the process state file
+  - Remove temporary files of interrupted downloads and updates
+  - Remove certificate and key files of tunnels that no longer exist
+
+Processes, the socket and the state file are left alone while a daemon is
+running. --dry-run lists what would be removed.`,
+		MenuLabel: "Clean Up",
+		Inputs: []InputField{
+			{
+				Name:  "dry-run",
+				Label: "List what would be removed without removing anything",
+				Type:  InputTypeBool,
+			},
+		},
+		Confirm: &ConfirmConfig{
+			Message:     "Remove leftover processes and files?",
+			Description: "Key and certificate files of deleted tunnels can't be recovered.",
+			DefaultNo:   true,
+			ForceFlag:   "force",
+			SkipFlag:    "dry-run",
 		},
 	})
 
@@ -43,18 +148,68 @@ func init() {
 
 This will:
   - Stop all running tunnels
-  - Remove all tunnel configurations
+  - Remove all tunnel configurations and their keyring secrets
   - Remove downloaded binaries (slipstream-client, dnstt-client, sslocal)
   - Remove configuration files
   - Remove data files
 
+Use --keep-config to keep the tunnel configuration, imported keys and
+certificates and keyring secrets, or --binaries-only to remove only the
+downloaded binaries. --dry-run lists what would be removed.
+
 Note: The dnstc binary itself is kept for easy reinstallation.`,
 		MenuLabel: "Uninstall",
+		Inputs: []InputField{
+			{
+				Name:  "keep-config",
+				Label: "Keep tunnel configuration, keys and certificates",
+				Type:  InputTypeBool,
+			},
+			{
+				Name:  "binaries-only",
+				Label: "Remove downloaded binaries only",
+				Type:  InputTypeBool,
+			},
+			{
+				Name:  "dry-run",
+				Label: "List what would be removed without removing anything",
+				Type:  InputTypeBool,
+			},
+			{
+				Name:            "scope",
+				Label:           "What to Remove",
+				Type:            InputTypeSelect,
+				Required:        true,
+				InteractiveOnly: true,
+				Options: []SelectOption{
+					{Label: "Everything", Value: UninstallAll},
+					{Label: "Keep configuration and keys", Value: UninstallKeepConfig, Recommended: true},
+					{Label: "Binaries only", Value: UninstallBinaries},
+				},
+			},
+		},
 		Confirm: &ConfirmConfig{
-			Message:     "Are you sure you want to uninstall everything?",
-			Description: "This will remove all dnstc components from your system.",
+			Message:     "Are you sure you want to uninstall?",
+			Description: "This will remove the selected dnstc components from your system.",
 			DefaultNo:   true,
 			ForceFlag:   "force",
+			SkipFlag:    "dry-run",
 		},
 	})
 }
+
+// Uninstall scopes, chosen with the scope input or the --keep-config and
+// --binaries-only flags.
+const (
+	UninstallAll        = "all"
+	UninstallKeepConfig = "keep-config"
+	UninstallBinaries   = "binaries"
+)
+
+// optionalBinaries returns the binaries not required by the tunnels in the context config.
+func optionalBinaries(ctx *Context) []string {
+	if ctx.Config == nil {
+		return transport.OptionalBinariesFor(nil)
+	}
+	return transport.OptionalBinariesFor(ctx.Config.Tunnels)
+}
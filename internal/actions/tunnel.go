@@ -2,10 +2,14 @@ package actions
 
 import (
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/port"
+	"github.com/net2share/dnstc/internal/secrets"
+	"github.com/net2share/dnstc/internal/sshtunnel"
 )
 
 func init() {
@@ -26,8 +30,15 @@ func init() {
 		Parent:    ActionTunnel,
 		Use:       "list",
 		Short:     "List all tunnels",
-		Long:      "List all configured DNS tunnels and their status",
+		Long:      "List all configured DNS tunnels and their status. Live state is read from the daemon when it is running.",
 		MenuLabel: "List",
+		Inputs: []InputField{
+			{
+				Name:  "json",
+				Label: "Output as JSON",
+				Type:  InputTypeBool,
+			},
+		},
 	})
 
 	// tunnel status
@@ -48,11 +59,14 @@ func init() {
 
 	// tunnel remove
 	Register(&Action{
-		ID:        ActionTunnelRemove,
-		Parent:    ActionTunnel,
-		Use:       "remove",
-		Short:     "Remove a tunnel",
-		Long:      "Remove a tunnel and its configuration",
+		ID:     ActionTunnelRemove,
+		Parent: ActionTunnel,
+		Use:    "remove",
+		Short:  "Remove a tunnel",
+		Long: `Remove a tunnel and its configuration.
+
+Certificate and key files that dnstc wrote for the tunnel when it was added
+or imported are deleted too, unless --keep-files is given.`,
 		MenuLabel: "Remove",
 		Args: &ArgsSpec{
 			Name:        "tag",
@@ -60,20 +74,32 @@ func init() {
 			Required:    true,
 			PickerFunc:  TunnelPicker,
 		},
+		Inputs: []InputField{
+			{
+				Name:  "keep-files",
+				Label: "Keep the tunnel's certificate and key files",
+				Type:  InputTypeBool,
+			},
+		},
 		Confirm: &ConfirmConfig{
-			Message:   "Remove tunnel?",
-			DefaultNo: true,
-			ForceFlag: "force",
+			Message:         "Remove tunnel?",
+			DescriptionFunc: removeDescription,
+			DefaultNo:       true,
+			ForceFlag:       "force",
 		},
 	})
 
 	// tunnel activate
 	Register(&Action{
-		ID:        ActionTunnelActivate,
-		Parent:    ActionTunnel,
-		Use:       "activate",
-		Short:     "Set active tunnel",
-		Long:      "Set a tunnel as the active route",
+		ID:     ActionTunnelActivate,
+		Parent: ActionTunnel,
+		Use:    "activate",
+		Short:  "Set active tunnel",
+		Long: `Set a tunnel as the active route.
+
+With --temporary the running daemon routes through the tunnel until it
+restarts, and route.active in the config is left as it is; activating the
+configured tunnel again ends the temporary switch.`,
 		MenuLabel: "Activate",
 		Args: &ArgsSpec{
 			Name:        "tag",
@@ -81,15 +107,155 @@ func init() {
 			Required:    true,
 			PickerFunc:  TunnelPicker,
 		},
+		Inputs: []InputField{
+			{
+				Name:        "temporary",
+				Label:       "Until the daemon restarts",
+				Type:        InputTypeBool,
+				Description: "Switch the running daemon only, without saving the config",
+			},
+		},
 	})
 
-	// tunnel import
+	// tunnel standby
+	Register(&Action{
+		ID:     ActionTunnelStandby,
+		Parent: ActionTunnel,
+		Use:    "standby",
+		Short:  "Set standby tunnel",
+		Long: `Set a tunnel as the standby for the active one. The daemon keeps it
+running, unused, and routes new connections through it as soon as the active
+tunnel goes down, until that is back. Activating the standby swaps the pair.
+
+With --clear the route has no standby.`,
+		MenuLabel: "Use as standby",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag",
+			PickerFunc:  TunnelPicker,
+		},
+		Inputs: []InputField{
+			{
+				Name:        "clear",
+				Label:       "Clear the standby",
+				Type:        InputTypeBool,
+				Description: "Remove route.standby instead of setting it",
+			},
+		},
+	})
+
+	// tunnel preset
+	Register(&Action{
+		ID:     ActionTunnelPreset,
+		Parent: ActionTunnel,
+		Use:    "preset",
+		Short:  "Tune a tunnel for its network",
+		Long: `Tune a tunnel for the network it runs over in one step: the transport's
+keep-alive interval (Slipstream with socks or ssh backend), how long the
+gateway waits to connect to it, and how often and for how long its health is
+probed. traffic.keepalive_ms, if set, still wins over the preset's.
+
+Presets:
+  datacenter  low latency: keep-alive 200ms, dial 5s, probe every 15s (10s timeout)
+  mobile      metered, changing latency: keep-alive 1s, dial 10s, probe every 60s (30s timeout)
+  satellite   long round trips: keep-alive 2s, dial 20s, probe every 60s (45s timeout)
+  none        the defaults`,
+		MenuLabel: "Network preset",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag",
+			Required:    true,
+			PickerFunc:  TunnelPicker,
+		},
+		Inputs: []InputField{
+			{
+				Name:        "preset",
+				Label:       "Preset",
+				Type:        InputTypeSelect,
+				Required:    true,
+				Options:     presetOptions(),
+				Description: "Network the tunnel runs over (datacenter, mobile, satellite, none)",
+			},
+		},
+	})
+
+	// tunnel move
 	Register(&Action{
-		ID:        ActionTunnelImport,
+		ID:     ActionTunnelMove,
+		Parent: ActionTunnel,
+		Use:    "move",
+		Short:  "Move a tunnel up or down the list",
+		Long: `Move a tunnel one place up or down the list of tunnels. The order is the
+one tunnels are listed and started in.`,
+		MenuLabel: "Move",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag",
+			Required:    true,
+			PickerFunc:  TunnelPicker,
+		},
+		Inputs: moveInputs,
+	})
+
+	// tunnel test
+	Register(&Action{
+		ID:        ActionTunnelTest,
 		Parent:    ActionTunnel,
-		Use:       "import",
-		Short:     "Import a tunnel from a dnstm:// URL",
-		Long:      "Import a tunnel configuration from a shared dnstm:// URL",
+		Use:       "test",
+		Short:     "Probe a running tunnel now",
+		Long:      "Run an end-to-end probe through a running tunnel (a DNS query over its SOCKS port) and show the round-trip time",
+		MenuLabel: "Test now",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag",
+			Required:    true,
+			PickerFunc:  TunnelPicker,
+		},
+	})
+
+	// tunnel test-config
+	Register(&Action{
+		ID:     ActionTunnelCheck,
+		Parent: ActionTunnel,
+		Use:    "test-config",
+		Short:  "Check a tunnel's settings without starting it",
+		Long: `Check a tunnel's settings without starting it.
+
+Runs the checks in order and stops at the first failure:
+  1. config       required fields, credentials and key files
+  2. binary       the transport binary is installed
+  3. resolver     the resolver answers DNS queries
+  4. delegation   the tunnel domain exists in DNS
+  5. server       a query under the tunnel domain reaches the tunnel server`,
+		MenuLabel: "Test config",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag",
+			Required:    true,
+			PickerFunc:  TunnelPicker,
+		},
+		Inputs: []InputField{
+			{
+				Name:        "resolver",
+				Label:       "Resolver",
+				ShortFlag:   'r',
+				Type:        InputTypeText,
+				Description: "Test through this resolver instead of the tunnel's (host:port)",
+			},
+		},
+	})
+
+	// tunnel import
+	Register(&Action{
+		ID:     ActionTunnelImport,
+		Parent: ActionTunnel,
+		Use:    "import",
+		Short:  "Import a tunnel from a dnstm:// or ss:// URL",
+		Long: `Import a tunnel configuration from a shared dnstm:// URL, or from an ss:// (SIP002) URL that uses slipstream as its plugin.
+
+Several URLs separated by spaces are taken as alternatives for the same
+tunnel, e.g. the same server behind different domains: the first one is
+imported and the domains and resolvers of the others are kept as fallbacks.`,
 		MenuLabel: "Import",
 		Inputs: []InputField{
 			{
@@ -97,19 +263,114 @@ func init() {
 				Label:       "URL",
 				Type:        InputTypeText,
 				Required:    true,
-				Placeholder: "dnstm://...",
-				Description: "The dnstm:// URL to import",
+				Placeholder: "dnstm://... or ss://...",
+				Description: "The dnstm:// or ss:// URL to import; separate alternative URLs for the same tunnel with spaces",
+			},
+			importChoiceInput,
+			importTagInput,
+			{
+				Name:        "tag",
+				Label:       "Tag",
+				ShortFlag:   't',
+				Type:        InputTypeText,
+				Description: "Tag for the imported tunnel (default: the tag in the URL)",
+				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
+			},
+			{
+				Name:  "overwrite",
+				Label: "Replace an existing tunnel with the same tag",
+				Type:  InputTypeBool,
+			},
+			{
+				Name:  "keyring",
+				Label: "Store passwords in the OS keyring instead of the config file",
+				Type:  InputTypeBool,
+			},
+		},
+	})
+
+	// tunnel export
+	Register(&Action{
+		ID:     ActionTunnelExport,
+		Parent: ActionTunnel,
+		Use:    "export",
+		Short:  "Export a tunnel as a dnstm:// URL",
+		Long: `Print a dnstm:// URL for a tunnel, embedding its certificate, keys and
+passwords, so it can be imported elsewhere with 'dnstc tunnel import'.
+
+With --server-bundle, print instead what the server must match as JSON
+(domain, DNSTT public key or certificate fingerprint, backend type and port),
+without any credentials, to compare against the dnstm server config.`,
+		MenuLabel: "Export",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag",
+			Required:    true,
+			PickerFunc:  TunnelPicker,
+		},
+		Inputs: []InputField{
+			{
+				Name:  "server-bundle",
+				Label: "Print the server-side expectations as JSON",
+				Type:  InputTypeBool,
+			},
+		},
+	})
+
+	// tunnel share
+	Register(&Action{
+		ID:     ActionTunnelShare,
+		Parent: ActionTunnel,
+		Use:    "share",
+		Short:  "Serve a tunnel's dnstm:// URL as a QR code page",
+		Long: `Briefly serve a web page with a QR code and the dnstm:// URL of a tunnel,
+so a phone or another computer on the LAN can import it.
+
+The page lives at a random one-time address: it can be opened once, and the
+server stops after that or when it expires.`,
+		MenuLabel: "Share",
+		Args: &ArgsSpec{
+			Name:        "tag",
+			Description: "Tunnel tag",
+			Required:    true,
+			PickerFunc:  TunnelPicker,
+		},
+		Inputs: []InputField{
+			{
+				Name:  "local",
+				Label: "Only serve on 127.0.0.1",
+				Type:  InputTypeBool,
+			},
+			{
+				Name:        "port",
+				Label:       "Port",
+				ShortFlag:   'p',
+				Type:        InputTypeNumber,
+				Description: "Port to serve the page on (random if omitted)",
+				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
+			},
+			{
+				Name:        "expire",
+				Label:       "Expiry (minutes)",
+				Type:        InputTypeNumber,
+				Default:     "10",
+				Description: "Minutes before the page stops being served",
+				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
 			},
 		},
 	})
 
 	// tunnel add
 	Register(&Action{
-		ID:        ActionTunnelAdd,
-		Parent:    ActionTunnel,
-		Use:       "add",
-		Short:     "Add a new tunnel",
-		Long:      "Add a new DNS tunnel interactively or via flags",
+		ID:     ActionTunnelAdd,
+		Parent: ActionTunnel,
+		Use:    "add",
+		Short:  "Add a new tunnel",
+		Long: `Add a new DNS tunnel interactively or via flags.
+
+Backend-specific flags:
+  shadowsocks  --ss-server, --ss-password, --ss-method
+  ssh          --ssh-user and --ssh-password and/or --ssh-key`,
 		MenuLabel: "Add",
 		Inputs: []InputField{
 			{
@@ -120,6 +381,17 @@ func init() {
 				Description: "Tunnel tag (auto-generated if omitted)",
 				ShowIf:      func(ctx *Context) bool { return !ctx.IsInteractive },
 			},
+			{
+				Name:            "url",
+				Label:           "Import URL",
+				Type:            InputTypeText,
+				InteractiveOnly: true,
+				Placeholder:     "dnstm://... or ss://...",
+				Description:     "Paste a dnstm:// or ss:// URL to import it, or leave empty to set up the tunnel manually",
+				Validate:        ValidateImportURL,
+			},
+			importChoiceInput,
+			importTagInput,
 			{
 				Name:        "transport",
 				Label:       "Transport",
@@ -127,6 +399,7 @@ func init() {
 				Required:    true,
 				Options:     TransportOptions(),
 				Description: "The transport protocol to use",
+				ShowIf:      manualAdd,
 			},
 			{
 				Name:        "backend",
@@ -136,6 +409,7 @@ func init() {
 				Required:    true,
 				OptionsFunc: BackendOptionsForTransport,
 				Description: "The backend type",
+				ShowIf:      manualAdd,
 			},
 			{
 				Name:        "domain",
@@ -145,12 +419,13 @@ func init() {
 				Required:    true,
 				Placeholder: "t1.example.com",
 				Description: "DNS tunnel domain",
+				ShowIf:      manualAdd,
 			},
 			{
-				Name:      "port",
-				Label:     "Local Port",
-				ShortFlag: 'p',
-				Type:      InputTypeNumber,
+				Name:        "port",
+				Label:       "Local Port",
+				ShortFlag:   'p',
+				Type:        InputTypeNumber,
 				Description: "Local SOCKS port",
 				DefaultFunc: func(ctx *Context) string {
 					p, err := port.GetAvailable()
@@ -165,10 +440,23 @@ func init() {
 						return fmt.Errorf("invalid port number")
 					}
 					if !port.IsAvailable(p) {
-						return fmt.Errorf("port %d is already in use", p)
+						return fmt.Errorf("port %d is already in use by %s", p, port.FindOwner(p))
 					}
 					return nil
 				},
+				ShowIf: manualAdd,
+			},
+			{
+				Name:        "resolver",
+				Label:       "DNS Resolver",
+				ShortFlag:   'r',
+				Type:        InputTypeSelect,
+				OptionsFunc: ResolverOptions,
+				Description: "DNS resolver for this tunnel (host:port, default: global resolver)",
+				DescriptionFunc: func(ctx *Context) string {
+					return fmt.Sprintf("Public resolvers probed against %s. Skip to use the global resolver.", ctx.GetString("domain"))
+				},
+				ShowIf: manualAdd,
 			},
 			{
 				Name:        "pubkey",
@@ -177,7 +465,7 @@ func init() {
 				Description: "DNSTT public key (64 hex characters)",
 				Validate:    ValidatePubkey,
 				ShowIf: func(ctx *Context) bool {
-					return config.TransportType(ctx.GetString("transport")) == config.TransportDNSTT
+					return manualAdd(ctx) && config.TransportType(ctx.GetString("transport")) == config.TransportDNSTT
 				},
 			},
 			{
@@ -186,7 +474,7 @@ func init() {
 				Type:        InputTypeText,
 				Description: "Slipstream certificate path (optional)",
 				ShowIf: func(ctx *Context) bool {
-					return config.TransportType(ctx.GetString("transport")) == config.TransportSlipstream &&
+					return manualAdd(ctx) && config.TransportType(ctx.GetString("transport")) == config.TransportSlipstream &&
 						config.BackendType(ctx.GetString("backend")) != config.BackendShadowsocks
 				},
 			},
@@ -196,7 +484,7 @@ func init() {
 				Type:        InputTypeText,
 				Description: "Shadowsocks server address (host:port)",
 				ShowIf: func(ctx *Context) bool {
-					return config.BackendType(ctx.GetString("backend")) == config.BackendShadowsocks
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendShadowsocks
 				},
 			},
 			{
@@ -205,7 +493,7 @@ func init() {
 				Type:        InputTypePassword,
 				Description: "Shadowsocks password",
 				ShowIf: func(ctx *Context) bool {
-					return config.BackendType(ctx.GetString("backend")) == config.BackendShadowsocks
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendShadowsocks
 				},
 			},
 			{
@@ -216,36 +504,175 @@ func init() {
 				Default:     "chacha20-ietf-poly1305",
 				Description: "Shadowsocks encryption method",
 				ShowIf: func(ctx *Context) bool {
-					return config.BackendType(ctx.GetString("backend")) == config.BackendShadowsocks
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendShadowsocks
 				},
 			},
 			{
 				Name:        "ssh-user",
 				Label:       "SSH User",
 				Type:        InputTypeText,
+				Required:    true,
 				Description: "SSH username",
 				ShowIf: func(ctx *Context) bool {
-					return config.BackendType(ctx.GetString("backend")) == config.BackendSSH
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendSSH
+				},
+			},
+			{
+				Name:            "ssh-auth",
+				Label:           "SSH Authentication",
+				Type:            InputTypeSelect,
+				Required:        true,
+				InteractiveOnly: true,
+				Options:         SSHAuthOptions(),
+				Description:     "How to authenticate to the SSH server",
+				ShowIf: func(ctx *Context) bool {
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendSSH
 				},
 			},
 			{
 				Name:        "ssh-password",
 				Label:       "SSH Password",
 				Type:        InputTypePassword,
+				Required:    true,
 				Description: "SSH password",
 				ShowIf: func(ctx *Context) bool {
-					return config.BackendType(ctx.GetString("backend")) == config.BackendSSH
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendSSH &&
+						(!ctx.IsInteractive || ctx.GetString("ssh-auth") == SSHAuthPassword)
 				},
 			},
 			{
 				Name:        "ssh-key",
 				Label:       "SSH Key Path",
 				Type:        InputTypeText,
+				Required:    true,
 				Description: "Path to SSH private key file",
+				DefaultFunc: func(ctx *Context) string { return sshtunnel.DefaultKeyPath() },
+				Validate:    ValidateSSHKeyFile,
+				ShowIf: func(ctx *Context) bool {
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendSSH &&
+						(!ctx.IsInteractive || ctx.GetString("ssh-auth") == SSHAuthKeyFile)
+				},
+			},
+			{
+				Name:            "ssh-key-data",
+				Label:           "SSH Private Key",
+				Type:            InputTypePassword,
+				Required:        true,
+				InteractiveOnly: true,
+				Description:     "Paste the private key (PEM, including the BEGIN/END lines); it is saved next to the config",
+				Validate:        ValidateSSHKeyData,
 				ShowIf: func(ctx *Context) bool {
-					return config.BackendType(ctx.GetString("backend")) == config.BackendSSH
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendSSH &&
+						ctx.GetString("ssh-auth") == SSHAuthKeyPaste
 				},
 			},
+			{
+				Name:                "ssh-passphrase",
+				Label:               "SSH Key Passphrase",
+				Type:                InputTypePassword,
+				Required:            true,
+				Description:         "Passphrase of the SSH private key",
+				ValidateWithContext: ValidateSSHPassphrase,
+				ShowIf: func(ctx *Context) bool {
+					return manualAdd(ctx) && config.BackendType(ctx.GetString("backend")) == config.BackendSSH &&
+						(!ctx.IsInteractive || sshKeyEncrypted(ctx))
+				},
+			},
+			{
+				Name:            "secret-store",
+				Label:           "Store Passwords In",
+				Type:            InputTypeSelect,
+				Required:        true,
+				InteractiveOnly: true,
+				Options:         SecretStoreOptions(),
+				Description:     "The OS keyring keeps passwords out of the config file",
+				ShowIf: func(ctx *Context) bool {
+					return manualAdd(ctx) && secrets.Available() &&
+						(ctx.GetString("ss-password") != "" || ctx.GetString("ssh-password") != "" || ctx.GetString("ssh-passphrase") != "")
+				},
+			},
+			{
+				Name:  "keyring",
+				Label: "Store passwords in the OS keyring instead of the config file",
+				Type:  InputTypeBool,
+			},
 		},
 	})
 }
+
+// Import choices offered after a URL is entered.
+const (
+	ImportChoiceImport    = "import"
+	ImportChoiceOverwrite = "overwrite"
+	ImportChoiceRename    = "rename"
+	ImportChoiceCancel    = "cancel"
+)
+
+// importChoiceInput previews the tunnel in the "url" value and asks whether to
+// import it, or how to resolve a tag conflict.
+var importChoiceInput = InputField{
+	Name:            "import-choice",
+	Label:           "Import Tunnel",
+	Type:            InputTypeSelect,
+	Required:        true,
+	InteractiveOnly: true,
+	OptionsFunc:     ImportChoiceOptions,
+	DescriptionFunc: ImportPreview,
+	ShowIf:          func(ctx *Context) bool { return !manualAdd(ctx) },
+}
+
+// importTagInput asks for a new tag when the imported one is taken.
+var importTagInput = InputField{
+	Name:                "new-tag",
+	Label:               "New Tag",
+	Type:                InputTypeText,
+	Required:            true,
+	InteractiveOnly:     true,
+	Description:         "Tag for the imported tunnel",
+	DefaultFunc:         func(ctx *Context) string { return config.GenerateUniqueTag(contextTunnels(ctx)) },
+	ValidateWithContext: ValidateNewTag,
+	ShowIf:              func(ctx *Context) bool { return ctx.GetString("import-choice") == ImportChoiceRename },
+}
+
+// manualAdd reports whether tunnel add is configuring a tunnel field by field
+// rather than importing a pasted URL.
+func manualAdd(ctx *Context) bool {
+	return ctx.GetString("url") == ""
+}
+
+// removeDescription lists the files that removing the tunnel deletes.
+func removeDescription(ctx *Context) string {
+	tag := ctx.GetArg(0)
+	if tag == "" {
+		tag = ctx.GetString("tag")
+	}
+	for _, tc := range contextTunnels(ctx) {
+		if tc.Tag != tag {
+			continue
+		}
+		var lines []string
+		for _, f := range tc.OwnedFiles() {
+			if _, err := os.Stat(f); err == nil {
+				lines = append(lines, "  "+f)
+			}
+		}
+		if len(lines) > 0 {
+			return "These files will be deleted:\n" + strings.Join(lines, "\n")
+		}
+	}
+	return ""
+}
+
+// presetOptions returns the network presets, and none to clear the preset.
+func presetOptions() []SelectOption {
+	descriptions := map[string]string{
+		config.PresetDatacenter: "Low latency, poll and probe often",
+		config.PresetMobile:     "Metered, latency that varies",
+		config.PresetSatellite:  "Round trips of half a second and more",
+	}
+	var opts []SelectOption
+	for _, name := range config.PresetNames() {
+		opts = append(opts, SelectOption{Label: name, Value: name, Description: descriptions[name]})
+	}
+	return append(opts, SelectOption{Label: "none", Value: "none", Description: "The defaults"})
+}
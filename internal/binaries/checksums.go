@@ -0,0 +1,122 @@
+package binaries
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/go-corelib/binman"
+)
+
+// ChecksumManifest records the SHA256 of each binary as it was installed.
+type ChecksumManifest struct {
+	Checksums map[string]string `json:"checksums"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// LoadChecksums loads the recorded checksums. Returns an empty manifest if none exist.
+func LoadChecksums() (*ChecksumManifest, error) {
+	m := &ChecksumManifest{Checksums: make(map[string]string)}
+	data, err := os.ReadFile(config.ChecksumsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Checksums == nil {
+		m.Checksums = make(map[string]string)
+	}
+	return m, nil
+}
+
+// Save writes the checksum manifest to disk.
+func (m *ChecksumManifest) Save() error {
+	path := config.ChecksumsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	m.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Record computes and stores the checksum of an installed binary.
+func (m *ChecksumManifest) Record(name, path string) error {
+	sum, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+	m.Checksums[name] = sum
+	return nil
+}
+
+// FileSHA256 returns the hex-encoded SHA256 of a file.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// UpstreamChecksum fetches the published SHA256 for a binary at the given version.
+// Archived binaries are published as a checksum of the archive, not the extracted
+// binary, so they cannot be verified this way.
+func UpstreamChecksum(def binman.BinaryDef, version string) (string, error) {
+	if def.ChecksumURL == "" {
+		return "", fmt.Errorf("no upstream checksum published")
+	}
+	if def.Archive {
+		return "", fmt.Errorf("upstream checksum covers the archive, not the binary")
+	}
+
+	mgr := NewManager()
+	assetName := filepath.Base(mgr.BuildURL(def, version))
+	checksumDef := def
+	checksumDef.URLPattern = def.ChecksumURL
+	checksumURL := mgr.BuildURL(checksumDef, version)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(checksumURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", checksumURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: %s", checksumURL, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) >= 2 && strings.TrimPrefix(parts[len(parts)-1], "*") == assetName {
+			return strings.ToLower(parts[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksum file: %w", err)
+	}
+	return "", fmt.Errorf("checksum for %s not found", assetName)
+}
@@ -0,0 +1,70 @@
+package binaries
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/net2share/go-corelib/binman"
+)
+
+// SelfRepo is the GitHub repository dnstc itself is released from.
+const SelfRepo = "net2share/dnstc"
+
+// Repo returns the GitHub "owner/name" repository a binary is downloaded
+// from, or "" if its URL pattern does not point at GitHub releases.
+func Repo(def binman.BinaryDef) string {
+	rest, ok := strings.CutPrefix(def.URLPattern, "https://github.com/")
+	if !ok {
+		return ""
+	}
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) < 3 || !strings.HasPrefix(parts[2], "releases/") {
+		return ""
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// ReleaseURL returns the web page of a release.
+func ReleaseURL(repo, version string) string {
+	if version == "" || version == "latest" {
+		return fmt.Sprintf("https://github.com/%s/releases/latest", repo)
+	}
+	return fmt.Sprintf("https://github.com/%s/releases/tag/%s", repo, version)
+}
+
+// ReleaseNotes fetches the release notes published with a release.
+// A version of "latest" fetches the notes of the latest release.
+func ReleaseNotes(repo, version string) (string, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/tags/%s", repo, version)
+	if version == "" || version == "latest" {
+		url = fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", repo)
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "dnstc")
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch release notes: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch release notes: %s", resp.Status)
+	}
+
+	var release struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("failed to parse release notes: %w", err)
+	}
+	return strings.TrimSpace(release.Body), nil
+}
@@ -86,9 +86,9 @@ func EnvPath(def binman.BinaryDef) string {
 	return ""
 }
 
-// CopyToBinDir copies a binary from srcPath into the managed bin directory.
-func CopyToBinDir(def binman.BinaryDef, srcPath string) error {
-	binDir := config.BinDir()
+// CopyToDir copies a binary from srcPath into binDir, the managed bin
+// directory or SystemBinDir.
+func CopyToDir(def binman.BinaryDef, srcPath, binDir string) error {
 	if err := os.MkdirAll(binDir, 0750); err != nil {
 		return fmt.Errorf("failed to create bin directory: %w", err)
 	}
@@ -107,8 +107,71 @@ func CopyToBinDir(def binman.BinaryDef, srcPath string) error {
 }
 
 // AreInstalled returns true if 'dnstc install' has been run.
-// It checks for the version manifest file, which is created by the install handler.
+// It checks for the version manifest file, which is created by the install handler,
+// or for binaries installed for all users with 'install --system'.
 func AreInstalled() bool {
-	_, err := os.Stat(config.VersionsPath())
-	return err == nil
+	if _, err := os.Stat(config.VersionsPath()); err == nil {
+		return true
+	}
+	return len(loadSystemRecord().Binaries) > 0
+}
+
+// VersionInfo describes the installed and pinned version of a managed binary.
+type VersionInfo struct {
+	Name            string `json:"name"`
+	Installed       string `json:"installed"`
+	Pinned          string `json:"pinned"`
+	UpdateAvailable bool   `json:"update_available"`
+}
+
+// Versions returns version information for all managed binaries from the version manifest.
+// Binaries missing from the manifest have an empty Installed version.
+func Versions() []VersionInfo {
+	manifest, err := binman.LoadManifest(config.VersionsPath())
+	if err != nil {
+		manifest = binman.NewManifest()
+	}
+
+	defs := Defs()
+	var infos []VersionInfo
+	for _, name := range AllNames() {
+		def := defs[name]
+		installed := manifest.GetVersion(name)
+		infos = append(infos, VersionInfo{
+			Name:            name,
+			Installed:       installed,
+			Pinned:          def.PinnedVersion,
+			UpdateAvailable: installed != "" && !def.SkipUpdate && binman.IsNewer(installed, def.PinnedVersion),
+		})
+	}
+	return infos
+}
+
+// FormatVersion returns a one-line summary such as "slipstream-client v1.0 (update available: v1.1)".
+func (v VersionInfo) FormatVersion() string {
+	if v.Installed == "" {
+		return fmt.Sprintf("%s not installed", v.Name)
+	}
+	if v.UpdateAvailable {
+		return fmt.Sprintf("%s %s (update available: %s)", v.Name, v.Installed, v.Pinned)
+	}
+	return fmt.Sprintf("%s %s", v.Name, v.Installed)
+}
+
+// InstalledVersion returns the version of the copy of a binary that dnstc
+// runs, or "" if unknown: it is not installed, or was not installed by dnstc.
+func InstalledVersion(name string) string {
+	def, ok := Defs()[name]
+	if !ok {
+		return ""
+	}
+	path, err := Resolve(def)
+	if err != nil || EnvPath(def) != "" || !OwnsPath(name, path) {
+		return ""
+	}
+	manifest, err := binman.LoadManifest(config.VersionsPath())
+	if err != nil {
+		return ""
+	}
+	return manifest.GetVersion(name)
 }
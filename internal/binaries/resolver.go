@@ -0,0 +1,172 @@
+package binaries
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/go-corelib/binman"
+)
+
+// Resolver finds the installed copy of a binary that dnstc runs.
+type Resolver interface {
+	Resolve(def binman.BinaryDef) (string, error)
+}
+
+// Store is a place binaries may be installed in, such as a package manager's
+// profile. Find returns the binary's path, or "" if the store lacks it.
+type Store interface {
+	Find(name string) string
+}
+
+// Store names accepted in binaries.stores.
+const (
+	StoreNix      = "nix"
+	StoreHomebrew = "homebrew"
+)
+
+// DirStore looks for binaries in a list of directories, in order.
+type DirStore []string
+
+// Find implements Store.
+func (s DirStore) Find(name string) string {
+	for _, dir := range s {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// NixStore finds binaries installed with Nix, in the user's profile first.
+func NixStore() Store {
+	home, _ := os.UserHomeDir()
+	dirs := DirStore{filepath.Join(home, ".nix-profile", "bin")}
+	if user := os.Getenv("USER"); user != "" {
+		dirs = append(dirs, filepath.Join("/etc/profiles/per-user", user, "bin"))
+	}
+	return append(dirs, "/nix/var/nix/profiles/default/bin", "/run/current-system/sw/bin")
+}
+
+// homebrewStore finds binaries linked into a Homebrew prefix and, for
+// keg-only formulae, in the newest version in the Cellar.
+type homebrewStore struct {
+	prefixes []string
+}
+
+// HomebrewStore finds binaries installed with Homebrew.
+func HomebrewStore() Store {
+	prefixes := []string{"/home/linuxbrew/.linuxbrew"}
+	if runtime.GOOS == "darwin" {
+		prefixes = []string{"/opt/homebrew", "/usr/local"}
+	}
+	if p := os.Getenv("HOMEBREW_PREFIX"); p != "" {
+		prefixes = append([]string{p}, prefixes...)
+	}
+	return homebrewStore{prefixes: prefixes}
+}
+
+// Find implements Store.
+func (s homebrewStore) Find(name string) string {
+	for _, prefix := range s.prefixes {
+		if p := (DirStore{filepath.Join(prefix, "bin")}).Find(name); p != "" {
+			return p
+		}
+		// Formulae are not always named after their binary, e.g. sslocal
+		// comes from shadowsocks-rust, so look through every keg
+		matches, _ := filepath.Glob(filepath.Join(prefix, "Cellar", "*", "*", "bin", name))
+		if len(matches) > 0 {
+			sort.Strings(matches)
+			return matches[len(matches)-1]
+		}
+	}
+	return ""
+}
+
+// chainResolver looks a binary up in the env override, then each store in
+// turn, then dnstc's own bin directory.
+type chainResolver struct {
+	stores []Store
+	binDir string
+}
+
+// NewResolver returns the resolver for the binaries section of the config,
+// which may be nil. Binaries are looked up in the env override, the
+// configured paths and stores, the system paths, then dnstc's bin directory.
+func NewResolver(cfg *config.BinariesConfig) Resolver {
+	var stores []Store
+	if cfg != nil {
+		if len(cfg.Paths) > 0 {
+			stores = append(stores, DirStore(cfg.Paths))
+		}
+		for _, name := range cfg.Stores {
+			switch name {
+			case StoreNix:
+				stores = append(stores, NixStore())
+			case StoreHomebrew:
+				stores = append(stores, HomebrewStore())
+			}
+		}
+	}
+	stores = append(stores, DirStore(systemPaths))
+	return &chainResolver{stores: stores, binDir: config.BinDir()}
+}
+
+// Resolve implements Resolver.
+func (r *chainResolver) Resolve(def binman.BinaryDef) (string, error) {
+	if p := EnvPath(def); p != "" {
+		return p, nil
+	}
+	for _, s := range r.stores {
+		if p := s.Find(def.Name); p != "" {
+			return p, nil
+		}
+	}
+	if p := (DirStore{r.binDir}).Find(def.Name); p != "" {
+		return p, nil
+	}
+	return "", fmt.Errorf("binary %s not found", def.Name)
+}
+
+var (
+	resolverMu sync.Mutex
+	resolver   Resolver
+)
+
+// SetResolver replaces the resolver used by Resolve and IsInstalled.
+func SetResolver(r Resolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	resolver = r
+}
+
+// currentResolver returns the resolver set with SetResolver or, until one
+// is, the one for the saved config.
+func currentResolver() Resolver {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	if resolver == nil {
+		var bc *config.BinariesConfig
+		if cfg, err := config.Load(); err == nil {
+			bc = cfg.Binaries
+		}
+		resolver = NewResolver(bc)
+	}
+	return resolver
+}
+
+// Resolve returns the path of the copy of a binary that dnstc runs.
+func Resolve(def binman.BinaryDef) (string, error) {
+	return currentResolver().Resolve(def)
+}
+
+// IsInstalled reports whether a binary can be found.
+func IsInstalled(def binman.BinaryDef) bool {
+	_, err := Resolve(def)
+	return err == nil
+}
@@ -0,0 +1,129 @@
+package binaries
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/net2share/go-corelib/binman"
+)
+
+// SystemBinDir is where 'dnstc install --system' puts binaries, shared by all
+// users. Binaries there take precedence over the per-user bin directory.
+const SystemBinDir = "/usr/local/bin"
+
+// systemRecordPath lists the binaries in SystemBinDir that dnstc installed,
+// so it never updates or removes one that came from a package manager.
+const systemRecordPath = "/usr/local/share/dnstc/system-binaries.json"
+
+// systemRecord maps binary names to the SHA256 they had when dnstc installed
+// them into SystemBinDir.
+type systemRecord struct {
+	Binaries map[string]string `json:"binaries"`
+}
+
+func loadSystemRecord() *systemRecord {
+	r := &systemRecord{Binaries: make(map[string]string)}
+	if data, err := os.ReadFile(systemRecordPath); err == nil {
+		json.Unmarshal(data, r)
+	}
+	if r.Binaries == nil {
+		r.Binaries = make(map[string]string)
+	}
+	return r
+}
+
+func (r *systemRecord) save() error {
+	if len(r.Binaries) == 0 {
+		err := os.Remove(systemRecordPath)
+		os.Remove(filepath.Dir(systemRecordPath))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(systemRecordPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(systemRecordPath, data, 0644)
+}
+
+// NewSystemManager creates a binman.Manager that installs into SystemBinDir.
+func NewSystemManager() *binman.Manager {
+	return binman.NewManager(SystemBinDir)
+}
+
+// RecordSystemInstall marks the binary in SystemBinDir as installed by dnstc.
+func RecordSystemInstall(name string) error {
+	sum, err := FileSHA256(filepath.Join(SystemBinDir, name))
+	if err != nil {
+		return err
+	}
+	r := loadSystemRecord()
+	r.Binaries[name] = sum
+	return r.save()
+}
+
+// OwnsPath reports whether the binary at path was installed by dnstc: it is
+// in the per-user bin directory, or 'install --system' put it in SystemBinDir.
+func OwnsPath(name, path string) bool {
+	switch filepath.Dir(path) {
+	case filepath.Clean(NewManager().BinDir()):
+		return true
+	case SystemBinDir:
+		_, ok := loadSystemRecord().Binaries[name]
+		return ok
+	}
+	return false
+}
+
+// ManagerFor returns the manager that installs into the directory the binary
+// is currently used from, so that updates and repairs replace that copy.
+func ManagerFor(def binman.BinaryDef) *binman.Manager {
+	if path, err := Resolve(def); err == nil &&
+		filepath.Dir(path) == SystemBinDir && OwnsPath(def.Name, path) {
+		return NewSystemManager()
+	}
+	return NewManager()
+}
+
+// RemovablePaths returns the paths RemoveBinary would remove for a binary.
+func RemovablePaths(name string) []string {
+	var paths []string
+	userPath := filepath.Join(NewManager().BinDir(), name)
+	if _, err := os.Stat(userPath); err == nil {
+		paths = append(paths, userPath)
+	}
+	systemPath := filepath.Join(SystemBinDir, name)
+	if recorded, ok := loadSystemRecord().Binaries[name]; ok {
+		if sum, err := FileSHA256(systemPath); err == nil && sum == recorded {
+			paths = append(paths, systemPath)
+		}
+	}
+	return paths
+}
+
+// RemoveBinary removes a managed binary from the per-user bin directory and,
+// if dnstc installed it there, from SystemBinDir. It returns the paths
+// removed. Binaries in SystemBinDir that dnstc did not install, or that were
+// replaced since, are left alone.
+func RemoveBinary(name string) ([]string, error) {
+	var removed []string
+	for _, path := range RemovablePaths(name) {
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+
+	r := loadSystemRecord()
+	if _, ok := r.Binaries[name]; !ok {
+		return removed, nil
+	}
+	delete(r.Binaries, name)
+	return removed, r.save()
+}
@@ -0,0 +1,74 @@
+package binaries
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/go-corelib/binman"
+)
+
+// updateCheckInterval is how often the background update check contacts GitHub.
+const updateCheckInterval = 24 * time.Hour
+
+// UpdateCheck is the cached result of the last background update check.
+type UpdateCheck struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest"`
+}
+
+// LoadUpdateCheck reads the cached update check. A missing or unreadable
+// cache yields an empty check.
+func LoadUpdateCheck() UpdateCheck {
+	var c UpdateCheck
+	data, err := os.ReadFile(config.UpdateCheckPath())
+	if err != nil {
+		return c
+	}
+	json.Unmarshal(data, &c)
+	return c
+}
+
+// Save writes the update check cache to disk.
+func (c UpdateCheck) Save() error {
+	path := config.UpdateCheckPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// AvailableUpdate returns the cached latest dnstc release if it is newer
+// than currentVersion, or "". It never touches the network.
+func AvailableUpdate(currentVersion string) string {
+	if currentVersion == "dev" {
+		return ""
+	}
+	c := LoadUpdateCheck()
+	if c.Latest != "" && binman.IsNewer(currentVersion, c.Latest) {
+		return c.Latest
+	}
+	return ""
+}
+
+// RefreshUpdateCheck looks up the latest dnstc release unless the cache was
+// refreshed within the last day. Failures are left for the next attempt.
+func RefreshUpdateCheck(currentVersion string) {
+	if currentVersion == "dev" {
+		return
+	}
+	if time.Since(LoadUpdateCheck().CheckedAt) < updateCheckInterval {
+		return
+	}
+	latest, _, err := binman.CheckSelfUpdate(SelfRepo, currentVersion)
+	if err != nil {
+		return
+	}
+	UpdateCheck{CheckedAt: time.Now(), Latest: latest}.Save()
+}
@@ -28,9 +28,12 @@ func Decode(url string) (*ClientConfig, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
-	if cfg.Version < 1 {
+	if cfg.Version < Version1 {
 		return nil, fmt.Errorf("unsupported config version: %d", cfg.Version)
 	}
+	if cfg.Version > CurrentVersion {
+		return nil, fmt.Errorf("unsupported config version: %d (update dnstc to import this URL)", cfg.Version)
+	}
 
 	return &cfg, nil
 }
@@ -14,7 +14,17 @@ func Encode(cfg *ClientConfig) (string, error) {
 		return "", fmt.Errorf("config is nil")
 	}
 
-	data, err := json.Marshal(cfg)
+	// Stay readable by older decoders unless a newer field is used
+	out := *cfg
+	out.Version = Version1
+	switch {
+	case out.usesV3():
+		out.Version = Version3
+	case out.usesV2():
+		out.Version = Version2
+	}
+
+	data, err := json.Marshal(&out)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal config: %w", err)
 	}
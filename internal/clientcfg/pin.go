@@ -0,0 +1,20 @@
+package clientcfg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+)
+
+const pinPrefix = "sha256:"
+
+// CertPin returns the pin of a PEM certificate: the SHA-256 of its DER bytes.
+func CertPin(certPEM string) (string, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return "", fmt.Errorf("certificate is not PEM encoded")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return pinPrefix + hex.EncodeToString(sum[:]), nil
+}
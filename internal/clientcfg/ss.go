@@ -0,0 +1,118 @@
+package clientcfg
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const ssPrefix = "ss://"
+
+// Parse decodes a dnstm:// URL or an ss:// (SIP002) URL that uses slipstream
+// as its plugin. Several URLs separated by whitespace are alternatives for
+// the same tunnel: the first is used and the domains and resolvers of the
+// others become its fallbacks.
+func Parse(s string) (*ClientConfig, error) {
+	urls := strings.Fields(s)
+	if len(urls) == 0 {
+		return Decode("")
+	}
+	cfg, err := parseOne(urls[0])
+	if err != nil {
+		return nil, err
+	}
+	for i, u := range urls[1:] {
+		alt, err := parseOne(u)
+		if err != nil {
+			return nil, fmt.Errorf("URL %d: %w", i+2, err)
+		}
+		if err := cfg.Merge(alt); err != nil {
+			return nil, fmt.Errorf("URL %d: %w", i+2, err)
+		}
+	}
+	return cfg, nil
+}
+
+func parseOne(s string) (*ClientConfig, error) {
+	if strings.HasPrefix(s, ssPrefix) {
+		return DecodeSS(s)
+	}
+	return Decode(s)
+}
+
+// IsURL reports whether s looks like a URL accepted by Parse.
+func IsURL(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, urlPrefix) || strings.HasPrefix(s, ssPrefix)
+}
+
+// DecodeSS parses a SIP002 ss:// URL whose plugin is slipstream, e.g.
+//
+//	ss://YWVzLTI1Ni1nY206c2VjcmV0@127.0.0.1:8388?plugin=slipstream%3Bdomain%3Dt.example.com#tag
+//
+// into a slipstream + shadowsocks ClientConfig.
+func DecodeSS(s string) (*ClientConfig, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Scheme != "ss" {
+		return nil, fmt.Errorf("invalid URL: not an ss:// URL")
+	}
+	if u.User == nil {
+		return nil, fmt.Errorf("invalid URL: missing method and password")
+	}
+
+	method, password, err := ssUserInfo(u.User)
+	if err != nil {
+		return nil, err
+	}
+
+	plugin := strings.Split(u.Query().Get("plugin"), ";")
+	if !strings.HasPrefix(path.Base(plugin[0]), "slipstream") {
+		return nil, fmt.Errorf("unsupported ss:// URL: plugin must be slipstream")
+	}
+	var domain string
+	for _, opt := range plugin[1:] {
+		if k, v, ok := strings.Cut(opt, "="); ok && k == "domain" {
+			domain = v
+		}
+	}
+	if domain == "" {
+		return nil, fmt.Errorf("invalid URL: plugin options have no domain")
+	}
+
+	return &ClientConfig{
+		Version: 1,
+		Tag:     u.Fragment,
+		Transport: TransportConfig{
+			Type:   "slipstream",
+			Domain: domain,
+		},
+		Backend: BackendConfig{
+			Type:     "shadowsocks",
+			Password: password,
+			Method:   method,
+		},
+	}, nil
+}
+
+// ssUserInfo returns the method and password of a SIP002 userinfo, which is
+// either base64url("method:password") or a percent-encoded "method:password".
+func ssUserInfo(info *url.Userinfo) (string, string, error) {
+	if password, ok := info.Password(); ok {
+		return info.Username(), password, nil
+	}
+	raw := info.Username()
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(raw, "="))
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(raw, "="))
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+	method, password, ok := strings.Cut(string(data), ":")
+	if !ok || method == "" {
+		return "", "", fmt.Errorf("invalid URL: malformed method and password")
+	}
+	return method, password, nil
+}
@@ -1,26 +1,99 @@
 package clientcfg
 
+import (
+	"fmt"
+	"slices"
+)
+
+// Schema versions. Version 2 adds resolvers, a preferred local port, the
+// Shadowsocks server, the SSH key passphrase and fallback domains. Decoders
+// ignore unknown fields, so older dnstc releases still read version 2 URLs and
+// just drop the additions. Version 3 adds the SSH stream scrambling key and the
+// DoH upstreams that resolvers refer to, which a tunnel can't connect without,
+// so older releases refuse it instead.
+const (
+	Version1       = 1
+	Version2       = 2
+	Version3       = 3
+	CurrentVersion = Version3
+)
+
 // ClientConfig is the JSON payload embedded in a dnstm:// URL.
 type ClientConfig struct {
 	Version   int             `json:"v"`
 	Tag       string          `json:"tag"`
 	Transport TransportConfig `json:"transport"`
 	Backend   BackendConfig   `json:"backend"`
+	Resolvers []string        `json:"resolvers,omitempty"` // v2: recommended resolvers, best first
+	Port      int             `json:"port,omitempty"`      // v2: preferred local SOCKS port
+	DoH       []DoHUpstream   `json:"doh,omitempty"`       // v3: DoH upstreams that "doh:<name>" resolvers refer to
+}
+
+// DoHUpstream describes a DNS-over-HTTPS upstream used as a resolver.
+type DoHUpstream struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	SNI  string `json:"sni,omitempty"`
+	IP   string `json:"ip,omitempty"`
 }
 
 // TransportConfig describes the DNS transport layer.
 type TransportConfig struct {
-	Type   string `json:"type"`             // "slipstream" or "dnstt"
-	Domain string `json:"domain"`           // NS domain
-	Cert   string `json:"cert,omitempty"`   // PEM string (slipstream)
-	PubKey string `json:"pubkey,omitempty"` // 64-char hex (dnstt)
+	Type      string   `json:"type"`                // "slipstream" or "dnstt"
+	Domain    string   `json:"domain"`              // NS domain
+	Fallbacks []string `json:"fallbacks,omitempty"` // v2: alternative NS domains of the same server
+	Cert      string   `json:"cert,omitempty"`      // PEM string (slipstream)
+	PubKey    string   `json:"pubkey,omitempty"`    // 64-char hex (dnstt)
 }
 
 // BackendConfig describes the backend service behind the tunnel.
 type BackendConfig struct {
-	Type     string `json:"type"`               // "socks", "ssh", "shadowsocks"
-	User     string `json:"user,omitempty"`     // ssh
-	Password string `json:"password,omitempty"` // ssh, shadowsocks
-	Key      string `json:"key,omitempty"`      // ssh (private key PEM)
-	Method   string `json:"method,omitempty"`   // shadowsocks
+	Type       string `json:"type"`                 // "socks", "ssh", "shadowsocks"
+	User       string `json:"user,omitempty"`       // ssh
+	Password   string `json:"password,omitempty"`   // ssh, shadowsocks
+	Key        string `json:"key,omitempty"`        // ssh (private key PEM)
+	Passphrase string `json:"passphrase,omitempty"` // v2: ssh private key passphrase
+	Method     string `json:"method,omitempty"`     // shadowsocks
+	Server     string `json:"server,omitempty"`     // v2: shadowsocks server as seen by the plugin
+	ObfsKey    string `json:"obfs_key,omitempty"`   // v3: ssh stream scrambling key
+	ObfsPad    bool   `json:"obfs_pad,omitempty"`   // v3: ssh stream scrambling padding
+}
+
+// usesV2 reports whether cfg has fields that version 1 can't carry.
+func (c *ClientConfig) usesV2() bool {
+	return len(c.Resolvers) > 0 || c.Port != 0 || c.Backend.Server != "" ||
+		c.Backend.Passphrase != "" || len(c.Transport.Fallbacks) > 0
+}
+
+// usesV3 reports whether cfg has fields that version 2 can't carry.
+func (c *ClientConfig) usesV3() bool {
+	return c.Backend.ObfsKey != "" || len(c.DoH) > 0
+}
+
+// Merge adds the domain, fallback domains, resolvers and DoH upstreams of alt,
+// which must describe the same tunnel, to c's.
+func (c *ClientConfig) Merge(alt *ClientConfig) error {
+	if alt.Transport.Type != c.Transport.Type || alt.Transport.Cert != c.Transport.Cert ||
+		alt.Transport.PubKey != c.Transport.PubKey || alt.Backend != c.Backend {
+		return fmt.Errorf("describes a different tunnel; alternative URLs may only differ in domain and resolvers")
+	}
+	for _, d := range append([]string{alt.Transport.Domain}, alt.Transport.Fallbacks...) {
+		if d != c.Transport.Domain && !slices.Contains(c.Transport.Fallbacks, d) {
+			c.Transport.Fallbacks = append(c.Transport.Fallbacks, d)
+		}
+	}
+	for _, r := range alt.Resolvers {
+		if !slices.Contains(c.Resolvers, r) {
+			c.Resolvers = append(c.Resolvers, r)
+		}
+	}
+	for _, d := range alt.DoH {
+		i := slices.IndexFunc(c.DoH, func(u DoHUpstream) bool { return u.Name == d.Name })
+		if i < 0 {
+			c.DoH = append(c.DoH, d)
+		} else if c.DoH[i] != d {
+			return fmt.Errorf("defines DoH upstream '%s' differently", d.Name)
+		}
+	}
+	return nil
 }
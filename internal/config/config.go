@@ -2,9 +2,11 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -14,11 +16,26 @@ const DefaultResolver = "1.1.1.1:53"
 
 // Config holds the dnstc configuration.
 type Config struct {
-	Log       LogConfig      `json:"log,omitempty"`
-	Listen    ListenConfig   `json:"listen,omitempty"`
-	Resolvers []string       `json:"resolvers,omitempty"`
-	Tunnels   []TunnelConfig `json:"tunnels,omitempty"`
-	Route     RouteConfig    `json:"route,omitempty"`
+	Log       LogConfig       `json:"log,omitempty"`
+	Listen    ListenConfig    `json:"listen,omitempty"`
+	Resolvers []string        `json:"resolvers,omitempty"`
+	Tunnels   []TunnelConfig  `json:"tunnels,omitempty"`
+	Route     RouteConfig     `json:"route,omitempty"`
+	Binaries  *BinariesConfig `json:"binaries,omitempty"`
+	Disk      *DiskConfig     `json:"disk,omitempty"`
+	DoH       []DoHConfig     `json:"doh,omitempty"`
+
+	// StatusFile, if set, is kept up to date with the daemon status as JSON.
+	StatusFile string `json:"status_file,omitempty"`
+
+	// KeepHistory saves the tunnels' throughput and RTT history, so the
+	// graphs survive daemon restarts.
+	KeepHistory bool `json:"keep_history,omitempty"`
+
+	// RestartOnPanic starts a daemon subsystem, such as the gateway's accept
+	// loop, again after it panics. Panics are logged and reported in the
+	// status either way.
+	RestartOnPanic bool `json:"restart_on_panic,omitempty"`
 }
 
 // LogConfig configures logging behavior.
@@ -28,12 +45,94 @@ type LogConfig struct {
 
 // ListenConfig holds local listener configuration.
 type ListenConfig struct {
-	SOCKS string `json:"socks,omitempty"`
+	SOCKS string          `json:"socks,omitempty"`
+	Extra []ExtraListener `json:"extra,omitempty"`
+
+	// MaxPending limits, per listener, the connections waiting for the tunnel
+	// to answer their SOCKS handshake. Further connections wait up to QueueMS
+	// for a slot and are then refused. 0 means no limit.
+	MaxPending int `json:"max_pending,omitempty"`
+	QueueMS    int `json:"queue_ms,omitempty"` // 0 adapts the wait to the tunnel's handshake time
+
+	QoS *QoSConfig `json:"qos,omitempty"`
+
+	// IdleTimeoutSec closes relayed connections with no data either way for
+	// this long; 0 never does. KeepAliveSec sets the TCP keep-alive period
+	// of relayed connections; 0 keeps the default of 15 seconds.
+	IdleTimeoutSec int `json:"idle_timeout_sec,omitempty"`
+	KeepAliveSec   int `json:"keepalive_sec,omitempty"`
+
+	// Prewarm keeps this many connections open through the active tunnel
+	// ahead of use, where its backend allows, so the first request after a
+	// quiet spell doesn't wait for a stream to be set up. 0 keeps none.
+	Prewarm int `json:"prewarm,omitempty"`
+}
+
+// MaxPrewarm is the most connections listen.prewarm may keep open.
+const MaxPrewarm = 8
+
+// QoSConfig makes the gateway favor interactive connections over bulk
+// transfers while both are active. Connections to InteractivePorts and
+// BulkPorts are classified by port; others count as interactive until they
+// have received BulkAfterKB.
+type QoSConfig struct {
+	InteractivePorts []int `json:"interactive_ports,omitempty"`
+	BulkPorts        []int `json:"bulk_ports,omitempty"`
+	BulkAfterKB      int   `json:"bulk_after_kb,omitempty"`
+}
+
+// Defaults for QoSConfig fields that are not set.
+var (
+	DefaultInteractivePorts = []int{22, 23, 3389, 5900}
+	DefaultBulkAfterKB      = 512
+)
+
+// Interactive returns the ports classified as interactive.
+func (q *QoSConfig) Interactive() []int {
+	if q.InteractivePorts == nil {
+		return DefaultInteractivePorts
+	}
+	return q.InteractivePorts
+}
+
+// BulkAfter returns the bytes after which a connection counts as bulk.
+func (q *QoSConfig) BulkAfter() int64 {
+	if q.BulkAfterKB == 0 {
+		return int64(DefaultBulkAfterKB) << 10
+	}
+	return int64(q.BulkAfterKB) << 10
+}
+
+// ExtraListener is an additional SOCKS listener pinned to a specific tunnel,
+// independent of route.active.
+type ExtraListener struct {
+	SOCKS string `json:"socks"`
+	Via   string `json:"via"` // tunnel tag
+}
+
+// BinariesConfig adds places to look for the transport binaries, ahead of
+// the system paths and dnstc's own bin directory.
+type BinariesConfig struct {
+	Paths  []string `json:"paths,omitempty"`  // directories, searched in order
+	Stores []string `json:"stores,omitempty"` // package managers: "nix", "homebrew"
 }
 
 // RouteConfig configures routing and active tunnel.
 type RouteConfig struct {
 	Active string `json:"active,omitempty"`
+
+	// Standby is a tunnel kept running, unused, to take over from the
+	// active one as soon as it goes down.
+	Standby string `json:"standby,omitempty"`
+}
+
+// Activate makes tag the active tunnel. Activating the standby swaps the
+// pair, so the tunnel it replaces becomes the standby.
+func (r *RouteConfig) Activate(tag string) {
+	if tag == r.Standby {
+		r.Standby = r.Active
+	}
+	r.Active = tag
 }
 
 // Default returns a default configuration.
@@ -74,6 +173,21 @@ func LoadFromPath(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// ParseStrict parses a configuration like LoadFromPath, but rejects unknown
+// fields so that misspelled keys are reported instead of ignored.
+func ParseStrict(data []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level object")
+	}
+	return &cfg, nil
+}
+
 // LoadOrDefault reads the configuration from disk, or returns a default config if not found.
 func LoadOrDefault() (*Config, error) {
 	cfg, err := Load()
@@ -90,6 +204,19 @@ func LoadOrDefault() (*Config, error) {
 	return cfg, nil
 }
 
+// Clone returns a deep copy of the configuration.
+func (c *Config) Clone() *Config {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(fmt.Sprintf("config: failed to copy: %v", err))
+	}
+	var out Config
+	if err := json.Unmarshal(data, &out); err != nil {
+		panic(fmt.Sprintf("config: failed to copy: %v", err))
+	}
+	return &out
+}
+
 // Save writes the configuration to the default path.
 func (c *Config) Save() error {
 	return c.SaveToPath(Path())
@@ -107,7 +234,24 @@ func (c *Config) SaveToPath(path string) error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0640); err != nil {
+	// Written to a temporary file and renamed over the config, so that
+	// readers such as a CLI running meanwhile never see it half written
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	err = tmp.Chmod(0640)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -139,8 +283,9 @@ func (c *Config) GetResolver(tc *TunnelConfig) string {
 	return DefaultResolver
 }
 
-// GetFormattedConfig returns the configuration as a formatted JSON string.
+// GetFormattedConfig returns the configuration as a formatted JSON string
+// with secrets redacted, suitable for display and logging.
 func (c *Config) GetFormattedConfig() string {
-	data, _ := json.MarshalIndent(c, "", "  ")
+	data, _ := json.MarshalIndent(c.Redacted(), "", "  ")
 	return string(data)
 }
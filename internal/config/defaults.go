@@ -35,10 +35,10 @@ func (c *Config) ApplyDefaults() {
 		}
 	}
 
-	// Route active defaults to first enabled tunnel
+	// Route active defaults to first enabled tunnel other than the standby
 	if c.Route.Active == "" && len(c.Tunnels) > 0 {
 		for _, t := range c.Tunnels {
-			if t.IsEnabled() {
+			if t.IsEnabled() && t.Tag != c.Route.Standby {
 				c.Route.Active = t.Tag
 				break
 			}
@@ -0,0 +1,52 @@
+package config
+
+// Default caps on the space dnstc's files take up, in MB.
+const (
+	DefaultDiskLogsMB      = 8
+	DefaultDiskDownloadsMB = 32
+	DefaultDiskBackupsMB   = 1
+)
+
+// DiskConfig caps the space taken up by tunnel logs, leftovers of
+// interrupted downloads and config backups, for devices such as routers with
+// a few MB of free flash. Each cap is in MB: 0 uses the default and -1 turns
+// the cap off. Over a cap, the oldest files go first.
+type DiskConfig struct {
+	LogsMB      int `json:"logs_mb,omitempty"`
+	DownloadsMB int `json:"downloads_mb,omitempty"`
+	BackupsMB   int `json:"backups_mb,omitempty"`
+}
+
+// LogsCap returns the cap on tunnel logs in bytes, or 0 for none.
+func (d *DiskConfig) LogsCap() int64 {
+	if d == nil {
+		return diskCap(0, DefaultDiskLogsMB)
+	}
+	return diskCap(d.LogsMB, DefaultDiskLogsMB)
+}
+
+// DownloadsCap returns the cap on download leftovers in bytes, or 0 for none.
+func (d *DiskConfig) DownloadsCap() int64 {
+	if d == nil {
+		return diskCap(0, DefaultDiskDownloadsMB)
+	}
+	return diskCap(d.DownloadsMB, DefaultDiskDownloadsMB)
+}
+
+// BackupsCap returns the cap on config backups in bytes, or 0 for none.
+func (d *DiskConfig) BackupsCap() int64 {
+	if d == nil {
+		return diskCap(0, DefaultDiskBackupsMB)
+	}
+	return diskCap(d.BackupsMB, DefaultDiskBackupsMB)
+}
+
+func diskCap(mb, def int) int64 {
+	switch {
+	case mb < 0:
+		return 0
+	case mb == 0:
+		mb = def
+	}
+	return int64(mb) << 20
+}
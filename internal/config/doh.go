@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// DoHPrefix marks a resolver that is a DoH upstream: "doh:<name>" refers to
+// the entry of that name in doh.
+const DoHPrefix = "doh:"
+
+// DoHConfig is a DNS-over-HTTPS upstream. Tunnels use it as a resolver
+// named "doh:<name>", through a local forwarder the daemon runs, so it works
+// with every transport.
+type DoHConfig struct {
+	Name string `json:"name"`
+	URL  string `json:"url"` // e.g. https://dns.google/dns-query
+
+	// SNI is the TLS server name sent instead of the URL's host, so that a
+	// resolver blocked by SNI can be reached through a front on the same CDN.
+	// The URL's host is still sent as the HTTP Host.
+	SNI string `json:"sni,omitempty"`
+	// IP is connected to instead of resolving the URL's host, with port 443
+	// unless it has one.
+	IP string `json:"ip,omitempty"`
+}
+
+// DoHName returns the DoH upstream a resolver refers to, if it does.
+func DoHName(resolver string) (string, bool) {
+	return strings.CutPrefix(resolver, DoHPrefix)
+}
+
+// GetDoH returns the DoH upstream with the given name, or nil.
+func (c *Config) GetDoH(name string) *DoHConfig {
+	for i := range c.DoH {
+		if c.DoH[i].Name == name {
+			return &c.DoH[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks a DoH upstream on its own.
+func (d *DoHConfig) Validate() error {
+	if err := ValidateTag(d.Name); err != nil {
+		return fmt.Errorf("invalid name: %w", err)
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("url must be an https:// URL")
+	}
+	if d.SNI != "" && (strings.ContainsAny(d.SNI, ":/ ") || net.ParseIP(d.SNI) != nil) {
+		return fmt.Errorf("sni must be a host name")
+	}
+	if d.IP != "" {
+		host := d.IP
+		if h, _, err := net.SplitHostPort(d.IP); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("ip must be an IP address, optionally with a port")
+		}
+	}
+	return nil
+}
+
+// validateDoH validates the DoH upstreams and the resolvers that refer to them.
+func (c *Config) validateDoH() error {
+	seen := make(map[string]bool)
+	for i := range c.DoH {
+		d := &c.DoH[i]
+		if err := d.Validate(); err != nil {
+			return fmt.Errorf("doh[%d]: %w", i, err)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("doh[%d]: duplicate name '%s'", i, d.Name)
+		}
+		seen[d.Name] = true
+	}
+
+	refs := append([]string(nil), c.Resolvers...)
+	for _, t := range c.Tunnels {
+		refs = append(refs, t.Resolver)
+		if t.Fallback != nil {
+			refs = append(refs, t.Fallback.Resolvers...)
+		}
+	}
+	for _, r := range refs {
+		if name, ok := DoHName(r); ok && !seen[name] {
+			return fmt.Errorf("resolver %s: no doh upstream named '%s'", r, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import "testing"
+
+func TestDoHConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		doh     DoHConfig
+		wantErr bool
+	}{
+		{"plain", DoHConfig{Name: "google", URL: "https://dns.google/dns-query"}, false},
+		{"sni and ip", DoHConfig{Name: "front", URL: "https://dns.google/dns-query", SNI: "www.google.com", IP: "8.8.8.8"}, false},
+		{"ip with port", DoHConfig{Name: "front", URL: "https://dns.google/dns-query", IP: "8.8.8.8:8443"}, false},
+		{"ipv6", DoHConfig{Name: "front", URL: "https://dns.google/dns-query", IP: "[2001:4860:4860::8888]:443"}, false},
+		{"bad name", DoHConfig{Name: "G", URL: "https://dns.google/dns-query"}, true},
+		{"http url", DoHConfig{Name: "google", URL: "http://dns.google/dns-query"}, true},
+		{"no host", DoHConfig{Name: "google", URL: "https:///dns-query"}, true},
+		{"not a url", DoHConfig{Name: "google", URL: "dns.google"}, true},
+		{"sni with port", DoHConfig{Name: "google", URL: "https://dns.google/dns-query", SNI: "www.google.com:443"}, true},
+		{"sni is an ip", DoHConfig{Name: "google", URL: "https://dns.google/dns-query", SNI: "8.8.8.8"}, true},
+		{"ip is a host name", DoHConfig{Name: "google", URL: "https://dns.google/dns-query", IP: "dns.google"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.doh.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDoHReferences(t *testing.T) {
+	google := DoHConfig{Name: "google", URL: "https://dns.google/dns-query"}
+	tests := []struct {
+		name    string
+		doh     []DoHConfig
+		global  []string
+		tunnel  string
+		wantErr bool
+	}{
+		{"no doh", nil, []string{"8.8.8.8"}, "1.1.1.1", false},
+		{"global reference", []DoHConfig{google}, []string{"doh:google"}, "", false},
+		{"tunnel reference", []DoHConfig{google}, nil, "doh:google", false},
+		{"unknown global reference", []DoHConfig{google}, []string{"doh:other"}, "", true},
+		{"unknown tunnel reference", nil, nil, "doh:google", true},
+		{"duplicate name", []DoHConfig{google, google}, nil, "", true},
+		{"invalid upstream", []DoHConfig{{Name: "google"}}, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				DoH:       tt.doh,
+				Resolvers: tt.global,
+				Tunnels:   []TunnelConfig{{Tag: "one", Resolver: tt.tunnel}},
+			}
+			err := cfg.validateDoH()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDoH() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
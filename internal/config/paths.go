@@ -6,42 +6,74 @@ import (
 	"runtime"
 )
 
-const (
-	appName = "dnstc"
-)
+// AppName names the config and data directories. Uninstall only removes
+// paths under a directory of this name.
+const AppName = "dnstc"
 
-// ConfigDir returns the platform-specific configuration directory.
+// ConfigDir returns the platform-specific configuration directory, or the
+// portable directory in portable mode.
 func ConfigDir() string {
+	if dir := PortableDir(); dir != "" {
+		return dir
+	}
 	switch runtime.GOOS {
 	case "darwin":
 		home, _ := os.UserHomeDir()
-		return filepath.Join(home, "Library", "Application Support", appName)
+		return filepath.Join(home, "Library", "Application Support", AppName)
 	case "windows":
-		return filepath.Join(os.Getenv("APPDATA"), appName)
+		return filepath.Join(os.Getenv("APPDATA"), AppName)
 	default: // linux and others
 		if xdgConfig := os.Getenv("XDG_CONFIG_HOME"); xdgConfig != "" {
-			return filepath.Join(xdgConfig, appName)
+			return filepath.Join(xdgConfig, AppName)
 		}
 		home, _ := os.UserHomeDir()
-		return filepath.Join(home, ".config", appName)
+		return filepath.Join(home, ".config", AppName)
 	}
 }
 
-// BinDir returns the platform-specific binary directory.
+// BinDir returns the platform-specific binary directory, or bin in the
+// portable directory in portable mode.
 func BinDir() string {
+	if dir := PortableDir(); dir != "" {
+		return filepath.Join(dir, "bin")
+	}
 	switch runtime.GOOS {
 	case "darwin":
 		home, _ := os.UserHomeDir()
-		return filepath.Join(home, "Library", "Application Support", appName, "bin")
+		return filepath.Join(home, "Library", "Application Support", AppName, "bin")
 	case "windows":
-		return filepath.Join(os.Getenv("APPDATA"), appName, "bin")
+		return filepath.Join(os.Getenv("APPDATA"), AppName, "bin")
 	default: // linux and others
 		if xdgData := os.Getenv("XDG_DATA_HOME"); xdgData != "" {
-			return filepath.Join(xdgData, appName, "bin")
+			return filepath.Join(xdgData, AppName, "bin")
 		}
 		home, _ := os.UserHomeDir()
-		return filepath.Join(home, ".local", "share", appName, "bin")
+		return filepath.Join(home, ".local", "share", AppName, "bin")
+	}
+}
+
+// SystemDir returns the directory of the files an administrator puts in
+// place for every user: /etc/dnstc, or dnstc in ProgramData on Windows.
+func SystemDir() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), AppName)
 	}
+	return filepath.Join("/etc", AppName)
+}
+
+// ProvisionPaths returns where a one-shot provisioning file is looked for,
+// in order: the system directory, then the config directory.
+func ProvisionPaths() []string {
+	return []string{
+		filepath.Join(SystemDir(), "provision.json"),
+		filepath.Join(ConfigDir(), "provision.json"),
+	}
+}
+
+// ProvisionedPath returns the path to the record of the provisioning files
+// already applied.
+func ProvisionedPath() string {
+	return filepath.Join(ConfigDir(), "provisioned.json")
 }
 
 // Path returns the full path to the config file.
@@ -64,11 +96,42 @@ func SocketPath() string {
 	return filepath.Join(ConfigDir(), "engine.sock")
 }
 
+// LogDir returns the directory holding tunnel process logs.
+func LogDir() string {
+	return filepath.Join(ConfigDir(), "logs")
+}
+
+// TunnelLogPath returns the path to the output log of a tunnel's transport process.
+func TunnelLogPath(tag string) string {
+	return filepath.Join(LogDir(), "tunnel-"+tag+".log")
+}
+
 // VersionsPath returns the path to the binary version manifest.
 func VersionsPath() string {
 	return filepath.Join(ConfigDir(), "versions.json")
 }
 
+// ChecksumsPath returns the path to the recorded binary checksums.
+func ChecksumsPath() string {
+	return filepath.Join(ConfigDir(), "checksums.json")
+}
+
+// UpdateCheckPath returns the path to the cached result of the last update check.
+func UpdateCheckPath() string {
+	return filepath.Join(ConfigDir(), "update-check.json")
+}
+
+// UsagePath returns the path to the per-tunnel data usage of the current month.
+func UsagePath() string {
+	return filepath.Join(ConfigDir(), "usage.json")
+}
+
+// HistoryPath returns the path to the saved throughput and RTT history,
+// written when keep_history is set.
+func HistoryPath() string {
+	return filepath.Join(ConfigDir(), "history.json")
+}
+
 // EnsureDirs creates the config and bin directories if they don't exist.
 func EnsureDirs() error {
 	if err := os.MkdirAll(ConfigDir(), 0750); err != nil {
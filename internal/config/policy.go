@@ -0,0 +1,214 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Policy is a system-wide overlay on the user config, for fleets managed by
+// an administrator. The daemon runs the user config with the policy applied
+// over a copy of it, so the user's own settings are kept on disk and come
+// back if the policy is relaxed; CheckPolicy refuses changes that go against
+// it.
+type Policy struct {
+	// Resolvers, if set, are the only resolvers tunnels may use. They replace
+	// the global resolvers, and tunnel resolvers not among them are dropped.
+	Resolvers []string `json:"resolvers,omitempty"`
+
+	// ForbidBackends lists backends that may not be used. Tunnels using them
+	// are disabled.
+	ForbidBackends []BackendType `json:"forbid_backends,omitempty"`
+
+	// LoopbackOnly keeps the gateway and extra listeners on loopback
+	// addresses, so they can't be shared with the network. Other addresses
+	// are moved to 127.0.0.1 on the same port.
+	LoopbackOnly bool `json:"loopback_only,omitempty"`
+
+	// KillSwitch keeps the gateway listening for as long as the daemon runs,
+	// even with every tunnel stopped, and refuses requests to stop it alone.
+	// Apps pointed at it then fail instead of reaching another proxy that
+	// binds the freed port, or going out directly.
+	KillSwitch bool `json:"kill_switch,omitempty"`
+}
+
+// PolicyPath returns the path of the system policy file.
+func PolicyPath() string {
+	return filepath.Join(SystemDir(), "policy.json")
+}
+
+// LoadPolicy reads the system policy, returning nil if there is none.
+func LoadPolicy() (*Policy, error) {
+	data, err := os.ReadFile(PolicyPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", PolicyPath(), err)
+	}
+	return &p, nil
+}
+
+// Apply returns a copy of cfg with the policy overlaid on it. cfg itself is
+// left as it is, so that saving it doesn't write the policy's effects into
+// the user's config. A nil policy returns cfg.
+func (p *Policy) Apply(cfg *Config) *Config {
+	if p == nil {
+		return cfg
+	}
+	out := cfg.Clone()
+	if len(p.Resolvers) > 0 {
+		out.Resolvers = slices.Clone(p.Resolvers)
+	}
+	for i := range out.Tunnels {
+		tc := &out.Tunnels[i]
+		if tc.Resolver != "" && !p.allowsResolver(tc.Resolver) {
+			tc.Resolver = ""
+		}
+		if tc.Fallback != nil {
+			tc.Fallback.Resolvers = slices.DeleteFunc(tc.Fallback.Resolvers, func(r string) bool {
+				return !p.allowsResolver(r)
+			})
+		}
+		if slices.Contains(p.ForbidBackends, tc.Backend) {
+			disabled := false
+			tc.Enabled = &disabled
+		}
+	}
+	if p.LoopbackOnly {
+		out.Listen.SOCKS = loopbackAddr(out.Listen.SOCKS)
+		for i := range out.Listen.Extra {
+			out.Listen.Extra[i].SOCKS = loopbackAddr(out.Listen.Extra[i].SOCKS)
+		}
+	}
+	return out
+}
+
+// Check returns an error describing the first way cfg goes against the
+// policy.
+func (p *Policy) Check(cfg *Config) error {
+	if v := p.violations(cfg); len(v) > 0 {
+		return errors.New(v[0])
+	}
+	return nil
+}
+
+// violations describes every way cfg goes against the policy.
+func (p *Policy) violations(cfg *Config) []string {
+	if p == nil {
+		return nil
+	}
+	var out []string
+	if len(p.Resolvers) > 0 {
+		for _, r := range cfg.Resolvers {
+			if !p.allowsResolver(r) {
+				out = append(out, fmt.Sprintf("resolver %s is not allowed by the policy", r))
+			}
+		}
+	}
+	for _, tc := range cfg.Tunnels {
+		if tc.Resolver != "" && !p.allowsResolver(tc.Resolver) {
+			out = append(out, fmt.Sprintf("tunnel '%s': resolver %s is not allowed by the policy", tc.Tag, tc.Resolver))
+		}
+		if tc.Fallback != nil {
+			for _, r := range tc.Fallback.Resolvers {
+				if !p.allowsResolver(r) {
+					out = append(out, fmt.Sprintf("tunnel '%s': fallback resolver %s is not allowed by the policy", tc.Tag, r))
+				}
+			}
+		}
+		if tc.IsEnabled() && slices.Contains(p.ForbidBackends, tc.Backend) {
+			out = append(out, fmt.Sprintf("tunnel '%s': the %s backend is forbidden by the policy", tc.Tag, tc.Backend))
+		}
+	}
+	addrs := []string{cfg.Listen.SOCKS}
+	for _, l := range cfg.Listen.Extra {
+		addrs = append(addrs, l.SOCKS)
+	}
+	for _, addr := range addrs {
+		if addr != "" && !p.AllowsListen(addr) {
+			out = append(out, fmt.Sprintf("listen address %s is not allowed by the policy: it must be a loopback address", addr))
+		}
+	}
+	return out
+}
+
+// KeepsGateway reports whether the policy's kill switch is on.
+func (p *Policy) KeepsGateway() bool {
+	return p != nil && p.KillSwitch
+}
+
+// AllowsListen reports whether the gateway or an extra listener may listen
+// on addr.
+func (p *Policy) AllowsListen(addr string) bool {
+	return p == nil || !p.LoopbackOnly || loopbackAddr(addr) == addr
+}
+
+// CheckPolicy checks a change from old to cfg against the system policy, if
+// there is one, returning the first violation in cfg that old doesn't have.
+// Settings made before the policy came in are left to its overlay, so they
+// don't block unrelated changes. old may be nil.
+func CheckPolicy(old, cfg *Config) error {
+	p, err := LoadPolicy()
+	if err != nil || p == nil {
+		return err
+	}
+	return p.checkChange(old, cfg)
+}
+
+// checkChange implements CheckPolicy for p.
+func (p *Policy) checkChange(old, cfg *Config) error {
+	var had []string
+	if old != nil {
+		had = p.violations(old)
+	}
+	for _, v := range p.violations(cfg) {
+		if !slices.Contains(had, v) {
+			return errors.New(v)
+		}
+	}
+	return nil
+}
+
+// allowsResolver reports whether tunnels may use a resolver.
+func (p *Policy) allowsResolver(r string) bool {
+	if len(p.Resolvers) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Resolvers, func(allowed string) bool {
+		return resolverKey(allowed) == resolverKey(r)
+	})
+}
+
+// resolverKey returns a resolver address with the default port, so that
+// "1.1.1.1" and "1.1.1.1:53" compare equal.
+func resolverKey(r string) string {
+	if _, _, err := net.SplitHostPort(r); err != nil {
+		return net.JoinHostPort(r, "53")
+	}
+	return r
+}
+
+// loopbackAddr returns addr if its host is a loopback address, and
+// otherwise 127.0.0.1 with its port.
+func loopbackAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "localhost" {
+		return addr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
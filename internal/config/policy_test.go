@@ -0,0 +1,199 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// policyConfig returns a config with an SSH tunnel using a resolver of its
+// own and a fallback, and a SOCKS gateway on all interfaces.
+func policyConfig() *Config {
+	cfg := Default()
+	cfg.Resolvers = []string{"8.8.8.8"}
+	cfg.Listen.SOCKS = "0.0.0.0:1080"
+	cfg.Listen.Extra = []ExtraListener{{SOCKS: "[::1]:1081"}}
+	cfg.Tunnels = []TunnelConfig{{
+		Tag:       "one",
+		Transport: TransportDNSTT,
+		Backend:   BackendSSH,
+		Domain:    "t.example.com",
+		Resolver:  "9.9.9.9:53",
+		Fallback:  &FallbackConfig{Resolvers: []string{"1.1.1.1", "8.8.4.4"}},
+	}}
+	return cfg
+}
+
+func TestPolicyApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		check  func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:   "nil policy",
+			policy: nil,
+			check: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg, policyConfig()) {
+					t.Errorf("config changed: %+v", cfg)
+				}
+			},
+		},
+		{
+			name:   "resolvers",
+			policy: &Policy{Resolvers: []string{"1.1.1.1:53", "9.9.9.9"}},
+			check: func(t *testing.T, cfg *Config) {
+				if want := []string{"1.1.1.1:53", "9.9.9.9"}; !reflect.DeepEqual(cfg.Resolvers, want) {
+					t.Errorf("resolvers = %v, want %v", cfg.Resolvers, want)
+				}
+				tc := cfg.Tunnels[0]
+				if tc.Resolver != "9.9.9.9:53" {
+					t.Errorf("tunnel resolver = %q, want it kept", tc.Resolver)
+				}
+				if want := []string{"1.1.1.1"}; !reflect.DeepEqual(tc.Fallback.Resolvers, want) {
+					t.Errorf("fallback resolvers = %v, want %v", tc.Fallback.Resolvers, want)
+				}
+			},
+		},
+		{
+			name:   "tunnel resolver not allowed",
+			policy: &Policy{Resolvers: []string{"1.1.1.1"}},
+			check: func(t *testing.T, cfg *Config) {
+				if r := cfg.Tunnels[0].Resolver; r != "" {
+					t.Errorf("tunnel resolver = %q, want it dropped", r)
+				}
+			},
+		},
+		{
+			name:   "forbidden backend",
+			policy: &Policy{ForbidBackends: []BackendType{BackendSSH}},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Tunnels[0].IsEnabled() {
+					t.Error("tunnel enabled, want it disabled")
+				}
+			},
+		},
+		{
+			name:   "loopback only",
+			policy: &Policy{LoopbackOnly: true},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Listen.SOCKS != "127.0.0.1:1080" {
+					t.Errorf("gateway = %s, want 127.0.0.1:1080", cfg.Listen.SOCKS)
+				}
+				if cfg.Listen.Extra[0].SOCKS != "[::1]:1081" {
+					t.Errorf("extra listener = %s, want it kept", cfg.Listen.Extra[0].SOCKS)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := policyConfig()
+			got := tt.policy.Apply(cfg)
+			tt.check(t, got)
+			if !reflect.DeepEqual(cfg, policyConfig()) {
+				t.Error("Apply changed the config it was given")
+			}
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *Policy
+		wantErr bool
+	}{
+		{"nil policy", nil, false},
+		{"empty policy", &Policy{}, false},
+		{"kill switch only", &Policy{KillSwitch: true}, false},
+		{"allowed resolvers", &Policy{Resolvers: []string{"8.8.8.8:53", "9.9.9.9", "1.1.1.1", "8.8.4.4"}}, false},
+		{"global resolver not allowed", &Policy{Resolvers: []string{"9.9.9.9", "1.1.1.1", "8.8.4.4"}}, true},
+		{"fallback resolver not allowed", &Policy{Resolvers: []string{"8.8.8.8", "9.9.9.9", "1.1.1.1"}}, true},
+		{"forbidden backend", &Policy{ForbidBackends: []BackendType{BackendSSH}}, true},
+		{"other backend forbidden", &Policy{ForbidBackends: []BackendType{BackendShadowsocks}}, false},
+		{"gateway not on loopback", &Policy{LoopbackOnly: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(policyConfig())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckChange(t *testing.T) {
+	p := &Policy{LoopbackOnly: true, ForbidBackends: []BackendType{BackendShadowsocks}}
+	tests := []struct {
+		name    string
+		old     *Config
+		change  func(cfg *Config)
+		wantErr bool
+	}{
+		{
+			name:    "new config with a violation",
+			old:     nil,
+			change:  func(cfg *Config) {},
+			wantErr: true,
+		},
+		{
+			name:    "violation from before the policy",
+			old:     policyConfig(),
+			change:  func(cfg *Config) { cfg.Resolvers = []string{"1.1.1.1"} },
+			wantErr: false,
+		},
+		{
+			name: "new violation",
+			old:  policyConfig(),
+			change: func(cfg *Config) {
+				cfg.Tunnels = append(cfg.Tunnels, TunnelConfig{Tag: "two", Backend: BackendShadowsocks})
+			},
+			wantErr: true,
+		},
+		{
+			name:    "new listener off loopback",
+			old:     policyConfig(),
+			change:  func(cfg *Config) { cfg.Listen.Extra[0].SOCKS = "0.0.0.0:1081" },
+			wantErr: true,
+		},
+		{
+			name:    "violation fixed",
+			old:     policyConfig(),
+			change:  func(cfg *Config) { cfg.Listen.SOCKS = "127.0.0.1:1080" },
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := policyConfig()
+			tt.change(cfg)
+			err := p.checkChange(tt.old, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkChange() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowsListen(t *testing.T) {
+	tests := []struct {
+		policy *Policy
+		addr   string
+		want   bool
+	}{
+		{nil, "0.0.0.0:1080", true},
+		{&Policy{}, "0.0.0.0:1080", true},
+		{&Policy{LoopbackOnly: true}, "0.0.0.0:1080", false},
+		{&Policy{LoopbackOnly: true}, "192.168.1.2:1080", false},
+		{&Policy{LoopbackOnly: true}, "127.0.0.1:1080", true},
+		{&Policy{LoopbackOnly: true}, "127.0.0.2:1080", true},
+		{&Policy{LoopbackOnly: true}, "[::1]:1080", true},
+		{&Policy{LoopbackOnly: true}, "localhost:1080", true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.AllowsListen(tt.addr); got != tt.want {
+			t.Errorf("%+v.AllowsListen(%s) = %v, want %v", tt.policy, tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PortableEnv turns portable mode on ("1") or off ("0") whatever the marker
+// says. SetPortable sets it, so the daemon and other processes dnstc starts
+// follow the mode of the one that started them.
+const PortableEnv = "DNSTC_PORTABLE"
+
+// PortableMarker is the file that, next to the executable, turns portable
+// mode on.
+const PortableMarker = "dnstc.portable"
+
+var (
+	portableMu  sync.Mutex
+	portableDir *string // nil until detected or set
+)
+
+// PortableDir returns the directory that holds the config, binaries, state
+// and socket in portable mode, data/dnstc next to the executable, or "" when
+// portable mode is off.
+func PortableDir() string {
+	portableMu.Lock()
+	defer portableMu.Unlock()
+	if portableDir == nil {
+		dir := ""
+		if exeDir := executableDir(); exeDir != "" {
+			on := os.Getenv(PortableEnv) == "1"
+			if os.Getenv(PortableEnv) == "" {
+				_, err := os.Stat(filepath.Join(exeDir, PortableMarker))
+				on = err == nil
+			}
+			if on {
+				dir = filepath.Join(exeDir, "data", AppName)
+			}
+		}
+		portableDir = &dir
+	}
+	return *portableDir
+}
+
+// SetPortable turns portable mode on or off for this process and the ones
+// it starts. It must be called before any path is used.
+func SetPortable(on bool) {
+	portableMu.Lock()
+	portableDir = nil
+	portableMu.Unlock()
+	if on {
+		os.Setenv(PortableEnv, "1")
+	} else {
+		os.Setenv(PortableEnv, "0")
+	}
+}
+
+// executableDir returns the directory of the executable, or "" if it can't
+// be found.
+func executableDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Dir(exe)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"slices"
+	"time"
+)
+
+// Network presets, set per tunnel with preset.
+const (
+	PresetMobile     = "mobile"
+	PresetSatellite  = "satellite"
+	PresetDatacenter = "datacenter"
+)
+
+// Preset tunes a tunnel for the network it runs over. Zero fields keep the
+// defaults.
+type Preset struct {
+	// KeepAliveMs is the transport's keep-alive interval, where the
+	// transport has one (see TrafficConfig).
+	KeepAliveMs int
+	// DialTimeout bounds the gateway's connect to the tunnel.
+	DialTimeout time.Duration
+	// HealthInterval is the time between health probes, and HealthTimeout
+	// bounds each of them.
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+}
+
+// Presets are the network presets by name.
+var Presets = map[string]Preset{
+	// Low latency and cheap traffic: poll and probe often, give up quickly
+	PresetDatacenter: {KeepAliveMs: 200, DialTimeout: 5 * time.Second, HealthInterval: 15 * time.Second, HealthTimeout: 10 * time.Second},
+	// Metered, NAT mappings that expire and latency that varies
+	PresetMobile: {KeepAliveMs: 1000, DialTimeout: 10 * time.Second, HealthInterval: time.Minute, HealthTimeout: 30 * time.Second},
+	// Round trips of half a second and more
+	PresetSatellite: {KeepAliveMs: 2000, DialTimeout: 20 * time.Second, HealthInterval: time.Minute, HealthTimeout: 45 * time.Second},
+}
+
+// PresetNames returns the names of the network presets, sorted.
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Tuning returns the tunnel's network preset, or the zero Preset if it has
+// none.
+func (t *TunnelConfig) Tuning() Preset {
+	return Presets[t.Preset]
+}
+
+// KeepAliveMs returns the tunnel's keep-alive interval: traffic.keepalive_ms
+// if set, else its preset's where the transport has one, else 0 for the
+// transport default.
+func (t *TunnelConfig) KeepAliveMs() int {
+	if t.Traffic != nil && t.Traffic.KeepAliveMs > 0 {
+		return t.Traffic.KeepAliveMs
+	}
+	if t.Transport != TransportSlipstream || t.Backend == BackendShadowsocks {
+		return 0
+	}
+	return t.Tuning().KeepAliveMs
+}
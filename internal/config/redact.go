@@ -0,0 +1,56 @@
+package config
+
+import "strings"
+
+// RedactedValue replaces secrets in displayed or logged configuration.
+const RedactedValue = "****"
+
+// RedactSecret returns RedactedValue for a non-empty secret. Keyring
+// references are not secret and are returned as is.
+func RedactSecret(s string) string {
+	if s == "" || IsKeyringRef(s) {
+		return s
+	}
+	return RedactedValue
+}
+
+// Redacted returns a deep copy of the configuration with secrets replaced by RedactedValue.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Resolvers = append([]string(nil), c.Resolvers...)
+	out.Tunnels = make([]TunnelConfig, len(c.Tunnels))
+	for i, t := range c.Tunnels {
+		out.Tunnels[i] = t.Redacted()
+	}
+	return &out
+}
+
+// Redacted returns a copy of the tunnel configuration with secrets replaced by RedactedValue.
+func (t TunnelConfig) Redacted() TunnelConfig {
+	if t.Shadowsocks != nil {
+		ss := *t.Shadowsocks
+		ss.Password = RedactSecret(ss.Password)
+		t.Shadowsocks = &ss
+	}
+	if t.SSH != nil {
+		sshCfg := *t.SSH
+		sshCfg.Password = RedactSecret(sshCfg.Password)
+		sshCfg.Passphrase = RedactSecret(sshCfg.Passphrase)
+		if sshCfg.Obfs != nil {
+			obfs := *sshCfg.Obfs
+			obfs.Key = RedactSecret(obfs.Key)
+			sshCfg.Obfs = &obfs
+		}
+		t.SSH = &sshCfg
+	}
+	return t
+}
+
+// KeyringPrefix marks a secret stored in the OS keyring; the rest of the value
+// is the keyring account, e.g. "keyring:swift-tunnel/ss-password".
+const KeyringPrefix = "keyring:"
+
+// IsKeyringRef reports whether a secret value refers to the OS keyring.
+func IsKeyringRef(s string) bool {
+	return strings.HasPrefix(s, KeyringPrefix)
+}
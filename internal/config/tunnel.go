@@ -1,5 +1,11 @@
 package config
 
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
 // TransportType defines the type of transport.
 type TransportType string
 
@@ -25,11 +31,25 @@ type TunnelConfig struct {
 	Backend     BackendType        `json:"backend"`
 	Domain      string             `json:"domain"`
 	Port        int                `json:"port,omitempty"`
+	Preset      string             `json:"preset,omitempty"` // network preset, see Presets
 	Resolver    string             `json:"resolver,omitempty"`
+	Fallback    *FallbackConfig    `json:"fallback,omitempty"`
 	Slipstream  *SlipstreamConfig  `json:"slipstream,omitempty"`
 	DNSTT       *DNSTTConfig       `json:"dnstt,omitempty"`
 	Shadowsocks *ShadowsocksConfig `json:"shadowsocks,omitempty"`
 	SSH         *SSHConfig         `json:"ssh,omitempty"`
+	Env         map[string]string  `json:"env,omitempty"` // extra environment for the transport process
+	Limits      *LimitsConfig      `json:"limits,omitempty"`
+	Traffic     *TrafficConfig     `json:"traffic,omitempty"`
+	Quota       *QuotaConfig       `json:"quota,omitempty"`
+	Files       []string           `json:"files,omitempty"` // files written for the tunnel, deleted along with it
+}
+
+// FallbackConfig lists alternatives to a tunnel's domain and resolver, for
+// when the primary ones get blocked.
+type FallbackConfig struct {
+	Domains   []string `json:"domains,omitempty"`   // other NS domains served by the same server
+	Resolvers []string `json:"resolvers,omitempty"` // other resolvers to reach them through
 }
 
 // SlipstreamConfig holds Slipstream-specific configuration.
@@ -51,9 +71,74 @@ type ShadowsocksConfig struct {
 
 // SSHConfig holds SSH backend configuration.
 type SSHConfig struct {
-	User     string `json:"user"`
-	Password string `json:"password,omitempty"`
-	Key      string `json:"key,omitempty"` // path to PEM private key file
+	User       string `json:"user"`
+	Password   string `json:"password,omitempty"`
+	Key        string `json:"key,omitempty"`        // path to PEM private key file
+	Passphrase string `json:"passphrase,omitempty"` // passphrase of an encrypted key
+	Share      string `json:"share,omitempty"`      // tunnels with the same share name use one SSH connection
+
+	// Obfs scrambles the SSH stream inside the DNS tunnel, for servers that
+	// fingerprint SSH banners. The server must unscramble it the same way.
+	Obfs *ObfsConfig `json:"obfs,omitempty"`
+}
+
+// ObfsConfig configures the scrambling of a backend stream, see package obfs.
+type ObfsConfig struct {
+	Key string `json:"key"`           // shared with the server
+	Pad bool   `json:"pad,omitempty"` // random padding at the start of each direction
+}
+
+// LimitsConfig holds resource limits for a tunnel's transport process (Linux only).
+type LimitsConfig struct {
+	Nice       int   `json:"nice,omitempty"`        // -20 (highest priority) to 19 (lowest)
+	CPUs       []int `json:"cpus,omitempty"`        // CPU affinity
+	MemoryMB   int   `json:"memory_mb,omitempty"`   // cgroup memory.max, else data segment limit
+	CPUPercent int   `json:"cpu_percent,omitempty"` // cgroup cpu.max, in percent of one CPU
+}
+
+// DefaultEconomyKeepAliveMs is the keep-alive interval used in economy mode
+// when economy_keepalive_ms is not set.
+const DefaultEconomyKeepAliveMs = 10000
+
+// TrafficConfig tunes the background DNS traffic a transport sends to keep
+// its session alive (Slipstream with socks or ssh backend only).
+type TrafficConfig struct {
+	KeepAliveMs        int  `json:"keepalive_ms,omitempty"`         // keep-alive interval; 0 keeps the transport default
+	Economy            bool `json:"economy,omitempty"`              // use EconomyKeepAliveMs while the gateway is idle
+	EconomyKeepAliveMs int  `json:"economy_keepalive_ms,omitempty"` // keep-alive interval in economy mode
+}
+
+// EconomyInterval returns the keep-alive interval to use in economy mode.
+func (t *TrafficConfig) EconomyInterval() int {
+	if t.EconomyKeepAliveMs > 0 {
+		return t.EconomyKeepAliveMs
+	}
+	return DefaultEconomyKeepAliveMs
+}
+
+// DefaultQuotaWarnPercent is the share of a quota at which a warning is logged
+// when warn_percent is not set.
+const DefaultQuotaWarnPercent = 80
+
+// QuotaConfig limits the data a tunnel carries through the gateway per calendar month.
+type QuotaConfig struct {
+	MonthlyMB   int  `json:"monthly_mb"`
+	WarnPercent int  `json:"warn_percent,omitempty"` // warn when this share is used
+	Stop        bool `json:"stop,omitempty"`         // stop the tunnel once the quota is used up
+}
+
+// Bytes returns the quota in bytes.
+func (q *QuotaConfig) Bytes() int64 {
+	return int64(q.MonthlyMB) << 20
+}
+
+// WarnAt returns the usage in bytes at which a warning is logged.
+func (q *QuotaConfig) WarnAt() int64 {
+	pct := q.WarnPercent
+	if pct == 0 {
+		pct = DefaultQuotaWarnPercent
+	}
+	return q.Bytes() * int64(pct) / 100
 }
 
 // IsEnabled returns true if the tunnel is enabled.
@@ -61,6 +146,45 @@ func (t *TunnelConfig) IsEnabled() bool {
 	return t.Enabled == nil || *t.Enabled
 }
 
+// OwnedFiles returns the files in the config directory that belong to the
+// tunnel and go when it is removed: those listed in Files, and for tunnels
+// added before Files existed, a certificate or key named after the tag.
+// Paths outside the config directory are never returned.
+func (t *TunnelConfig) OwnedFiles() []string {
+	candidates := slices.Clone(t.Files)
+	if t.Slipstream != nil && t.Slipstream.Cert == filepath.Join(ConfigDir(), t.Tag+".cert.pem") {
+		candidates = append(candidates, t.Slipstream.Cert)
+	}
+	if t.SSH != nil && t.SSH.Key == filepath.Join(ConfigDir(), t.Tag+".key.pem") {
+		candidates = append(candidates, t.SSH.Key)
+	}
+
+	dir := filepath.Clean(ConfigDir())
+	var files []string
+	for _, f := range candidates {
+		f = filepath.Clean(f)
+		if filepath.Dir(f) != dir || slices.Contains(files, f) {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// EnvList returns the tunnel's extra environment as sorted KEY=VALUE pairs.
+func (t *TunnelConfig) EnvList() []string {
+	keys := make([]string, 0, len(t.Env))
+	for k := range t.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+t.Env[k])
+	}
+	return env
+}
+
 // IsSlipstream returns true if this is a Slipstream tunnel.
 func (t *TunnelConfig) IsSlipstream() bool {
 	return t.Transport == TransportSlipstream
@@ -2,7 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 )
 
 var tagRegex = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
@@ -21,6 +25,26 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+
+	if err := c.validateBinaries(); err != nil {
+		return err
+	}
+
+	if err := c.validateDisk(); err != nil {
+		return err
+	}
+
+	if err := c.validateDoH(); err != nil {
+		return err
+	}
+
+	if c.StatusFile != "" && !filepath.IsAbs(c.StatusFile) {
+		return fmt.Errorf("status_file must be an absolute path")
+	}
+
 	return nil
 }
 
@@ -65,6 +89,19 @@ func (c *Config) validateTunnels() error {
 			return fmt.Errorf("tunnel '%s': domain is required", t.Tag)
 		}
 
+		if f := t.Fallback; f != nil {
+			for i, d := range f.Domains {
+				if d == "" || d == t.Domain || slices.Contains(f.Domains[:i], d) {
+					return fmt.Errorf("tunnel '%s': fallback domain %q is empty or repeated", t.Tag, d)
+				}
+			}
+			for _, r := range f.Resolvers {
+				if r == "" {
+					return fmt.Errorf("tunnel '%s': fallback resolvers must not be empty", t.Tag)
+				}
+			}
+		}
+
 		// Check transport-backend compatibility
 		if err := validateTransportBackendCompatibility(t.Transport, t.Backend); err != nil {
 			return fmt.Errorf("tunnel '%s': %w", t.Tag, err)
@@ -109,6 +146,57 @@ func (c *Config) validateTunnels() error {
 			if t.SSH.Password == "" && t.SSH.Key == "" {
 				return fmt.Errorf("tunnel '%s': ssh.password or ssh.key is required", t.Tag)
 			}
+			if t.SSH.Obfs != nil && t.SSH.Obfs.Key == "" {
+				return fmt.Errorf("tunnel '%s': ssh.obfs.key is required", t.Tag)
+			}
+		}
+
+		for k, v := range t.Env {
+			if k == "" || strings.ContainsAny(k, "=\x00") || strings.ContainsRune(v, 0) {
+				return fmt.Errorf("tunnel '%s': invalid env variable %q", t.Tag, k)
+			}
+		}
+
+		if l := t.Limits; l != nil {
+			if l.Nice < -20 || l.Nice > 19 {
+				return fmt.Errorf("tunnel '%s': limits.nice must be between -20 and 19", t.Tag)
+			}
+			for _, cpu := range l.CPUs {
+				if cpu < 0 || cpu >= 1024 {
+					return fmt.Errorf("tunnel '%s': invalid CPU %d in limits.cpus", t.Tag, cpu)
+				}
+			}
+			if l.MemoryMB < 0 {
+				return fmt.Errorf("tunnel '%s': limits.memory_mb must not be negative", t.Tag)
+			}
+			if l.CPUPercent < 0 {
+				return fmt.Errorf("tunnel '%s': limits.cpu_percent must not be negative", t.Tag)
+			}
+		}
+
+		if q := t.Quota; q != nil {
+			if q.MonthlyMB <= 0 {
+				return fmt.Errorf("tunnel '%s': quota.monthly_mb must be positive", t.Tag)
+			}
+			if q.WarnPercent < 0 || q.WarnPercent > 100 {
+				return fmt.Errorf("tunnel '%s': quota.warn_percent must be between 1 and 100", t.Tag)
+			}
+		}
+
+		if _, ok := Presets[t.Preset]; t.Preset != "" && !ok {
+			return fmt.Errorf("tunnel '%s': unknown preset %q", t.Tag, t.Preset)
+		}
+
+		if tr := t.Traffic; tr != nil {
+			if t.Transport != TransportSlipstream || t.Backend == BackendShadowsocks {
+				return fmt.Errorf("tunnel '%s': traffic settings are only supported by slipstream with socks or ssh backend", t.Tag)
+			}
+			if tr.KeepAliveMs < 0 || tr.EconomyKeepAliveMs < 0 {
+				return fmt.Errorf("tunnel '%s': traffic intervals must not be negative", t.Tag)
+			}
+			if tr.Economy && tr.KeepAliveMs > 0 && tr.EconomyInterval() < tr.KeepAliveMs {
+				return fmt.Errorf("tunnel '%s': traffic.economy_keepalive_ms must not be shorter than keepalive_ms", t.Tag)
+			}
 		}
 	}
 
@@ -122,6 +210,99 @@ func (c *Config) validateRoute() error {
 			return fmt.Errorf("route.active: tunnel '%s' does not exist", c.Route.Active)
 		}
 	}
+	if c.Route.Standby != "" {
+		if c.GetTunnelByTag(c.Route.Standby) == nil {
+			return fmt.Errorf("route.standby: tunnel '%s' does not exist", c.Route.Standby)
+		}
+		if c.Route.Standby == c.Route.Active {
+			return fmt.Errorf("route.standby: tunnel '%s' is already the active tunnel", c.Route.Standby)
+		}
+	}
+	return nil
+}
+
+// validateListeners validates the extra listeners.
+func (c *Config) validateListeners() error {
+	if c.Listen.MaxPending < 0 {
+		return fmt.Errorf("listen.max_pending must not be negative")
+	}
+	if c.Listen.QueueMS < 0 {
+		return fmt.Errorf("listen.queue_ms must not be negative")
+	}
+	if c.Listen.IdleTimeoutSec < 0 {
+		return fmt.Errorf("listen.idle_timeout_sec must not be negative")
+	}
+	if c.Listen.KeepAliveSec < 0 {
+		return fmt.Errorf("listen.keepalive_sec must not be negative")
+	}
+	if c.Listen.Prewarm < 0 || c.Listen.Prewarm > MaxPrewarm {
+		return fmt.Errorf("listen.prewarm must be between 0 and %d", MaxPrewarm)
+	}
+	if q := c.Listen.QoS; q != nil {
+		for _, p := range append(slices.Clone(q.InteractivePorts), q.BulkPorts...) {
+			if p < 1 || p > 65535 {
+				return fmt.Errorf("listen.qos: invalid port %d", p)
+			}
+		}
+		if q.BulkAfterKB < 0 {
+			return fmt.Errorf("listen.qos.bulk_after_kb must not be negative")
+		}
+	}
+	seen := map[string]bool{c.Listen.SOCKS: true}
+	for i, l := range c.Listen.Extra {
+		if l.SOCKS == "" {
+			return fmt.Errorf("listen.extra[%d]: socks is required", i)
+		}
+		if _, _, err := net.SplitHostPort(l.SOCKS); err != nil {
+			return fmt.Errorf("listen.extra[%d]: invalid address %q", i, l.SOCKS)
+		}
+		if seen[l.SOCKS] {
+			return fmt.Errorf("listen.extra[%d]: address %s is already used", i, l.SOCKS)
+		}
+		seen[l.SOCKS] = true
+		if c.GetTunnelByTag(l.Via) == nil {
+			return fmt.Errorf("listen.extra[%d]: tunnel '%s' does not exist", i, l.Via)
+		}
+	}
+	return nil
+}
+
+// validateBinaries validates the binary search paths and stores.
+func (c *Config) validateBinaries() error {
+	if c.Binaries == nil {
+		return nil
+	}
+	for i, p := range c.Binaries.Paths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("binaries.paths[%d]: %q must be an absolute path", i, p)
+		}
+	}
+	for i, s := range c.Binaries.Stores {
+		if s != "nix" && s != "homebrew" {
+			return fmt.Errorf("binaries.stores[%d]: unknown store %q (want nix or homebrew)", i, s)
+		}
+	}
+	return nil
+}
+
+// validateDisk validates the disk usage caps.
+func (c *Config) validateDisk() error {
+	if c.Disk == nil {
+		return nil
+	}
+	caps := []struct {
+		name string
+		mb   int
+	}{
+		{"logs_mb", c.Disk.LogsMB},
+		{"downloads_mb", c.Disk.DownloadsMB},
+		{"backups_mb", c.Disk.BackupsMB},
+	}
+	for _, cp := range caps {
+		if cp.mb < -1 {
+			return fmt.Errorf("disk.%s must be -1 (no cap), 0 (default) or a size in MB", cp.name)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,131 @@
+// Package crash recovers panics in the daemon's goroutines. A panic is logged
+// with its stack trace and reported to the engine, which shows itself as
+// degraded, instead of taking the daemon down or silently ending a loop such
+// as the gateway's accept loop.
+package crash
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Panic describes a recovered panic.
+type Panic struct {
+	Subsystem string    `json:"subsystem"`
+	Value     string    `json:"value"`
+	Time      time.Time `json:"time"`
+	Restarted bool      `json:"restarted,omitempty"` // the subsystem was started again
+}
+
+const (
+	// restartDelay is how long Supervise waits before running a subsystem
+	// again, so that one panicking at once doesn't spin.
+	restartDelay = time.Second
+	// maxRestarts is how many times in a row Supervise runs a subsystem that
+	// keeps panicking within restartWindow of its previous panic.
+	maxRestarts   = 5
+	restartWindow = time.Minute
+)
+
+var (
+	handlerMu sync.Mutex
+	handler   func(Panic)
+
+	restart atomic.Bool
+)
+
+// SetHandler sets the function told about each recovered panic. It is called
+// after the panic is logged, from the goroutine that panicked.
+func SetHandler(fn func(Panic)) {
+	handlerMu.Lock()
+	defer handlerMu.Unlock()
+	handler = fn
+}
+
+// SetRestart sets whether Supervise starts a subsystem again after it panics.
+func SetRestart(on bool) {
+	restart.Store(on)
+}
+
+// Report logs a value recovered from a panic, with the stack of the current
+// goroutine, and passes it to the handler. It is for deferred functions that
+// recover themselves; most callers want Recover.
+func Report(subsystem string, v any) {
+	report(subsystem, v, debug.Stack(), false)
+}
+
+func report(subsystem string, v any, stack []byte, restarted bool) {
+	slog.Error("recovered from panic", "subsystem", subsystem, "panic", fmt.Sprint(v),
+		"restart", restarted, "stack", string(stack))
+
+	handlerMu.Lock()
+	fn := handler
+	handlerMu.Unlock()
+	if fn != nil {
+		fn(Panic{Subsystem: subsystem, Value: fmt.Sprint(v), Time: time.Now(), Restarted: restarted})
+	}
+}
+
+// Recover recovers a panic in the calling goroutine and reports it. It must
+// be deferred directly:
+//
+//	defer crash.Recover("gateway connection")
+func Recover(subsystem string) {
+	if v := recover(); v != nil {
+		Report(subsystem, v)
+	}
+}
+
+// Go runs fn in a new goroutine, recovering a panic in it.
+func Go(subsystem string, fn func()) {
+	go func() {
+		defer Recover(subsystem)
+		fn()
+	}()
+}
+
+// Supervise runs fn, a long-running loop, until it returns. If fn panics, the
+// panic is reported and, with restarts on and while again reports that the
+// subsystem is still wanted, fn is run again after a short pause. A subsystem
+// that keeps panicking is given up on after a few attempts.
+func Supervise(subsystem string, fn func(), again func() bool) {
+	var last time.Time
+	failures := 0
+	for {
+		v, stack, panicked := run(fn)
+		if !panicked {
+			return
+		}
+		if time.Since(last) > restartWindow {
+			failures = 0
+		}
+		last = time.Now()
+		failures++
+
+		retry := restart.Load() && failures <= maxRestarts && again()
+		report(subsystem, v, stack, retry)
+		if !retry {
+			return
+		}
+		time.Sleep(restartDelay)
+		if !again() {
+			return
+		}
+	}
+}
+
+// run calls fn, returning the value it panicked with and where, if it did.
+func run(fn func()) (v any, stack []byte, panicked bool) {
+	panicked = true
+	defer func() {
+		if panicked {
+			v, stack = recover(), debug.Stack()
+		}
+	}()
+	fn()
+	return nil, nil, false
+}
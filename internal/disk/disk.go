@@ -0,0 +1,157 @@
+// Package disk keeps the files dnstc leaves behind — tunnel logs, leftovers
+// of interrupted downloads and config backups — within the caps set in the
+// disk section of the config, removing the oldest first, so that they can't
+// fill up the few MB of free flash a router has.
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/config"
+)
+
+// Kinds of file, as reported in Usage.Kind.
+const (
+	KindLogs      = "logs"
+	KindDownloads = "downloads"
+	KindBackups   = "backups"
+)
+
+// downloadGrace spares download leftovers this recent, which may belong to
+// a download still in progress.
+const downloadGrace = 10 * time.Minute
+
+// Usage is the space taken up by one kind of file.
+type Usage struct {
+	Kind  string `json:"kind"`
+	Bytes int64  `json:"bytes"`
+	Files int    `json:"files"`
+	Cap   int64  `json:"cap,omitempty"`   // 0 if there is none
+	Freed int64  `json:"freed,omitempty"` // by the Enforce that reported it
+}
+
+// String describes the usage, e.g. "logs 1.2 of 8 MB".
+func (u Usage) String() string {
+	used := float64(u.Bytes) / (1 << 20)
+	if u.Cap == 0 {
+		return fmt.Sprintf("%s %.1f MB", u.Kind, used)
+	}
+	return fmt.Sprintf("%s %.1f of %d MB", u.Kind, used, u.Cap>>20)
+}
+
+// kind is a kind of file and where to find it.
+type kind struct {
+	name  string
+	globs []string
+	cap   int64
+	grace time.Duration // files modified more recently are left alone
+}
+
+// kinds returns the kinds of file kept in check, with their caps.
+func kinds(cfg *config.DiskConfig) []kind {
+	tmp := os.TempDir()
+	downloads := []string{filepath.Join(tmp, "binman-*"), filepath.Join(tmp, "selfupdate-*")}
+	for _, name := range binaries.AllNames() {
+		downloads = append(downloads, filepath.Join(tmp, name+"-extracted-*"))
+	}
+	return []kind{
+		{
+			name:  KindLogs,
+			globs: []string{filepath.Join(config.LogDir(), "*.log"), filepath.Join(config.LogDir(), "*.log.1")},
+			cap:   cfg.LogsCap(),
+		},
+		{name: KindDownloads, globs: downloads, cap: cfg.DownloadsCap(), grace: downloadGrace},
+		{name: KindBackups, globs: []string{filepath.Join(config.ConfigDir(), "*.backup")}, cap: cfg.BackupsCap()},
+	}
+}
+
+// file is a file counted towards a cap.
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// find returns the files of a kind, oldest first.
+func (k kind) find() []file {
+	var files []file
+	for _, g := range k.globs {
+		matches, _ := filepath.Glob(g)
+		for _, p := range matches {
+			info, err := os.Stat(p)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, file{path: p, size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+	slices.SortFunc(files, func(a, b file) int { return a.modTime.Compare(b.modTime) })
+	return files
+}
+
+// Measure reports the space each kind of file takes up.
+func Measure(cfg *config.DiskConfig) []Usage {
+	var out []Usage
+	for _, k := range kinds(cfg) {
+		u := Usage{Kind: k.name, Cap: k.cap}
+		for _, f := range k.find() {
+			u.Bytes += f.size
+			u.Files++
+		}
+		out = append(out, u)
+	}
+	return out
+}
+
+// Enforce brings each kind of file that is over its cap back under it,
+// oldest files first, and reports the space taken up afterwards. Tunnel
+// logs are truncated rather than removed, as the transports keep them open
+// and removing them would free nothing.
+func Enforce(cfg *config.DiskConfig) ([]Usage, error) {
+	var out []Usage
+	var errs []error
+	for _, k := range kinds(cfg) {
+		u := Usage{Kind: k.name, Cap: k.cap}
+		files := k.find()
+		for _, f := range files {
+			u.Bytes += f.size
+			u.Files++
+		}
+		for _, f := range files {
+			if k.cap == 0 || u.Bytes <= k.cap {
+				break
+			}
+			if k.grace > 0 && time.Since(f.modTime) < k.grace {
+				continue
+			}
+			removed, err := release(f.path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			u.Bytes -= f.size
+			u.Freed += f.size
+			if removed {
+				u.Files--
+			}
+		}
+		out = append(out, u)
+	}
+	return out, errors.Join(errs...)
+}
+
+// release frees the space a file takes up: a live log is truncated in
+// place, anything else removed. It reports whether the file was removed.
+func release(path string) (bool, error) {
+	if strings.HasSuffix(path, ".log") {
+		return false, os.Truncate(path, 0)
+	}
+	return true, os.Remove(path)
+}
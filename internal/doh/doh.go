@@ -0,0 +1,205 @@
+// Package doh reaches DNS-over-HTTPS upstreams, optionally through a domain
+// front: the TLS server name and the address connected to can differ from
+// the host in the URL, which is still sent as the HTTP Host. A Forwarder
+// serves an upstream on a local UDP port, so transports that only speak
+// plain DNS can use it as their resolver.
+package doh
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/crash"
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+const (
+	// exchangeTimeout bounds one query, including connecting.
+	exchangeTimeout = 10 * time.Second
+	// maxMessage is the largest DNS message relayed.
+	maxMessage = 65535
+)
+
+// Client sends DNS queries to one DoH upstream.
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// NewClient returns a client for an upstream.
+func NewClient(d config.DoHConfig) (*Client, error) {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, err
+	}
+	serverName := u.Hostname()
+	if d.SNI != "" {
+		serverName = d.SNI
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+	if d.IP != "" {
+		addr = d.IP
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(d.IP, "443")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: exchangeTimeout}
+	tr := &http.Transport{
+		ForceAttemptHTTP2: true,
+		TLSClientConfig:   &tls.Config{ServerName: serverName, NextProtos: []string{"h2", "http/1.1"}},
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		IdleConnTimeout: 90 * time.Second,
+	}
+	return &Client{url: d.URL, http: &http.Client{Transport: tr, Timeout: exchangeTimeout}}, nil
+}
+
+// Exchange sends a DNS message and returns the answer.
+func (c *Client) Exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMessage))
+}
+
+// Close drops the client's idle connections.
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// Probe checks that an upstream forwards queries for names under domain, by
+// asking for a random (uncached) subdomain, as probe.ProbeResolver does for
+// plain resolvers.
+func Probe(ctx context.Context, d config.DoHConfig, domain string) (time.Duration, error) {
+	c, err := NewClient(d)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	id := uint16(rand.IntN(0x10000))
+	query, err := probe.BuildQuery(id, fmt.Sprintf("probe-%08x.%s", rand.Uint32(), domain), probe.TypeTXT)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	answer, err := c.Exchange(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	resp, err := probe.ParseResponse(answer, id)
+	if err != nil {
+		return 0, fmt.Errorf("invalid answer: %w", err)
+	}
+	if resp.RCode == probe.RCodeServFail || resp.RCode == probe.RCodeRefused {
+		return 0, fmt.Errorf("upstream returned %s", probe.RCodeName(resp.RCode))
+	}
+	return rtt, nil
+}
+
+// Forwarder answers plain DNS queries on a local UDP port through a DoH
+// upstream.
+type Forwarder struct {
+	conn   net.PacketConn
+	client atomic.Pointer[Client]
+	wg     sync.WaitGroup
+}
+
+// NewForwarder starts forwarding an upstream on a random loopback port.
+func NewForwarder(d config.DoHConfig) (*Forwarder, error) {
+	c, err := NewClient(d)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	f := &Forwarder{conn: conn}
+	f.client.Store(c)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		crash.Supervise("doh forwarder", f.serve, func() bool { return true })
+	}()
+	return f, nil
+}
+
+// Addr returns the local address to use as the resolver.
+func (f *Forwarder) Addr() string {
+	return f.conn.LocalAddr().String()
+}
+
+// Update switches the forwarder to a changed upstream, keeping its address.
+func (f *Forwarder) Update(d config.DoHConfig) error {
+	c, err := NewClient(d)
+	if err != nil {
+		return err
+	}
+	if old := f.client.Swap(c); old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close stops the forwarder.
+func (f *Forwarder) Close() {
+	f.conn.Close()
+	f.wg.Wait()
+	f.client.Load().Close()
+}
+
+func (f *Forwarder) serve() {
+	buf := make([]byte, maxMessage)
+	for {
+		n, from, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		msg := bytes.Clone(buf[:n])
+		go func() {
+			defer crash.Recover("doh query")
+			ctx, cancel := context.WithTimeout(context.Background(), exchangeTimeout)
+			defer cancel()
+			answer, err := f.client.Load().Exchange(ctx, msg)
+			if err != nil {
+				slog.Debug("doh query failed", "error", err)
+				return
+			}
+			f.conn.WriteTo(answer, from)
+		}()
+	}
+}
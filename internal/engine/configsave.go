@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// configSaveDelay is how long the engine waits for further changes before
+// saving the config, so that a burst of them, e.g. from rapid TUI actions,
+// is written once.
+const configSaveDelay = 500 * time.Millisecond
+
+// configSaver saves the engine's config in the background, off the paths
+// that hold e.mu for writing. Saves are serialized, and each writes the
+// config as it is then.
+type configSaver struct {
+	save func() error // writes the config; takes e.mu for reading
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending bool
+
+	writeMu sync.Mutex // held across a save; taken before e.mu
+}
+
+// schedule saves the config after configSaveDelay without further changes.
+// It may be called with e.mu held.
+func (s *configSaver) schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = true
+	if s.timer == nil {
+		s.timer = time.AfterFunc(configSaveDelay, s.flush)
+	} else {
+		s.timer.Reset(configSaveDelay)
+	}
+}
+
+// flush saves the config now if a save is pending. It must not be called
+// with e.mu held.
+func (s *configSaver) flush() {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = false
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+
+	if !pending {
+		return
+	}
+	if err := s.save(); err != nil {
+		slog.Warn("failed to save config", "error", err)
+	}
+}
+
+// saveConfig writes the user's config to disk, without the policy applied.
+func (e *Engine) saveConfig() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.saved.Save()
+}
+
+// FlushConfig writes a pending config change to disk now instead of after
+// configSaveDelay, e.g. before a client reads the file.
+func (e *Engine) FlushConfig() {
+	e.saver.flush()
+}
+
+// FlushConfig writes the in-process engine's pending config change, if any,
+// so that the config file loaded next includes it.
+func FlushConfig() {
+	if e, ok := Get().(*Engine); ok {
+		e.FlushConfig()
+	}
+}
@@ -1,18 +1,35 @@
 package engine
 
-import "github.com/net2share/dnstc/internal/config"
+import (
+	"context"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/process"
+)
 
 // EngineController defines the interface for controlling the engine.
 // Both *Engine (local) and the IPC client implement this.
+//
+// Every method takes a context; its deadline bounds how long the caller
+// waits, and over IPC it is sent along so the daemon gives up too.
 type EngineController interface {
-	Start() error
-	Stop() error
-	StartTunnel(tag string) error
-	StopTunnel(tag string) error
-	RestartTunnel(tag string) error
-	ActivateTunnel(tag string) error
-	Status() *Status
-	GetConfig() *config.Config
-	ReloadConfig() error
-	IsConnected() bool
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	StartTunnel(ctx context.Context, tag string) error
+	StopTunnel(ctx context.Context, tag string) error
+	RestartTunnel(ctx context.Context, tag string) error
+	ActivateTunnel(ctx context.Context, tag string) error
+	OverrideActive(ctx context.Context, tag string) error
+	Status(ctx context.Context) *Status
+	GetConfig(ctx context.Context) *config.Config
+	ReloadConfig(ctx context.Context) error
+	IsConnected(ctx context.Context) bool
+	Gateway(ctx context.Context) (*GatewayInfo, error)
+	RestartGateway(ctx context.Context) error
+	StopGateway(ctx context.Context) error
+	StartGateway(ctx context.Context) error
+	StopTunnels(ctx context.Context) error
+	SetGatewayAddr(ctx context.Context, addr string) error
+	History(ctx context.Context, tag string) (History, error)
+	RotateLogs(ctx context.Context, keep bool) (process.Rotation, error)
 }
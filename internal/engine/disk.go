@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/net2share/dnstc/internal/disk"
+)
+
+// diskCheckInterval is how often the disk caps are enforced.
+const diskCheckInterval = time.Minute
+
+// checkDisk enforces the disk caps, at most once every diskCheckInterval.
+// It is called from the status refresher only.
+func (e *Engine) checkDisk() {
+	now := e.clock.Now()
+	if now.Sub(e.diskChecked) < diskCheckInterval {
+		return
+	}
+	e.diskChecked = now
+
+	e.mu.RLock()
+	caps := e.cfg.Disk
+	e.mu.RUnlock()
+
+	usage, err := disk.Enforce(caps)
+	if err != nil {
+		slog.Warn("failed to free disk space", "error", err)
+	}
+	for _, u := range usage {
+		if u.Freed > 0 {
+			slog.Warn("disk cap reached; freed oldest files", "kind", u.Kind, "freed", u.Freed, "cap", u.Cap)
+		}
+	}
+	e.disk.Store(&usage)
+}
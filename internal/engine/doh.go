@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/doh"
+)
+
+// dohForwarder serves a DoH upstream on a local UDP port for the tunnels
+// that use it as their resolver.
+type dohForwarder struct {
+	*doh.Forwarder
+	cfg config.DoHConfig
+}
+
+// resolverAddrLocked returns the address to give a transport for a
+// resolver: the resolver itself, or for a "doh:<name>" one the local
+// forwarder of that upstream, started if it isn't yet. Caller must hold e.mu.
+func (e *Engine) resolverAddrLocked(resolver string) (string, error) {
+	name, ok := config.DoHName(resolver)
+	if !ok {
+		return resolver, nil
+	}
+	if f := e.doh[name]; f != nil {
+		return f.Addr(), nil
+	}
+	d := e.cfg.GetDoH(name)
+	if d == nil {
+		return "", fmt.Errorf("no doh upstream named '%s'", name)
+	}
+	f, err := doh.NewForwarder(*d)
+	if err != nil {
+		return "", fmt.Errorf("failed to start DoH forwarder for '%s': %w", name, err)
+	}
+	slog.Info("started DoH forwarder", "name", name, "url", d.URL, "sni", d.SNI, "ip", d.IP, "addr", f.Addr())
+	e.doh[name] = &dohForwarder{Forwarder: f, cfg: *d}
+	return f.Addr(), nil
+}
+
+// syncDoHLocked updates the running forwarders to the DoH upstreams in the
+// config, keeping their addresses so the tunnels using them carry on, and
+// stops those of upstreams that were removed. Caller must hold e.mu.
+func (e *Engine) syncDoHLocked() {
+	for name, f := range e.doh {
+		d := e.cfg.GetDoH(name)
+		switch {
+		case d == nil:
+			f.Close()
+			delete(e.doh, name)
+		case *d != f.cfg:
+			if err := f.Update(*d); err != nil {
+				slog.Warn("failed to update DoH forwarder", "name", name, "error", err)
+				continue
+			}
+			f.cfg = *d
+		}
+	}
+}
+
+// stopDoHLocked stops every forwarder. Caller must hold e.mu.
+func (e *Engine) stopDoHLocked() {
+	for name, f := range e.doh {
+		f.Close()
+		delete(e.doh, name)
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/net2share/dnstc/internal/config"
+)
+
+// economyIdle is how long the gateway must go without connections before
+// tunnels with traffic.economy switch to their economy keep-alive interval.
+const economyIdle = 2 * time.Minute
+
+// wakeTimeout bounds how long a new connection waits for a tunnel leaving
+// economy mode to accept connections again.
+const wakeTimeout = 10 * time.Second
+
+// wake records gateway activity and takes tag out of economy mode, waiting
+// for its restarted transport to become ready. Called per connection.
+func (e *Engine) wake(tag string) {
+	e.lastConn.Store(e.clock.Now().UnixNano())
+	if !e.targetCache().asleep[tag] {
+		return
+	}
+
+	e.mu.Lock()
+	if e.economy[tag] {
+		slog.Info("gateway connection; leaving economy mode", "tag", tag)
+		if err := e.switchEconomyLocked(tag, false); err != nil {
+			slog.Warn("failed to leave economy mode", "tag", tag, "error", err)
+		}
+	}
+	e.mu.Unlock()
+
+	deadline := time.Now().Add(wakeTimeout)
+	for time.Now().Before(deadline) {
+		e.mu.RLock()
+		ready := e.procMgr.IsReady("tunnel-"+tag) && e.tunnelTargetLocked(tag) != ""
+		e.mu.RUnlock()
+		if ready {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	slog.Warn("tunnel not ready after leaving economy mode", "tag", tag)
+}
+
+// checkEconomy switches tunnels with traffic.economy to the economy interval
+// once the gateway and extra listeners have been idle for economyIdle. The
+// standby tunnel is left alone, so it can take over without a restart.
+func (e *Engine) checkEconomy() {
+	if e.clock.Now().Sub(time.Unix(0, e.lastConn.Load())) < economyIdle {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.activeConnsLocked() > 0 {
+		return
+	}
+	for _, tc := range e.cfg.Tunnels {
+		if tc.Traffic == nil || !tc.Traffic.Economy || e.economy[tc.Tag] || tc.Tag == e.cfg.Route.Standby ||
+			!e.procMgr.IsReady("tunnel-"+tc.Tag) {
+			continue
+		}
+		slog.Info("gateway idle; entering economy mode", "tag", tc.Tag, "keepalive_ms", tc.Traffic.EconomyInterval())
+		if err := e.switchEconomyLocked(tc.Tag, true); err != nil {
+			slog.Warn("failed to enter economy mode", "tag", tc.Tag, "error", err)
+		}
+	}
+}
+
+// switchEconomyLocked restarts a tunnel's transport with or without the
+// economy keep-alive interval. Caller must hold e.mu.
+func (e *Engine) switchEconomyLocked(tag string, on bool) error {
+	if err := e.stopTunnelLocked(tag); err != nil {
+		return err
+	}
+	if on {
+		e.economy[tag] = true
+	}
+
+	// A mode switch is not a restart
+	starts := e.starts[tag]
+	err := e.startTunnelLocked(context.Background(), tag)
+	e.starts[tag] = starts
+	e.publishStatusLocked()
+	return err
+}
+
+// activeConnsLocked returns the number of connections open through the
+// gateway and the extra listeners. Caller must hold e.mu.
+func (e *Engine) activeConnsLocked() int {
+	n := 0
+	if e.gw != nil {
+		n += e.gw.Active()
+	}
+	for _, l := range e.listeners {
+		n += l.gw.Active()
+	}
+	return n
+}
+
+// economize returns tc with the keep-alive interval of economy mode.
+func economize(tc config.TunnelConfig) config.TunnelConfig {
+	traffic := *tc.Traffic
+	traffic.KeepAliveMs = traffic.EconomyInterval()
+	tc.Traffic = &traffic
+	return tc
+}
@@ -3,17 +3,27 @@
 package engine
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/net2share/dnstc/internal/binaries"
 	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/crash"
+	"github.com/net2share/dnstc/internal/disk"
 	"github.com/net2share/dnstc/internal/gateway"
 	"github.com/net2share/dnstc/internal/port"
 	"github.com/net2share/dnstc/internal/process"
+	"github.com/net2share/dnstc/internal/secrets"
 	"github.com/net2share/dnstc/internal/sshtunnel"
 	"github.com/net2share/dnstc/internal/transport"
 )
@@ -40,9 +50,24 @@ func Get() EngineController {
 
 // Status represents the current state of all tunnels and the gateway.
 type Status struct {
-	Active      string                   `json:"active"`
-	GatewayAddr string                   `json:"gateway_addr"`
-	Tunnels     map[string]*TunnelStatus `json:"tunnels"`
+	Active         string                   `json:"active"`
+	ActiveOverride bool                     `json:"active_override,omitempty"` // Active is set for this daemon run only, not in route.active
+	Standby        string                   `json:"standby,omitempty"`
+	Routing        string                   `json:"routing,omitempty"` // the standby, while it carries new connections for Active
+	GatewayAddr    string                   `json:"gateway_addr"`
+	GatewayBusy    string                   `json:"gateway_busy,omitempty"`    // configured address that was taken, if the gateway moved off it
+	GatewayBusyBy  string                   `json:"gateway_busy_by,omitempty"` // the process holding it, if known
+	GatewayHeld    bool                     `json:"gateway_held,omitempty"`    // stopped on request while tunnels keep running
+	Refused        int64                    `json:"refused,omitempty"`         // connections turned away while the tunnel was saturated
+	Tunnels        map[string]*TunnelStatus `json:"tunnels"`
+	Listeners      []ListenerStatus         `json:"listeners,omitempty"`
+
+	// Degraded is set once a panic was recovered in one of the daemon's
+	// subsystems; Panics lists the most recent ones.
+	Degraded bool          `json:"degraded,omitempty"`
+	Panics   []crash.Panic `json:"panics,omitempty"`
+
+	Disk []disk.Usage `json:"disk,omitempty"` // space taken up by logs, download leftovers and backups
 }
 
 // TunnelStatus represents the status of a single tunnel.
@@ -53,32 +78,187 @@ type TunnelStatus struct {
 	Domain    string               `json:"domain"`
 	Running   bool                 `json:"running"`
 	Active    bool                 `json:"active"`
+	Standby   bool                 `json:"standby,omitempty"`
 	Port      int                  `json:"port"`
+	Ready     bool                 `json:"ready"`           // running and accepting connections
+	Error     string               `json:"error,omitempty"` // why the process last exited, if it crashed
+	Started   time.Time            `json:"started,omitzero"`
+	Restarts  int                  `json:"restarts,omitempty"` // starts since the engine came up, minus one
+	Economy   bool                 `json:"economy,omitempty"`  // running with the economy keep-alive interval
+	Usage     int64                `json:"usage,omitempty"`    // bytes relayed through the gateway this month
+	Quota     int64                `json:"quota,omitempty"`    // monthly quota in bytes, if set
+	Health    *Health              `json:"health,omitempty"`
+	RateUp    int64                `json:"rate_up,omitempty"`   // bytes per second towards the tunnel, over the last few seconds
+	RateDown  int64                `json:"rate_down,omitempty"` // bytes per second from the tunnel
+
+	Metrics *transport.Metrics `json:"metrics,omitempty"` // sessions and streams, from the transport's log where it logs them
+
+	UsingDomain   string `json:"using_domain,omitempty"`   // fallback domain in use, the primary looked blocked
+	UsingResolver string `json:"using_resolver,omitempty"` // fallback resolver in use, the primary stopped answering
+
+	ConnErrors    int64  `json:"conn_errors,omitempty"`     // SSH backend: connections that failed the handshake or could not be opened
+	LastConnError string `json:"last_conn_error,omitempty"` // the last of those errors
 }
 
+// statusRefreshInterval is how often the status snapshot is rebuilt to pick
+// up SSH sessions that dropped. Process exits are reported by the process
+// manager and published immediately.
+const statusRefreshInterval = 2 * time.Second
+
+// startGrace is how long starting a tunnel waits for the transport process to
+// become ready, so that immediate failures (e.g. usage errors) are reported to
+// the caller. Slower transports keep starting in the background.
+const startGrace = 500 * time.Millisecond
+
 // Engine manages the full dnstc runtime: tunnel processes and gateway.
 type Engine struct {
-	cfg        *config.Config
-	procMgr    *process.Manager
-	gw         *gateway.Gateway
-	sshTunnels map[string]*sshtunnel.Tunnel
-	mu         sync.RWMutex
+	cfg          *config.Config // saved with the system policy applied over it
+	saved        *config.Config // the user's config, as written back by saver
+	policy       *config.Policy
+	loadPolicy   func() (*config.Policy, error)
+	procMgr      ProcessManager
+	newGw        func(addr string, target func() string) *gateway.Gateway
+	clock        Clock
+	historyPath  string
+	gw           *gateway.Gateway
+	sshTunnels   map[string]*sshtunnel.Tunnel
+	health       *healthMonitor
+	refreshCh    chan struct{} // closed to stop the status refresher
+	listeners    []pinnedListener
+	starts       map[string]int // tunnel starts per tag, for Restarts
+	inherited    *inheritedGateway
+	gwBusy       string          // configured gateway address found taken at start
+	gwBusyBy     string          // the process holding gwBusy
+	gwHeld       bool            // gateway stopped with StopGateway, see startGatewayLocked
+	economy      map[string]bool // tunnels running with the economy keep-alive interval
+	lastConn     atomic.Int64    // unix nanos of the last gateway connection
+	usage        *usage
+	quotaLevel   map[string]int  // quota warnings logged this month
+	quotaStopped map[string]bool // tunnels stopped until next month
+	rotation     map[string]*rotation
+	doh          map[string]*dohForwarder // by upstream name, see resolverAddrLocked
+	history      *history
+	rates        *rateMeter
+	metrics      *transportMetrics
+	statusFile   statusFile
+	saver        *configSaver
+	mu           sync.RWMutex
+
+	panicsMu sync.Mutex
+	panics   []crash.Panic // recovered panics, see onPanic
+
+	activeOverride string // replaces route.active until the daemon restarts, see OverrideActive
+
+	failedOver atomic.Bool // routing through the standby, see logFailover
+
+	disk        atomic.Pointer[[]disk.Usage] // after the last checkDisk
+	diskChecked time.Time                    // set by the status refresher only
+
+	targets   atomic.Pointer[targetCache]
+	targetGen atomic.Uint64
+
+	// status is the last published snapshot, read lock-free by Status.
+	status atomic.Pointer[Status]
 }
 
 // New creates a new engine with the given configuration.
 func New(cfg *config.Config) *Engine {
-	return &Engine{
-		cfg:        cfg,
-		procMgr:    process.NewManager(config.StatePath()),
-		sshTunnels: make(map[string]*sshtunnel.Tunnel),
+	return NewWithOptions(cfg, Options{})
+}
+
+// NewWithOptions creates a new engine with the given configuration and
+// dependencies.
+func NewWithOptions(cfg *config.Config, opts Options) *Engine {
+	if opts.Processes == nil {
+		opts.Processes = process.NewManager(config.StatePath())
+	}
+	if opts.NewGateway == nil {
+		opts.NewGateway = gateway.New
+	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+	if opts.UsagePath == "" {
+		opts.UsagePath = config.UsagePath()
+	}
+	if opts.HistoryPath == "" {
+		opts.HistoryPath = config.HistoryPath()
 	}
+	if opts.Policy == nil {
+		opts.Policy = config.LoadPolicy
+	}
+	policy, err := opts.Policy()
+	if err != nil {
+		slog.Warn("ignoring system policy", "error", err)
+	}
+	saved := cfg
+	cfg = policy.Apply(saved)
+
+	e := &Engine{
+		cfg:          cfg,
+		saved:        saved,
+		policy:       policy,
+		loadPolicy:   opts.Policy,
+		procMgr:      opts.Processes,
+		newGw:        opts.NewGateway,
+		clock:        opts.Clock,
+		historyPath:  opts.HistoryPath,
+		sshTunnels:   make(map[string]*sshtunnel.Tunnel),
+		starts:       make(map[string]int),
+		economy:      make(map[string]bool),
+		usage:        loadUsage(opts.UsagePath, opts.Clock),
+		quotaLevel:   make(map[string]int),
+		quotaStopped: make(map[string]bool),
+		rotation:     make(map[string]*rotation),
+		doh:          make(map[string]*dohForwarder),
+		rates:        newRateMeter(opts.Clock),
+		metrics:      newTransportMetrics(),
+	}
+	historyPath := ""
+	if cfg.KeepHistory {
+		historyPath = e.historyPath
+	}
+	e.history = loadHistory(historyPath, opts.Clock)
+	e.saver = &configSaver{save: e.saveConfig}
+	e.lastConn.Store(e.clock.Now().UnixNano())
+	binaries.SetResolver(binaries.NewResolver(cfg.Binaries))
+	crash.SetRestart(cfg.RestartOnPanic)
+	crash.SetHandler(e.onPanic)
+	e.health = newHealthMonitor(e.refreshStatus)
+	e.procMgr.SetLivenessCallback(e.onLivenessChanged)
+	e.publishStatusLocked()
+	return e
 }
 
-// Start starts all enabled tunnels and the gateway.
-func (e *Engine) Start() error {
+// onLivenessChanged is called by the process manager when a tunnel process
+// exits on its own. It tears down dependent state and publishes the new status.
+func (e *Engine) onLivenessChanged(name string, running bool) {
+	tag, ok := strings.CutPrefix(name, "tunnel-")
+	if !ok || running {
+		return
+	}
+	slog.Warn("tunnel exited unexpectedly", "tag", tag)
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	// The SSH session rides on the transport process, so it's gone too
+	if st, ok := e.sshTunnels[tag]; ok {
+		st.Stop()
+		delete(e.sshTunnels, tag)
+	}
+	e.health.forget(tag)
+	e.publishStatusLocked()
+}
+
+// Start starts all enabled tunnels and the gateway.
+func (e *Engine) Start(ctx context.Context) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
 	// Start gateway
 	if err := e.startGatewayLocked(); err != nil {
 		return fmt.Errorf("failed to start gateway: %w", err)
@@ -89,20 +269,111 @@ func (e *Engine) Start() error {
 		if !tc.IsEnabled() {
 			continue
 		}
-		if err := e.startTunnelLocked(tc.Tag); err != nil {
+		if err := e.startTunnelLocked(ctx, tc.Tag); err != nil {
 			// Log but don't fail — start as many as possible
-			fmt.Printf("warning: failed to start tunnel %q: %v\n", tc.Tag, err)
+			slog.Warn("failed to start tunnel", "tag", tc.Tag, "error", err)
 		}
 	}
 
+	e.startRefresherLocked()
+	e.health.start(e.healthTargets)
 	return nil
 }
 
-// Stop stops all tunnels and the gateway.
-func (e *Engine) Stop() error {
+// AdoptOrphans reattaches tunnel processes left running by a previous daemon
+// (e.g. across an upgrade) so their connectivity is preserved. A process is
+// adopted only if it is still running the exact command the current config
+// would start; everything else is stopped. Returns the adopted tunnel tags.
+//
+// SSH backend tunnels are never adopted: their SSH session lived inside the
+// previous daemon, so the transport process is restarted along with it.
+func (e *Engine) AdoptOrphans() []string {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	var adopted []string
+	for _, info := range e.procMgr.Adopted() {
+		tag := strings.TrimPrefix(info.Name, "tunnel-")
+		if reason := e.adoptMismatchLocked(tag, info); reason != "" {
+			slog.Info("stopping orphan process", "name", info.Name, "pid", info.PID, "reason", reason)
+			e.procMgr.Stop(info.Name)
+			continue
+		}
+		slog.Info("adopted tunnel", "tag", tag, "pid", info.PID)
+		adopted = append(adopted, tag)
+	}
+	return adopted
+}
+
+// adoptMismatchLocked returns why an orphan process can't be adopted, or "" if it can.
+func (e *Engine) adoptMismatchLocked(tag string, info process.ProcessInfo) string {
+	tc := e.cfg.GetTunnelByTag(tag)
+	switch {
+	case tc == nil:
+		return "tunnel no longer configured"
+	case !tc.IsEnabled():
+		return "tunnel disabled"
+	case tc.Backend == config.BackendSSH:
+		return "SSH sessions can't be reattached"
+	// Only Linux exposes a process's command line; elsewhere the PID being
+	// alive, as Adopted checks, has to do
+	case runtime.GOOS == "linux" && !process.MatchesCommand(info):
+		return "process no longer matches recorded command"
+	}
+
+	t, err := transport.Get(tc.Transport)
+	if err != nil {
+		return err.Error()
+	}
+	resolved, err := secrets.Resolve(*tc)
+	if err != nil {
+		return err.Error()
+	}
+	resolver, err := e.resolverAddrLocked(e.cfg.GetResolver(tc))
+	if err != nil {
+		return err.Error()
+	}
+	binary, args, err := t.BuildArgs(&resolved, e.exposedPortLocked(tc), resolver)
+	if err != nil {
+		return err.Error()
+	}
+	if binary != info.Binary || !slices.Equal(args, info.Args) {
+		return "config changed since it was started"
+	}
+	return ""
+}
+
+// Stop stops all tunnels and the gateway.
+func (e *Engine) Stop(ctx context.Context) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.saver.flush() // once unlocked
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	e.health.stop()
+	if e.refreshCh != nil {
+		close(e.refreshCh)
+		e.refreshCh = nil
+	}
+
+	e.stopTunnelsLocked()
+
+	// Stop gateway
+	e.stopGatewayLocked()
+	e.stopDoHLocked()
+	e.usage.save(true)
+	if e.cfg.KeepHistory {
+		e.history.save(e.historyPath)
+	}
+
+	return nil
+}
 
+// stopTunnelsLocked stops every tunnel's SSH session and transport process.
+func (e *Engine) stopTunnelsLocked() {
 	// Stop SSH tunnels first (they depend on transport processes)
 	for tag, st := range e.sshTunnels {
 		st.Stop()
@@ -111,103 +382,275 @@ func (e *Engine) Stop() error {
 
 	// Stop all tunnel processes
 	e.procMgr.StopAll()
-
-	// Stop gateway
-	if e.gw != nil {
-		e.gw.Stop()
-		e.gw = nil
+	for _, tc := range e.cfg.Tunnels {
+		e.health.forget(tc.Tag)
+		e.metrics.forget(tc.Tag)
+		delete(e.economy, tc.Tag)
 	}
-
-	return nil
 }
 
 // StartTunnel starts a specific tunnel by tag.
-func (e *Engine) StartTunnel(tag string) error {
-	e.mu.Lock()
+func (e *Engine) StartTunnel(ctx context.Context, tag string) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
 	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
 
-	if err := e.startTunnelLocked(tag); err != nil {
+	if err := e.startTunnelLocked(ctx, tag); err != nil {
 		return err
 	}
 
-	// Ensure gateway is running
-	if e.gw == nil {
+	// Ensure gateway is running, unless it was stopped on its own
+	if e.gw == nil && !e.gwHeld {
 		if err := e.startGatewayLocked(); err != nil {
 			return fmt.Errorf("tunnel started but gateway failed: %w", err)
 		}
 	}
 
+	e.startRefresherLocked()
+	e.health.start(e.healthTargets)
 	return nil
 }
 
 // StopTunnel stops a specific tunnel by tag.
-func (e *Engine) StopTunnel(tag string) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	// Stop SSH tunnel first (depends on transport process)
-	if st, ok := e.sshTunnels[tag]; ok {
-		st.Stop()
-		delete(e.sshTunnels, tag)
+func (e *Engine) StopTunnel(ctx context.Context, tag string) error {
+	if err := e.lock(ctx); err != nil {
+		return err
 	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
 
-	processName := "tunnel-" + tag
-	if err := e.procMgr.Stop(processName); err != nil {
+	if err := e.stopTunnelLocked(tag); err != nil {
 		return err
 	}
 
-	// If no tunnels are running, stop the gateway
-	if !e.hasRunningTunnelsLocked() && e.gw != nil {
-		e.gw.Stop()
-		e.gw = nil
+	// If no tunnels are running, stop the gateway, unless the policy's kill
+	// switch keeps it up
+	if !e.hasRunningTunnelsLocked() && !e.policy.KeepsGateway() {
+		e.stopGatewayLocked()
 	}
 
 	return nil
 }
 
 // RestartTunnel restarts a specific tunnel by tag.
-func (e *Engine) RestartTunnel(tag string) error {
-	e.mu.Lock()
+func (e *Engine) RestartTunnel(ctx context.Context, tag string) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
 	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
 
-	// Stop SSH tunnel if running
+	e.stopTunnelLocked(tag)
+	return e.startTunnelLocked(ctx, tag)
+}
+
+// stopTunnelLocked stops a tunnel's SSH session and transport process.
+func (e *Engine) stopTunnelLocked(tag string) error {
+	// Stop SSH tunnel first (depends on transport process)
 	if st, ok := e.sshTunnels[tag]; ok {
 		st.Stop()
 		delete(e.sshTunnels, tag)
 	}
 
-	processName := "tunnel-" + tag
-	e.procMgr.Stop(processName)
-
-	return e.startTunnelLocked(tag)
+	e.health.forget(tag)
+	e.metrics.forget(tag)
+	delete(e.economy, tag)
+	return e.procMgr.Stop("tunnel-" + tag)
 }
 
-// ActivateTunnel sets a tunnel as the active route and saves config.
-func (e *Engine) ActivateTunnel(tag string) error {
-	e.mu.Lock()
+// ActivateTunnel sets a tunnel as the active route. The config is saved in
+// the background.
+func (e *Engine) ActivateTunnel(ctx context.Context, tag string) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
 	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
 
 	tc := e.cfg.GetTunnelByTag(tag)
 	if tc == nil {
 		return fmt.Errorf("tunnel %q not found", tag)
 	}
 
-	e.cfg.Route.Active = tag
-	return e.cfg.Save()
+	e.cfg.Route.Activate(tag)
+	e.saved.Route.Activate(tag)
+	e.activeOverride = ""
+	e.saver.schedule()
+	return nil
+}
+
+// OverrideActive routes the gateway through a tunnel until the daemon
+// restarts, without changing route.active in the config. An empty tag, or
+// the configured active tunnel, removes the override.
+func (e *Engine) OverrideActive(ctx context.Context, tag string) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	if tag != "" && e.cfg.GetTunnelByTag(tag) == nil {
+		return fmt.Errorf("tunnel %q not found", tag)
+	}
+	if tag == e.cfg.Route.Active {
+		tag = ""
+	}
+	e.activeOverride = tag
+	return nil
+}
+
+// activeLocked returns the tunnel the gateway routes through: the runtime
+// override if there is one, otherwise route.active. Caller must hold e.mu.
+func (e *Engine) activeLocked() string {
+	if e.activeOverride != "" {
+		return e.activeOverride
+	}
+	return e.cfg.Route.Active
 }
 
 // Status returns the current status of all tunnels and the gateway.
-func (e *Engine) Status() *Status {
+// It reads the last published snapshot and never blocks on the engine lock.
+func (e *Engine) Status(ctx context.Context) *Status {
+	return e.status.Load().clone()
+}
+
+// GatewayNotice explains that the gateway is not on its configured port,
+// or returns "" if it is.
+func (s *Status) GatewayNotice() string {
+	if s.GatewayBusy == "" {
+		return ""
+	}
+	by := ""
+	if s.GatewayBusyBy != "" {
+		by = " by " + s.GatewayBusyBy
+	}
+	return fmt.Sprintf("%s was in use%s, so the gateway listens on %s instead; point SOCKS clients at the new address",
+		s.GatewayBusy, by, s.GatewayAddr)
+}
+
+// PanicNotice explains that the engine is degraded by a recovered panic, or
+// returns "" if none was.
+func (s *Status) PanicNotice() string {
+	if !s.Degraded || len(s.Panics) == 0 {
+		return ""
+	}
+	last := s.Panics[len(s.Panics)-1]
+	state := "it is stopped"
+	if last.Restarted {
+		state = "it was restarted"
+	}
+	return fmt.Sprintf("degraded: the %s panicked at %s (%s) and %s; see the daemon log for the stack trace",
+		last.Subsystem, last.Time.Format(time.TimeOnly), last.Value, state)
+}
+
+// FallbackNotice explains that the tunnel runs on a fallback domain or
+// resolver, or returns "" if it runs on the configured ones.
+func (ts *TunnelStatus) FallbackNotice() string {
+	switch {
+	case ts.UsingDomain != "" && ts.UsingResolver != "":
+		return fmt.Sprintf("tunnel '%s' switched to fallback domain %s via resolver %s", ts.Tag, ts.UsingDomain, ts.UsingResolver)
+	case ts.UsingDomain != "":
+		return fmt.Sprintf("tunnel '%s' switched to fallback domain %s; %s appears blocked", ts.Tag, ts.UsingDomain, ts.Domain)
+	case ts.UsingResolver != "":
+		return fmt.Sprintf("tunnel '%s' switched to fallback resolver %s", ts.Tag, ts.UsingResolver)
+	}
+	return ""
+}
+
+// clone returns a deep copy so callers can't modify the shared snapshot.
+func (s *Status) clone() *Status {
+	c := *s
+	c.Tunnels = make(map[string]*TunnelStatus, len(s.Tunnels))
+	for tag, ts := range s.Tunnels {
+		tsCopy := *ts
+		c.Tunnels[tag] = &tsCopy
+	}
+	c.Listeners = slices.Clone(s.Listeners)
+	c.Disk = slices.Clone(s.Disk)
+	return &c
+}
+
+// refreshStatus rebuilds and publishes the status snapshot.
+func (e *Engine) refreshStatus() {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
+	e.publishStatusLocked()
+}
 
+// publishStatusLocked rebuilds the status snapshot. Caller must hold e.mu.
+func (e *Engine) publishStatusLocked() {
+	e.invalidateTargetsLocked()
+	s := e.buildStatusLocked()
+	e.logFailover(s)
+	e.status.Store(s)
+	e.statusFile.write(e.cfg.StatusFile, s)
+}
+
+// startRefresherLocked starts the periodic status refresher if not running.
+func (e *Engine) startRefresherLocked() {
+	if e.refreshCh != nil {
+		return
+	}
+	stopCh := make(chan struct{})
+	e.refreshCh = stopCh
+
+	go crash.Supervise("status refresher", func() {
+		ticker := time.NewTicker(statusRefreshInterval)
+		defer ticker.Stop()
+		last := time.Now()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				// Not the tick's time: a late tick carries its scheduled time
+				if slept := sleptFor(last, time.Now()); slept > 0 {
+					e.onResume(slept)
+				}
+				last = time.Now()
+				e.rates.tick()
+				e.metrics.read()
+				e.refreshStatus()
+				e.checkEconomy()
+				e.checkQuotas()
+				e.checkBlocking()
+				e.recordHistory()
+				e.checkDisk()
+			}
+		}
+	}, func() bool { return !isClosed(stopCh) })
+}
+
+func (e *Engine) buildStatusLocked() *Status {
 	s := &Status{
-		Active:  e.cfg.Route.Active,
+		Active:  e.activeLocked(),
 		Tunnels: make(map[string]*TunnelStatus),
+		Panics:  e.recentPanics(),
+	}
+	s.Degraded = len(s.Panics) > 0
+	if usage := e.disk.Load(); usage != nil {
+		s.Disk = *usage
+	}
+	s.ActiveOverride = e.activeOverride != ""
+	if s.Active != e.cfg.Route.Standby {
+		s.Standby = e.cfg.Route.Standby
+	}
+	if route := e.routeLocked(); route != s.Active {
+		s.Routing = route
 	}
 
 	if e.gw != nil {
 		s.GatewayAddr = e.gw.Addr()
+		s.GatewayBusy = e.gwBusy
+		s.GatewayBusyBy = e.gwBusyBy
+		s.Refused = e.gw.Refused()
+	}
+	s.GatewayHeld = e.gwHeld
+	for _, l := range e.listeners {
+		s.Listeners = append(s.Listeners, ListenerStatus{Addr: l.gw.Addr(), Via: l.via})
+		s.Refused += l.gw.Refused()
 	}
 
 	for _, tc := range e.cfg.Tunnels {
@@ -216,20 +659,54 @@ func (e *Engine) Status() *Status {
 			Transport: tc.Transport,
 			Backend:   tc.Backend,
 			Domain:    tc.Domain,
-			Active:    tc.Tag == e.cfg.Route.Active,
+			Active:    tc.Tag == s.Active,
+			Standby:   tc.Tag == s.Standby,
 			Port:      tc.Port,
 		}
 
 		processName := "tunnel-" + tc.Tag
 		ts.Running = e.procMgr.IsRunning(processName)
+		ts.Ready = e.procMgr.IsReady(processName)
+		if !ts.Running {
+			ts.Error = e.procMgr.ExitError(processName)
+		} else if info := e.procMgr.GetProcessInfo(processName); info != nil {
+			ts.Started = info.Started
+		}
+		if n := e.starts[tc.Tag]; n > 1 {
+			ts.Restarts = n - 1
+		}
+		ts.Economy = e.economy[tc.Tag]
+		ts.Usage = e.usage.get(tc.Tag)
+		if tc.Quota != nil {
+			ts.Quota = tc.Quota.Bytes()
+		}
+		if e.quotaStopped[tc.Tag] {
+			ts.Error = "monthly quota used up"
+		}
+		if r := e.rotation[tc.Tag]; r != nil {
+			if d := r.domainOf(&tc); d != tc.Domain {
+				ts.UsingDomain = d
+			}
+			if r.resolver > 0 {
+				ts.UsingResolver = r.resolverOf(&tc, e.cfg.GetResolver(&tc))
+			}
+		}
 
 		// For SSH tunnels, also check the SSH tunnel itself
 		if tc.Backend == config.BackendSSH {
 			if st, ok := e.sshTunnels[tc.Tag]; ok {
 				ts.Running = ts.Running && st.IsAlive()
+				ts.ConnErrors, ts.LastConnError = st.ConnErrors()
 			} else {
 				ts.Running = false
 			}
+			ts.Ready = ts.Ready && ts.Running
+		}
+
+		if ts.Running {
+			ts.Health = e.health.get(tc.Tag)
+			ts.RateUp, ts.RateDown = e.rates.get(tc.Tag)
+			ts.Metrics = e.metrics.get(tc.Tag)
 		}
 
 		s.Tunnels[tc.Tag] = ts
@@ -238,27 +715,92 @@ func (e *Engine) Status() *Status {
 	return s
 }
 
-// GetConfig returns the current configuration.
-func (e *Engine) GetConfig() *config.Config {
+// healthTargets returns the SOCKS address of every running tunnel, with the
+// probe interval and timeout of its network preset.
+func (e *Engine) healthTargets() map[string]healthTarget {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	return e.cfg
+
+	targets := make(map[string]healthTarget)
+	for _, tc := range e.cfg.Tunnels {
+		if !e.procMgr.IsRunning("tunnel-" + tc.Tag) {
+			continue
+		}
+		if tc.Backend == config.BackendSSH {
+			if st, ok := e.sshTunnels[tc.Tag]; !ok || !st.IsAlive() {
+				continue
+			}
+		}
+		tunnelPort := tc.Port
+		if tunnelPort == 0 {
+			tunnelPort = extractPort(e.cfg.Listen.SOCKS)
+		}
+		if tunnelPort == 0 {
+			continue
+		}
+		tuning := tc.Tuning()
+		targets[tc.Tag] = healthTarget{
+			addr:     fmt.Sprintf("127.0.0.1:%d", tunnelPort),
+			interval: tuning.HealthInterval,
+			timeout:  tuning.HealthTimeout,
+		}
+	}
+	return targets
 }
 
-// ReloadConfig reloads configuration from disk.
-func (e *Engine) ReloadConfig() error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+// GetConfig returns the current configuration. If the engine is busy past
+// ctx's deadline, e.g. starting a slow tunnel, the config on disk is
+// returned instead.
+func (e *Engine) GetConfig(ctx context.Context) *config.Config {
+	if err := e.rlock(ctx); err != nil {
+		cfg, err := config.LoadOrDefault()
+		if err != nil {
+			return config.Default()
+		}
+		return cfg
+	}
+	defer e.mu.RUnlock()
+	return e.cfg
+}
 
+// ReloadConfig reloads configuration from disk and applies it with ApplyConfig.
+func (e *Engine) ReloadConfig(ctx context.Context) error {
 	cfg, err := config.Load()
 	if err != nil {
 		return err
 	}
-	e.cfg = cfg
+	return e.ApplyConfig(ctx, cfg)
+}
+
+// lockPollInterval is how often lock and rlock retry while waiting.
+const lockPollInterval = 10 * time.Millisecond
+
+// lock acquires e.mu for writing, giving up once ctx is done so callers
+// don't queue forever behind a hung start or stop.
+func (e *Engine) lock(ctx context.Context) error {
+	for !e.mu.TryLock() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("engine busy: %w", ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+	return nil
+}
+
+// rlock is lock for readers.
+func (e *Engine) rlock(ctx context.Context) error {
+	for !e.mu.TryRLock() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("engine busy: %w", ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
 	return nil
 }
 
-func (e *Engine) startTunnelLocked(tag string) error {
+func (e *Engine) startTunnelLocked(ctx context.Context, tag string) error {
 	tc := e.cfg.GetTunnelByTag(tag)
 	if tc == nil {
 		return fmt.Errorf("tunnel %q not found", tag)
@@ -269,6 +811,12 @@ func (e *Engine) startTunnelLocked(tag string) error {
 		return nil // already running, skip
 	}
 
+	if q := tc.Quota; q != nil && q.Stop && e.usage.get(tag) >= q.Bytes() {
+		e.quotaStopped[tag] = true
+		return fmt.Errorf("monthly quota of %d MB used up", q.MonthlyMB)
+	}
+	delete(e.quotaStopped, tag)
+
 	// Get transport provider
 	t, err := transport.Get(tc.Transport)
 	if err != nil {
@@ -276,11 +824,9 @@ func (e *Engine) startTunnelLocked(tag string) error {
 	}
 
 	// Check required binaries are installed
-	mgr := binaries.NewManager()
 	defs := binaries.Defs()
 	for _, name := range t.RequiredBinaries(tc.Backend) {
-		def := defs[name]
-		if !mgr.IsInstalled(def) {
+		if !binaries.IsInstalled(defs[name]) {
 			return fmt.Errorf("binary %s not installed — run 'dnstc install' first", name)
 		}
 	}
@@ -291,13 +837,7 @@ func (e *Engine) startTunnelLocked(tag string) error {
 	// For other backends, transport process listens on the exposed port directly.
 	isSSH := tc.Backend == config.BackendSSH
 
-	exposedPort := tc.Port
-	if exposedPort == 0 {
-		exposedPort = extractPort(e.cfg.Listen.SOCKS)
-		if exposedPort == 0 {
-			exposedPort = 1080
-		}
-	}
+	exposedPort := e.exposedPortLocked(tc)
 
 	transportPort := exposedPort
 	if isSSH {
@@ -309,23 +849,64 @@ func (e *Engine) startTunnelLocked(tag string) error {
 		transportPort = internalPort
 	} else {
 		if !port.IsAvailable(transportPort) {
-			return fmt.Errorf("port %d is already in use", transportPort)
+			return fmt.Errorf("port %d is already in use by %s", transportPort, port.FindOwner(transportPort))
 		}
 	}
 
 	// Determine resolver: per-tunnel override > global config > default
 	resolver := e.cfg.GetResolver(tc)
+	if r := e.rotation[tag]; r != nil {
+		resolver = r.resolverOf(tc, resolver)
+	}
+	if resolver, err = e.resolverAddrLocked(resolver); err != nil {
+		return err
+	}
+
+	// Credentials may live in the OS keyring
+	resolved, err := secrets.Resolve(*tc)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials: %w", err)
+	}
+	if e.economy[tag] {
+		resolved = economize(resolved)
+	}
+	if r := e.rotation[tag]; r != nil {
+		resolved.Domain = r.domainOf(tc)
+	}
 
 	// Build args — transport process always listens on transportPort
-	binary, args, err := t.BuildArgs(tc, transportPort, resolver)
+	binary, args, err := t.BuildArgs(&resolved, transportPort, resolver)
 	if err != nil {
 		return fmt.Errorf("failed to build args: %w", err)
 	}
 
 	// Start transport process
-	if err := e.procMgr.Start(processName, binary, args); err != nil {
+	opts := process.Options{
+		Env:          tc.EnvList(),
+		LogPath:      config.TunnelLogPath(tag),
+		ReadyAddr:    fmt.Sprintf("127.0.0.1:%d", transportPort),
+		ReadyPattern: t.ReadyPattern(tc.Backend),
+	}
+	if l := tc.Limits; l != nil {
+		opts.Nice = l.Nice
+		opts.CPUs = l.CPUs
+		opts.MemoryLimit = uint64(l.MemoryMB) << 20
+		opts.CPUQuota = l.CPUPercent
+	}
+	slog.Debug("starting transport", "tag", tag, "command", redactedCommand(binary, args, &resolved))
+	logOffset := logSize(opts.LogPath)
+	if err := e.procMgr.Start(processName, binary, args, opts); err != nil {
 		return fmt.Errorf("failed to start tunnel: %w", err)
 	}
+	e.starts[tag]++
+	e.metrics.follow(tag, t, opts.LogPath, logOffset)
+	grace := startGrace
+	if deadline, ok := ctx.Deadline(); ok {
+		grace = min(grace, time.Until(deadline))
+	}
+	if err := e.procMgr.WaitReady(processName, grace); err != nil && !errors.Is(err, process.ErrNotReady) {
+		return fmt.Errorf("transport process failed: %w", err)
+	}
 
 	// For SSH backend, start SSH tunnel asynchronously.
 	// The transport needs time to establish the DNS session before SSH can connect.
@@ -343,41 +924,99 @@ func (e *Engine) startTunnelLocked(tag string) error {
 		}
 
 		sshCfg := sshtunnel.Config{
+			Tag:              tag,
 			TransportAddr:    transportAddr,
 			SOCKSAddr:        socksAddr,
 			User:             tc.SSH.User,
-			Password:         tc.SSH.Password,
+			Password:         resolved.SSH.Password,
 			KeyPath:          tc.SSH.Key,
+			KeyPassphrase:    resolved.SSH.Passphrase,
 			HandshakeTimeout: handshakeTimeout,
+			IdleTimeout:      time.Duration(e.cfg.Listen.IdleTimeoutSec) * time.Second,
 			MaxRetries:       maxRetries,
+			Share:            tc.SSH.Share,
+		}
+		if resolved.SSH.Obfs != nil {
+			sshCfg.ObfsKey = resolved.SSH.Obfs.Key
+			sshCfg.ObfsPad = resolved.SSH.Obfs.Pad
 		}
 
-		go func() {
-			if err := waitForPort(transportAddr, 10*time.Second); err != nil {
-				fmt.Printf("warning: transport for %q did not become ready: %v\n", tag, err)
+		crash.Go("SSH tunnel start", func() {
+			if err := e.procMgr.WaitReady(processName, 10*time.Second); err != nil {
+				slog.Warn("transport did not become ready", "tag", tag, "error", err)
 				e.procMgr.Stop(processName)
+				e.refreshStatus()
 				return
 			}
 
 			st, err := sshtunnel.Start(sshCfg)
 			if err != nil {
-				fmt.Printf("warning: SSH tunnel %q failed: %v\n", tag, err)
+				slog.Warn("SSH tunnel failed", "tag", tag, "error", err)
 				e.procMgr.Stop(processName)
+				e.refreshStatus()
 				return
 			}
 
 			e.mu.Lock()
 			e.sshTunnels[tag] = st
+			e.publishStatusLocked()
 			e.mu.Unlock()
-		}()
+		})
 	}
 
 	return nil
 }
 
+// redactedCommand returns the command line for logs, with the tunnel's
+// secrets masked.
+func redactedCommand(binary string, args []string, tc *config.TunnelConfig) string {
+	secret := ""
+	if tc.Shadowsocks != nil {
+		secret = tc.Shadowsocks.Password
+	}
+	parts := []string{binary}
+	for _, a := range args {
+		if secret != "" && a == secret {
+			a = config.RedactedValue
+		}
+		parts = append(parts, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// exposedPortLocked returns the local SOCKS port a tunnel is reachable on.
+func (e *Engine) exposedPortLocked(tc *config.TunnelConfig) int {
+	return exposedPort(e.cfg, tc)
+}
+
+// exposedPort returns the local SOCKS port a tunnel is reachable on under cfg.
+func exposedPort(cfg *config.Config, tc *config.TunnelConfig) int {
+	if tc.Port > 0 {
+		return tc.Port
+	}
+	if p := extractPort(cfg.Listen.SOCKS); p > 0 {
+		return p
+	}
+	return 1080
+}
+
+// startGatewayLocked starts the gateway and the extra listeners, unless
+// they are running or were stopped with StopGateway, which holds them down
+// until StartGateway.
 func (e *Engine) startGatewayLocked() error {
-	if e.gw != nil {
-		return nil // already running
+	if e.gw != nil || e.gwHeld {
+		return nil
+	}
+
+	// Resume a gateway handed over by the previous daemon
+	if in := e.inherited; in != nil {
+		e.inherited = nil
+		e.gw = e.newGateway(in.listener.Addr().String(), e.resolveActiveTarget)
+		e.gw.StartWithListener(in.listener)
+		e.gw.Resume(in.relays)
+		e.applyPrewarmLocked()
+		e.startListenersLocked()
+		return nil
 	}
 
 	gwAddr := e.cfg.Listen.SOCKS
@@ -392,28 +1031,50 @@ func (e *Engine) startGatewayLocked() error {
 		if err != nil {
 			return fmt.Errorf("gateway port %d in use and no available port found: %w", gwPort, err)
 		}
+		owner := port.FindOwner(gwPort).String()
+		slog.Warn("gateway port in use; listening on another port and saving it to the config",
+			"configured", gwAddr, "owner", owner, "addr", fmt.Sprintf("127.0.0.1:%d", newPort))
+		e.gwBusy = gwAddr
+		e.gwBusyBy = owner
 		gwAddr = fmt.Sprintf("127.0.0.1:%d", newPort)
 		// Update config so status reflects the actual port
 		e.cfg.Listen.SOCKS = gwAddr
-		e.cfg.Save()
+		e.saved.Listen.SOCKS = gwAddr
+		e.saver.schedule()
 	}
 
-	e.gw = gateway.New(gwAddr, e.resolveActiveTarget)
-	return e.gw.Start()
+	e.gw = e.newGateway(gwAddr, e.resolveActiveTarget)
+	if err := e.gw.Start(); err != nil {
+		e.gw = nil
+		return err
+	}
+	e.applyPrewarmLocked()
+	e.startListenersLocked()
+	return nil
 }
 
-// resolveActiveTarget returns the address of the active tunnel for the gateway.
-// Called per-connection so activate takes effect immediately.
+// resolveActiveTarget returns the address of the active tunnel for the
+// gateway, or of the standby while the active one is down. Called
+// per-connection so activate and failover take effect immediately.
 func (e *Engine) resolveActiveTarget() string {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
+	return e.resolveTarget(e.targetCache().active)
+}
+
+// resolveTarget returns the address of a specific tunnel, for listeners
+// pinned to it. A tunnel in economy mode is woken up first.
+func (e *Engine) resolveTarget(tag string) string {
+	e.wake(tag)
+	return e.targetCache().target(tag, e.lockedTarget)
+}
 
-	activeTag := e.cfg.Route.Active
-	if activeTag == "" {
+// tunnelTargetLocked returns the local SOCKS address of a tunnel, or "" if it
+// doesn't exist or isn't running.
+func (e *Engine) tunnelTargetLocked(tag string) string {
+	if tag == "" {
 		return ""
 	}
 
-	tc := e.cfg.GetTunnelByTag(activeTag)
+	tc := e.cfg.GetTunnelByTag(tag)
 	if tc == nil {
 		return ""
 	}
@@ -427,14 +1088,14 @@ func (e *Engine) resolveActiveTarget() string {
 	}
 
 	// Check if the tunnel is actually running
-	processName := "tunnel-" + activeTag
+	processName := "tunnel-" + tag
 	if !e.procMgr.IsRunning(processName) {
 		return ""
 	}
 
 	// For SSH backend, verify the SSH tunnel is alive
 	if tc.Backend == config.BackendSSH {
-		st, ok := e.sshTunnels[activeTag]
+		st, ok := e.sshTunnels[tag]
 		if !ok || !st.IsAlive() {
 			return ""
 		}
@@ -444,10 +1105,13 @@ func (e *Engine) resolveActiveTarget() string {
 }
 
 // IsConnected returns true if any tunnels are currently running.
-func (e *Engine) IsConnected() bool {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-	return e.hasRunningTunnelsLocked()
+func (e *Engine) IsConnected(ctx context.Context) bool {
+	for _, ts := range e.status.Load().Tunnels {
+		if ts.Running {
+			return true
+		}
+	}
+	return false
 }
 
 func (e *Engine) hasRunningTunnelsLocked() bool {
@@ -461,20 +1125,6 @@ func (e *Engine) hasRunningTunnelsLocked() bool {
 	return len(e.sshTunnels) > 0
 }
 
-// waitForPort polls a TCP address until it accepts connections or the timeout expires.
-func waitForPort(addr string, timeout time.Duration) error {
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			return nil
-		}
-		time.Sleep(200 * time.Millisecond)
-	}
-	return fmt.Errorf("timeout waiting for %s", addr)
-}
-
 func extractPort(addr string) int {
 	_, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/gateway"
+)
+
+// GatewayInfo describes the gateway's configured and live state.
+type GatewayInfo struct {
+	Running    bool             `json:"running"`
+	Addr       string           `json:"addr,omitempty"` // where it is listening, if running
+	Configured string           `json:"configured"`     // listen.socks from the config
+	Listeners  []ListenerStatus `json:"listeners,omitempty"`
+}
+
+// Gateway returns the gateway's configured and live state.
+func (e *Engine) Gateway(ctx context.Context) (*GatewayInfo, error) {
+	if err := e.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	info := &GatewayInfo{Configured: e.cfg.Listen.SOCKS}
+	if e.gw != nil {
+		info.Running = true
+		info.Addr = e.gw.Addr()
+	}
+	for _, l := range e.listeners {
+		info.Listeners = append(info.Listeners, ListenerStatus{Addr: l.gw.Addr(), Via: l.via})
+	}
+	return info, nil
+}
+
+// RestartGateway restarts the gateway and extra listeners on their configured
+// addresses. Tunnels keep running; connections through the gateway are dropped.
+func (e *Engine) RestartGateway(ctx context.Context) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	if e.gw == nil {
+		return fmt.Errorf("gateway is not running")
+	}
+	e.stopGatewayLocked()
+	return e.startGatewayLocked()
+}
+
+// StopGateway stops the gateway and extra listeners while the tunnels keep
+// running, so apps can use the tunnels' own SOCKS ports and nothing else is
+// proxied. It stays down, through reloads and tunnel starts, until
+// StartGateway or the daemon restarts.
+func (e *Engine) StopGateway(ctx context.Context) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	if e.policy.KeepsGateway() {
+		return fmt.Errorf("the policy's kill switch keeps the gateway running")
+	}
+	e.stopGatewayLocked()
+	e.gwHeld = true
+	return nil
+}
+
+// StartGateway starts the gateway and extra listeners again after
+// StopGateway, or starts them if no tunnel has.
+func (e *Engine) StartGateway(ctx context.Context) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	e.gwHeld = false
+	return e.startGatewayLocked()
+}
+
+// StopTunnels stops every tunnel and leaves the gateway listening, so the
+// gateway's address stays bound while the sessions are down. Connections
+// through it fail until a tunnel is started again.
+func (e *Engine) StopTunnels(ctx context.Context) error {
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	e.stopTunnelsLocked()
+	return nil
+}
+
+// gatewayDrainTimeout is how long connections through a moved gateway's old
+// address may stay open before they are closed.
+const gatewayDrainTimeout = 10 * time.Minute
+
+// SetGatewayAddr moves the gateway to addr and saves it as listen.socks.
+// The new address is bound before the old listener is closed, so a bad
+// address leaves the gateway where it was. Connections already open through
+// the old address drain in the background. If the gateway isn't running,
+// only the config changes.
+func (e *Engine) SetGatewayAddr(ctx context.Context, addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if !e.policy.AllowsListen(addr) {
+		return fmt.Errorf("address %s is not allowed by the policy: it must be a loopback address", addr)
+	}
+
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	if e.gw != nil && e.gw.Addr() != addr {
+		gw := e.newGateway(addr, e.resolveActiveTarget)
+		if err := gw.Start(); err != nil {
+			return err
+		}
+		go e.gw.Drain(gatewayDrainTimeout)
+		e.gw = gw
+		e.applyPrewarmLocked()
+	}
+
+	e.cfg.Listen.SOCKS = addr
+	e.saved.Listen.SOCKS = addr
+	e.gwBusy, e.gwBusyBy = "", ""
+	e.saver.schedule()
+	return nil
+}
+
+// newGateway creates a gateway whose traffic counts toward tunnel usage,
+// with the configured pending connection limit and QoS, and the dial
+// timeouts of the tunnels' network presets. Caller must hold e.mu.
+func (e *Engine) newGateway(addr string, target func() string) *gateway.Gateway {
+	gw := e.newGw(addr, target)
+	gw.SetCounter(e.countBytes)
+	gw.SetDialTimeout(e.dialTimeout)
+	e.applyGatewaySettingsLocked(gw)
+	return gw
+}
+
+// applyGatewaySettingsLocked applies the configured pending connection
+// limit, timeouts and QoS to gw. Caller must hold e.mu.
+func (e *Engine) applyGatewaySettingsLocked(gw *gateway.Gateway) {
+	l := e.cfg.Listen
+	gw.SetLimits(gateway.Limits{
+		MaxPending:   l.MaxPending,
+		QueueTimeout: time.Duration(l.QueueMS) * time.Millisecond,
+	})
+	gw.SetTimeouts(gateway.Timeouts{
+		Idle:      time.Duration(l.IdleTimeoutSec) * time.Second,
+		KeepAlive: time.Duration(l.KeepAliveSec) * time.Second,
+	})
+	if l.QoS == nil {
+		gw.SetQoS(nil)
+		return
+	}
+	gw.SetQoS(&gateway.QoS{
+		InteractivePorts: l.QoS.Interactive(),
+		BulkPorts:        l.QoS.BulkPorts,
+		BulkAfter:        l.QoS.BulkAfter(),
+	})
+}
+
+// applyPrewarmLocked sets the gateway's prewarmed connections from
+// listen.prewarm. Caller must hold e.mu.
+func (e *Engine) applyPrewarmLocked() {
+	if e.gw != nil {
+		e.gw.SetPrewarm(gateway.Prewarm{Conns: e.cfg.Listen.Prewarm, Target: e.prewarmTarget})
+	}
+}
+
+// prewarmTarget returns where the gateway keeps prewarmed connections open:
+// the tunnel it routes through, if that has a SOCKS backend, whose far end
+// waits for a request on an unused stream. Shadowsocks and SSH backends
+// only reach the server once a request is made, so they gain nothing. A
+// tunnel in economy mode isn't kept busy.
+func (e *Engine) prewarmTarget() string {
+	c := e.targetCache()
+	if c.active == "" || c.asleep[c.active] {
+		return ""
+	}
+	e.mu.RLock()
+	tc := e.cfg.GetTunnelByTag(c.active)
+	socks := tc != nil && tc.Backend == config.BackendSOCKS
+	e.mu.RUnlock()
+	if !socks {
+		return ""
+	}
+	return c.target(c.active, e.lockedTarget)
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"net"
+	"os"
+)
+
+// inheritedGateway is a gateway listener and its in-flight relays handed
+// over by a previous daemon process.
+type inheritedGateway struct {
+	listener net.Listener
+	relays   [][2]net.Conn
+}
+
+// InheritGateway makes the next gateway start reuse ln and resume relays
+// instead of opening a new listener. Must be called before Start.
+func (e *Engine) InheritGateway(ln net.Listener, relays [][2]net.Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.inherited = &inheritedGateway{listener: ln, relays: relays}
+}
+
+// PrepareHandover gets the engine ready for the daemon to exec a new binary.
+// The gateway is detached and its listener and paused relays are returned as
+// files; tunnel processes are left running for the new daemon to adopt.
+// In-process SSH sessions can't survive the exec and are stopped.
+func (e *Engine) PrepareHandover() (*os.File, [][2]*os.File, error) {
+	e.mu.Lock()
+	defer e.saver.flush() // once unlocked, before the new daemon loads it
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	e.health.stop()
+	if e.refreshCh != nil {
+		close(e.refreshCh)
+		e.refreshCh = nil
+	}
+
+	for tag, st := range e.sshTunnels {
+		st.Stop()
+		delete(e.sshTunnels, tag)
+	}
+
+	// Extra listeners are not handed over; the new daemon binds them again
+	e.stopListenersLocked()
+
+	if e.gw == nil {
+		return nil, nil, nil
+	}
+	lnFile, relays, err := e.gw.Detach()
+	if err != nil {
+		return nil, nil, err
+	}
+	e.gw = nil
+	return lnFile, relays, nil
+}
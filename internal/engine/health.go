@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/net2share/dnstc/internal/crash"
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+const (
+	// healthInterval is the time between health probes of a running tunnel,
+	// unless its network preset sets another.
+	healthInterval = 30 * time.Second
+	// healthTimeout bounds a single probe. DNS tunnels are slow to set up a stream.
+	healthTimeout = 20 * time.Second
+	// healthTick is how often the probe loop checks which tunnels are due.
+	healthTick = 5 * time.Second
+	// healthWindow is the number of recent probes used for the loss estimate.
+	healthWindow = 10
+
+	healthProbeResolver = "1.1.1.1:53"
+	healthProbeName     = "example.com"
+)
+
+// Health is the result of recent health probes for a tunnel.
+type Health struct {
+	RTT       time.Duration `json:"rtt"`  // round-trip of the last successful probe
+	Loss      float64       `json:"loss"` // fraction of failed probes in the window
+	Probes    int           `json:"probes"`
+	LastProbe time.Time     `json:"last_probe"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// FormatRTT returns the RTT for display, or "-" if no probe has succeeded.
+func (h *Health) FormatRTT() string {
+	if h == nil || h.RTT == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", h.RTT.Milliseconds())
+}
+
+// FormatLoss returns the loss estimate for display, or "-" if nothing was probed.
+func (h *Health) FormatLoss() string {
+	if h == nil || h.Probes == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", h.Loss*100)
+}
+
+// healthTarget is a tunnel to probe: its SOCKS address and, from its network
+// preset, how often and for how long. Zero durations keep the defaults.
+type healthTarget struct {
+	addr     string
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// healthRecord tracks a sliding window of probe outcomes for one tunnel.
+type healthRecord struct {
+	since     time.Time // when the tunnel was first up for probing
+	results   []bool
+	rtt       time.Duration
+	lastProbe time.Time
+	lastError string
+	failures  int // consecutive failed probes
+}
+
+func (r *healthRecord) add(rtt time.Duration, err error) {
+	r.results = append(r.results, err == nil)
+	if len(r.results) > healthWindow {
+		r.results = r.results[len(r.results)-healthWindow:]
+	}
+	r.lastProbe = time.Now()
+	if err != nil {
+		r.lastError = err.Error()
+		r.failures++
+		return
+	}
+	r.rtt = rtt
+	r.lastError = ""
+	r.failures = 0
+}
+
+func (r *healthRecord) snapshot() *Health {
+	failed := 0
+	for _, ok := range r.results {
+		if !ok {
+			failed++
+		}
+	}
+	h := &Health{
+		RTT:       r.rtt,
+		Probes:    len(r.results),
+		LastProbe: r.lastProbe,
+		LastError: r.lastError,
+	}
+	if len(r.results) > 0 {
+		h.Loss = float64(failed) / float64(len(r.results))
+	}
+	return h
+}
+
+// healthMonitor periodically probes running tunnels through their SOCKS port.
+type healthMonitor struct {
+	mu       sync.Mutex
+	records  map[string]*healthRecord
+	stopCh   chan struct{}
+	kickCh   chan struct{}
+	onUpdate func() // called after each probe round
+}
+
+func newHealthMonitor(onUpdate func()) *healthMonitor {
+	return &healthMonitor{
+		records:  make(map[string]*healthRecord),
+		kickCh:   make(chan struct{}, 1),
+		onUpdate: onUpdate,
+	}
+}
+
+// start launches the probe loop. targets returns every tunnel that should be
+// probed, by tag.
+func (m *healthMonitor) start(targets func() map[string]healthTarget) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopCh != nil {
+		return
+	}
+	stopCh := make(chan struct{})
+	m.stopCh = stopCh
+
+	go crash.Supervise("health monitor", func() {
+		ticker := time.NewTicker(healthTick)
+		defer ticker.Stop()
+		for {
+			all := false
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			case <-m.kickCh:
+				all = true
+			}
+			if m.probeDue(targets(), all, stopCh) {
+				m.onUpdate()
+			}
+		}
+	}, func() bool { return !isClosed(stopCh) })
+}
+
+// kick runs a probe round now instead of waiting for the next interval.
+func (m *healthMonitor) kick() {
+	select {
+	case m.kickCh <- struct{}{}:
+	default:
+	}
+}
+
+// stop stops the probe loop and discards all results.
+func (m *healthMonitor) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
+	m.records = make(map[string]*healthRecord)
+}
+
+// forget discards the results for a tunnel, e.g. when it is stopped.
+func (m *healthMonitor) forget(tag string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, tag)
+}
+
+// get returns the current health for a tunnel, or nil if it was never probed.
+func (m *healthMonitor) get(tag string) *Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.records[tag]; ok && len(r.results) > 0 {
+		return r.snapshot()
+	}
+	return nil
+}
+
+// failures returns the number of consecutive failed probes of a tunnel.
+func (m *healthMonitor) failures(tag string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.records[tag]; ok {
+		return r.failures
+	}
+	return 0
+}
+
+// probeDue probes the targets whose interval has passed since their last
+// probe, or since they came up, or all of them. It reports whether any was.
+func (m *healthMonitor) probeDue(targets map[string]healthTarget, all bool, stopCh chan struct{}) bool {
+	now := time.Now()
+	due := make(map[string]healthTarget)
+	m.mu.Lock()
+	for tag, t := range targets {
+		r, ok := m.records[tag]
+		if !ok {
+			r = &healthRecord{since: now}
+			m.records[tag] = r
+		}
+		interval := t.interval
+		if interval <= 0 {
+			interval = healthInterval
+		}
+		if all || now.Sub(r.since) >= interval && now.Sub(r.lastProbe) >= interval {
+			due[tag] = t
+		}
+	}
+	m.mu.Unlock()
+
+	if len(due) == 0 {
+		return false
+	}
+	m.probeAll(due, stopCh)
+	return true
+}
+
+func (m *healthMonitor) probeAll(targets map[string]healthTarget, stopCh chan struct{}) {
+	var wg sync.WaitGroup
+	for tag, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer crash.Recover("health probe")
+			timeout := t.timeout
+			if timeout <= 0 {
+				timeout = healthTimeout
+			}
+			rtt, err := probeTunnel(t.addr, timeout)
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			select {
+			case <-stopCh:
+				return // stopped while probing
+			default:
+			}
+			r, ok := m.records[tag]
+			if !ok {
+				r = &healthRecord{since: time.Now()}
+				m.records[tag] = r
+			}
+			r.add(rtt, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// ProbeTunnel resolves a name over TCP through the tunnel's SOCKS port and
+// returns the DNS round-trip time, which crosses the tunnel exactly once.
+func ProbeTunnel(socksAddr string) (time.Duration, error) {
+	return probeTunnel(socksAddr, healthTimeout)
+}
+
+// probeTunnel is ProbeTunnel with a timeout.
+func probeTunnel(socksAddr string, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := probe.DialSOCKS5(ctx, socksAddr, healthProbeResolver)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	start := time.Now()
+	if _, err := probe.QueryConn(conn, healthProbeName, probe.TypeA); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
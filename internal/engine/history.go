@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// historyStep is the time covered by one history sample.
+	historyStep = time.Minute
+	// historyLen is the number of samples kept per tunnel: three hours.
+	historyLen = 180
+)
+
+// Sample is one step of a tunnel's throughput and RTT history.
+type Sample struct {
+	Time  time.Time     `json:"time"`           // end of the step
+	Bytes int64         `json:"bytes"`          // relayed through the gateway during the step
+	RTT   time.Duration `json:"rtt,omitempty"`  // last successful probe in the step, if any
+	Down  bool          `json:"down,omitempty"` // the tunnel was not running at the end of the step
+}
+
+// History is the recent samples of a tunnel, oldest first.
+type History []Sample
+
+// Last returns the most recent n samples.
+func (h History) Last(n int) History {
+	if len(h) <= n {
+		return h
+	}
+	return h[len(h)-n:]
+}
+
+// Rate returns the throughput of a sample in bytes per second.
+func (s Sample) Rate() float64 {
+	return float64(s.Bytes) / historyStep.Seconds()
+}
+
+// PeakRate returns the highest throughput in bytes per second.
+func (h History) PeakRate() float64 {
+	peak := 0.0
+	for _, s := range h {
+		peak = max(peak, s.Rate())
+	}
+	return peak
+}
+
+// RateSparkline renders the throughput as a sparkline at most width
+// characters wide. Steps where the tunnel was down are left blank.
+func (h History) RateSparkline(width int) string {
+	values := make([]float64, len(h))
+	for i, s := range h {
+		values[i] = s.Rate()
+		if s.Down {
+			values[i] = math.NaN()
+		}
+	}
+	return sparkline(values, width)
+}
+
+// RTTSparkline renders the probe RTT as a sparkline at most width characters
+// wide. Steps without a successful probe are left blank.
+func (h History) RTTSparkline(width int) string {
+	values := make([]float64, len(h))
+	for i, s := range h {
+		values[i] = float64(s.RTT)
+		if s.RTT == 0 {
+			values[i] = math.NaN()
+		}
+	}
+	return sparkline(values, width)
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline scales values to block characters, averaging neighbours so the
+// result fits in width. NaN marks a gap.
+func sparkline(values []float64, width int) string {
+	if len(values) == 0 || width <= 0 {
+		return ""
+	}
+	per := (len(values) + width - 1) / width
+	var buckets []float64
+	for i := 0; i < len(values); i += per {
+		sum, n := 0.0, 0
+		for _, v := range values[i:min(i+per, len(values))] {
+			if !math.IsNaN(v) {
+				sum += v
+				n++
+			}
+		}
+		if n == 0 {
+			buckets = append(buckets, math.NaN())
+		} else {
+			buckets = append(buckets, sum/float64(n))
+		}
+	}
+
+	peak := 0.0
+	for _, v := range buckets {
+		if !math.IsNaN(v) {
+			peak = max(peak, v)
+		}
+	}
+	var b strings.Builder
+	for _, v := range buckets {
+		switch {
+		case math.IsNaN(v):
+			b.WriteRune(' ')
+		case peak == 0:
+			b.WriteRune(sparkBlocks[0])
+		default:
+			b.WriteRune(sparkBlocks[int(v/peak*float64(len(sparkBlocks)-1)+0.5)])
+		}
+	}
+	return b.String()
+}
+
+// history keeps the last historyLen samples of every tunnel in memory, and
+// in a file when keep_history is set.
+type history struct {
+	mu      sync.Mutex
+	pending map[string]int64 // bytes relayed in the current step
+	samples map[string]History
+	stepped time.Time
+	clock   Clock
+}
+
+// loadHistory reads the samples saved at path that are still recent enough
+// to show. path may not exist.
+func loadHistory(path string, clock Clock) *history {
+	h := &history{
+		pending: make(map[string]int64),
+		samples: make(map[string]History),
+		stepped: clock.Now(),
+		clock:   clock,
+	}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	var saved map[string]History
+	if json.Unmarshal(data, &saved) != nil {
+		return h
+	}
+	cutoff := clock.Now().Add(-historyLen * historyStep)
+	for tag, samples := range saved {
+		for i, s := range samples {
+			if s.Time.After(cutoff) {
+				h.samples[tag] = samples[i:].Last(historyLen)
+				break
+			}
+		}
+	}
+	return h
+}
+
+func (h *history) add(tag string, n int64) {
+	h.mu.Lock()
+	h.pending[tag] += n
+	h.mu.Unlock()
+}
+
+func (h *history) get(tag string) History {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append(History(nil), h.samples[tag]...)
+}
+
+// step closes the current step if historyStep has passed, appending a
+// sample for every tunnel in the status. Tunnels no longer in the status are
+// dropped. It reports whether a step was closed.
+func (h *history) step(s *Status) bool {
+	now := h.clock.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now.Sub(h.stepped) < historyStep {
+		return false
+	}
+	for tag := range h.samples {
+		if _, ok := s.Tunnels[tag]; !ok {
+			delete(h.samples, tag)
+		}
+	}
+	for tag, ts := range s.Tunnels {
+		sample := Sample{Time: now, Bytes: h.pending[tag], Down: !ts.Running}
+		if hl := ts.Health; hl != nil && hl.LastError == "" && hl.LastProbe.After(h.stepped) {
+			sample.RTT = hl.RTT
+		}
+		h.samples[tag] = append(h.samples[tag], sample).Last(historyLen)
+	}
+	clear(h.pending)
+	h.stepped = now
+	return true
+}
+
+// save writes all samples to path.
+func (h *history) save(path string) {
+	h.mu.Lock()
+	data, err := json.Marshal(h.samples)
+	h.mu.Unlock()
+
+	if err == nil {
+		err = os.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		slog.Warn("failed to save history", "error", err)
+	}
+}
+
+// recordHistory adds a history sample per tunnel once every historyStep,
+// and saves them if keep_history is set.
+func (e *Engine) recordHistory() {
+	if !e.history.step(e.status.Load()) {
+		return
+	}
+	e.mu.RLock()
+	keep := e.cfg.KeepHistory
+	e.mu.RUnlock()
+	if keep {
+		e.history.save(e.historyPath)
+	}
+}
+
+// History returns the throughput and RTT samples of a tunnel, oldest first.
+func (e *Engine) History(ctx context.Context, tag string) (History, error) {
+	if _, ok := e.status.Load().Tunnels[tag]; !ok {
+		return nil, fmt.Errorf("tunnel %q not found", tag)
+	}
+	return e.history.get(tag), nil
+}
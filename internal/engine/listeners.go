@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"log/slog"
+
+	"github.com/net2share/dnstc/internal/gateway"
+)
+
+// ListenerStatus describes an extra listener pinned to a specific tunnel.
+type ListenerStatus struct {
+	Addr string `json:"addr"`
+	Via  string `json:"via"`
+}
+
+// pinnedListener is a running extra listener.
+type pinnedListener struct {
+	via string
+	gw  *gateway.Gateway
+}
+
+// startListenersLocked starts the extra listeners from listen.extra. Each one
+// routes to its own tunnel regardless of route.active. A listener that fails
+// to bind is logged and skipped so it doesn't take the main gateway down.
+func (e *Engine) startListenersLocked() {
+	for _, l := range e.cfg.Listen.Extra {
+		via := l.Via
+		gw := e.newGateway(l.SOCKS, func() string { return e.resolveTarget(via) })
+		if err := gw.Start(); err != nil {
+			slog.Warn("failed to start extra listener", "addr", l.SOCKS, "via", via, "error", err)
+			continue
+		}
+		e.listeners = append(e.listeners, pinnedListener{via: via, gw: gw})
+	}
+}
+
+// stopListenersLocked stops all extra listeners.
+func (e *Engine) stopListenersLocked() {
+	for _, l := range e.listeners {
+		l.gw.Stop()
+	}
+	e.listeners = nil
+}
+
+// stopGatewayLocked stops the main gateway and the extra listeners.
+func (e *Engine) stopGatewayLocked() {
+	e.stopListenersLocked()
+	if e.gw != nil {
+		e.gw.Stop()
+		e.gw = nil
+	}
+}
@@ -0,0 +1,18 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/process"
+)
+
+// RotateLogs truncates the tunnels' transport logs without restarting them,
+// keeping a copy of each as <name>.log.1 if asked. It runs in the daemon
+// so that logs it owns can be cleared by an unprivileged client.
+func (e *Engine) RotateLogs(ctx context.Context, keep bool) (process.Rotation, error) {
+	r, err := process.RotateLogs(config.LogDir(), keep)
+	slog.Info("rotated logs", "files", r.Files, "freed", r.Freed, "keep", keep)
+	return r, err
+}
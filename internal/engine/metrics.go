@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/net2share/dnstc/internal/transport"
+)
+
+// maxMetricsRead bounds how much new log is parsed for metrics per refresh;
+// past it, the rest is skipped.
+const maxMetricsRead = 1 << 20
+
+// metricsTail follows a transport's log from where its process started,
+// parsing metrics from each new line.
+type metricsTail struct {
+	parser  transport.MetricsParser
+	path    string
+	offset  int64
+	partial string // an unfinished last line
+	m       transport.Metrics
+}
+
+// transportMetrics keeps the metrics of the tunnels whose transport logs
+// them. It has its own lock so that reading logs doesn't hold up e.mu.
+type transportMetrics struct {
+	mu    sync.Mutex
+	tails map[string]*metricsTail
+}
+
+func newTransportMetrics() *transportMetrics {
+	return &transportMetrics{tails: make(map[string]*metricsTail)}
+}
+
+// logSize returns the size of a log file, where a process started now
+// begins writing, or 0 if it doesn't exist yet.
+func logSize(path string) int64 {
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
+	}
+	return 0
+}
+
+// follow starts counting a tunnel's metrics from offset in its log, if its
+// transport logs them.
+func (tm *transportMetrics) follow(tag string, t transport.Transport, path string, offset int64) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	delete(tm.tails, tag)
+	if p, ok := t.(transport.MetricsParser); ok {
+		tm.tails[tag] = &metricsTail{parser: p, path: path, offset: offset}
+	}
+}
+
+// forget stops counting a tunnel's metrics.
+func (tm *transportMetrics) forget(tag string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	delete(tm.tails, tag)
+}
+
+// get returns a copy of a tunnel's metrics, or nil if they aren't counted.
+func (tm *transportMetrics) get(tag string) *transport.Metrics {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if t, ok := tm.tails[tag]; ok {
+		m := t.m
+		return &m
+	}
+	return nil
+}
+
+// read parses what the transports logged since the last read.
+func (tm *transportMetrics) read() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for _, t := range tm.tails {
+		t.read()
+	}
+}
+
+func (t *metricsTail) read() {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() < t.offset {
+		t.offset, t.partial = 0, "" // truncated, e.g. by log rotation
+	}
+	if info.Size()-t.offset > maxMetricsRead {
+		t.offset, t.partial = info.Size()-maxMetricsRead, ""
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return
+	}
+	t.offset += int64(len(data))
+
+	lines := strings.Split(t.partial+string(data), "\n")
+	t.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		t.parser.ParseMetrics(line, &t.m)
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/gateway"
+	"github.com/net2share/dnstc/internal/process"
+)
+
+// ProcessManager starts and tracks the tunnels' transport processes.
+// *process.Manager implements it.
+type ProcessManager interface {
+	SetLivenessCallback(fn process.LivenessFunc)
+	Start(name, binary string, args []string, opts process.Options) error
+	Stop(name string) error
+	StopAll() error
+	IsRunning(name string) bool
+	IsReady(name string) bool
+	WaitReady(name string, timeout time.Duration) error
+	ExitError(name string) string
+	Adopted() []process.ProcessInfo
+	GetProcessInfo(name string) *process.ProcessInfo
+}
+
+// Clock tells the engine the time for idle detection, monthly quotas,
+// throughput rates and history.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Options replaces the engine's dependencies, e.g. to drive it from tests.
+// Zero fields use the real implementations. DNS is resolved by the
+// transports themselves, so there is no resolver to replace.
+type Options struct {
+	// Processes manages the transport processes. Defaults to a
+	// process.Manager keeping its state at config.StatePath().
+	Processes ProcessManager
+	// NewGateway creates the gateway and the extra listeners, which the engine
+	// then configures and starts. Defaults to gateway.New.
+	NewGateway func(addr string, target func() string) *gateway.Gateway
+	// Clock defaults to the system clock.
+	Clock Clock
+	// UsagePath is where monthly usage is kept. Defaults to config.UsagePath().
+	UsagePath string
+	// HistoryPath is where history is kept when the config asks for it.
+	// Defaults to config.HistoryPath().
+	HistoryPath string
+	// Policy loads the system policy, which is applied over a copy of the
+	// config at creation and on each ApplyConfig. Defaults to
+	// config.LoadPolicy.
+	Policy func() (*config.Policy, error)
+}
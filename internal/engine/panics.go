@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"github.com/net2share/dnstc/internal/crash"
+)
+
+// maxPanics is how many recovered panics the status keeps.
+const maxPanics = 10
+
+// onPanic records a panic recovered in one of the daemon's goroutines, which
+// marks the engine degraded. It may be called while the goroutine that
+// panicked holds e.mu, so the status is refreshed from another.
+func (e *Engine) onPanic(p crash.Panic) {
+	e.panicsMu.Lock()
+	e.panics = append(e.panics, p)
+	if len(e.panics) > maxPanics {
+		e.panics = e.panics[len(e.panics)-maxPanics:]
+	}
+	e.panicsMu.Unlock()
+	go e.refreshStatus()
+}
+
+// recentPanics returns a copy of the recorded panics, oldest first.
+func (e *Engine) recentPanics() []crash.Panic {
+	e.panicsMu.Lock()
+	defer e.panicsMu.Unlock()
+	return append([]crash.Panic(nil), e.panics...)
+}
+
+// isClosed reports whether a stop channel has been closed, i.e. whether a
+// loop that panicked is no longer wanted.
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
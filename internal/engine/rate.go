@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// rateMeter turns the bytes relayed through the gateway into per-second
+// rates in each direction, measured between status refreshes.
+type rateMeter struct {
+	mu      sync.Mutex
+	pending map[string][2]int64 // up, down since the last tick
+	rates   map[string][2]int64 // up, down in bytes per second
+	ticked  time.Time
+	clock   Clock
+}
+
+func newRateMeter(clock Clock) *rateMeter {
+	return &rateMeter{
+		pending: make(map[string][2]int64),
+		rates:   make(map[string][2]int64),
+		ticked:  clock.Now(),
+		clock:   clock,
+	}
+}
+
+func (m *rateMeter) add(tag string, up bool, n int64) {
+	m.mu.Lock()
+	c := m.pending[tag]
+	if up {
+		c[0] += n
+	} else {
+		c[1] += n
+	}
+	m.pending[tag] = c
+	m.mu.Unlock()
+}
+
+// tick computes the rates since the last tick.
+func (m *rateMeter) tick() {
+	now := m.clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elapsed := now.Sub(m.ticked).Seconds()
+	m.ticked = now
+	clear(m.rates)
+	if elapsed <= 0 {
+		return
+	}
+	for tag, c := range m.pending {
+		m.rates[tag] = [2]int64{int64(float64(c[0]) / elapsed), int64(float64(c[1]) / elapsed)}
+	}
+	clear(m.pending)
+}
+
+// get returns the upload and download rate of a tunnel in bytes per second.
+func (m *rateMeter) get(tag string) (up, down int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.rates[tag]
+	return r[0], r[1]
+}
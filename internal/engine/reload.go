@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/crash"
+)
+
+// ApplyConfig replaces the configuration and reconciles the runtime with it,
+// touching only what changed:
+//   - running tunnels that were removed or disabled are stopped
+//   - running tunnels whose settings changed are restarted, including the
+//     global resolver or gateway port they fall back to
+//   - added or re-enabled tunnels are started if the engine is running
+//   - the gateway is restarted if its listen address changed, and the extra
+//     listeners if they changed
+//   - a changed pending connection limit, timeout, QoS or number of
+//     prewarmed connections is applied without restarting them
+//
+// The system policy is read again and applied over a copy of cfg; cfg itself
+// is what the engine saves. An invalid configuration, or a policy that can't
+// be read, is rejected and the current one is kept.
+func (e *Engine) ApplyConfig(ctx context.Context, cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	policy, err := e.loadPolicy()
+	if err != nil {
+		return err
+	}
+
+	if err := e.lock(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	old := e.cfg
+	e.saved, e.policy = cfg, policy
+	cfg = policy.Apply(cfg)
+	e.cfg = cfg
+	binaries.SetResolver(binaries.NewResolver(cfg.Binaries))
+	crash.SetRestart(cfg.RestartOnPanic)
+	e.syncDoHLocked()
+	// A runtime override gives way to a new route.active, and goes with its tunnel
+	if cfg.Route.Active != old.Route.Active || cfg.GetTunnelByTag(e.activeOverride) == nil {
+		e.activeOverride = ""
+	}
+	engineRunning := e.gw != nil || e.gwHeld
+
+	for _, prev := range old.Tunnels {
+		if !e.procMgr.IsRunning("tunnel-" + prev.Tag) {
+			continue
+		}
+		next := cfg.GetTunnelByTag(prev.Tag)
+		switch {
+		case next == nil || !next.IsEnabled():
+			slog.Info("stopping tunnel removed from config", "tag", prev.Tag)
+			e.stopTunnelLocked(prev.Tag)
+		case tunnelChanged(old, &prev, cfg, next):
+			slog.Info("restarting tunnel with changed config", "tag", prev.Tag)
+			e.stopTunnelLocked(prev.Tag)
+			delete(e.rotation, prev.Tag)
+			if err := e.startTunnelLocked(ctx, prev.Tag); err != nil {
+				slog.Warn("failed to restart tunnel", "tag", prev.Tag, "error", err)
+			}
+		}
+	}
+
+	if !engineRunning {
+		return nil
+	}
+
+	for _, tc := range cfg.Tunnels {
+		if !tc.IsEnabled() || e.procMgr.IsRunning("tunnel-"+tc.Tag) {
+			continue
+		}
+		if prev := old.GetTunnelByTag(tc.Tag); prev != nil && prev.IsEnabled() {
+			continue // stopped on purpose or crashed; not a config change
+		}
+		slog.Info("starting tunnel added to config", "tag", tc.Tag)
+		if err := e.startTunnelLocked(ctx, tc.Tag); err != nil {
+			slog.Warn("failed to start tunnel", "tag", tc.Tag, "error", err)
+		}
+	}
+
+	switch {
+	case e.gwHeld:
+		// StartGateway starts it with the new settings
+	case cfg.Listen.SOCKS != old.Listen.SOCKS:
+		slog.Info("restarting gateway on new address", "addr", cfg.Listen.SOCKS)
+		e.stopGatewayLocked()
+		if err := e.startGatewayLocked(); err != nil {
+			return fmt.Errorf("failed to restart gateway: %w", err)
+		}
+	case !reflect.DeepEqual(cfg.Listen.Extra, old.Listen.Extra):
+		slog.Info("restarting extra listeners")
+		e.stopListenersLocked()
+		e.startListenersLocked()
+	}
+	if cfg.Listen.MaxPending != old.Listen.MaxPending || cfg.Listen.QueueMS != old.Listen.QueueMS ||
+		cfg.Listen.IdleTimeoutSec != old.Listen.IdleTimeoutSec || cfg.Listen.KeepAliveSec != old.Listen.KeepAliveSec ||
+		!reflect.DeepEqual(cfg.Listen.QoS, old.Listen.QoS) {
+		if e.gw != nil {
+			e.applyGatewaySettingsLocked(e.gw)
+		}
+		for _, l := range e.listeners {
+			e.applyGatewaySettingsLocked(l.gw)
+		}
+	}
+	if cfg.Listen.Prewarm != old.Listen.Prewarm {
+		e.applyPrewarmLocked()
+	}
+
+	return nil
+}
+
+// tunnelChanged reports whether a tunnel must be restarted to move from its
+// settings under old to those under cfg. Besides the tunnel's own settings,
+// this covers the global resolvers and gateway port it may fall back to.
+func tunnelChanged(old *config.Config, prev *config.TunnelConfig, cfg *config.Config, next *config.TunnelConfig) bool {
+	return !reflect.DeepEqual(*prev, *next) ||
+		old.GetResolver(prev) != cfg.GetResolver(next) ||
+		exposedPort(old, prev) != exposedPort(cfg, next)
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/net2share/dnstc/internal/crash"
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+// resumeGap is how far the wall clock must run ahead of the status
+// refresher before the engine assumes the system was asleep. Timers don't
+// fire during suspend, so the first tick after resume arrives late.
+const resumeGap = 30 * time.Second
+
+// sleptFor returns how long the system was suspended between two refresher
+// ticks, or 0 if it wasn't. Wall-clock readings are compared because the
+// monotonic clock stops during suspend on most platforms.
+func sleptFor(last, now time.Time) time.Duration {
+	gap := now.Round(0).Sub(last.Round(0)) - statusRefreshInterval
+	if gap < resumeGap {
+		return 0
+	}
+	return gap
+}
+
+// onResume restarts running tunnels after the system wakes up: transport
+// processes survive suspend with dead sessions and still look healthy. The
+// tunnels are then probed right away instead of at the next health round.
+func (e *Engine) onResume(slept time.Duration) {
+	slog.Info("system resumed; restarting tunnels", "slept", slept.Round(time.Second))
+
+	e.mu.Lock()
+	checks := make(map[string]string) // resolver by domain, probed below
+	for _, tc := range e.cfg.Tunnels {
+		if !e.procMgr.IsRunning("tunnel-" + tc.Tag) {
+			continue
+		}
+		e.stopTunnelLocked(tc.Tag)
+		if err := e.startTunnelLocked(context.Background(), tc.Tag); err != nil {
+			slog.Warn("failed to restart tunnel after resume", "tag", tc.Tag, "error", err)
+		}
+		if resolver, err := e.resolverAddrLocked(e.cfg.GetResolver(&tc)); err == nil {
+			checks[tc.Domain] = resolver
+		}
+	}
+	e.publishStatusLocked()
+	e.mu.Unlock()
+
+	e.health.kick()
+
+	// The network may have changed while asleep (e.g. another Wi-Fi)
+	for domain, resolver := range checks {
+		crash.Go("resume check", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if _, err := probe.ProbeResolver(ctx, resolver, domain); err != nil {
+				slog.Warn("resolver not reachable after resume", "resolver", resolver, "domain", domain, "error", err)
+			}
+		})
+	}
+}
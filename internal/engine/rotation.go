@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/crash"
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+// blockedAfter is the number of consecutive failed health probes after which
+// a tunnel with fallbacks is checked for blocking: if its resolver still
+// answers, the domain is taken to be blocked and the next fallback domain is
+// tried; if not, the next fallback resolver is.
+const blockedAfter = 3
+
+// resolverCheckTimeout bounds the query that tells a blocked domain from a
+// resolver that stopped answering.
+const resolverCheckTimeout = 5 * time.Second
+
+// rotationRestartTimeout bounds restarting a tunnel on its next fallback,
+// including waiting for the engine lock.
+const rotationRestartTimeout = 10 * time.Second
+
+// rotation is the fallback domain and resolver a tunnel runs with. Index 0 is
+// the configured primary, i the (i-1)th fallback.
+type rotation struct {
+	domain   int
+	resolver int
+	checked  int // failure count at the last check, so each streak is checked once per probe
+}
+
+// domainOf returns the domain tc runs with.
+func (r *rotation) domainOf(tc *config.TunnelConfig) string {
+	if r.domain == 0 || tc.Fallback == nil || r.domain > len(tc.Fallback.Domains) {
+		return tc.Domain
+	}
+	return tc.Fallback.Domains[r.domain-1]
+}
+
+// resolverOf returns the resolver tc runs with, primary being the configured one.
+func (r *rotation) resolverOf(tc *config.TunnelConfig, primary string) string {
+	if r.resolver == 0 || tc.Fallback == nil || r.resolver > len(tc.Fallback.Resolvers) {
+		return primary
+	}
+	return tc.Fallback.Resolvers[r.resolver-1]
+}
+
+// checkBlocking switches tunnels whose health probes keep failing to their
+// next fallback domain or resolver.
+func (e *Engine) checkBlocking() {
+	type suspect struct{ tag, resolver string }
+	var suspects []suspect
+
+	e.mu.Lock()
+	for _, tc := range e.cfg.Tunnels {
+		if tc.Fallback == nil || (len(tc.Fallback.Domains) == 0 && len(tc.Fallback.Resolvers) == 0) {
+			continue
+		}
+		failures := e.health.failures(tc.Tag)
+		r := e.rotation[tc.Tag]
+		if failures < blockedAfter || (r != nil && r.checked == failures) {
+			continue
+		}
+		if r == nil {
+			r = &rotation{}
+			e.rotation[tc.Tag] = r
+		}
+		r.checked = failures
+		resolver, err := e.resolverAddrLocked(r.resolverOf(&tc, e.cfg.GetResolver(&tc)))
+		if err != nil {
+			continue
+		}
+		suspects = append(suspects, suspect{tc.Tag, resolver})
+	}
+	e.mu.Unlock()
+
+	for _, s := range suspects {
+		ctx, cancel := context.WithTimeout(context.Background(), resolverCheckTimeout)
+		_, _, err := probe.QueryUDP(ctx, s.resolver, healthProbeName, probe.TypeA)
+		cancel()
+
+		e.mu.Lock()
+		rotated := e.health.failures(s.tag) >= blockedAfter && e.rotateLocked(s.tag, err == nil)
+		e.mu.Unlock()
+		if rotated {
+			crash.Go("tunnel rotation", func() { e.restartRotated(s.tag) })
+		}
+	}
+}
+
+// rotateLocked moves a tunnel to its next fallback domain, or to its next
+// fallback resolver if the current one stopped answering. After the last
+// fallback it goes back to the primary. It reports whether the tunnel must
+// be restarted. Caller must hold e.mu.
+func (e *Engine) rotateLocked(tag string, resolverOK bool) bool {
+	tc := e.cfg.GetTunnelByTag(tag)
+	r := e.rotation[tag]
+	if tc == nil || tc.Fallback == nil || r == nil {
+		return false
+	}
+
+	primaryResolver := e.cfg.GetResolver(tc)
+	switch {
+	case resolverOK && len(tc.Fallback.Domains) > 0:
+		from := r.domainOf(tc)
+		r.domain = (r.domain + 1) % (len(tc.Fallback.Domains) + 1)
+		slog.Warn("tunnel domain appears blocked; switching to another domain",
+			"tag", tag, "from", from, "to", r.domainOf(tc), "failed_probes", r.checked)
+	case !resolverOK && len(tc.Fallback.Resolvers) > 0:
+		from := r.resolverOf(tc, primaryResolver)
+		r.resolver = (r.resolver + 1) % (len(tc.Fallback.Resolvers) + 1)
+		slog.Warn("tunnel resolver is not answering; switching to another resolver",
+			"tag", tag, "from", from, "to", r.resolverOf(tc, primaryResolver), "failed_probes", r.checked)
+	default:
+		return false
+	}
+	r.checked = 0
+	return true
+}
+
+// restartRotated restarts a tunnel on the fallback rotateLocked moved it to.
+// It runs apart from the status refresher and gives up if the engine stays
+// busy, so a rotation never holds up control operations for long.
+func (e *Engine) restartRotated(tag string) {
+	ctx, cancel := context.WithTimeout(context.Background(), rotationRestartTimeout)
+	defer cancel()
+	if err := e.lock(ctx); err != nil {
+		slog.Warn("failed to restart tunnel on fallback", "tag", tag, "error", err)
+		return
+	}
+	defer e.mu.Unlock()
+	defer e.publishStatusLocked()
+
+	if !e.procMgr.IsRunning("tunnel-" + tag) {
+		return // stopped meanwhile
+	}
+	if err := e.stopTunnelLocked(tag); err != nil {
+		slog.Warn("failed to stop tunnel", "tag", tag, "error", err)
+		return
+	}
+	if err := e.startTunnelLocked(ctx, tag); err != nil {
+		slog.Warn("failed to restart tunnel", "tag", tag, "error", err)
+	}
+}
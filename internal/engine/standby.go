@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// standbyAfter is the number of consecutive failed health probes after which
+// a running active tunnel counts as down and the standby takes over.
+const standbyAfter = 2
+
+// routeLocked returns the tunnel the gateway sends new connections through:
+// the active tunnel, or route.standby while the active one is down and the
+// standby is up. Caller must hold e.mu.
+func (e *Engine) routeLocked() string {
+	active := e.activeLocked()
+	standby := e.cfg.Route.Standby
+	if standby == "" || standby == active || !e.downLocked(active) || e.downLocked(standby) {
+		return active
+	}
+	return standby
+}
+
+// downLocked reports whether a tunnel can't carry connections: it isn't
+// running and ready, or its health probes keep failing. Caller must hold e.mu.
+func (e *Engine) downLocked(tag string) bool {
+	return e.tunnelTargetLocked(tag) == "" || !e.procMgr.IsReady("tunnel-"+tag) ||
+		e.health.failures(tag) >= standbyAfter
+}
+
+// logFailover logs the gateway moving to the standby tunnel and back.
+func (e *Engine) logFailover(s *Status) {
+	on := s.Routing != ""
+	if e.failedOver.Swap(on) == on {
+		return
+	}
+	if on {
+		slog.Warn("active tunnel is down; routing through the standby", "active", s.Active, "standby", s.Routing)
+	} else {
+		slog.Info("active tunnel is back; routing through it again", "active", s.Active)
+	}
+}
+
+// StandbyNotice explains that the gateway routes through the standby tunnel
+// because the active one is down, or returns "" if it doesn't.
+func (s *Status) StandbyNotice() string {
+	if s.Routing == "" {
+		return ""
+	}
+	return fmt.Sprintf("active tunnel '%s' is down; new connections go through standby '%s'", s.Active, s.Routing)
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// statusFile mirrors status snapshots to the file set by status_file, so
+// status bars and dashboards can read it without talking to the daemon.
+// The file is replaced atomically, and only when the status changed.
+type statusFile struct {
+	mu      sync.Mutex
+	path    string
+	last    []byte
+	lastErr string
+}
+
+func (f *statusFile) write(path string, s *Status) {
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if path == f.path && bytes.Equal(data, f.last) {
+		return
+	}
+
+	out, _ := json.MarshalIndent(struct {
+		Updated time.Time `json:"updated"`
+		*Status
+	}{time.Now(), s}, "", "  ")
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, append(out, '\n'), 0644)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		// Log once per distinct failure, not on every status change
+		if err.Error() != f.lastErr {
+			slog.Warn("failed to write status file", "path", path, "error", err)
+			f.lastErr = err.Error()
+		}
+		return
+	}
+	f.path, f.last, f.lastErr = path, data, ""
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// targetCache memoizes where the gateway sends connections, so that each new
+// connection doesn't take e.mu and check its tunnel's liveness. It holds
+// what was true at the last state change: publishStatusLocked, which runs on
+// every tunnel, route and config change and on each status refresh, drops it.
+type targetCache struct {
+	gen    uint64          // e.targetGen when it was built
+	active string          // the tunnel the gateway routes through, see routeLocked
+	asleep map[string]bool // tunnels in economy mode
+
+	mu      sync.Mutex
+	targets map[string]string        // tag → SOCKS address, "" if not usable
+	dials   map[string]time.Duration // SOCKS address → the tunnel's dial timeout
+}
+
+// target returns the address of tunnel tag, resolving it on first use.
+func (c *targetCache) target(tag string, resolve func(string) string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.targets[tag]; ok {
+		return t
+	}
+	t := resolve(tag)
+	c.targets[tag] = t
+	return t
+}
+
+// dialTimeout returns the dial timeout of the tunnel at addr, resolving it on
+// first use.
+func (c *targetCache) dialTimeout(addr string, resolve func(string) time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.dials[addr]; ok {
+		return d
+	}
+	d := resolve(addr)
+	c.dials[addr] = d
+	return d
+}
+
+// invalidateTargetsLocked drops the target cache. Caller must hold e.mu, for
+// reading at least.
+func (e *Engine) invalidateTargetsLocked() {
+	e.targetGen.Add(1)
+	e.targets.Store(nil)
+}
+
+// targetCache returns the current target cache, building it if needed. A
+// cache built while the state changed is used for that connection only.
+func (e *Engine) targetCache() *targetCache {
+	gen := e.targetGen.Load()
+	if c := e.targets.Load(); c != nil && c.gen == gen {
+		return c
+	}
+
+	e.mu.RLock()
+	c := &targetCache{
+		gen:     gen,
+		active:  e.routeLocked(),
+		asleep:  maps.Clone(e.economy),
+		targets: make(map[string]string),
+		dials:   make(map[string]time.Duration),
+	}
+	e.mu.RUnlock()
+	if e.targetGen.Load() == gen {
+		e.targets.Store(c)
+	}
+	return c
+}
+
+// lockedTarget resolves a tunnel's address under e.mu, for targetCache.
+func (e *Engine) lockedTarget(tag string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.tunnelTargetLocked(tag)
+}
+
+// dialTimeout returns how long the gateway may take to connect to the
+// tunnel at addr, as set by its network preset, or 0 for the default.
+func (e *Engine) dialTimeout(addr string) time.Duration {
+	return e.targetCache().dialTimeout(addr, e.lockedDialTimeout)
+}
+
+// lockedDialTimeout resolves a dial timeout under e.mu, for targetCache.
+func (e *Engine) lockedDialTimeout(addr string) time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, tc := range e.cfg.Tunnels {
+		if e.tunnelTargetLocked(tc.Tag) == addr {
+			return tc.Tuning().DialTimeout
+		}
+	}
+	return 0
+}
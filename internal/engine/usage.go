@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// usageSaveInterval is how often changed usage counters are written to disk.
+const usageSaveInterval = 30 * time.Second
+
+// Quota warning levels, per tunnel and month.
+const (
+	quotaWarned = 1 // warn_percent reached
+	quotaUsedUp = 2 // quota reached
+)
+
+// usage counts the bytes each tunnel carries through the gateway in the
+// current calendar month. Counters survive restarts in a small JSON file.
+type usage struct {
+	mu    sync.Mutex
+	path  string
+	month string
+	bytes map[string]int64
+	dirty bool
+	saved time.Time
+	clock Clock
+}
+
+type usageFile struct {
+	Month   string           `json:"month"`
+	Tunnels map[string]int64 `json:"tunnels"`
+}
+
+func (u *usage) currentMonth() string {
+	return u.clock.Now().Format("2006-01")
+}
+
+// loadUsage reads the counters saved at path, if they are for this month.
+func loadUsage(path string, clock Clock) *usage {
+	u := &usage{path: path, bytes: make(map[string]int64), clock: clock}
+	u.month = u.currentMonth()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return u
+	}
+	var f usageFile
+	if json.Unmarshal(data, &f) == nil && f.Month == u.month {
+		for tag, n := range f.Tunnels {
+			u.bytes[tag] = n
+		}
+	}
+	return u
+}
+
+func (u *usage) add(tag string, n int64) {
+	u.mu.Lock()
+	u.bytes[tag] += n
+	u.dirty = true
+	u.mu.Unlock()
+}
+
+func (u *usage) get(tag string) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.bytes[tag]
+}
+
+// roll resets the counters when a new month starts and reports whether it did.
+func (u *usage) roll() bool {
+	month := u.currentMonth()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if month == u.month {
+		return false
+	}
+	u.month = month
+	clear(u.bytes)
+	u.dirty = true
+	return true
+}
+
+// save writes the counters if they changed since the last save, at most
+// once per usageSaveInterval unless force is set.
+func (u *usage) save(force bool) {
+	u.mu.Lock()
+	if !u.dirty || (!force && u.clock.Now().Sub(u.saved) < usageSaveInterval) {
+		u.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(usageFile{Month: u.month, Tunnels: u.bytes})
+	u.dirty = false
+	u.saved = u.clock.Now()
+	u.mu.Unlock()
+
+	if err == nil {
+		err = os.WriteFile(u.path, data, 0600)
+	}
+	if err != nil {
+		slog.Warn("failed to save usage counters", "error", err)
+	}
+}
+
+// countBytes attributes bytes relayed by a gateway to the tunnel listening
+// on target. It runs on every write, so it reads the lock-free status
+// snapshot instead of the config.
+func (e *Engine) countBytes(target string, up bool, n int64) {
+	p := extractPort(target)
+	for tag, ts := range e.status.Load().Tunnels {
+		if ts.Port == p {
+			e.usage.add(tag, n)
+			e.history.add(tag, n)
+			e.rates.add(tag, up, n)
+			return
+		}
+	}
+}
+
+// checkQuotas logs quota warnings, stops tunnels whose quota is used up if
+// configured to, and starts them again when a new month begins.
+func (e *Engine) checkQuotas() {
+	rolled := e.usage.roll()
+	defer e.usage.save(false)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if rolled {
+		clear(e.quotaLevel)
+		for tag := range e.quotaStopped {
+			delete(e.quotaStopped, tag)
+			slog.Info("new month; starting tunnel stopped by its quota", "tag", tag)
+			if err := e.startTunnelLocked(context.Background(), tag); err != nil {
+				slog.Warn("failed to start tunnel", "tag", tag, "error", err)
+			}
+		}
+		e.publishStatusLocked()
+	}
+
+	for _, tc := range e.cfg.Tunnels {
+		q := tc.Quota
+		if q == nil {
+			continue
+		}
+		used := e.usage.get(tc.Tag)
+
+		level := 0
+		if used >= q.WarnAt() {
+			level = quotaWarned
+		}
+		if used >= q.Bytes() {
+			level = quotaUsedUp
+		}
+		if level > e.quotaLevel[tc.Tag] {
+			e.quotaLevel[tc.Tag] = level
+			if level == quotaWarned {
+				slog.Warn("tunnel is nearing its monthly quota", "tag", tc.Tag, "used_mb", used>>20, "quota_mb", q.MonthlyMB)
+			} else {
+				slog.Warn("tunnel has used up its monthly quota", "tag", tc.Tag, "used_mb", used>>20, "quota_mb", q.MonthlyMB)
+			}
+		}
+
+		if level == quotaUsedUp && q.Stop && !e.quotaStopped[tc.Tag] && e.procMgr.IsRunning("tunnel-"+tc.Tag) {
+			slog.Warn("stopping tunnel until next month", "tag", tc.Tag)
+			e.stopTunnelLocked(tc.Tag)
+			e.quotaStopped[tc.Tag] = true
+			e.publishStatusLocked()
+		}
+	}
+}
@@ -4,11 +4,16 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/net2share/dnstc/internal/crash"
 )
 
 // Gateway is a TCP relay that listens on a local port and forwards
@@ -17,9 +22,28 @@ type Gateway struct {
 	addr     string
 	listener net.Listener
 	target   func() string // returns "host:port" of active tunnel
+	count    func(target string, up bool, n int64)
+	limits   atomic.Pointer[limiter]
+	refused  atomic.Int64
+	sched    atomic.Pointer[scheduler]
+	timeouts atomic.Pointer[Timeouts]
+	prewarm  atomic.Pointer[Prewarm]
 	ctx      context.Context
 	cancel   context.CancelFunc
 	wg       sync.WaitGroup
+
+	dialTimeout func(target string) time.Duration // see SetDialTimeout
+
+	// Handover state (see Detach)
+	detaching atomic.Bool
+	relaysMu  sync.Mutex
+	relays    map[*relay]struct{}
+	detached  []*relay
+
+	// Prewarmed connections (see SetPrewarm)
+	poolMu      sync.Mutex
+	pool        []*pooledConn
+	prewarmKick chan struct{}
 }
 
 // New creates a new gateway. targetFunc is called per-connection to
@@ -31,9 +55,46 @@ func New(addr string, targetFunc func() string) *Gateway {
 		target: targetFunc,
 		ctx:    ctx,
 		cancel: cancel,
+		relays: make(map[*relay]struct{}),
+
+		prewarmKick: make(chan struct{}, 1),
 	}
 }
 
+// SetCounter sets a function called with the tunnel address, the direction
+// (up is towards the tunnel) and the number of bytes each time data is
+// relayed. It must be set before Start.
+func (g *Gateway) SetCounter(count func(target string, up bool, n int64)) {
+	g.count = count
+}
+
+// SetLimits bounds the connections that wait for the tunnel to answer. It
+// may be called while running; connections already waiting keep their place,
+// and the limiter is kept as is if l does not change it.
+func (g *Gateway) SetLimits(l Limits) {
+	old := g.limits.Load()
+	if old != nil && old.limits == l {
+		return
+	}
+	next := newLimiter(l)
+	if old != nil && next != nil {
+		next.handshake.Store(old.handshake.Load())
+	}
+	g.limits.Store(next)
+}
+
+// SetQoS enables prioritizing interactive connections, or disables it if q
+// is nil. It may be called while running and applies to new connections.
+func (g *Gateway) SetQoS(q *QoS) {
+	g.sched.Store(newScheduler(q))
+}
+
+// Refused returns the number of connections turned away because too many
+// were waiting for the tunnel.
+func (g *Gateway) Refused() int64 {
+	return g.refused.Load()
+}
+
 // Start begins accepting connections on the gateway port.
 func (g *Gateway) Start() error {
 	ln, err := net.Listen("tcp", g.addr)
@@ -43,8 +104,7 @@ func (g *Gateway) Start() error {
 	}
 	g.listener = ln
 
-	g.wg.Add(1)
-	go g.acceptLoop()
+	g.startLoops()
 
 	return nil
 }
@@ -59,6 +119,35 @@ func (g *Gateway) Stop() error {
 	return nil
 }
 
+// Drain stops accepting connections and lets the active ones finish,
+// closing any still open after timeout. It returns once all have ended.
+func (g *Gateway) Drain(timeout time.Duration) {
+	g.cancel()
+	if g.listener != nil {
+		g.listener.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	g.relaysMu.Lock()
+	for r := range g.relays {
+		r.src.Close()
+		r.dst.Close()
+	}
+	g.relaysMu.Unlock()
+	<-done
+}
+
 // Addr returns the actual listen address (useful when port was auto-assigned).
 func (g *Gateway) Addr() string {
 	if g.listener != nil {
@@ -67,9 +156,32 @@ func (g *Gateway) Addr() string {
 	return g.addr
 }
 
-func (g *Gateway) acceptLoop() {
-	defer g.wg.Done()
+// Active returns the number of connections currently being relayed.
+func (g *Gateway) Active() int {
+	g.relaysMu.Lock()
+	defer g.relaysMu.Unlock()
+	return len(g.relays)
+}
+
+// startLoops starts the accept, reaper and prewarm loops, supervised so that
+// a panic in any is reported and, if restarts are on, recovered from. The
+// prewarm loop isn't waited for on Stop: its target function may wait on a
+// caller that is stopping the gateway. It closes its connections on its way out.
+func (g *Gateway) startLoops() {
+	running := func() bool { return g.ctx.Err() == nil }
+	g.wg.Add(2)
+	go func() {
+		defer g.wg.Done()
+		crash.Supervise("gateway accept loop", g.acceptLoop, running)
+	}()
+	go func() {
+		defer g.wg.Done()
+		crash.Supervise("gateway reaper", g.reapLoop, running)
+	}()
+	go crash.Supervise("gateway prewarm", g.prewarmLoop, running)
+}
 
+func (g *Gateway) acceptLoop() {
 	for {
 		conn, err := g.listener.Accept()
 		if err != nil {
@@ -88,23 +200,125 @@ func (g *Gateway) acceptLoop() {
 
 func (g *Gateway) handleConn(src net.Conn) {
 	defer g.wg.Done()
-	defer src.Close()
+	defer crash.Recover("gateway connection")
+
+	var s *slot
+	if l := g.limits.Load(); l != nil {
+		if s = l.acquire(g.ctx); s == nil {
+			g.refused.Add(1)
+			refuse(src)
+			return
+		}
+	}
 
 	target := g.target()
 	if target == "" {
+		s.free(false)
+		src.Close()
 		return
 	}
 
-	dst, err := net.DialTimeout("tcp", target, 5*time.Second)
+	dst, err := g.dial(target)
 	if err != nil {
+		s.free(false)
+		src.Close()
 		return
 	}
-	defer dst.Close()
+	g.keepAlive(src)
+	g.keepAlive(dst)
+
+	g.relay(src, dst, s, g.sched.Load().conn())
+}
+
+// relay copies data between src and dst until both sides have finished
+// sending, or either fails. s, if not nil, is freed once dst first answers;
+// q, if not nil, paces the connection while it is bulk.
+func (g *Gateway) relay(src, dst net.Conn, s *slot, q *qosConn) {
+	defer s.free(false)
+
+	r := &relay{src: src, dst: dst}
+	r.active.Store(time.Now().UnixNano())
+	if !g.track(r) {
+		src.Close()
+		dst.Close()
+		return
+	}
+
+	var up, down io.Writer = dst, src
+	if s != nil {
+		down = &answerWriter{w: down, slot: s}
+	}
+	if q != nil {
+		up = &qosWriter{w: up, c: q, up: true}
+		down = &qosWriter{w: down, c: q}
+	}
+	if g.count != nil {
+		target := dst.RemoteAddr().String()
+		up = &countingWriter{w: up, target: target, up: true, count: g.count}
+		down = &countingWriter{w: down, target: target, count: g.count}
+	}
+	up = &activityWriter{w: up, active: &r.active}
+	down = &activityWriter{w: down, active: &r.active}
+
+	// Each copy reports the connection it wrote to
+	type copied struct {
+		to  net.Conn
+		err error
+	}
+	done := make(chan copied, 2)
+	go func() { done <- copied{dst, copyConn(up, src)} }()
+	go func() { done <- copied{src, copyConn(down, dst)} }()
 
-	errc := make(chan error, 2)
-	go func() { _, err := io.Copy(dst, src); errc <- err }()
-	go func() { _, err := io.Copy(src, dst); errc <- err }()
+	// Wait for first direction to finish. During a handover both directions
+	// stop on their read deadline and the pair is kept open for the new daemon.
+	first := <-done
+	if g.detaching.Load() && errors.Is(first.err, os.ErrDeadlineExceeded) {
+		if second := <-done; errors.Is(second.err, os.ErrDeadlineExceeded) {
+			g.untrack(r, true)
+			return
+		}
+	} else if first.err == nil && closeWrite(first.to) == nil {
+		// One side finished sending: pass that on and let the other side
+		// finish its answer, e.g. a client that shuts down writing after
+		// its request.
+		r.halfClosed.Store(true)
+		<-done
+	}
+
+	// Closing both terminates the other direction.
+	g.untrack(r, false)
+	src.Close()
+	dst.Close()
+}
 
-	// Wait for first direction to finish; deferred Close()s terminate the other.
-	<-errc
+// errPanicked ends a relay whose copy panicked.
+var errPanicked = errors.New("relay panicked")
+
+// copyConn copies src to dst. A panic, e.g. in one of the writers wrapping
+// dst, is reported and ends the relay as an error would.
+func copyConn(dst io.Writer, src io.Reader) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			crash.Report("gateway relay", v)
+			err = errPanicked
+		}
+	}()
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// countingWriter reports the bytes written through it.
+type countingWriter struct {
+	w      io.Writer
+	target string
+	up     bool
+	count  func(target string, up bool, n int64)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if n > 0 {
+		c.count(c.target, c.up, int64(n))
+	}
+	return n, err
 }
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/net2share/dnstc/internal/crash"
+)
+
+// relay is an in-flight client connection and its tunnel connection.
+type relay struct {
+	src, dst   net.Conn
+	active     atomic.Int64 // unix nanos of the last data either way
+	halfClosed atomic.Bool  // one side has finished sending
+}
+
+// filer is implemented by *net.TCPConn, *net.TCPListener and friends.
+type filer interface {
+	File() (*os.File, error)
+}
+
+// StartWithListener begins accepting connections on an inherited listener.
+func (g *Gateway) StartWithListener(ln net.Listener) {
+	g.listener = ln
+	g.startLoops()
+}
+
+// Resume relays inherited connection pairs handed over by a previous daemon.
+func (g *Gateway) Resume(pairs [][2]net.Conn) {
+	for _, pair := range pairs {
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			defer crash.Recover("gateway relay")
+			g.relay(pair[0], pair[1], nil, nil)
+		}()
+	}
+}
+
+// Detach stops the gateway without closing its listener or in-flight
+// connections and returns duplicated files for them, for handover to a new
+// process. Relays are paused at a point where no data is buffered in user
+// space; any that can't be paused cleanly are closed.
+func (g *Gateway) Detach() (*os.File, [][2]*os.File, error) {
+	lf, ok := g.listener.(filer)
+	if !ok {
+		return nil, nil, errors.New("gateway listener can't be handed over")
+	}
+	lnFile, err := lf.File()
+	if err != nil {
+		return nil, nil, fmt.Errorf("gateway listener: %w", err)
+	}
+
+	// Stop accepting: a past deadline unblocks Accept without closing the socket
+	g.detaching.Store(true)
+	g.cancel()
+	if tl, ok := g.listener.(*net.TCPListener); ok {
+		tl.SetDeadline(time.Now())
+	}
+
+	// Pause relays: a past read deadline makes both copy loops return after
+	// finishing any write in progress.
+	g.relaysMu.Lock()
+	for r := range g.relays {
+		r.src.SetReadDeadline(time.Now())
+		r.dst.SetReadDeadline(time.Now())
+	}
+	g.relaysMu.Unlock()
+
+	g.wg.Wait()
+	g.listener.Close()
+
+	var pairs [][2]*os.File
+	for _, r := range g.detached {
+		srcFile, err1 := fileOf(r.src)
+		dstFile, err2 := fileOf(r.dst)
+		if err1 == nil && err2 == nil {
+			pairs = append(pairs, [2]*os.File{srcFile, dstFile})
+		} else {
+			if srcFile != nil {
+				srcFile.Close()
+			}
+			if dstFile != nil {
+				dstFile.Close()
+			}
+		}
+		r.src.Close()
+		r.dst.Close()
+	}
+	g.detached = nil
+
+	return lnFile, pairs, nil
+}
+
+func fileOf(c net.Conn) (*os.File, error) {
+	f, ok := c.(filer)
+	if !ok {
+		return nil, errors.New("connection can't be handed over")
+	}
+	return f.File()
+}
+
+// track registers an active relay. Returns false if the gateway is detaching.
+func (g *Gateway) track(r *relay) bool {
+	g.relaysMu.Lock()
+	defer g.relaysMu.Unlock()
+	if g.detaching.Load() {
+		return false
+	}
+	g.relays[r] = struct{}{}
+	return true
+}
+
+// untrack removes a finished relay, keeping it for handover if paused.
+func (g *Gateway) untrack(r *relay, paused bool) {
+	g.relaysMu.Lock()
+	defer g.relaysMu.Unlock()
+	delete(g.relays, r)
+	if paused {
+		g.detached = append(g.detached, r)
+	}
+}
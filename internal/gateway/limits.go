@@ -0,0 +1,248 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits bounds the connections that wait on a saturated tunnel.
+type Limits struct {
+	// MaxPending is the number of connections that may wait at once for the
+	// tunnel's first reply, i.e. for the first data from the destination
+	// after the SOCKS handshake. 0 means no limit.
+	MaxPending int
+	// QueueTimeout is how long a connection over the limit waits for a slot
+	// before it is refused. 0 adapts it to how long handshakes take.
+	QueueTimeout time.Duration
+}
+
+// Bounds of the adaptive queue timeout, which is a few handshake times.
+const (
+	minQueueTimeout    = time.Second
+	maxQueueTimeout    = 10 * time.Second
+	queueTimeoutFactor = 3
+)
+
+// refuseTimeout bounds the SOCKS exchange used to turn a connection away.
+const refuseTimeout = 2 * time.Second
+
+// limiter hands out the MaxPending slots.
+type limiter struct {
+	limits    Limits
+	slots     chan struct{}
+	timeout   time.Duration
+	handshake atomic.Int64 // moving average of handshake times, in nanoseconds
+}
+
+func newLimiter(l Limits) *limiter {
+	if l.MaxPending <= 0 {
+		return nil
+	}
+	return &limiter{limits: l, slots: make(chan struct{}, l.MaxPending), timeout: l.QueueTimeout}
+}
+
+// queueTimeout returns how long a connection may wait for a slot.
+func (l *limiter) queueTimeout() time.Duration {
+	if l.timeout > 0 {
+		return l.timeout
+	}
+	return min(max(time.Duration(l.handshake.Load())*queueTimeoutFactor, minQueueTimeout), maxQueueTimeout)
+}
+
+// acquire waits for a slot. It returns nil if none frees up in time.
+func (l *limiter) acquire(ctx context.Context) *slot {
+	s := &slot{l: l, start: time.Now()}
+	select {
+	case l.slots <- struct{}{}:
+		return s
+	default:
+	}
+
+	timer := time.NewTimer(l.queueTimeout())
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		s.start = time.Now()
+		return s
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// observe adds a handshake time to the moving average.
+func (l *limiter) observe(d time.Duration) {
+	old := l.handshake.Load()
+	if old == 0 {
+		l.handshake.Store(int64(d))
+		return
+	}
+	l.handshake.Store(old + (int64(d)-old)/8)
+}
+
+// slot is a pending connection's place under MaxPending. It is held until the
+// tunnel first answers or the connection ends.
+type slot struct {
+	l     *limiter
+	start time.Time
+	once  sync.Once
+}
+
+// free gives the slot back. answered tells whether the tunnel replied, so
+// the handshake time counts toward the queue timeout.
+func (s *slot) free(answered bool) {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		if answered {
+			s.l.observe(time.Since(s.start))
+		}
+		<-s.l.slots
+	})
+}
+
+// answerWriter frees a slot once the tunnel has answered: on the first byte
+// from the tunnel that follows its SOCKS replies. The SOCKS method selection
+// and, for Shadowsocks, the CONNECT reply come from the local transport
+// process without crossing the tunnel, so they are not counted as an answer.
+type answerWriter struct {
+	w    io.Writer
+	slot *slot
+	buf  []byte
+	done bool
+}
+
+// answerSniffLimit is the most tunnel data buffered while looking for the
+// end of the SOCKS replies.
+const answerSniffLimit = 1024
+
+func (a *answerWriter) Write(p []byte) (int, error) {
+	if !a.done {
+		a.buf = append(a.buf, p...)
+		n, ok, failed := socksReplyLen(a.buf)
+		switch {
+		case failed:
+			// A refused CONNECT is the tunnel's answer; no data follows.
+			a.slot.free(true)
+			a.done = true
+		case ok && len(a.buf) > n, len(a.buf) > answerSniffLimit:
+			a.slot.free(true)
+			a.done = true
+		}
+		if a.done {
+			a.buf = nil
+		}
+	}
+	return a.w.Write(p)
+}
+
+// socksReplyLen returns the length of the SOCKS replies at the start of the
+// data b received from the tunnel. ok is false while b may be an incomplete
+// reply; failed reports a complete SOCKS5 reply refusing the request. Data
+// that is not a SOCKS reply has length 0.
+func socksReplyLen(b []byte) (n int, ok, failed bool) {
+	if len(b) < 1 {
+		return 0, false, false
+	}
+	switch b[0] {
+	case 0: // SOCKS4: VN CD DSTPORT DSTIP
+		if len(b) < 2 {
+			return 0, false, false
+		}
+		return 8, true, b[1] != 90
+	case 5:
+	default:
+		return 0, true, false
+	}
+
+	// Method selection: VER METHOD, then the username/password status
+	// (RFC 1929) if that method was chosen.
+	if len(b) < 2 {
+		return 0, false, false
+	}
+	i := 2
+	switch b[1] {
+	case 0:
+	case 2:
+		if len(b) < i+2 {
+			return 0, false, false
+		}
+		if b[i+1] != 0 {
+			return i + 2, true, true
+		}
+		i += 2
+	default:
+		return i, true, b[1] == 0xff
+	}
+
+	// Reply: VER REP RSV ATYP BND.ADDR BND.PORT
+	if len(b) < i+5 {
+		return 0, false, false
+	}
+	var addrLen int
+	switch b[i+3] {
+	case 1:
+		addrLen = 4
+	case 3:
+		addrLen = 1 + int(b[i+4])
+	case 4:
+		addrLen = 16
+	default:
+		return i, true, false
+	}
+	end := i + 4 + addrLen + 2
+	if len(b) < end {
+		return 0, false, false
+	}
+	return end, true, b[i+1] != 0
+}
+
+// refuse turns a connection away. SOCKS5 clients are answered with a general
+// failure so that browsers show an error at once instead of waiting; anything
+// else is just closed.
+func refuse(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(refuseTimeout))
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil || hdr[0] != 5 {
+		return
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	if !bytes.Contains(methods, []byte{0}) {
+		conn.Write([]byte{5, 0xff}) // no acceptable methods
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// Read the whole request, so that closing doesn't reset the connection
+	// before the client has read the reply
+	var req [5]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return
+	}
+	var rest int
+	switch req[3] {
+	case 1: // IPv4
+		rest = 4 - 1 + 2
+	case 3: // domain name, req[4] is its length
+		rest = int(req[4]) + 2
+	case 4: // IPv6
+		rest = 16 - 1 + 2
+	default:
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, rest)); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0}) // general SOCKS server failure
+}
@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSOCKS is a SOCKS5 server that, like sslocal or ssh -D, answers the
+// greeting at once. With stall set it never answers the CONNECT request;
+// otherwise it replies and sends some payload.
+func fakeSOCKS(t *testing.T, stall bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		ln.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := io.ReadFull(conn, make([]byte, 3)); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+				if _, err := io.ReadFull(conn, make([]byte, 10)); err != nil {
+					return
+				}
+				if stall {
+					<-done
+					return
+				}
+				conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80})
+				conn.Write([]byte("hello"))
+				<-done
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// socksConnect performs a SOCKS5 CONNECT through the gateway at addr.
+func socksConnect(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte{5, 1, 0})
+	if _, err := io.ReadFull(conn, make([]byte, 2)); err != nil {
+		t.Fatalf("reading method selection: %v", err)
+	}
+	conn.Write([]byte{5, 1, 0, 1, 1, 2, 3, 4, 0, 80})
+	return conn
+}
+
+func startGateway(t *testing.T, target string) *Gateway {
+	t.Helper()
+	g := New("127.0.0.1:0", func() string { return target })
+	g.SetLimits(Limits{MaxPending: 1, QueueTimeout: 200 * time.Millisecond})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Drain(0) })
+	return g
+}
+
+func TestPendingHeldUntilConnectAnswered(t *testing.T) {
+	g := startGateway(t, fakeSOCKS(t, true))
+
+	socksConnect(t, g.Addr())
+	second := socksConnect(t, g.Addr())
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(second, reply); err != nil {
+		t.Fatalf("second connection: %v", err)
+	}
+	if reply[1] != 1 {
+		t.Errorf("second connection reply = %v, want general failure", reply)
+	}
+	if n := g.Refused(); n != 1 {
+		t.Errorf("Refused() = %d, want 1", n)
+	}
+}
+
+func TestPendingFreedByPayload(t *testing.T) {
+	g := startGateway(t, fakeSOCKS(t, false))
+
+	for i := range 2 {
+		conn := socksConnect(t, g.Addr())
+		buf := make([]byte, 10+len("hello"))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("connection %d: %v", i, err)
+		}
+		if string(buf[10:]) != "hello" {
+			t.Errorf("connection %d payload = %q", i, buf[10:])
+		}
+	}
+	if n := g.Refused(); n != 0 {
+		t.Errorf("Refused() = %d, want 0", n)
+	}
+}
+
+func TestSetLimitsKeepsPending(t *testing.T) {
+	g := New("127.0.0.1:0", func() string { return "" })
+	g.SetLimits(Limits{MaxPending: 1})
+	l := g.limits.Load()
+	l.observe(time.Second)
+
+	g.SetLimits(Limits{MaxPending: 1})
+	if g.limits.Load() != l {
+		t.Error("unchanged limits replaced the limiter")
+	}
+
+	g.SetLimits(Limits{MaxPending: 2})
+	if got := g.limits.Load().handshake.Load(); got != int64(time.Second) {
+		t.Errorf("handshake average = %v after change, want %v", time.Duration(got), time.Second)
+	}
+}
+
+func TestSOCKSReplyLen(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     []byte
+		n      int
+		ok     bool
+		failed bool
+	}{
+		{"empty", nil, 0, false, false},
+		{"not socks", []byte("SSH-2.0"), 0, true, false},
+		{"method only", []byte{5, 0}, 0, false, false},
+		{"no acceptable method", []byte{5, 0xff}, 2, true, true},
+		{"ipv4 reply", []byte{5, 0, 5, 0, 0, 1, 1, 2, 3, 4, 0, 80}, 12, true, false},
+		{"reply partial", []byte{5, 0, 5, 0, 0, 1, 1, 2}, 0, false, false},
+		{"domain reply", []byte{5, 0, 5, 0, 0, 3, 1, 'a', 0, 80}, 10, true, false},
+		{"ipv6 reply", append(append([]byte{5, 0, 5, 0, 0, 4}, make([]byte, 16)...), 0, 80), 24, true, false},
+		{"refused", []byte{5, 0, 5, 5, 0, 1, 0, 0, 0, 0, 0, 0}, 12, true, true},
+		{"auth ok", []byte{5, 2, 1, 0, 5, 0, 0, 1, 1, 2, 3, 4, 0, 80}, 14, true, false},
+		{"auth failed", []byte{5, 2, 1, 1}, 4, true, true},
+		{"socks4 granted", []byte{0, 90, 0, 80, 1, 2, 3, 4}, 8, true, false},
+		{"socks4 rejected", []byte{0, 91, 0, 0, 0, 0, 0, 0}, 8, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, ok, failed := socksReplyLen(tt.in)
+			if n != tt.n || ok != tt.ok || failed != tt.failed {
+				t.Errorf("socksReplyLen(%v) = %d, %v, %v; want %d, %v, %v",
+					tt.in, n, ok, failed, tt.n, tt.ok, tt.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// Prewarm keeps connections to the tunnel open ahead of use, so that a new
+// client skips opening a stream through the tunnel, which takes several DNS
+// round trips. It only helps where the tunnel opens the stream as soon as the
+// local connection is made and the far end waits for the client to speak
+// first, as a SOCKS backend does.
+type Prewarm struct {
+	Conns  int           // connections kept open; 0 disables prewarming
+	Target func() string // where to keep them open, or "" for nowhere for now
+}
+
+const (
+	// prewarmInterval is how often the pool is checked and topped up.
+	prewarmInterval = 5 * time.Second
+	// prewarmMaxAge replaces pooled connections before the far end, e.g. a
+	// SOCKS server with a negotiation timeout, gives up waiting for them.
+	prewarmMaxAge = 20 * time.Second
+	// prewarmDialTimeout bounds dialing a pooled connection.
+	prewarmDialTimeout = 5 * time.Second
+)
+
+// pooledConn is a prewarmed connection waiting for a client.
+type pooledConn struct {
+	net.Conn
+	target string
+	dialed time.Time
+}
+
+// usable reports whether c is still open to target and young enough to use.
+func (c *pooledConn) usable(target string) bool {
+	return c.target == target && time.Since(c.dialed) < prewarmMaxAge && isOpen(c.Conn)
+}
+
+// isOpen reports whether the peer has neither closed c nor sent anything
+// on it, which a far end waiting for a request doesn't.
+func isOpen(c net.Conn) bool {
+	c.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer c.SetReadDeadline(time.Time{})
+	var b [1]byte
+	_, err := c.Read(b[:])
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// SetPrewarm sets how many connections to keep open to the tunnel ahead of
+// use. It may be called while running.
+func (g *Gateway) SetPrewarm(p Prewarm) {
+	g.prewarm.Store(&p)
+	g.kickPrewarm()
+}
+
+// kickPrewarm has the pool topped up now.
+func (g *Gateway) kickPrewarm() {
+	select {
+	case g.prewarmKick <- struct{}{}:
+	default:
+	}
+}
+
+// dial returns a prewarmed connection to target if one is pooled, and dials
+// one otherwise.
+func (g *Gateway) dial(target string) (net.Conn, error) {
+	g.poolMu.Lock()
+	for len(g.pool) > 0 {
+		c := g.pool[0]
+		g.pool = g.pool[1:]
+		if c.usable(target) {
+			g.poolMu.Unlock()
+			g.kickPrewarm()
+			return c.Conn, nil
+		}
+		c.Close()
+	}
+	g.poolMu.Unlock()
+	return net.DialTimeout("tcp", target, g.dialTimeoutFor(target))
+}
+
+// prewarmLoop keeps the pool topped up until the gateway stops, then closes
+// the pooled connections.
+func (g *Gateway) prewarmLoop() {
+	defer g.fillPool("", 0)
+	ticker := time.NewTicker(prewarmInterval)
+	defer ticker.Stop()
+	for {
+		target, want := "", 0
+		if p := g.prewarm.Load(); p != nil && p.Conns > 0 && p.Target != nil {
+			if target = p.Target(); target != "" {
+				want = p.Conns
+			}
+		}
+		g.fillPool(target, want)
+
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-g.prewarmKick:
+		}
+	}
+}
+
+// fillPool closes the pooled connections that are no longer usable or not
+// wanted, then dials target until want are pooled.
+func (g *Gateway) fillPool(target string, want int) {
+	g.poolMu.Lock()
+	var keep []*pooledConn
+	for _, c := range g.pool {
+		if len(keep) < want && c.usable(target) {
+			keep = append(keep, c)
+		} else {
+			c.Close()
+		}
+	}
+	g.pool = keep
+	missing := want - len(keep)
+	g.poolMu.Unlock()
+
+	for range missing {
+		if g.ctx.Err() != nil {
+			return
+		}
+		conn, err := net.DialTimeout("tcp", target, prewarmDialTimeout)
+		if err != nil {
+			return // the tunnel is down; try again next round
+		}
+		g.keepAlive(conn)
+		g.poolMu.Lock()
+		g.pool = append(g.pool, &pooledConn{Conn: conn, target: target, dialed: time.Now()})
+		g.poolMu.Unlock()
+	}
+}
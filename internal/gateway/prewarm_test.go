@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// numberingServer answers each connection, once the client has finished
+// sending, with the order it was accepted in and what was sent.
+func numberingServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			n := accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				fmt.Fprintf(conn, "%d:%s", n, data)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func (g *Gateway) pooled() int {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	return len(g.pool)
+}
+
+func TestPrewarmUsesPooledConn(t *testing.T) {
+	target := numberingServer(t)
+	g := New("127.0.0.1:0", func() string { return target })
+	g.SetPrewarm(Prewarm{Conns: 2, Target: func() string { return target }})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Drain(0) })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for g.pooled() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("pool not filled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, err := net.Dial("tcp", g.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("x"))
+	conn.(*net.TCPConn).CloseWrite()
+
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "1:x" {
+		t.Errorf("answer = %q, want %q from the first pooled connection", got, "1:x")
+	}
+}
+
+func TestPrewarmDisabled(t *testing.T) {
+	target := numberingServer(t)
+	g := New("127.0.0.1:0", func() string { return target })
+	g.SetPrewarm(Prewarm{Conns: 2, Target: func() string { return "" }})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Drain(0) })
+
+	time.Sleep(100 * time.Millisecond)
+	if n := g.pooled(); n != 0 {
+		t.Errorf("pooled %d connections with no target, want 0", n)
+	}
+}
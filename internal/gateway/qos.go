@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"io"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// QoS prioritizes interactive connections, such as SSH sessions and page
+// loads, over bulk transfers while both share the tunnel. A connection is
+// classified by the destination port of its SOCKS request, or else counts as
+// interactive until it has received BulkAfter bytes.
+type QoS struct {
+	InteractivePorts []int
+	BulkPorts        []int
+	BulkAfter        int64
+}
+
+const (
+	// qosWindow is how long after interactive traffic the tunnel counts as
+	// busy with it.
+	qosWindow = 300 * time.Millisecond
+	// qosMaxDelay bounds how long a bulk write waits for interactive traffic
+	// to pause, so that bulk transfers slow down but never stall.
+	qosMaxDelay = 100 * time.Millisecond
+	// qosBulkChunk is the most a bulk transfer writes at once while
+	// interactive traffic is flowing.
+	qosBulkChunk = 4096
+)
+
+// qosClass is how a connection is treated.
+type qosClass int32
+
+const (
+	qosAuto        qosClass = iota // interactive until BulkAfter bytes
+	qosInteractive                 // by port
+	qosBulk                        // by port or volume
+)
+
+// scheduler tracks interactive traffic across a gateway's connections.
+type scheduler struct {
+	qos             *QoS
+	lastInteractive atomic.Int64 // unix nanos
+}
+
+func newScheduler(q *QoS) *scheduler {
+	if q == nil {
+		return nil
+	}
+	return &scheduler{qos: q}
+}
+
+// busy reports whether interactive traffic flowed within qosWindow, and if
+// so for how much longer.
+func (s *scheduler) busy() time.Duration {
+	return qosWindow - time.Since(time.Unix(0, s.lastInteractive.Load()))
+}
+
+// yield waits while interactive traffic is flowing, up to qosMaxDelay.
+func (s *scheduler) yield() {
+	deadline := time.Now().Add(qosMaxDelay)
+	for {
+		wait := min(s.busy(), time.Until(deadline))
+		if wait <= 0 {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// qosConn is the QoS state of one relayed connection.
+type qosConn struct {
+	sched *scheduler
+	class atomic.Int32
+	down  atomic.Int64
+	sniff socksSniffer
+}
+
+func (s *scheduler) conn() *qosConn {
+	if s == nil {
+		return nil
+	}
+	return &qosConn{sched: s}
+}
+
+func (c *qosConn) bulk() bool {
+	switch qosClass(c.class.Load()) {
+	case qosBulk:
+		return true
+	case qosAuto:
+		return c.sched.qos.BulkAfter > 0 && c.down.Load() >= c.sched.qos.BulkAfter
+	}
+	return false
+}
+
+// classify pins the class once the destination port is known.
+func (c *qosConn) classify(port int) {
+	switch {
+	case slices.Contains(c.sched.qos.InteractivePorts, port):
+		c.class.Store(int32(qosInteractive))
+	case slices.Contains(c.sched.qos.BulkPorts, port):
+		c.class.Store(int32(qosBulk))
+	}
+}
+
+// qosWriter paces the writes of one direction of a connection.
+type qosWriter struct {
+	w  io.Writer
+	c  *qosConn
+	up bool
+}
+
+func (q *qosWriter) Write(p []byte) (int, error) {
+	c := q.c
+	if q.up {
+		if port, ok := c.sniff.feed(p); ok {
+			c.classify(port)
+		}
+	} else {
+		c.down.Add(int64(len(p)))
+	}
+	if !c.bulk() {
+		c.sched.lastInteractive.Store(time.Now().UnixNano())
+		return q.w.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if c.sched.busy() <= 0 {
+			n, err := q.w.Write(p)
+			return written + n, err
+		}
+		c.sched.yield()
+		n, err := q.w.Write(p[:min(len(p), qosBulkChunk)])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// socksSniffer follows the client side of a SOCKS handshake as it passes
+// through, to learn the destination port. It gives up on anything it does
+// not recognize.
+type socksSniffer struct {
+	buf  []byte
+	done bool
+}
+
+// socksSniffLimit is the most client data buffered before giving up.
+const socksSniffLimit = 1024
+
+// feed adds client data and returns the destination port once the request
+// has been seen.
+func (s *socksSniffer) feed(p []byte) (int, bool) {
+	if s.done {
+		return 0, false
+	}
+	s.buf = append(s.buf, p...)
+	port, ok, more := parseSOCKSPort(s.buf)
+	if ok || !more || len(s.buf) > socksSniffLimit {
+		s.done = true
+		s.buf = nil
+	}
+	return port, ok
+}
+
+// parseSOCKSPort returns the destination port of the SOCKS4 or SOCKS5
+// request in b. more reports whether b may still be an incomplete handshake.
+func parseSOCKSPort(b []byte) (port int, ok, more bool) {
+	if len(b) < 2 {
+		return 0, false, true
+	}
+	switch b[0] {
+	case 4: // VN CD DSTPORT DSTIP USERID NUL
+		if len(b) < 4 {
+			return 0, false, true
+		}
+		return int(binary.BigEndian.Uint16(b[2:4])), true, false
+	case 5:
+	default:
+		return 0, false, false
+	}
+
+	// Greeting: VER NMETHODS METHODS. Username/password authentication
+	// (RFC 1929) may follow, which is skipped when present.
+	i := 2 + int(b[1])
+	if len(b) < i+1 {
+		return 0, false, true
+	}
+	if b[i] == 1 {
+		if len(b) < i+2 {
+			return 0, false, true
+		}
+		i += 2 + int(b[i+1])
+		if len(b) < i+1 {
+			return 0, false, true
+		}
+		i += 1 + int(b[i])
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	if len(b) < i+5 {
+		return 0, false, true
+	}
+	if b[i] != 5 {
+		return 0, false, false
+	}
+	var addrLen int
+	switch b[i+3] {
+	case 1:
+		addrLen = 4
+	case 3:
+		addrLen = 1 + int(b[i+4])
+	case 4:
+		addrLen = 16
+	default:
+		return 0, false, false
+	}
+	end := i + 4 + addrLen + 2
+	if len(b) < end {
+		return 0, false, true
+	}
+	return int(binary.BigEndian.Uint16(b[end-2 : end])), true, false
+}
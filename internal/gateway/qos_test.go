@@ -0,0 +1,147 @@
+package gateway
+
+import "testing"
+
+func TestParseSOCKSPort(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		port int
+		ok   bool
+		more bool
+	}{
+		{"empty", nil, 0, false, true},
+		{"one byte", []byte{5}, 0, false, true},
+		{"not socks", []byte("GET / HTTP/1.1\r\n"), 0, false, false},
+		{"socks4", []byte{4, 1, 0x00, 0x16, 10, 0, 0, 1, 0}, 22, true, false},
+		{"socks4 short", []byte{4, 1, 0x00}, 0, false, true},
+		{"socks5 greeting only", []byte{5, 1, 0}, 0, false, true},
+		{"socks5 greeting partial methods", []byte{5, 3, 0}, 0, false, true},
+		{
+			"socks5 ipv4",
+			[]byte{5, 1, 0, 5, 1, 0, 1, 1, 2, 3, 4, 0x01, 0xbb},
+			443, true, false,
+		},
+		{
+			"socks5 domain",
+			append(append([]byte{5, 1, 0, 5, 1, 0, 3, 11}, "example.com"...), 0x00, 0x50),
+			80, true, false,
+		},
+		{
+			"socks5 ipv6",
+			append(append([]byte{5, 1, 0, 5, 1, 0, 4}, make([]byte, 16)...), 0x00, 0x16),
+			22, true, false,
+		},
+		{
+			"socks5 user/pass auth",
+			[]byte{5, 1, 2, 1, 1, 'u', 2, 'p', 'w', 5, 1, 0, 1, 1, 2, 3, 4, 0x0d, 0x3d},
+			3389, true, false,
+		},
+		{
+			"socks5 auth partial",
+			[]byte{5, 1, 2, 1, 4, 'u'},
+			0, false, true,
+		},
+		{
+			"socks5 request partial port",
+			[]byte{5, 1, 0, 5, 1, 0, 1, 1, 2, 3, 4, 0x01},
+			0, false, true,
+		},
+		{
+			"socks5 domain length past end",
+			[]byte{5, 1, 0, 5, 1, 0, 3, 255, 'a'},
+			0, false, true,
+		},
+		{
+			"socks5 bad request version",
+			[]byte{5, 1, 0, 4, 1, 0, 1, 1, 2, 3, 4, 0, 80},
+			0, false, false,
+		},
+		{
+			"socks5 bad address type",
+			[]byte{5, 1, 0, 5, 1, 0, 9, 1, 2, 3, 4, 0, 80},
+			0, false, false,
+		},
+		{
+			"socks5 many methods",
+			append(append([]byte{5, 255}, make([]byte, 255)...), 5, 1, 0, 1, 1, 2, 3, 4, 0, 80),
+			80, true, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, ok, more := parseSOCKSPort(tt.in)
+			if port != tt.port || ok != tt.ok || more != tt.more {
+				t.Errorf("parseSOCKSPort(%v) = %d, %v, %v; want %d, %v, %v",
+					tt.in, port, ok, more, tt.port, tt.ok, tt.more)
+			}
+		})
+	}
+}
+
+func TestSOCKSSniffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		port   int // 0 if the port is never found
+	}{
+		{
+			"single write",
+			[][]byte{{5, 1, 0, 5, 1, 0, 1, 1, 2, 3, 4, 0, 22}},
+			22,
+		},
+		{
+			"byte at a time",
+			[][]byte{{5}, {1}, {0}, {5}, {1}, {0}, {1}, {1}, {2}, {3}, {4}, {0}, {80}},
+			80,
+		},
+		{
+			"greeting then request",
+			[][]byte{{5, 1, 0}, {5, 1, 0, 1, 1, 2, 3, 4, 0x01, 0xbb}},
+			443,
+		},
+		{
+			"not socks",
+			[][]byte{[]byte("hello"), {5, 1, 0, 5, 1, 0, 1, 1, 2, 3, 4, 0, 22}},
+			0,
+		},
+		{
+			"over limit",
+			[][]byte{{5, 255}, make([]byte, socksSniffLimit), {5, 1, 0, 1, 1, 2, 3, 4, 0, 22}},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s socksSniffer
+			port := 0
+			for _, c := range tt.chunks {
+				if p, ok := s.feed(c); ok {
+					if port != 0 {
+						t.Fatalf("port reported twice")
+					}
+					port = p
+				}
+			}
+			if port != tt.port {
+				t.Errorf("port = %d, want %d", port, tt.port)
+			}
+			if !s.done && tt.port != 0 {
+				t.Errorf("sniffer not done after finding the port")
+			}
+			if s.done && s.buf != nil {
+				t.Errorf("sniffer kept %d bytes after finishing", len(s.buf))
+			}
+		})
+	}
+}
+
+func TestSOCKSSnifferStopsAfterPort(t *testing.T) {
+	var s socksSniffer
+	if _, ok := s.feed([]byte{4, 1, 0, 22, 1, 2, 3, 4, 0}); !ok {
+		t.Fatal("SOCKS4 request not recognized")
+	}
+	if _, ok := s.feed([]byte{4, 1, 0, 80, 1, 2, 3, 4, 0}); ok {
+		t.Error("sniffer reported a port after it was done")
+	}
+}
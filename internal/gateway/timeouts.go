@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Timeouts bounds how long relayed connections stay open without traffic.
+type Timeouts struct {
+	Idle      time.Duration // close connections with no data either way for this long; 0 never
+	KeepAlive time.Duration // TCP keep-alive period on both sides; 0 keeps Go's default
+}
+
+const (
+	// halfClosedIdle closes a connection one side of which has finished
+	// sending once the other has been quiet this long, even without an idle
+	// timeout, so a peer that never closes its side doesn't hold it forever.
+	halfClosedIdle = time.Minute
+	// reapInterval is how often connections are checked for being idle.
+	reapInterval = 5 * time.Second
+)
+
+// defaultDialTimeout bounds connecting to a tunnel without a dial timeout.
+const defaultDialTimeout = 5 * time.Second
+
+// SetDialTimeout sets a function returning how long connecting to a tunnel
+// may take, by its address; 0 keeps the default of 5 seconds. It must be set
+// before Start.
+func (g *Gateway) SetDialTimeout(fn func(target string) time.Duration) {
+	g.dialTimeout = fn
+}
+
+// dialTimeoutFor returns how long connecting to target may take.
+func (g *Gateway) dialTimeoutFor(target string) time.Duration {
+	if g.dialTimeout != nil {
+		if d := g.dialTimeout(target); d > 0 {
+			return d
+		}
+	}
+	return defaultDialTimeout
+}
+
+// SetTimeouts sets the idle timeout and TCP keep-alive period. It may be
+// called while running; the idle timeout applies to all connections, the
+// keep-alive period to new ones.
+func (g *Gateway) SetTimeouts(t Timeouts) {
+	g.timeouts.Store(&t)
+}
+
+// keepAlive applies the configured TCP keep-alive period to c.
+func (g *Gateway) keepAlive(c net.Conn) {
+	t := g.timeouts.Load()
+	if t == nil || t.KeepAlive <= 0 {
+		return
+	}
+	if tc, ok := c.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(t.KeepAlive)
+	}
+}
+
+// reapLoop closes idle connections until the gateway stops.
+func (g *Gateway) reapLoop() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+			g.reap()
+		}
+	}
+}
+
+// reap closes the connections idle for longer than allowed. Their relays
+// then see the error and end.
+func (g *Gateway) reap() {
+	var idle time.Duration
+	if t := g.timeouts.Load(); t != nil {
+		idle = t.Idle
+	}
+	now := time.Now()
+	g.relaysMu.Lock()
+	defer g.relaysMu.Unlock()
+	for r := range g.relays {
+		quiet := now.Sub(time.Unix(0, r.active.Load()))
+		if (idle > 0 && quiet > idle) || (r.halfClosed.Load() && quiet > halfClosedIdle) {
+			r.src.Close()
+			r.dst.Close()
+		}
+	}
+}
+
+// activityWriter records when data last went through a relay.
+type activityWriter struct {
+	w      io.Writer
+	active *atomic.Int64
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	a.active.Store(time.Now().UnixNano())
+	return a.w.Write(p)
+}
+
+// closeWrite shuts down the sending side of c, telling its peer there is no
+// more data.
+func closeWrite(c net.Conn) error {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.New("half-close not supported")
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoServer answers each connection, once the client has finished
+// sending, with what it sent and closes it.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				conn.Write(data)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRelayHalfClose(t *testing.T) {
+	target := echoServer(t)
+	g := New("127.0.0.1:0", func() string { return target })
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Drain(0) })
+
+	conn, err := net.Dial("tcp", g.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("request"))
+	conn.(*net.TCPConn).CloseWrite()
+
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "request" {
+		t.Errorf("answer after half-close = %q, want %q", got, "request")
+	}
+}
+
+func TestReapIdle(t *testing.T) {
+	target := echoServer(t)
+	g := New("127.0.0.1:0", func() string { return target })
+	g.SetTimeouts(Timeouts{Idle: time.Second})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Drain(0) })
+
+	conn, err := net.Dial("tcp", g.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("x"))
+	for g.Active() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	g.reap()
+	if g.Active() != 1 {
+		t.Fatal("reaped a connection that was not idle")
+	}
+
+	g.relaysMu.Lock()
+	for r := range g.relays {
+		r.active.Store(time.Now().Add(-2 * time.Second).UnixNano())
+	}
+	g.relaysMu.Unlock()
+	g.reap()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("idle connection still open after reaping")
+	}
+}
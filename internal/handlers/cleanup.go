@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/ipc"
+	"github.com/net2share/dnstc/internal/process"
+)
+
+// cleanupTempAge is how old a temporary file must be before cleanup removes
+// it, so that downloads in progress are not touched.
+const cleanupTempAge = time.Hour
+
+func init() {
+	actions.SetHandler(actions.ActionCleanup, HandleCleanup)
+}
+
+// HandleCleanup removes what a crashed daemon or an interrupted command left
+// behind: orphaned tunnel processes, a stale socket and state entries,
+// temporary downloads and the key files of deleted tunnels.
+func HandleCleanup(ctx *actions.Context) error {
+	beginProgress(ctx, "Clean Up")
+	dryRun := ctx.GetBool("dry-run")
+
+	daemonRunning := engine.Get() != nil
+	staleSocket := false
+	if _, err := os.Stat(config.SocketPath()); err == nil && !daemonRunning {
+		// A hung daemon still accepts connections, so only a refused dial is stale
+		if client, err := ipc.Dial(config.SocketPath()); err == nil {
+			client.Close()
+			daemonRunning = true
+		} else {
+			staleSocket = true
+		}
+	}
+
+	var orphans, stale []process.ProcessInfo
+	if !daemonRunning {
+		orphans, _ = process.Orphans(config.StatePath())
+		stale, _ = process.StaleEntries(config.StatePath())
+	}
+	tempFiles := cleanupTempFiles()
+	keyFiles, keysErr := danglingKeyFiles()
+
+	var targets []string
+	for _, p := range orphans {
+		targets = append(targets, fmt.Sprintf("%s (pid %d, orphaned process)", p.Name, p.PID))
+	}
+	if staleSocket {
+		targets = append(targets, config.SocketPath()+" (stale socket)")
+	}
+	if len(stale) > 0 {
+		targets = append(targets, fmt.Sprintf("%d stale process entries in %s", len(stale), config.StatePath()))
+	}
+	targets = append(targets, tempFiles...)
+	targets = append(targets, keyFiles...)
+
+	if daemonRunning {
+		ctx.Output.Info("A daemon is running; its processes, socket and state are left alone")
+	}
+	if keysErr != nil {
+		ctx.Output.Warning(fmt.Sprintf("Skipping key files: %v", keysErr))
+	}
+	if len(targets) == 0 {
+		ctx.Output.Success("Nothing to clean up")
+		endProgress(ctx)
+		return nil
+	}
+	if dryRun {
+		ctx.Output.Info("Dry run: the following would be removed")
+	} else {
+		ctx.Output.Info("The following will be removed")
+	}
+	for _, t := range targets {
+		ctx.Output.Status(t)
+	}
+	if dryRun {
+		endProgress(ctx)
+		return nil
+	}
+
+	failed := 0
+	if len(orphans) > 0 || len(stale) > 0 {
+		if _, err := process.StopOrphans(config.StatePath()); err != nil {
+			ctx.Output.Warning(fmt.Sprintf("Failed to stop orphaned processes: %v", err))
+			failed++
+		}
+	}
+	if staleSocket {
+		os.Remove(config.SocketPath())
+	}
+	for _, path := range append(tempFiles, keyFiles...) {
+		if err := os.RemoveAll(path); err != nil {
+			ctx.Output.Warning(fmt.Sprintf("Failed to remove %s: %v", path, err))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		ctx.Output.Warning(fmt.Sprintf("Cleanup finished with %d error(s)", failed))
+	} else {
+		ctx.Output.Success("Cleanup complete")
+	}
+	endProgress(ctx)
+	return nil
+}
+
+// cleanupTempFiles returns the temporary files and directories left by
+// interrupted binary downloads, self-updates and self-tests.
+func cleanupTempFiles() []string {
+	patterns := []string{"binman-*", "selfupdate-*", "dnstc-selftest-*"}
+	for _, name := range binaries.AllNames() {
+		patterns = append(patterns, name+"-extracted-*")
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(os.TempDir(), pattern))
+		for _, path := range matches {
+			info, err := os.Lstat(path)
+			if err != nil || time.Since(info.ModTime()) < cleanupTempAge {
+				continue
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// danglingKeyFiles returns the <tag>.cert.pem and <tag>.key.pem files in the
+// config directory that no configured tunnel uses.
+func danglingKeyFiles() ([]string, error) {
+	if !fileExists(config.Path()) {
+		return nil, nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]bool)
+	for _, tc := range cfg.Tunnels {
+		tags[tc.Tag] = true
+	}
+
+	entries, err := os.ReadDir(config.ConfigDir())
+	if err != nil {
+		return nil, nil
+	}
+	var paths []string
+	for _, e := range entries {
+		var tag string
+		switch name := e.Name(); {
+		case strings.HasSuffix(name, ".cert.pem"):
+			tag = strings.TrimSuffix(name, ".cert.pem")
+		case strings.HasSuffix(name, ".key.pem"):
+			tag = strings.TrimSuffix(name, ".key.pem")
+		default:
+			continue
+		}
+		path := filepath.Join(config.ConfigDir(), e.Name())
+		if e.IsDir() || tags[tag] || tunnelsUseFile(cfg.Tunnels, path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
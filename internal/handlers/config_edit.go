@@ -1,19 +1,32 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/ipc"
 )
 
 func init() {
 	actions.SetHandler(actions.ActionConfigEdit, HandleConfigEdit)
 }
 
-// HandleConfigEdit opens the configuration in an editor.
+// HandleConfigEdit opens a copy of the configuration in an editor. The copy
+// replaces the config only once it parses and validates; otherwise the
+// problem is shown and the editor re-opened. The running engine or daemon
+// then reloads it, restarting only the tunnels that changed.
 func HandleConfigEdit(ctx *actions.Context) error {
 	configPath := config.Path()
 
@@ -30,13 +43,137 @@ func HandleConfigEdit(ctx *actions.Context) error {
 		}
 	}
 
-	editorCmd := exec.Command(editor, configPath)
-	editorCmd.Stdin = os.Stdin
-	editorCmd.Stdout = os.Stdout
-	editorCmd.Stderr = os.Stderr
-	if err := editorCmd.Run(); err != nil {
-		return err
+	orig, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	editPath := filepath.Join(config.ConfigDir(), "config.edit.json")
+	if err := os.WriteFile(editPath, orig, 0600); err != nil {
+		return fmt.Errorf("failed to create edit copy: %w", err)
+	}
+	defer os.Remove(editPath)
+
+	var cfg *config.Config
+	var data []byte
+	for {
+		editorCmd := exec.Command(editor, editPath)
+		editorCmd.Stdin = os.Stdin
+		editorCmd.Stdout = os.Stdout
+		editorCmd.Stderr = os.Stderr
+		if err := editorCmd.Run(); err != nil {
+			return err
+		}
+
+		data, err = os.ReadFile(editPath)
+		if err != nil {
+			return fmt.Errorf("failed to read edited config: %w", err)
+		}
+		if bytes.Equal(data, orig) {
+			ctx.Output.Info("No changes")
+			return nil
+		}
+
+		cfg, err = config.ParseStrict(data)
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err == nil {
+			break
+		}
+
+		ctx.Output.Error(fmt.Sprintf("Invalid config: %v", err))
+		showConfigError(ctx, data, err)
+		if !promptYesNo("Edit again? [Y/n] ") {
+			ctx.Output.Warning("Changes discarded, the config was not modified")
+			return nil
+		}
+	}
+
+	if err := os.WriteFile(configPath, data, 0640); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	ctx.Config = cfg
+	ctx.Output.Success("Config saved")
+
+	if err := reloadEditedConfig(); err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Failed to apply the new config: %v", err))
+	}
+	return nil
+}
+
+// reloadEditedConfig applies the saved config to the in-process engine or the
+// running daemon, if any.
+func reloadEditedConfig() error {
+	if eng := engine.Get(); eng != nil {
+		return eng.ReloadConfig(context.Background())
+	}
+	if running, client := ipc.DetectDaemon(); running {
+		defer client.Close()
+		return client.ReloadConfig(context.Background())
 	}
-	NotifyDaemonReload()
 	return nil
 }
+
+var (
+	unknownFieldRe = regexp.MustCompile(`unknown field "([^"]+)"`)
+	tunnelTagRe    = regexp.MustCompile(`tunnel '([^']+)'`)
+)
+
+// showConfigError prints the lines of data around the place err refers to,
+// when it can be found.
+func showConfigError(ctx *actions.Context, data []byte, err error) {
+	line := configErrorLine(data, err)
+	if line == 0 {
+		return
+	}
+	lines := strings.Split(string(data), "\n")
+	for i := max(line-2, 1); i <= min(line+2, len(lines)); i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		ctx.Output.Printf("  %s %4d | %s\n", marker, i, lines[i-1])
+	}
+}
+
+// configErrorLine returns the 1-based line of data that err points at, or 0.
+// JSON errors carry an offset; for unknown fields and validation errors the
+// offending key or tunnel tag is looked up.
+func configErrorLine(data []byte, err error) int {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return bytes.Count(data[:min(int(syntaxErr.Offset), len(data))], []byte("\n")) + 1
+	case errors.As(err, &typeErr):
+		return bytes.Count(data[:min(int(typeErr.Offset), len(data))], []byte("\n")) + 1
+	}
+
+	var pattern string
+	if m := unknownFieldRe.FindStringSubmatch(err.Error()); m != nil {
+		pattern = `"` + regexp.QuoteMeta(m[1]) + `"\s*:`
+	} else if m := tunnelTagRe.FindStringSubmatch(err.Error()); m != nil {
+		pattern = `"tag"\s*:\s*"` + regexp.QuoteMeta(m[1]) + `"`
+	} else {
+		return 0
+	}
+	loc := regexp.MustCompile(pattern).FindIndex(data)
+	if loc == nil {
+		return 0
+	}
+	return bytes.Count(data[:loc[0]], []byte("\n")) + 1
+}
+
+// stdinReader is shared by prompts so that buffered input isn't lost between them.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// promptYesNo asks a question on the terminal, defaulting to yes.
+func promptYesNo(question string) bool {
+	fmt.Print(question)
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
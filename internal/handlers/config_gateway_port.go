@@ -34,9 +34,28 @@ func HandleConfigGatewayPort(ctx *actions.Context) error {
 		return nil
 	}
 
+	// A running gateway moves without restarting the tunnels; the engine
+	// saves the new address once it is bound.
+	moved := false
+	if eng := engine.Get(); eng != nil {
+		if err := eng.SetGatewayAddr(ctx.Ctx, newAddr); err != nil {
+			return fmt.Errorf("failed to move gateway: %w", err)
+		}
+		moved = true
+	} else if running, client := ipc.DetectDaemon(); running {
+		err := client.SetGatewayAddr(ctx.Ctx, newAddr)
+		client.Close()
+		if err != nil {
+			return fmt.Errorf("failed to move gateway: %w", err)
+		}
+		moved = true
+	}
+
 	cfg.Listen.SOCKS = newAddr
-	if err := cfg.Save(); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
+	if !moved {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
 	}
 
 	if oldAddr != "" {
@@ -44,23 +63,8 @@ func HandleConfigGatewayPort(ctx *actions.Context) error {
 	} else {
 		ctx.Output.Success(fmt.Sprintf("Gateway port set to %d", portVal))
 	}
-
-	// If engine is running, restart to apply the new port.
-	if eng := engine.Get(); eng != nil && eng.IsConnected() {
-		ctx.Output.Info("Restarting gateway...")
-		eng.Stop()
-		eng.ReloadConfig()
-		if err := eng.Start(); err != nil {
-			return fmt.Errorf("failed to restart: %w", err)
-		}
-		ctx.Output.Success("Gateway restarted on new port")
-	} else if running, client := ipc.DetectDaemon(); running {
-		ctx.Output.Info("Restarting daemon...")
-		client.Stop()
-		client.ReloadConfig()
-		client.Start()
-		client.Close()
-		ctx.Output.Success("Daemon restarted on new port")
+	if moved {
+		ctx.Output.Info("Open connections on the old port are kept until they close")
 	}
 
 	return nil
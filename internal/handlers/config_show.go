@@ -20,11 +20,18 @@ func HandleConfigShow(ctx *actions.Context) error {
 		return nil
 	}
 
+	if !ctx.GetBool("reveal") {
+		cfg = cfg.Redacted()
+	}
+
 	lines := []string{
 		fmt.Sprintf("Config file: %s", config.Path()),
-		"",
-		fmt.Sprintf("SOCKS listen: %s", cfg.Listen.SOCKS),
 	}
+	if p, _ := config.LoadPolicy(); p != nil {
+		cfg = p.Apply(cfg)
+		lines = append(lines, fmt.Sprintf("Policy: %s (applied below; the config file keeps your own settings)", config.PolicyPath()))
+	}
+	lines = append(lines, "", fmt.Sprintf("SOCKS listen: %s", cfg.Listen.SOCKS))
 
 	if len(cfg.Resolvers) > 0 {
 		lines = append(lines, "")
@@ -38,6 +45,9 @@ func HandleConfigShow(ctx *actions.Context) error {
 		lines = append(lines, "")
 		lines = append(lines, fmt.Sprintf("Active tunnel: %s", cfg.Route.Active))
 	}
+	if cfg.Route.Standby != "" {
+		lines = append(lines, fmt.Sprintf("Standby tunnel: %s", cfg.Route.Standby))
+	}
 
 	if len(cfg.Tunnels) > 0 {
 		lines = append(lines, "")
@@ -46,15 +56,56 @@ func HandleConfigShow(ctx *actions.Context) error {
 			activeMarker := ""
 			if tc.Tag == cfg.Route.Active {
 				activeMarker = " [active]"
+			} else if tc.Tag == cfg.Route.Standby {
+				activeMarker = " [standby]"
 			}
 			lines = append(lines, fmt.Sprintf("  %s%s: %s/%s (%s)",
 				tc.Tag, activeMarker,
 				config.GetTransportTypeDisplayName(tc.Transport),
 				config.GetBackendTypeDisplayName(tc.Backend),
 				tc.Domain))
+			for _, detail := range tunnelDetailLines(&tc) {
+				lines = append(lines, "      "+detail)
+			}
 		}
 	}
 
 	ctx.Output.Box("Configuration", lines)
 	return nil
 }
+
+// tunnelDetailLines returns transport and backend settings for display.
+func tunnelDetailLines(tc *config.TunnelConfig) []string {
+	var lines []string
+	if tc.Port > 0 {
+		lines = append(lines, fmt.Sprintf("port: %d", tc.Port))
+	}
+	if tc.Resolver != "" {
+		lines = append(lines, fmt.Sprintf("resolver: %s", tc.Resolver))
+	}
+	if tc.Preset != "" {
+		lines = append(lines, fmt.Sprintf("preset: %s", tc.Preset))
+	}
+	if tc.Slipstream != nil && tc.Slipstream.Cert != "" {
+		lines = append(lines, fmt.Sprintf("cert: %s", tc.Slipstream.Cert))
+	}
+	if tc.DNSTT != nil {
+		lines = append(lines, fmt.Sprintf("pubkey: %s", tc.DNSTT.Pubkey))
+	}
+	if ss := tc.Shadowsocks; ss != nil {
+		lines = append(lines,
+			fmt.Sprintf("ss-server: %s", ss.Server),
+			fmt.Sprintf("ss-password: %s", ss.Password),
+			fmt.Sprintf("ss-method: %s", ss.Method))
+	}
+	if sshCfg := tc.SSH; sshCfg != nil {
+		lines = append(lines, fmt.Sprintf("ssh-user: %s", sshCfg.User))
+		if sshCfg.Password != "" {
+			lines = append(lines, fmt.Sprintf("ssh-password: %s", sshCfg.Password))
+		}
+		if sshCfg.Key != "" {
+			lines = append(lines, fmt.Sprintf("ssh-key: %s", sshCfg.Key))
+		}
+	}
+	return lines
+}
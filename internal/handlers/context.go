@@ -2,8 +2,6 @@
 package handlers
 
 import (
-	"fmt"
-
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/engine"
@@ -15,7 +13,7 @@ func LoadConfig(ctx *actions.Context) (*config.Config, error) {
 		return ctx.Config, nil
 	}
 
-	cfg, err := config.Load()
+	cfg, err := LoadSavedConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -23,6 +21,13 @@ func LoadConfig(ctx *actions.Context) (*config.Config, error) {
 	return cfg, nil
 }
 
+// LoadSavedConfig loads the config file, once the in-process engine, if
+// there is one, has saved its pending changes to it.
+func LoadSavedConfig() (*config.Config, error) {
+	engine.FlushConfig()
+	return config.Load()
+}
+
 // GetTunnelByTag retrieves a tunnel by tag from the config.
 func GetTunnelByTag(ctx *actions.Context, tag string) (*config.TunnelConfig, error) {
 	cfg, err := LoadConfig(ctx)
@@ -93,7 +98,11 @@ func endProgress(ctx *actions.Context) {
 // failProgress shows an error in the progress view and returns the error.
 func failProgress(ctx *actions.Context, err error) error {
 	if ctx.IsInteractive {
-		ctx.Output.Error(fmt.Sprintf("Failed: %v", err))
+		msg, hint := actions.SplitError(err)
+		ctx.Output.Error("Failed: " + msg)
+		if hint != "" {
+			ctx.Output.Info(hint)
+		}
 		ctx.Output.EndProgress()
 	}
 	return err
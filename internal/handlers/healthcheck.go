@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/ipc"
+)
+
+// Healthcheck exit codes, documented in the healthcheck action.
+const (
+	healthExitDaemon     = 2
+	healthExitTunnel     = 3
+	healthExitNotRunning = 4
+	healthExitProbe      = 5
+)
+
+func init() {
+	actions.SetHandler(actions.ActionHealthcheck, HandleHealthcheck)
+}
+
+// HandleHealthcheck probes the active (or given) tunnel end to end and
+// reports the result through the exit code.
+func HandleHealthcheck(ctx *actions.Context) error {
+	var status *engine.Status
+	if eng := engine.Get(); eng != nil {
+		status = eng.Status(ctx.Ctx)
+	} else if running, client := ipc.DetectDaemon(); running {
+		status = client.Status(ctx.Ctx)
+		client.Close()
+	} else {
+		return healthError(healthExitDaemon, "daemon not running")
+	}
+
+	tag := ctx.GetArg(0)
+	if tag == "" {
+		tag = ctx.GetString("tag")
+	}
+	viaGateway := tag == ""
+	if viaGateway {
+		tag = status.Active
+	}
+	if tag == "" {
+		return healthError(healthExitTunnel, "no active tunnel")
+	}
+
+	ts, ok := status.Tunnels[tag]
+	if !ok {
+		return healthError(healthExitTunnel, fmt.Sprintf("tunnel '%s' not found", tag))
+	}
+	if !ts.Running {
+		return healthError(healthExitNotRunning, fmt.Sprintf("tunnel '%s' is not running", tag))
+	}
+
+	// The active tunnel is probed through the gateway so the whole path is covered
+	addr := status.GatewayAddr
+	if !viaGateway || addr == "" {
+		if ts.Port == 0 {
+			return healthError(healthExitProbe, fmt.Sprintf("tunnel '%s' has no local port", tag))
+		}
+		addr = fmt.Sprintf("127.0.0.1:%d", ts.Port)
+	}
+
+	rtt, err := engine.ProbeTunnel(addr)
+	if err != nil {
+		return healthError(healthExitProbe, fmt.Sprintf("tunnel '%s' probe failed: %v", tag, err))
+	}
+
+	ctx.Output.Println(fmt.Sprintf("healthy: tunnel '%s' (%dms)", tag, rtt.Milliseconds()))
+	return nil
+}
+
+func healthError(code int, msg string) error {
+	err := &actions.ActionError{Message: "unhealthy: " + msg, ExitCode: code}
+	if code == healthExitDaemon {
+		err.Code = actions.CodeDaemonUnreachable
+	}
+	return err
+}
@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/engine"
 	"github.com/net2share/dnstc/internal/ipc"
 )
@@ -12,7 +16,67 @@ func NotifyDaemonReload() {
 		return // in-process engine, config already in memory
 	}
 	if running, client := ipc.DetectDaemon(); running {
-		client.ReloadConfig()
+		client.ReloadConfig(context.Background())
+		client.Close()
+	}
+}
+
+// liveTunnelStatus returns the live tunnel status from the in-process engine
+// or a running daemon, or nil if neither is available.
+func liveTunnelStatus() map[string]*engine.TunnelStatus {
+	if eng := engine.Get(); eng != nil {
+		return eng.Status(context.Background()).Tunnels
+	}
+	if running, client := ipc.DetectDaemon(); running {
+		defer client.Close()
+		return client.Status(context.Background()).Tunnels
+	}
+	return nil
+}
+
+// liveTunnelHistory returns the throughput and RTT history of a tunnel from
+// the in-process engine or a running daemon, or nil if neither has one.
+func liveTunnelHistory(tag string) engine.History {
+	var h engine.History
+	if eng := engine.Get(); eng != nil {
+		h, _ = eng.History(context.Background(), tag)
+	} else if running, client := ipc.DetectDaemon(); running {
+		defer client.Close()
+		h, _ = client.History(context.Background(), tag)
+	}
+	return h
+}
+
+// GatewayAddr returns the gateway listen address, preferring the live address
+// reported by a running engine or daemon over the configured one.
+func GatewayAddr(cfg *config.Config) string {
+	if eng := engine.Get(); eng != nil {
+		if addr := eng.Status(context.Background()).GatewayAddr; addr != "" {
+			return addr
+		}
+	} else if running, client := ipc.DetectDaemon(); running {
+		addr := client.Status(context.Background()).GatewayAddr
 		client.Close()
+		if addr != "" {
+			return addr
+		}
+	}
+	if cfg != nil && cfg.Listen.SOCKS != "" {
+		return cfg.Listen.SOCKS
+	}
+	return "127.0.0.1:1080"
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. "1.5 GB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
 	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
 }
@@ -2,72 +2,218 @@ package handlers
 
 import (
 	"fmt"
+	"os"
+	"runtime"
+	"strings"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/binaries"
 	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/transport"
 	"github.com/net2share/go-corelib/binman"
+	"github.com/net2share/go-corelib/tui"
 )
 
 func init() {
 	actions.SetHandler(actions.ActionInstall, HandleInstall)
 }
 
-// HandleInstall downloads and installs all required binaries.
+// HandleInstall downloads and installs the binaries required by the configured tunnels.
 func HandleInstall(ctx *actions.Context) error {
 	beginProgress(ctx, "Install Binaries")
 
+	var tunnels []config.TunnelConfig
+	if cfg, err := LoadConfig(ctx); err == nil {
+		tunnels = cfg.Tunnels
+	}
+
+	names := transport.RequiredBinariesFor(tunnels)
+	optional := transport.OptionalBinariesFor(tunnels)
+	if ctx.GetBool("all") || ctx.GetString("extras") == "all" {
+		names = binaries.AllNames()
+		optional = nil
+	}
+
 	mgr := binaries.NewManager()
+	if ctx.GetBool("system") {
+		if runtime.GOOS == "windows" {
+			return failProgress(ctx, actions.NewActionError(
+				"--system is not supported on Windows",
+				"Run 'dnstc setup' to install dnstc for the current user",
+			))
+		}
+		if os.Geteuid() != 0 {
+			return failProgress(ctx, actions.NewActionError(
+				fmt.Sprintf("installing into %s requires root", binaries.SystemBinDir),
+				"Run 'sudo dnstc install --system'",
+			))
+		}
+		mgr = binaries.NewSystemManager()
+		ctx.Output.Info(fmt.Sprintf("Installing into %s for all users", binaries.SystemBinDir))
+	}
 	defs := binaries.Defs()
-	names := binaries.AllNames()
 	total := len(names)
 
-	manifest := binman.NewManifest()
+	manifest, err := binman.LoadManifest(config.VersionsPath())
+	if err != nil {
+		manifest = binman.NewManifest()
+	}
+	checksums, err := binaries.LoadChecksums()
+	if err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Failed to load checksums: %v", err))
+		checksums = &binaries.ChecksumManifest{Checksums: make(map[string]string)}
+	}
+
+	if len(tunnels) == 0 && total == 0 {
+		ctx.Output.Info("No tunnels configured — binaries will be installed when you add a tunnel")
+	}
 
 	for i, name := range names {
-		def := defs[name]
-		step := i + 1
+		installBinary(ctx, mgr, defs[name], i+1, total, manifest, checksums)
+	}
 
-		if !mgr.IsPlatformSupported(def) {
-			ctx.Output.Step(step, total, fmt.Sprintf("Skipping %s (unsupported platform)", name))
-			continue
+	if len(optional) > 0 {
+		ctx.Output.Status(fmt.Sprintf("Skipped (not required): %s", strings.Join(optional, ", ")))
+		if !ctx.IsInteractive {
+			ctx.Output.Info("Use 'dnstc install --all' to install them now")
 		}
+	}
 
-		// Copy from local path if provided via env var
-		if localPath := binaries.EnvPath(def); localPath != "" {
-			ctx.Output.Step(step, total, fmt.Sprintf("Copying %s from %s...", name, localPath))
-			if err := binaries.CopyToBinDir(def, localPath); err != nil {
-				ctx.Output.Error(fmt.Sprintf("Failed to copy %s: %v", name, err))
-				continue
-			}
-			manifest.SetVersion(name, def.PinnedVersion)
-			ctx.Output.Status(fmt.Sprintf("%s installed from local path", name))
-			continue
-		}
+	if err := manifest.Save(config.VersionsPath()); err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Failed to save version manifest: %v", err))
+	}
+	if err := checksums.Save(); err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Failed to save checksums: %v", err))
+	}
 
-		if mgr.IsInstalled(def) {
-			ctx.Output.Step(step, total, fmt.Sprintf("%s already installed", name))
-			manifest.SetVersion(name, def.PinnedVersion)
-			continue
-		}
+	ctx.Output.Success("Binary installation complete")
 
-		ctx.Output.Step(step, total, fmt.Sprintf("Downloading %s...", name))
+	endProgress(ctx)
+	return nil
+}
 
-		if err := mgr.Download(def, def.PinnedVersion, nil); err != nil {
-			ctx.Output.Error(fmt.Sprintf("Failed to install %s: %v", name, err))
-			continue
+// EnsureTunnelBinaries installs any binaries required by a tunnel that are
+// missing, asking first in the TUI. It is called once the tunnel is saved,
+// so a failed download is reported as a warning: the tunnel was still added,
+// and 'dnstc install' retries it.
+func EnsureTunnelBinaries(ctx *actions.Context, tc *config.TunnelConfig) {
+	if err := ensureTunnelBinaries(ctx, tc); err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Tunnel saved, but %v; run 'dnstc install' to retry", err))
+	}
+}
+
+// ensureTunnelBinaries implements EnsureTunnelBinaries.
+func ensureTunnelBinaries(ctx *actions.Context, tc *config.TunnelConfig) error {
+	mgr := binaries.NewManager()
+	defs := binaries.Defs()
+
+	var missing []string
+	for _, name := range transport.RequiredBinariesFor([]config.TunnelConfig{*tc}) {
+		if !binaries.IsInstalled(defs[name]) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if ctx.IsInteractive {
+		confirm, err := tui.RunConfirm(tui.ConfirmConfig{
+			Title:       "Download missing binaries?",
+			Description: fmt.Sprintf("The tunnel needs %s, not installed yet.", strings.Join(missing, ", ")),
+		})
+		if err != nil || !confirm {
+			ctx.Output.Info("Install them later with 'dnstc install'")
+			return nil
 		}
+	}
 
-		manifest.SetVersion(name, def.PinnedVersion)
-		ctx.Output.Status(fmt.Sprintf("%s installed", name))
+	manifest, err := binman.LoadManifest(config.VersionsPath())
+	if err != nil {
+		manifest = binman.NewManifest()
+	}
+	checksums, err := binaries.LoadChecksums()
+	if err != nil {
+		checksums = &binaries.ChecksumManifest{Checksums: make(map[string]string)}
+	}
+
+	var failed []string
+	for i, name := range missing {
+		if !installBinary(ctx, mgr, defs[name], i+1, len(missing), manifest, checksums) {
+			failed = append(failed, name)
+		}
 	}
 
 	if err := manifest.Save(config.VersionsPath()); err != nil {
 		ctx.Output.Warning(fmt.Sprintf("Failed to save version manifest: %v", err))
 	}
+	if err := checksums.Save(); err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Failed to save checksums: %v", err))
+	}
 
-	ctx.Output.Success("Binary installation complete")
-
-	endProgress(ctx)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to install %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
+
+// installBinary installs a single binary, recording its version and checksum.
+// Returns false if the binary could not be installed.
+func installBinary(ctx *actions.Context, mgr *binman.Manager, def binman.BinaryDef, step, total int, manifest *binman.VersionManifest, checksums *binaries.ChecksumManifest) bool {
+	name := def.Name
+	record := func() {
+		if path, err := mgr.ResolvePath(def); err == nil {
+			if err := checksums.Record(name, path); err != nil {
+				ctx.Output.Warning(fmt.Sprintf("Failed to record checksum for %s: %v", name, err))
+			}
+		}
+	}
+	// Only binaries dnstc wrote itself are claimed in the shared directory
+	installed := func() {
+		manifest.SetVersion(name, def.PinnedVersion)
+		record()
+		if mgr.BinDir() == binaries.SystemBinDir {
+			if err := binaries.RecordSystemInstall(name); err != nil {
+				ctx.Output.Warning(fmt.Sprintf("Failed to record %s as installed by dnstc: %v", name, err))
+			}
+		}
+	}
+
+	if !mgr.IsPlatformSupported(def) {
+		ctx.Output.Step(step, total, fmt.Sprintf("Skipping %s (unsupported platform)", name))
+		return false
+	}
+
+	// Copy from local path if provided via env var
+	if localPath := binaries.EnvPath(def); localPath != "" {
+		ctx.Output.Step(step, total, fmt.Sprintf("Copying %s from %s...", name, localPath))
+		if err := binaries.CopyToDir(def, localPath, mgr.BinDir()); err != nil {
+			ctx.Output.Error(fmt.Sprintf("Failed to copy %s: %v", name, err))
+			return false
+		}
+		installed()
+		ctx.Output.Status(fmt.Sprintf("%s installed from local path", name))
+		return true
+	}
+
+	if mgr.IsInstalled(def) {
+		ctx.Output.Step(step, total, fmt.Sprintf("%s already installed", name))
+		if manifest.GetVersion(name) == "" {
+			manifest.SetVersion(name, def.PinnedVersion)
+		}
+		if _, ok := checksums.Checksums[name]; !ok {
+			record()
+		}
+		return true
+	}
+
+	ctx.Output.Step(step, total, fmt.Sprintf("Downloading %s...", name))
+
+	if err := mgr.Download(def, def.PinnedVersion, nil); err != nil {
+		ctx.Output.Error(fmt.Sprintf("Failed to install %s: %v", name, err))
+		return false
+	}
+
+	installed()
+	ctx.Output.Status(fmt.Sprintf("%s installed", name))
+	return true
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/transport"
+	"github.com/net2share/go-corelib/binman"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionInstallVerify, HandleInstallVerify)
+}
+
+// verifyResult holds the outcome of verifying a single binary.
+type verifyResult struct {
+	name    string
+	path    string
+	status  string
+	managed bool // binary was installed by dnstc
+	failed  bool
+}
+
+// HandleInstallVerify re-computes checksums of installed binaries and
+// compares them to the recorded and upstream checksums. Binaries the
+// configured tunnels need must be present; others are checked if installed.
+func HandleInstallVerify(ctx *actions.Context) error {
+	beginProgress(ctx, "Verify Binaries")
+
+	var tunnels []config.TunnelConfig
+	if cfg, err := LoadConfig(ctx); err == nil {
+		tunnels = cfg.Tunnels
+	}
+	required := transport.RequiredBinariesFor(tunnels)
+
+	mgr := binaries.NewManager()
+	defs := binaries.Defs()
+
+	manifest, err := binman.LoadManifest(config.VersionsPath())
+	if err != nil {
+		manifest = binman.NewManifest()
+	}
+	checksums, err := binaries.LoadChecksums()
+	if err != nil {
+		return failProgress(ctx, fmt.Errorf("failed to load recorded checksums: %w", err))
+	}
+
+	var results []verifyResult
+	for _, name := range binaries.AllNames() {
+		def := defs[name]
+		if !mgr.IsPlatformSupported(def) {
+			continue
+		}
+		ctx.Output.Status(fmt.Sprintf("Verifying %s...", name))
+		results = append(results, verifyBinary(def, slices.Contains(required, name), manifest, checksums))
+	}
+
+	headers := []string{"BINARY", "STATUS", "PATH"}
+	var rows [][]string
+	var failed []verifyResult
+	for _, r := range results {
+		path := r.path
+		if path == "" {
+			path = "-"
+		}
+		rows = append(rows, []string{r.name, r.status, path})
+		if r.failed {
+			failed = append(failed, r)
+		}
+	}
+	ctx.Output.Table(headers, rows)
+
+	if len(failed) == 0 {
+		ctx.Output.Success("All binaries verified")
+		endProgress(ctx)
+		return nil
+	}
+
+	if !ctx.GetBool("repair") {
+		return failProgress(ctx, actions.NewActionError(
+			fmt.Sprintf("%d binary(s) failed verification", len(failed)),
+			"Run 'dnstc install verify --repair' to re-download them",
+		))
+	}
+
+	repaired := 0
+	for _, r := range failed {
+		def := defs[r.name]
+		if r.path != "" && !r.managed {
+			ctx.Output.Warning(fmt.Sprintf("%s is not managed by dnstc (%s), skipping", r.name, r.path))
+			continue
+		}
+
+		version := manifest.GetVersion(r.name)
+		if version == "" {
+			version = def.PinnedVersion
+		}
+
+		ctx.Output.Status(fmt.Sprintf("Re-downloading %s %s...", r.name, version))
+		binMgr := binaries.ManagerFor(def)
+		if err := binMgr.Download(def, version, nil); err != nil {
+			ctx.Output.Error(fmt.Sprintf("Failed to re-download %s: %v", r.name, err))
+			continue
+		}
+		if path, err := binMgr.ResolvePath(def); err == nil {
+			checksums.Record(r.name, path)
+		}
+		if binMgr.BinDir() == binaries.SystemBinDir {
+			binaries.RecordSystemInstall(r.name)
+		}
+		manifest.SetVersion(r.name, version)
+		repaired++
+		ctx.Output.Success(fmt.Sprintf("%s re-downloaded", r.name))
+	}
+
+	if err := checksums.Save(); err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Failed to save checksums: %v", err))
+	}
+	if err := manifest.Save(config.VersionsPath()); err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Failed to save version manifest: %v", err))
+	}
+
+	if repaired < len(failed) {
+		return failProgress(ctx, fmt.Errorf("%d of %d binary(s) could not be repaired", len(failed)-repaired, len(failed)))
+	}
+
+	ctx.Output.Success("All failing binaries re-downloaded")
+	endProgress(ctx)
+	return nil
+}
+
+// verifyBinary checks a single binary against its recorded and upstream
+// checksums. A missing binary fails only if it is required.
+func verifyBinary(def binman.BinaryDef, required bool, manifest *binman.VersionManifest, checksums *binaries.ChecksumManifest) verifyResult {
+	r := verifyResult{name: def.Name}
+
+	path, err := binaries.Resolve(def)
+	if err != nil {
+		if !required {
+			r.status = "not installed"
+			return r
+		}
+		r.status = "missing"
+		r.failed = true
+		return r
+	}
+	r.path = path
+	r.managed = binaries.OwnsPath(def.Name, path)
+
+	actual, err := binaries.FileSHA256(path)
+	if err != nil {
+		r.status = fmt.Sprintf("unreadable: %v", err)
+		r.failed = true
+		return r
+	}
+
+	recorded, hasRecorded := checksums.Checksums[def.Name]
+	if hasRecorded && recorded != actual {
+		r.status = "modified since install"
+		r.failed = true
+		return r
+	}
+
+	// Upstream checksums only describe binaries we downloaded ourselves
+	if !r.managed || binaries.EnvPath(def) != "" {
+		if hasRecorded {
+			r.status = "ok (recorded)"
+		} else {
+			r.status = "unverified (external binary)"
+		}
+		return r
+	}
+
+	version := manifest.GetVersion(def.Name)
+	if version == "" {
+		version = def.PinnedVersion
+	}
+	upstream, err := binaries.UpstreamChecksum(def, version)
+	switch {
+	case err == nil && upstream != actual:
+		r.status = "upstream checksum mismatch"
+		r.failed = true
+	case err == nil:
+		r.status = "ok (upstream)"
+	case hasRecorded:
+		r.status = "ok (recorded)"
+	default:
+		r.status = fmt.Sprintf("unverified (%v)", err)
+	}
+	return r
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+// leakTestName is a Google-operated name whose TXT answer reveals the
+// address of the resolver that queried it (and the EDNS client subnet).
+const leakTestName = "o-o.myaddr.l.google.com"
+
+// leakTestResolver is queried over TCP through the tunnel.
+const leakTestResolver = "8.8.8.8:53"
+
+func init() {
+	actions.SetHandler(actions.ActionLeakTest, HandleLeakTest)
+}
+
+// resolverIdentity is what an external service sees for a DNS query.
+type resolverIdentity struct {
+	resolvers []string
+	subnet    string
+}
+
+func (r resolverIdentity) String() string {
+	s := strings.Join(r.resolvers, ", ")
+	if r.subnet != "" {
+		s += fmt.Sprintf(" (client subnet %s)", r.subnet)
+	}
+	return s
+}
+
+// overlaps reports whether two identities share a resolver or client subnet.
+func (r resolverIdentity) overlaps(other resolverIdentity) bool {
+	if r.subnet != "" && r.subnet == other.subnet {
+		return true
+	}
+	for _, a := range r.resolvers {
+		for _, b := range other.resolvers {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HandleLeakTest checks whether DNS resolution goes through the tunnel.
+func HandleLeakTest(ctx *actions.Context) error {
+	cfg, _ := LoadConfig(ctx)
+	gwAddr := GatewayAddr(cfg)
+
+	beginProgress(ctx, "DNS Leak Test")
+
+	headers := []string{"CHECK", "RESULT", "DETAIL"}
+	var rows [][]string
+
+	// 1. Gateway reachable
+	conn, err := net.DialTimeout("tcp", gwAddr, 2*time.Second)
+	if err != nil {
+		return failProgress(ctx, actions.NewActionError(
+			fmt.Sprintf("gateway %s is not reachable", gwAddr),
+			"Start tunnels first: dnstc daemon start",
+		))
+	}
+	conn.Close()
+	rows = append(rows, []string{"Gateway", "ok", gwAddr})
+
+	// 2. Remote hostname resolution (socks5h-style CONNECT by name)
+	ctx.Output.Status("Testing remote hostname resolution through the tunnel...")
+	remoteDNSOK := false
+	dialCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if c, err := probe.DialSOCKS5(dialCtx, gwAddr, "dns.google:53"); err != nil {
+		rows = append(rows, []string{"Remote resolution", "FAIL", err.Error()})
+	} else {
+		c.Close()
+		remoteDNSOK = true
+		rows = append(rows, []string{"Remote resolution", "ok", "hostnames resolve at the tunnel exit"})
+	}
+	cancel()
+
+	// 3. DNS through the tunnel
+	ctx.Output.Status("Querying DNS through the tunnel...")
+	tunnelID, tunnelErr := tunnelResolverIdentity(gwAddr)
+	if tunnelErr != nil {
+		rows = append(rows, []string{"DNS via tunnel", "FAIL", tunnelErr.Error()})
+	} else {
+		rows = append(rows, []string{"DNS via tunnel", "ok", "seen as " + tunnelID.String()})
+	}
+
+	// 4. System resolver
+	ctx.Output.Status("Querying the system resolver directly...")
+	directID, directErr := systemResolverIdentity()
+	leak := false
+	switch {
+	case directErr != nil:
+		rows = append(rows, []string{"System resolver", "unknown", directErr.Error()})
+	case tunnelErr == nil && directID.overlaps(tunnelID):
+		rows = append(rows, []string{"System resolver", "ok", "seen as " + directID.String() + " (same as tunnel)"})
+	default:
+		leak = true
+		rows = append(rows, []string{"System resolver", "LEAK", "seen as " + directID.String()})
+	}
+
+	ctx.Output.Table(headers, rows)
+	ctx.Output.Println()
+
+	if !remoteDNSOK || tunnelErr != nil {
+		return failProgress(ctx, actions.NewActionError(
+			"DNS does not work through the tunnel",
+			"Check the active tunnel with 'dnstc tunnel status -t <tag>'",
+		))
+	}
+
+	if leak {
+		ctx.Output.Warning("Applications that resolve hostnames locally leak DNS queries outside the tunnel")
+		ctx.Output.Info("Configure applications to resolve hostnames through the proxy:")
+		ctx.Output.Status("Firefox: enable \"Proxy DNS when using SOCKS v5\"")
+		ctx.Output.Status("Chromium: --proxy-server=socks5://" + gwAddr)
+		ctx.Output.Status("curl: use --socks5-hostname (or socks5h://) instead of --socks5")
+		ctx.Output.Status("Other apps: prefer a socks5h:// proxy URL")
+	} else {
+		ctx.Output.Success("No DNS leak detected")
+	}
+
+	endProgress(ctx)
+	return nil
+}
+
+// tunnelResolverIdentity queries the leak-test name over TCP through the gateway.
+func tunnelResolverIdentity(gwAddr string) (resolverIdentity, error) {
+	dialCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conn, err := probe.DialSOCKS5(dialCtx, gwAddr, leakTestResolver)
+	if err != nil {
+		return resolverIdentity{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	resp, err := probe.QueryConn(conn, leakTestName, probe.TypeTXT)
+	if err != nil {
+		return resolverIdentity{}, err
+	}
+	if resp.RCode != probe.RCodeSuccess {
+		return resolverIdentity{}, fmt.Errorf("resolver returned %s", probe.RCodeName(resp.RCode))
+	}
+	return parseResolverIdentity(resp.Values(probe.TypeTXT)), nil
+}
+
+// systemResolverIdentity queries the leak-test name through the system resolver.
+func systemResolverIdentity() (resolverIdentity, error) {
+	lookupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	txts, err := net.DefaultResolver.LookupTXT(lookupCtx, leakTestName)
+	if err != nil {
+		return resolverIdentity{}, err
+	}
+	return parseResolverIdentity(txts), nil
+}
+
+func parseResolverIdentity(txts []string) resolverIdentity {
+	var id resolverIdentity
+	for _, txt := range txts {
+		if subnet, ok := strings.CutPrefix(txt, "edns0-client-subnet "); ok {
+			id.subnet = subnet
+		} else {
+			id.resolvers = append(id.resolvers, txt)
+		}
+	}
+	return id
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/ipc"
+	"github.com/net2share/dnstc/internal/process"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionLogsClear, HandleLogsClear)
+}
+
+// HandleLogsClear truncates the tunnel logs, through the in-process engine
+// or running daemon if there is one, so nothing has to restart.
+func HandleLogsClear(ctx *actions.Context) error {
+	keep := ctx.GetBool("keep")
+
+	var r process.Rotation
+	var err error
+	if eng := engine.Get(); eng != nil {
+		r, err = eng.RotateLogs(ctx.Ctx, keep)
+	} else if running, client := ipc.DetectDaemon(); running {
+		defer client.Close()
+		r, err = client.RotateLogs(ctx.Ctx, keep)
+	} else {
+		r, err = process.RotateLogs(config.LogDir(), keep)
+	}
+	if err != nil && r.Files == 0 {
+		return actions.NewActionError(fmt.Sprintf("failed to clear logs: %v", err),
+			"Run as the user the daemon runs as, or start the daemon and try again")
+	}
+
+	if r.Files == 0 {
+		ctx.Output.Info("No logs to clear")
+		return nil
+	}
+	noun := "logs"
+	if r.Files == 1 {
+		noun = "log"
+	}
+	ctx.Output.Success(fmt.Sprintf("Cleared %d %s, freeing %s", r.Files, noun, formatBytes(r.Freed)))
+	if keep {
+		ctx.Output.Info(fmt.Sprintf("Previous content kept as *.log.1 in %s", config.LogDir()))
+	}
+	if err != nil {
+		ctx.Output.Warning(fmt.Sprintf("Some logs could not be cleared: %v", err))
+	}
+	return nil
+}
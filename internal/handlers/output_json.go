@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/net2share/dnstc/internal/actions"
+)
+
+// JSONOutput implements OutputWriter by collecting what a handler reports
+// into a JSONResult, written with Emit once the handler returns.
+type JSONOutput struct {
+	result    JSONResult
+	progress  bool
+	text      strings.Builder
+	verbosity actions.Verbosity
+}
+
+// JSONResult is the output of a command run with --json.
+type JSONResult struct {
+	OK       bool               `json:"ok"`
+	Messages []JSONMessage      `json:"messages,omitempty"`
+	Tables   []JSONTable        `json:"tables,omitempty"`
+	Sections []JSONSection      `json:"sections,omitempty"`
+	Text     string             `json:"text,omitempty"` // printed as is, e.g. a config or URL
+	Error    *actions.ErrorJSON `json:"error,omitempty"`
+}
+
+// JSONMessage is a status line: Level is info, success, warning, error,
+// status, step or, with --verbose, debug.
+type JSONMessage struct {
+	Level string `json:"level"`
+	Text  string `json:"text"`
+}
+
+// JSONTable is a table, each row with a cell per header.
+type JSONTable struct {
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
+}
+
+// JSONSection is a box or a section of an info view.
+type JSONSection struct {
+	Title string        `json:"title,omitempty"`
+	Lines []string      `json:"lines,omitempty"`
+	Rows  []JSONInfoRow `json:"rows,omitempty"`
+}
+
+// JSONInfoRow is a row of an info section.
+type JSONInfoRow struct {
+	Key     string   `json:"key,omitempty"`
+	Value   string   `json:"value,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+}
+
+// NewJSONOutput creates a new JSON output writer.
+func NewJSONOutput() *JSONOutput {
+	return &JSONOutput{}
+}
+
+// SetVerbosity sets whether debug messages are collected. Other messages
+// are always collected.
+func (j *JSONOutput) SetVerbosity(v actions.Verbosity) {
+	j.verbosity = v
+}
+
+// Emit writes the collected output and err, if not nil, to w.
+func (j *JSONOutput) Emit(w io.Writer, err error) error {
+	r := j.result
+	r.OK = err == nil
+	r.Text = j.text.String()
+	if err != nil {
+		e := actions.NewErrorJSON(err)
+		r.Error = &e
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (j *JSONOutput) message(level, msg string) {
+	j.result.Messages = append(j.result.Messages, JSONMessage{Level: level, Text: msg})
+}
+
+func (j *JSONOutput) Print(msg string) {
+	j.text.WriteString(msg)
+}
+
+func (j *JSONOutput) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(&j.text, format, args...)
+}
+
+func (j *JSONOutput) Println(args ...interface{}) {
+	fmt.Fprintln(&j.text, args...)
+}
+
+func (j *JSONOutput) Info(msg string)    { j.message("info", msg) }
+func (j *JSONOutput) Success(msg string) { j.message("success", msg) }
+func (j *JSONOutput) Warning(msg string) { j.message("warning", msg) }
+func (j *JSONOutput) Error(msg string)   { j.message("error", msg) }
+func (j *JSONOutput) Status(msg string)  { j.message("status", msg) }
+
+func (j *JSONOutput) Step(current, total int, msg string) {
+	j.message("step", fmt.Sprintf("[%d/%d] %s", current, total, msg))
+}
+
+func (j *JSONOutput) Box(title string, lines []string) {
+	j.result.Sections = append(j.result.Sections, JSONSection{Title: title, Lines: lines})
+}
+
+func (j *JSONOutput) KV(key, value string) string {
+	return key + ": " + value
+}
+
+func (j *JSONOutput) Table(headers []string, rows [][]string) {
+	if rows == nil {
+		rows = [][]string{}
+	}
+	j.result.Tables = append(j.result.Tables, JSONTable{Headers: headers, Rows: rows})
+}
+
+func (j *JSONOutput) Separator(length int) {}
+
+func (j *JSONOutput) ShowInfo(cfg actions.InfoConfig) error {
+	if cfg.Title != "" || cfg.Description != "" {
+		s := JSONSection{Title: cfg.Title}
+		if cfg.Description != "" {
+			s.Lines = strings.Split(cfg.Description, "\n")
+		}
+		j.result.Sections = append(j.result.Sections, s)
+	}
+	for _, section := range cfg.Sections {
+		s := JSONSection{Title: section.Title}
+		for _, row := range section.Rows {
+			s.Rows = append(s.Rows, JSONInfoRow{Key: row.Key, Value: row.Value, Columns: row.Columns})
+		}
+		j.result.Sections = append(j.result.Sections, s)
+	}
+	return nil
+}
+
+func (j *JSONOutput) Debug(msg string) {
+	if j.verbosity >= actions.VerbosityVerbose {
+		j.message("debug", msg)
+	}
+}
+
+func (j *JSONOutput) BeginProgress(title string) { j.progress = true }
+func (j *JSONOutput) EndProgress()               { j.progress = false }
+func (j *JSONOutput) DismissProgress()           { j.progress = false }
+func (j *JSONOutput) IsProgressActive() bool     { return j.progress }
+
+var _ actions.OutputWriter = (*JSONOutput)(nil)
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/net2share/dnstc/internal/actions"
@@ -11,6 +12,7 @@ import (
 // TUIOutput implements OutputWriter using the tui package.
 type TUIOutput struct {
 	progressView *tui.ProgressView
+	verbosity    actions.Verbosity
 }
 
 // NewTUIOutput creates a new TUI output writer.
@@ -18,6 +20,15 @@ func NewTUIOutput() *TUIOutput {
 	return &TUIOutput{}
 }
 
+// SetVerbosity sets how much is shown.
+func (t *TUIOutput) SetVerbosity(v actions.Verbosity) {
+	t.verbosity = v
+}
+
+func (t *TUIOutput) quiet() bool {
+	return t.verbosity <= actions.VerbosityQuiet
+}
+
 func (t *TUIOutput) Print(msg string) {
 	if t.progressView != nil {
 		t.progressView.AddText(msg)
@@ -47,6 +58,9 @@ func (t *TUIOutput) Println(args ...interface{}) {
 }
 
 func (t *TUIOutput) Info(msg string) {
+	if t.quiet() {
+		return
+	}
 	if t.progressView != nil {
 		t.progressView.AddInfo(msg)
 		return
@@ -55,6 +69,9 @@ func (t *TUIOutput) Info(msg string) {
 }
 
 func (t *TUIOutput) Success(msg string) {
+	if t.quiet() {
+		return
+	}
 	if t.progressView != nil {
 		t.progressView.AddSuccess(msg)
 		return
@@ -79,6 +96,9 @@ func (t *TUIOutput) Error(msg string) {
 }
 
 func (t *TUIOutput) Status(msg string) {
+	if t.quiet() {
+		return
+	}
 	if t.progressView != nil {
 		t.progressView.AddStatus(msg)
 		return
@@ -87,6 +107,9 @@ func (t *TUIOutput) Status(msg string) {
 }
 
 func (t *TUIOutput) Step(current, total int, msg string) {
+	if t.quiet() {
+		return
+	}
 	if t.progressView != nil {
 		t.progressView.AddInfo(fmt.Sprintf("[%d/%d] %s", current, total, msg))
 		return
@@ -112,59 +135,28 @@ func (t *TUIOutput) KV(key, value string) string {
 }
 
 func (t *TUIOutput) Table(headers []string, rows [][]string) {
-	widths := make([]int, len(headers))
-	for i, h := range headers {
-		widths[i] = len(h)
-	}
-	for _, row := range rows {
-		for i, cell := range row {
-			if i < len(widths) && len(cell) > widths[i] {
-				widths[i] = len(cell)
-			}
-		}
+	width := TerminalWidth()
+	if t.progressView != nil && width > 0 {
+		width -= progressIndent
 	}
-
-	var formatParts []string
-	for _, w := range widths {
-		formatParts = append(formatParts, fmt.Sprintf("%%-%ds", w+2))
-	}
-	format := strings.Join(formatParts, "")
+	widths := columnWidths(headers, rows, width)
 
 	if t.progressView != nil {
-		headerArgs := make([]interface{}, len(headers))
-		for i, h := range headers {
-			headerArgs[i] = h
-		}
-		t.progressView.AddText(fmt.Sprintf(format, headerArgs...))
+		t.progressView.AddText(formatRow(headers, widths))
 		for _, row := range rows {
-			rowArgs := make([]interface{}, len(row))
-			for i, cell := range row {
-				rowArgs[i] = cell
-			}
-			t.progressView.AddText(fmt.Sprintf(format, rowArgs...))
+			t.progressView.AddText(formatRow(row, widths))
 		}
 		return
 	}
 
-	format += "\n"
-	headerArgs := make([]interface{}, len(headers))
-	for i, h := range headers {
-		headerArgs[i] = h
-	}
-	fmt.Printf(format, headerArgs...)
-
+	fmt.Println(formatRow(headers, widths))
 	total := 0
 	for _, w := range widths {
-		total += w + 2
+		total += w + columnGap
 	}
-	t.Separator(total)
-
+	t.Separator(total - columnGap)
 	for _, row := range rows {
-		rowArgs := make([]interface{}, len(row))
-		for i, cell := range row {
-			rowArgs[i] = cell
-		}
-		fmt.Printf(format, rowArgs...)
+		fmt.Println(formatRow(row, widths))
 	}
 }
 
@@ -195,6 +187,17 @@ func (t *TUIOutput) ShowInfo(cfg actions.InfoConfig) error {
 	return tui.ShowInfo(tuiCfg)
 }
 
+func (t *TUIOutput) Debug(msg string) {
+	if t.verbosity < actions.VerbosityVerbose {
+		return
+	}
+	if t.progressView != nil {
+		t.progressView.AddText(msg)
+		return
+	}
+	fmt.Fprintln(os.Stderr, msg)
+}
+
 func (t *TUIOutput) BeginProgress(title string) {
 	t.progressView = tui.NewProgressView(title)
 }
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/clientcfg"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/port"
+)
+
+// provisionFile is the content of a provisioning file: any config settings,
+// tunnels merged into the config by tag, and dnstm:// or ss:// URLs
+// imported as tunnels.
+type provisionFile struct {
+	*config.Config
+	URLs []string `json:"urls,omitempty"`
+}
+
+// Provision applies the first provisioning file found at
+// config.ProvisionPaths to the config, saves it and deletes the file, so
+// that it is applied once. It returns the file applied, or "" if there was
+// none. A file that fails to apply is left in place.
+//
+// The checksum of each file applied is recorded at config.ProvisionedPath,
+// so that one the user can't delete, such as a file under /etc/dnstc for a
+// daemon not running as root, isn't applied again over later changes.
+func Provision() (string, error) {
+	var path string
+	var data []byte
+	for _, p := range config.ProvisionPaths() {
+		d, err := os.ReadFile(p)
+		if err == nil {
+			path, data = p, d
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return p, fmt.Errorf("failed to read %s: %w", p, err)
+		}
+	}
+	if path == "" {
+		return "", nil
+	}
+	sum := sha256.Sum256(data)
+	applied := loadProvisioned()
+	if slices.Contains(applied, hex.EncodeToString(sum[:])) {
+		os.Remove(path) // may be read-only to us; already applied either way
+		return "", nil
+	}
+
+	cfg, err := config.LoadOrDefault()
+	if err != nil {
+		return path, err
+	}
+	if err := applyProvision(cfg, data); err != nil {
+		return path, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.Save(); err != nil {
+		return path, fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := saveProvisioned(append(applied, hex.EncodeToString(sum[:]))); err != nil {
+		return path, fmt.Errorf("applied, but failed to record it: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return path, fmt.Errorf("applied, but failed to remove %s; it won't be applied again: %w", path, err)
+	}
+	return path, nil
+}
+
+// loadProvisioned returns the checksums of the provisioning files applied.
+func loadProvisioned() []string {
+	var sums []string
+	if data, err := os.ReadFile(config.ProvisionedPath()); err == nil {
+		json.Unmarshal(data, &sums)
+	}
+	return sums
+}
+
+// saveProvisioned records the checksums of the provisioning files applied.
+func saveProvisioned(sums []string) error {
+	data, err := json.Marshal(sums)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(config.ProvisionedPath(), data, 0600)
+}
+
+// applyProvision merges a provisioning file into cfg.
+func applyProvision(cfg *config.Config, data []byte) error {
+	old := cfg.Clone()
+	// Settings are decoded over the config; tunnels are merged below
+	existing := cfg.Tunnels
+	cfg.Tunnels = nil
+	p := provisionFile{Config: cfg}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		cfg.Tunnels = existing
+		return fmt.Errorf("failed to parse: %w", err)
+	}
+	provisioned := cfg.Tunnels
+	cfg.Tunnels = existing
+
+	for _, tc := range provisioned {
+		mergeTunnel(cfg, tc)
+	}
+	for _, url := range p.URLs {
+		cc, err := clientcfg.Parse(url)
+		if err != nil {
+			return fmt.Errorf("failed to decode URL: %w", err)
+		}
+		tag := actions.ImportTag(cc, cfg.Tunnels)
+		localPort := cc.Port
+		if localPort == 0 || !port.IsAvailable(localPort) || portTaken(cfg, localPort) {
+			if localPort, err = port.GetAvailable(); err != nil {
+				return fmt.Errorf("failed to find available port: %w", err)
+			}
+		}
+		tc, err := TunnelFromClientConfig(cc, tag, localPort, config.ConfigDir())
+		if err != nil {
+			return err
+		}
+		if err := MergeDoH(cfg, cc); err != nil {
+			return err
+		}
+		mergeTunnel(cfg, tc)
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return config.CheckPolicy(old, cfg)
+}
+
+// mergeTunnel replaces the tunnel with the same tag, or adds it.
+func mergeTunnel(cfg *config.Config, tc config.TunnelConfig) {
+	if i := slices.IndexFunc(cfg.Tunnels, func(t config.TunnelConfig) bool { return t.Tag == tc.Tag }); i >= 0 {
+		cfg.Tunnels[i] = tc
+		return
+	}
+	cfg.Tunnels = append(cfg.Tunnels, tc)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/net2share/dnstc/internal/clientcfg"
+	"github.com/net2share/dnstc/internal/config"
+)
+
+const testPubkey = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// provisionBase returns a config with one DNSTT tunnel, "one".
+func provisionBase() *config.Config {
+	cfg := config.Default()
+	cfg.Tunnels = []config.TunnelConfig{{
+		Tag:       "one",
+		Transport: config.TransportDNSTT,
+		Backend:   config.BackendSOCKS,
+		Domain:    "a.example.com",
+		Port:      17001,
+		DNSTT:     &config.DNSTTConfig{Pubkey: testPubkey},
+	}}
+	cfg.Route.Active = "one"
+	return cfg
+}
+
+// provisionTunnel returns the JSON of a DNSTT tunnel for a provisioning file.
+func provisionTunnel(tag, domain string, port int) string {
+	return fmt.Sprintf(`{"tag":%q,"transport":"dnstt","backend":"socks","domain":%q,"port":%d,"dnstt":{"pubkey":%q}}`,
+		tag, domain, port, testPubkey)
+}
+
+func TestApplyProvision(t *testing.T) {
+	url, err := clientcfg.Encode(&clientcfg.ClientConfig{
+		Tag:       "three",
+		Transport: clientcfg.TransportConfig{Type: "dnstt", Domain: "c.example.com", PubKey: testPubkey},
+		Backend:   clientcfg.BackendConfig{Type: "socks"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+		// tags and domains of the tunnels afterwards, in order
+		want      []string
+		resolvers []string
+	}{
+		{
+			name:      "settings only",
+			file:      `{"resolvers":["9.9.9.9"]}`,
+			want:      []string{"one=a.example.com"},
+			resolvers: []string{"9.9.9.9"},
+		},
+		{
+			name: "tunnel replaced by tag",
+			file: `{"tunnels":[` + provisionTunnel("one", "b.example.com", 17001) + `]}`,
+			want: []string{"one=b.example.com"},
+		},
+		{
+			name: "tunnel added",
+			file: `{"tunnels":[` + provisionTunnel("two", "b.example.com", 17002) + `]}`,
+			want: []string{"one=a.example.com", "two=b.example.com"},
+		},
+		{
+			name: "url imported",
+			file: `{"urls":[` + fmt.Sprintf("%q", url) + `]}`,
+			want: []string{"one=a.example.com", "three=c.example.com"},
+		},
+		{
+			name:    "unknown field",
+			file:    `{"tunels":[]}`,
+			wantErr: "failed to parse",
+			want:    []string{"one=a.example.com"},
+		},
+		{
+			name:    "invalid tunnel",
+			file:    `{"tunnels":[{"tag":"two","transport":"dnstt","backend":"socks"}]}`,
+			wantErr: "domain is required",
+		},
+		{
+			name:    "bad url",
+			file:    `{"urls":["dnstm://!"]}`,
+			wantErr: "failed to decode URL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := provisionBase()
+			err := applyProvision(cfg, []byte(tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyProvision() = %v, want an error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("applyProvision() = %v", err)
+			}
+
+			if tt.want != nil {
+				var got []string
+				for _, tc := range cfg.Tunnels {
+					got = append(got, tc.Tag+"="+tc.Domain)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("tunnels = %v, want %v", got, tt.want)
+				}
+			}
+			if tt.resolvers != nil && !slices.Equal(cfg.Resolvers, tt.resolvers) {
+				t.Errorf("resolvers = %v, want %v", cfg.Resolvers, tt.resolvers)
+			}
+			if cfg.Route.Active != "one" {
+				t.Errorf("active tunnel = %q, want one", cfg.Route.Active)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionTunnelMove, HandleTunnelMove)
+	actions.SetHandler(actions.ActionResolverMove, HandleResolverMove)
+}
+
+// HandleTunnelMove moves a tunnel one place up or down the list.
+func HandleTunnelMove(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := RequireTag(ctx)
+	if err != nil {
+		return err
+	}
+	delta, err := moveDelta(ctx)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(cfg.Tunnels, func(tc config.TunnelConfig) bool { return tc.Tag == tag })
+	if i < 0 {
+		return actions.TunnelNotFoundError(tag)
+	}
+	j, ok := moveIndex(i, delta, len(cfg.Tunnels))
+	if !ok {
+		ctx.Output.Info(fmt.Sprintf("Tunnel '%s' is already %s", tag, moveEnd(delta)))
+		return nil
+	}
+	cfg.Tunnels[i], cfg.Tunnels[j] = cfg.Tunnels[j], cfg.Tunnels[i]
+	if err := saveReordered(cfg); err != nil {
+		return err
+	}
+	ctx.Output.Success(fmt.Sprintf("Moved tunnel '%s' to position %d of %d", tag, j+1, len(cfg.Tunnels)))
+	return nil
+}
+
+// HandleResolverMove moves a global resolver one place up or down the list.
+func HandleResolverMove(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	addr := ctx.GetArg(0)
+	if addr == "" {
+		addr = ctx.GetString("resolver")
+	}
+	delta, err := moveDelta(ctx)
+	if err != nil {
+		return err
+	}
+
+	i := slices.Index(cfg.Resolvers, addr)
+	if i < 0 {
+		return actions.NewActionError(fmt.Sprintf("resolver %s is not configured", addr), "See the resolvers with: dnstc config show")
+	}
+	j, ok := moveIndex(i, delta, len(cfg.Resolvers))
+	if !ok {
+		ctx.Output.Info(fmt.Sprintf("Resolver %s is already %s", addr, moveEnd(delta)))
+		return nil
+	}
+	cfg.Resolvers[i], cfg.Resolvers[j] = cfg.Resolvers[j], cfg.Resolvers[i]
+	if err := saveReordered(cfg); err != nil {
+		return err
+	}
+	ctx.Output.Success(fmt.Sprintf("Moved resolver %s to position %d of %d", addr, j+1, len(cfg.Resolvers)))
+	if j == 0 || i == 0 {
+		ctx.Output.Info(fmt.Sprintf("Tunnels without their own resolver now use %s", cfg.Resolvers[0]))
+	}
+	return nil
+}
+
+// moveDelta returns -1 for --up and 1 for --down.
+func moveDelta(ctx *actions.Context) (int, error) {
+	up, down := ctx.GetBool("up"), ctx.GetBool("down")
+	switch {
+	case up && !down:
+		return -1, nil
+	case down && !up:
+		return 1, nil
+	}
+	return 0, actions.NewCodedError(actions.CodeUsage, "give either --up or --down", "")
+}
+
+// moveIndex returns where an item at i in a list of n moves to, or false if
+// it is already at that end.
+func moveIndex(i, delta, n int) (int, bool) {
+	j := i + delta
+	return j, j >= 0 && j < n
+}
+
+func moveEnd(delta int) string {
+	if delta < 0 {
+		return "first"
+	}
+	return "last"
+}
+
+// saveReordered saves a reordered config and has a running daemon pick it up,
+// so that its own later saves keep the new order.
+func saveReordered(cfg *config.Config) error {
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	NotifyDaemonReload()
+	return nil
+}
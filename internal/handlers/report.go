@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/ipc"
+)
+
+// reportLogTail is how much of the end of each tunnel log goes in a report.
+const reportLogTail = 256 << 10
+
+// reportJournalTimeout bounds the journalctl query.
+const reportJournalTimeout = 10 * time.Second
+
+func init() {
+	actions.SetHandler(actions.ActionReport, HandleReport)
+}
+
+// reportFile is a file in the report archive.
+type reportFile struct {
+	name string
+	data []byte
+}
+
+// HandleReport writes a sanitized diagnostic bundle to a .tar.gz archive.
+func HandleReport(ctx *actions.Context) error {
+	path := ctx.GetString("output")
+	if path == "" {
+		path = fmt.Sprintf("dnstc-report-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+	events := ctx.GetInt("events")
+	if events <= 0 {
+		events = 500
+	}
+
+	var files []reportFile
+	add := func(name string, data []byte) {
+		files = append(files, reportFile{name: name, data: data})
+	}
+	addJSON := func(name string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		add(name, append(data, '\n'))
+		return nil
+	}
+
+	cfg, cfgErr := LoadConfig(ctx)
+	var secrets []string
+	if cfgErr == nil {
+		secrets = configSecrets(cfg)
+		if err := addJSON("config.json", cfg.Redacted()); err != nil {
+			return err
+		}
+	}
+
+	status, daemon := reportStatus()
+	if status != nil {
+		if err := addJSON("status.json", status); err != nil {
+			return err
+		}
+	}
+	if err := addJSON("versions.json", binaries.Versions()); err != nil {
+		return err
+	}
+
+	var sys strings.Builder
+	fmt.Fprintf(&sys, "dnstc:   %s\n", AppVersion)
+	fmt.Fprintf(&sys, "go:      %s\n", runtime.Version())
+	fmt.Fprintf(&sys, "os/arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	if data, err := os.ReadFile("/etc/os-release"); err == nil {
+		if name := osReleaseName(string(data)); name != "" {
+			fmt.Fprintf(&sys, "distro:  %s\n", name)
+		}
+	}
+	if out, err := exec.Command("uname", "-srm").Output(); err == nil {
+		fmt.Fprintf(&sys, "kernel:  %s", out)
+	}
+	fmt.Fprintf(&sys, "daemon:  %s\n", daemon)
+	if cfgErr != nil {
+		fmt.Fprintf(&sys, "config:  %v\n", cfgErr)
+	}
+	fmt.Fprintf(&sys, "created: %s\n", time.Now().Format(time.RFC3339))
+	add("system.txt", []byte(sys.String()))
+
+	logs, _ := filepath.Glob(filepath.Join(config.LogDir(), "*.log"))
+	sort.Strings(logs)
+	for _, p := range logs {
+		data, err := readTail(p, reportLogTail)
+		if err != nil {
+			continue
+		}
+		add("logs/"+filepath.Base(p), scrubSecrets(data, secrets))
+	}
+	if data := daemonJournal(ctx.Ctx, events); data != nil {
+		add("logs/daemon.log", scrubSecrets(data, secrets))
+	}
+
+	if err := writeReport(path, files); err != nil {
+		return actions.NewActionError(fmt.Sprintf("failed to write report: %v", err), "Check that the output directory is writable")
+	}
+
+	ctx.Output.Success(fmt.Sprintf("Report written to %s", path))
+	ctx.Output.Info("Secrets from the configuration are redacted; review the archive before sharing it")
+	return nil
+}
+
+// reportStatus returns the engine status and a description of where it came
+// from, or nil if no daemon is running.
+func reportStatus() (*engine.Status, string) {
+	if eng := engine.Get(); eng != nil {
+		return eng.Status(context.Background()), "in-process"
+	}
+	if running, client := ipc.DetectDaemon(); running {
+		defer client.Close()
+		s, err := client.FetchStatus(context.Background())
+		if err != nil {
+			return nil, fmt.Sprintf("running, status unavailable: %v", err)
+		}
+		return s, "running"
+	}
+	return nil, "not running"
+}
+
+// configSecrets returns the plaintext secrets in the config, which are
+// masked in the logs.
+func configSecrets(cfg *config.Config) []string {
+	var out []string
+	keep := func(s string) {
+		if config.RedactSecret(s) == config.RedactedValue {
+			out = append(out, s)
+		}
+	}
+	for _, t := range cfg.Tunnels {
+		if t.Shadowsocks != nil {
+			keep(t.Shadowsocks.Password)
+		}
+		if t.SSH != nil {
+			keep(t.SSH.Password)
+			keep(t.SSH.Passphrase)
+			if t.SSH.Obfs != nil {
+				keep(t.SSH.Obfs.Key)
+			}
+		}
+	}
+	return out
+}
+
+// scrubSecrets replaces every occurrence of a secret in data.
+func scrubSecrets(data []byte, secrets []string) []byte {
+	for _, s := range secrets {
+		data = bytes.ReplaceAll(data, []byte(s), []byte(config.RedactedValue))
+	}
+	return data
+}
+
+// readTail returns up to the last n bytes of a file.
+func readTail(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > n {
+		if _, err := f.Seek(-n, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
+
+// daemonJournal returns the last n lines the systemd service logged, or nil
+// if it has logged none or journald can't be read.
+func daemonJournal(ctx context.Context, n int) []byte {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, reportJournalTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "journalctl", "-u", "dnstc", "-n", strconv.Itoa(n),
+		"--no-pager", "-o", "short-iso").Output()
+	if err != nil || bytes.HasPrefix(out, []byte("-- No entries --")) {
+		return nil
+	}
+	return out
+}
+
+// osReleaseName returns PRETTY_NAME from an os-release file.
+func osReleaseName(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		if v, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return ""
+}
+
+// writeReport writes files to a gzipped tar archive at path, under a
+// directory named after it.
+func writeReport(path string, files []reportFile) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	dir := strings.TrimSuffix(filepath.Base(path), ".tar.gz")
+	now := time.Now()
+	for _, rf := range files {
+		hdr := &tar.Header{
+			Name:    dir + "/" + rf.name,
+			Mode:    0600,
+			Size:    int64(len(rf.data)),
+			ModTime: now,
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			break
+		}
+		if _, err = tw.Write(rf.data); err != nil {
+			break
+		}
+	}
+	for _, c := range []io.Closer{tw, gz, f} {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/doh"
+)
+
+// resolverDoHTimeout bounds the probe of a DoH upstream being added.
+const resolverDoHTimeout = 10 * time.Second
+
+func init() {
+	actions.SetHandler(actions.ActionResolverDoH, HandleResolverDoH)
+}
+
+// HandleResolverDoH probes a DoH upstream and, if it answers, adds it to the
+// config or replaces the one of the same name.
+func HandleResolverDoH(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	old := cfg.Clone()
+
+	d := config.DoHConfig{
+		Name: ctx.GetArg(0),
+		URL:  ctx.GetString("url"),
+		SNI:  ctx.GetString("sni"),
+		IP:   ctx.GetString("ip"),
+	}
+	if d.Name == "" {
+		d.Name = ctx.GetString("name")
+	}
+	if err := d.Validate(); err != nil {
+		return actions.NewActionError(err.Error(), "See 'dnstc resolver doh --help'")
+	}
+
+	domain := ctx.GetString("domain")
+	if domain == "" {
+		tag := ctx.GetString("tag")
+		if tag == "" {
+			tag = cfg.Route.Active
+		}
+		tc := cfg.GetTunnelByTag(tag)
+		if tc == nil {
+			if tag != "" {
+				return actions.TunnelNotFoundError(tag)
+			}
+			return actions.NewActionError("no tunnel domain to probe with",
+				"Give one with --domain, or a tunnel with --tag")
+		}
+		domain = tc.Domain
+	}
+
+	beginProgress(ctx, fmt.Sprintf("DoH Upstream: %s", d.Name))
+	ctx.Output.Info(fmt.Sprintf("Probing %s against %s...", d.URL, domain))
+
+	pctx, cancel := context.WithTimeout(ctx.Ctx, resolverDoHTimeout)
+	rtt, err := doh.Probe(pctx, d, domain)
+	cancel()
+	if err != nil {
+		hint := "Check the URL, or try --sni with a front on the same CDN and --ip with an address that isn't blocked"
+		return failProgress(ctx, actions.NewActionError(fmt.Sprintf("upstream did not answer: %v", err), hint))
+	}
+
+	if existing := cfg.GetDoH(d.Name); existing != nil {
+		*existing = d
+	} else {
+		cfg.DoH = append(cfg.DoH, d)
+	}
+	resolver := config.DoHPrefix + d.Name
+	if ctx.GetBool("use") {
+		cfg.Resolvers = append([]string{resolver}, slices.DeleteFunc(cfg.Resolvers, func(r string) bool { return r == resolver })...)
+	}
+	if err := cfg.Validate(); err != nil {
+		return failProgress(ctx, actions.NewActionError(err.Error(), ""))
+	}
+	if err := config.CheckPolicy(old, cfg); err != nil {
+		return failProgress(ctx, actions.NewActionError(err.Error(), "The policy is set by your administrator in "+config.PolicyPath()))
+	}
+	if err := cfg.Save(); err != nil {
+		return failProgress(ctx, fmt.Errorf("failed to save config: %w", err))
+	}
+	NotifyDaemonReload()
+
+	ctx.Output.Success(fmt.Sprintf("%s answered in %dms", d.Name, rtt.Milliseconds()))
+	if ctx.GetBool("use") {
+		ctx.Output.Info(fmt.Sprintf("Global resolver is now %s", resolver))
+	} else {
+		ctx.Output.Info(fmt.Sprintf("Use it as the resolver %s", resolver))
+	}
+	endProgress(ctx)
+	return nil
+}
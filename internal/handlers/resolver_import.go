@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/probe"
+	"github.com/net2share/dnstc/internal/resolvers"
+)
+
+// resolverImportTimeout bounds the probe of each resolver being benchmarked.
+const resolverImportTimeout = 3 * time.Second
+
+func init() {
+	actions.SetHandler(actions.ActionResolverImport, HandleResolverImport)
+}
+
+// HandleResolverImport benchmarks the curated resolvers of a region against
+// a tunnel domain and puts the fastest at the front of the global resolvers.
+func HandleResolverImport(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	old := cfg.Clone()
+
+	region := ctx.GetString("region")
+	list, ok := resolvers.ForRegion(region)
+	if !ok {
+		return actions.NewActionError(fmt.Sprintf("unknown region %q", region), "Use one of: global, ir, ru, cn")
+	}
+	count := ctx.GetInt("count")
+	if count <= 0 {
+		count = 3
+	}
+
+	domain := ctx.GetString("domain")
+	var tc *config.TunnelConfig
+	if domain == "" {
+		tag := ctx.GetArg(0)
+		if tag == "" {
+			tag = ctx.GetString("tag")
+		}
+		if tag == "" {
+			tag = cfg.Route.Active
+		}
+		if tc = cfg.GetTunnelByTag(tag); tc == nil {
+			if tag != "" {
+				return actions.TunnelNotFoundError(tag)
+			}
+			return actions.NewActionError("no tunnel domain to benchmark against",
+				"Give one with --domain, or a tunnel with --tag")
+		}
+		domain = tc.Domain
+	}
+
+	beginProgress(ctx, fmt.Sprintf("Resolver Import: %s", region))
+	ctx.Output.Info(fmt.Sprintf("Probing %d resolvers against %s...", len(list), domain))
+
+	servers := make([]string, len(list))
+	for i, r := range list {
+		servers[i] = r.Addr
+	}
+	results := probe.ProbeResolvers(servers, domain, resolverImportTimeout)
+
+	type ranked struct {
+		resolvers.Resolver
+		rtt time.Duration
+	}
+	var reachable []ranked
+	headers := []string{"RESOLVER", "ADDRESS", "RESULT"}
+	var rows [][]string
+	for i, res := range results {
+		if res.Err != nil {
+			rows = append(rows, []string{list[i].Name, list[i].Addr, res.Err.Error()})
+			continue
+		}
+		reachable = append(reachable, ranked{list[i], res.RTT})
+		rows = append(rows, []string{list[i].Name, list[i].Addr, fmt.Sprintf("%dms", res.RTT.Milliseconds())})
+	}
+	ctx.Output.Table(headers, rows)
+
+	if len(reachable) == 0 {
+		return failProgress(ctx, actions.NewActionError(
+			fmt.Sprintf("none of the %s resolvers reached %s", region, domain),
+			"Try another region, or check the domain's NS delegation with 'dnstc tunnel test-config'"))
+	}
+	slices.SortStableFunc(reachable, func(a, b ranked) int { return cmp.Compare(a.rtt, b.rtt) })
+	if len(reachable) > count {
+		reachable = reachable[:count]
+	}
+
+	var added []string
+	for _, r := range reachable {
+		added = append(added, r.Addr)
+	}
+	for _, addr := range cfg.Resolvers {
+		if !slices.Contains(added, addr) {
+			added = append(added, addr)
+		}
+	}
+	cfg.Resolvers = added
+	if err := config.CheckPolicy(old, cfg); err != nil {
+		return failProgress(ctx, actions.NewActionError(err.Error(), "The policy is set by your administrator in "+config.PolicyPath()))
+	}
+	if err := cfg.Save(); err != nil {
+		return failProgress(ctx, fmt.Errorf("failed to save config: %w", err))
+	}
+	NotifyDaemonReload()
+
+	for _, r := range reachable {
+		ctx.Output.Success(fmt.Sprintf("%s (%s) — %dms", r.Name, r.Addr, r.rtt.Milliseconds()))
+	}
+	ctx.Output.Info(fmt.Sprintf("Global resolver is now %s", cfg.Resolvers[0]))
+	if tc != nil && tc.Resolver != "" {
+		ctx.Output.Warning(fmt.Sprintf("Tunnel '%s' sets its own resolver (%s) and doesn't use the global one", tc.Tag, tc.Resolver))
+	}
+	endProgress(ctx)
+	return nil
+}
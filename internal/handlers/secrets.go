@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/secrets"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionSecretsList, HandleSecretsList)
+	actions.SetHandler(actions.ActionSecretsStore, HandleSecretsStore)
+	actions.SetHandler(actions.ActionSecretsRestore, HandleSecretsRestore)
+}
+
+// HandleSecretsList shows where each tunnel credential is stored.
+func HandleSecretsList(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for i := range cfg.Tunnels {
+		tc := &cfg.Tunnels[i]
+		for _, f := range secrets.Fields(tc) {
+			where := "config file"
+			if config.IsKeyringRef(*f.Value) {
+				where = "keyring"
+				if _, err := secrets.Get(strings.TrimPrefix(*f.Value, config.KeyringPrefix)); err != nil {
+					where = fmt.Sprintf("keyring (%v)", err)
+				}
+			}
+			rows = append(rows, []string{tc.Tag, f.Name, where})
+		}
+	}
+	if len(rows) == 0 {
+		ctx.Output.Info("No tunnel credentials configured")
+		return nil
+	}
+
+	ctx.Output.Table([]string{"TAG", "CREDENTIAL", "STORED IN"}, rows)
+	if !secrets.Available() {
+		ctx.Output.Warning("OS keyring not available on this system")
+	}
+	return nil
+}
+
+// HandleSecretsStore moves tunnel credentials from the config file into the keyring.
+func HandleSecretsStore(ctx *actions.Context) error {
+	if !secrets.Available() {
+		return actions.WrapError(secrets.ErrUnsupported, "OS keyring not available", "On Linux, install secret-tool (libsecret-tools)")
+	}
+	return moveSecrets(ctx, secrets.Store, "Stored %d credential(s) in the OS keyring")
+}
+
+// HandleSecretsRestore moves tunnel credentials from the keyring back into the config file.
+func HandleSecretsRestore(ctx *actions.Context) error {
+	return moveSecrets(ctx, secrets.Restore, "Moved %d credential(s) back into the config file")
+}
+
+// moveSecrets applies move to the tagged tunnel, or all tunnels, and saves the config.
+func moveSecrets(ctx *actions.Context, move func(*config.TunnelConfig) (int, error), done string) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag := ctx.GetString("tag")
+	if tag != "" && cfg.GetTunnelByTag(tag) == nil {
+		return actions.TunnelNotFoundError(tag)
+	}
+
+	total := 0
+	var errs []error
+	for i := range cfg.Tunnels {
+		tc := &cfg.Tunnels[i]
+		if tag != "" && tc.Tag != tag {
+			continue
+		}
+		n, err := move(tc)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tc.Tag, err))
+		}
+	}
+
+	// Save whatever moved, so the config matches the keyring even on partial failure
+	if total > 0 {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		NotifyDaemonReload()
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if total == 0 {
+		ctx.Output.Info("Nothing to move")
+		return nil
+	}
+	ctx.Output.Success(fmt.Sprintf(done, total))
+	return nil
+}
+
+// storeSecrets moves the tunnel's passwords into the OS keyring when the user
+// asked for it with --keyring or in the TUI.
+func storeSecrets(ctx *actions.Context, tc *config.TunnelConfig) error {
+	if !ctx.GetBool("keyring") && ctx.GetString("secret-store") != actions.SecretStoreKeyring {
+		return nil
+	}
+	n, err := secrets.Store(tc)
+	if err != nil {
+		return actions.WrapError(err, "failed to store credentials in the OS keyring", "Omit --keyring to keep them in the config file")
+	}
+	if n > 0 {
+		ctx.Output.Info(fmt.Sprintf("Stored %d credential(s) in the OS keyring", n))
+	}
+	return nil
+}
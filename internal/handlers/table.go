@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+const (
+	// columnGap is the space between table columns.
+	columnGap = 2
+	// minColumnWidth is how narrow a column may be truncated to.
+	minColumnWidth = 6
+	// progressIndent is the width the TUI progress view takes for its margins.
+	progressIndent = 4
+)
+
+// TerminalWidth returns the width of the terminal on stdout, or COLUMNS when
+// stdout is not a terminal, or 0 if unknown. Output piped to another program
+// is then not truncated.
+func TerminalWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 0
+}
+
+// columnWidths returns the display width of each column. When the table is
+// wider than maxWidth (if non-zero), the widest columns are narrowed first,
+// down to minColumnWidth.
+func columnWidths(headers []string, rows [][]string, maxWidth int) []int {
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = runewidth.StringWidth(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], runewidth.StringWidth(cell))
+			}
+		}
+	}
+	if maxWidth <= 0 {
+		return widths
+	}
+
+	total := columnGap * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for total > maxWidth {
+		widest := -1
+		for i, w := range widths {
+			if w > minColumnWidth && (widest < 0 || w > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break // can't fit; let the terminal wrap
+		}
+		widths[widest]--
+		total--
+	}
+	return widths
+}
+
+// formatRow pads each cell to its column width by display width, so wide
+// characters stay aligned, and truncates cells that don't fit with "…".
+func formatRow(cells []string, widths []int) string {
+	var b strings.Builder
+	for i, w := range widths {
+		cell := ""
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		if runewidth.StringWidth(cell) > w {
+			cell = runewidth.Truncate(cell, w, "…")
+		}
+		if i == len(widths)-1 {
+			b.WriteString(cell)
+			break
+		}
+		b.WriteString(runewidth.FillRight(cell, w+columnGap))
+	}
+	return b.String()
+}
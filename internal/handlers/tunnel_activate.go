@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/engine"
 	"github.com/net2share/dnstc/internal/ipc"
 )
@@ -28,7 +30,11 @@ func HandleTunnelActivate(ctx *actions.Context) error {
 		return actions.TunnelNotFoundError(tag)
 	}
 
-	if cfg.Route.Active == tag {
+	if ctx.GetBool("temporary") {
+		return activateTemporarily(ctx, cfg, tag)
+	}
+
+	if cfg.Route.Active == tag && !activeOverridden() {
 		ctx.Output.Info(fmt.Sprintf("Tunnel '%s' is already active", tag))
 		return nil
 	}
@@ -37,16 +43,16 @@ func HandleTunnelActivate(ctx *actions.Context) error {
 	// Otherwise, try IPC to a running daemon.
 	// Fallback: update config on disk only.
 	if eng := engine.Get(); eng != nil {
-		if err := eng.ActivateTunnel(tag); err != nil {
+		if err := eng.ActivateTunnel(ctx.Ctx, tag); err != nil {
 			return fmt.Errorf("failed to activate tunnel: %w", err)
 		}
 	} else if running, client := ipc.DetectDaemon(); running {
 		defer client.Close()
-		if err := client.ActivateTunnel(tag); err != nil {
+		if err := client.ActivateTunnel(ctx.Ctx, tag); err != nil {
 			return fmt.Errorf("failed to activate tunnel: %w", err)
 		}
 	} else {
-		cfg.Route.Active = tag
+		cfg.Route.Activate(tag)
 		if err := cfg.Save(); err != nil {
 			return fmt.Errorf("failed to save config: %w", err)
 		}
@@ -55,3 +61,42 @@ func HandleTunnelActivate(ctx *actions.Context) error {
 	ctx.Output.Success(fmt.Sprintf("Switched active tunnel to '%s'", tag))
 	return nil
 }
+
+// activateTemporarily switches the running engine or daemon to a tunnel
+// until it restarts, leaving route.active in the config as it is.
+func activateTemporarily(ctx *actions.Context, cfg *config.Config, tag string) error {
+	var eng engine.EngineController
+	if eng = engine.Get(); eng == nil {
+		running, client := ipc.DetectDaemon()
+		if !running {
+			return actions.NewActionError("no daemon running",
+				"A temporary switch applies to the running daemon; start it with: dnstc daemon start")
+		}
+		defer client.Close()
+		eng = client
+	}
+	if err := eng.OverrideActive(ctx.Ctx, tag); err != nil {
+		return fmt.Errorf("failed to activate tunnel: %w", err)
+	}
+
+	if tag == cfg.Route.Active {
+		ctx.Output.Success(fmt.Sprintf("Back on the configured active tunnel '%s'", tag))
+		return nil
+	}
+	ctx.Output.Success(fmt.Sprintf("Switched active tunnel to '%s' until the daemon restarts", tag))
+	ctx.Output.Info(fmt.Sprintf("route.active stays '%s'", cfg.Route.Active))
+	return nil
+}
+
+// activeOverridden reports whether the running engine or daemon routes
+// through a tunnel other than route.active.
+func activeOverridden() bool {
+	if eng := engine.Get(); eng != nil {
+		return eng.Status(context.Background()).ActiveOverride
+	}
+	if running, client := ipc.DetectDaemon(); running {
+		defer client.Close()
+		return client.Status(context.Background()).ActiveOverride
+	}
+	return false
+}
@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/port"
+	"github.com/net2share/dnstc/internal/sshtunnel"
 )
 
 func init() {
@@ -22,10 +27,16 @@ func HandleTunnelAdd(ctx *actions.Context) error {
 		if !port.IsAvailable(gwPort) {
 			if p, pErr := port.GetAvailable(); pErr == nil {
 				cfg.Listen.SOCKS = fmt.Sprintf("127.0.0.1:%d", p)
+				ctx.Output.Warning(fmt.Sprintf("Port %d is in use by %s; the gateway will listen on %s", gwPort, port.FindOwner(gwPort), cfg.Listen.SOCKS))
 			}
 		}
 		ctx.Config = cfg
 	}
+	old := cfg.Clone()
+
+	if url := ctx.GetString("url"); url != "" {
+		return importTunnel(ctx, cfg, url)
+	}
 
 	transportStr := ctx.GetString("transport")
 	backendStr := ctx.GetString("backend")
@@ -82,6 +93,13 @@ func HandleTunnelAdd(ctx *actions.Context) error {
 		Port:      localPort,
 	}
 
+	if resolver := ctx.GetString("resolver"); resolver != "" {
+		if _, _, err := net.SplitHostPort(resolver); err != nil {
+			resolver = net.JoinHostPort(resolver, "53")
+		}
+		tc.Resolver = resolver
+	}
+
 	// Transport-specific config
 	switch transportType {
 	case config.TransportSlipstream:
@@ -100,6 +118,14 @@ func HandleTunnelAdd(ctx *actions.Context) error {
 		tc.DNSTT = &config.DNSTTConfig{Pubkey: pubkey}
 	}
 
+	// Backend-specific flags must match the backend
+	if backendType != config.BackendSSH && (ctx.GetString("ssh-user") != "" || ctx.GetString("ssh-password") != "" || ctx.GetString("ssh-key") != "") {
+		return actions.NewActionError("--ssh-user, --ssh-password and --ssh-key only apply to the SSH backend", "Use --backend ssh")
+	}
+	if backendType != config.BackendShadowsocks && (ctx.GetString("ss-server") != "" || ctx.GetString("ss-password") != "") {
+		return actions.NewActionError("--ss-server and --ss-password only apply to the Shadowsocks backend", "Use --backend shadowsocks")
+	}
+
 	// Backend-specific config
 	switch backendType {
 	case config.BackendShadowsocks:
@@ -124,21 +150,53 @@ func HandleTunnelAdd(ctx *actions.Context) error {
 		if sshUser == "" {
 			return fmt.Errorf("--ssh-user is required for SSH backend")
 		}
+		if data := ctx.GetString("ssh-key-data"); data != "" {
+			sshKey = filepath.Join(config.ConfigDir(), tag+".key.pem")
+			if err := os.MkdirAll(config.ConfigDir(), 0755); err != nil {
+				return fmt.Errorf("failed to save SSH key: %w", err)
+			}
+			if err := os.WriteFile(sshKey, sshtunnel.NormalizeKey(data), 0600); err != nil {
+				return fmt.Errorf("failed to save SSH key: %w", err)
+			}
+		}
 		if sshPassword == "" && sshKey == "" {
 			return fmt.Errorf("--ssh-password or --ssh-key is required for SSH backend")
 		}
+		if sshKey != "" {
+			// The daemon runs with a different working directory and home
+			if sshKey, err = absPath(sshKey); err != nil {
+				return fmt.Errorf("invalid SSH key path: %w", err)
+			}
+			if err := sshtunnel.CheckKeyFile(sshKey, ctx.GetString("ssh-passphrase")); err != nil {
+				return actions.NewActionError(fmt.Sprintf("invalid SSH key: %v", err), "Pass --ssh-passphrase for encrypted keys")
+			}
+		}
 		tc.SSH = &config.SSHConfig{
-			User:     sshUser,
-			Password: sshPassword,
-			Key:      sshKey,
+			User:       sshUser,
+			Password:   sshPassword,
+			Key:        sshKey,
+			Passphrase: ctx.GetString("ssh-passphrase"),
+		}
+		if ctx.GetString("ssh-key-data") != "" {
+			tc.Files = append(tc.Files, sshKey)
 		}
 	}
 
+	if err := storeSecrets(ctx, &tc); err != nil {
+		return err
+	}
+
 	// Add to config
 	cfg.Tunnels = append(cfg.Tunnels, tc)
 	if cfg.Route.Active == "" {
 		cfg.Route.Active = tag
 	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid tunnel: %w", err)
+	}
+	if err := config.CheckPolicy(old, cfg); err != nil {
+		return actions.NewActionError(err.Error(), "The policy is set by your administrator in "+config.PolicyPath())
+	}
 
 	if err := cfg.Save(); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
@@ -150,10 +208,26 @@ func HandleTunnelAdd(ctx *actions.Context) error {
 	ctx.Output.Status(fmt.Sprintf("Backend: %s", config.GetBackendTypeDisplayName(backendType)))
 	ctx.Output.Status(fmt.Sprintf("Domain: %s", domain))
 	ctx.Output.Status(fmt.Sprintf("Local port: %d", localPort))
+	if tc.Resolver != "" {
+		ctx.Output.Status(fmt.Sprintf("Resolver: %s", tc.Resolver))
+	}
 
 	if cfg.Route.Active == tag {
 		ctx.Output.Info("Set as active tunnel")
 	}
 
+	EnsureTunnelBinaries(ctx, &tc)
 	return nil
 }
+
+// absPath expands a leading ~ and makes path absolute.
+func absPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
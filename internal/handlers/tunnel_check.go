@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/doh"
+	"github.com/net2share/dnstc/internal/probe"
+	"github.com/net2share/dnstc/internal/secrets"
+	"github.com/net2share/dnstc/internal/sshtunnel"
+	"github.com/net2share/dnstc/internal/transport"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionTunnelCheck, HandleTunnelCheck)
+}
+
+// checkQueryTimeout bounds each DNS query made by the pre-flight checks.
+const checkQueryTimeout = 5 * time.Second
+
+// HandleTunnelCheck checks a tunnel's configuration and DNS path without
+// starting it, stopping at the first stage that fails.
+func HandleTunnelCheck(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag, err := RequireTag(ctx)
+	if err != nil {
+		return err
+	}
+
+	tc := cfg.GetTunnelByTag(tag)
+	if tc == nil {
+		return actions.TunnelNotFoundError(tag)
+	}
+
+	resolver := ctx.GetString("resolver")
+	if resolver == "" {
+		resolver = cfg.GetResolver(tc)
+	}
+	if name, ok := config.DoHName(resolver); ok {
+		// Query the upstream through a forwarder, as the engine does
+		d := cfg.GetDoH(name)
+		if d == nil {
+			return actions.NewActionError(fmt.Sprintf("no doh upstream named '%s'", name), "Add it with: dnstc resolver doh")
+		}
+		f, err := doh.NewForwarder(*d)
+		if err != nil {
+			return fmt.Errorf("failed to start DoH forwarder: %w", err)
+		}
+		defer f.Close()
+		resolver = f.Addr()
+	} else if _, _, err := net.SplitHostPort(resolver); err != nil {
+		resolver = net.JoinHostPort(resolver, "53")
+	}
+
+	beginProgress(ctx, fmt.Sprintf("Test Config: %s", tag))
+
+	totalSteps := 5
+
+	// Step 1: Configuration
+	ctx.Output.Step(1, totalSteps, "Checking configuration...")
+	if err := checkTunnelConfig(cfg, tc); err != nil {
+		return failProgress(ctx, err)
+	}
+	ctx.Output.Status("Configuration is valid")
+
+	// Step 2: Transport binary
+	ctx.Output.Step(2, totalSteps, "Checking transport binary...")
+	if err := checkTunnelBinaries(tc); err != nil {
+		return failProgress(ctx, err)
+	}
+	ctx.Output.Status("Transport binary is installed")
+
+	// Step 3: Resolver
+	ctx.Output.Step(3, totalSteps, fmt.Sprintf("Querying resolver %s...", resolver))
+	rtt, err := checkResolver(ctx.Ctx, resolver, tc.Domain)
+	if err != nil {
+		return failProgress(ctx, err)
+	}
+	ctx.Output.Status(fmt.Sprintf("Resolver answered (%dms)", rtt.Milliseconds()))
+
+	// Step 4: Delegation
+	ctx.Output.Step(4, totalSteps, fmt.Sprintf("Looking up %s...", tc.Domain))
+	servers, err := checkDelegation(ctx.Ctx, resolver, tc.Domain)
+	if err != nil {
+		return failProgress(ctx, err)
+	}
+	if len(servers) > 0 {
+		ctx.Output.Status(fmt.Sprintf("Delegated to %s", strings.Join(servers, ", ")))
+	} else {
+		ctx.Output.Status("Domain exists")
+	}
+
+	// Step 5: Tunnel server
+	ctx.Output.Step(5, totalSteps, "Querying the tunnel server...")
+	qctx, cancel := context.WithTimeout(ctx.Ctx, checkQueryTimeout)
+	rtt, err = probe.ProbeResolver(qctx, resolver, tc.Domain)
+	cancel()
+	if err != nil {
+		return failProgress(ctx, actions.NewActionError(
+			fmt.Sprintf("server check failed: tunnel server did not answer through %s: %v", resolver, err),
+			"Check that the tunnel server is running and that the NS record of "+tc.Domain+" points at it",
+		))
+	}
+	ctx.Output.Status(fmt.Sprintf("Tunnel server answered (%dms)", rtt.Milliseconds()))
+
+	ctx.Output.Success(fmt.Sprintf("Tunnel '%s' passed all checks", tag))
+	endProgress(ctx)
+	return nil
+}
+
+// checkTunnelConfig validates tc on its own and checks that its secrets and
+// key files can be read.
+func checkTunnelConfig(cfg *config.Config, tc *config.TunnelConfig) error {
+	// Validate a config holding only this tunnel so that problems with
+	// other tunnels or listeners do not fail the check
+	single := *cfg
+	single.Tunnels = []config.TunnelConfig{*tc}
+	single.Listen.Extra = nil
+	single.Route.Active = ""
+	if err := single.Validate(); err != nil {
+		return actions.NewActionError(fmt.Sprintf("config check failed: %v", err), "Fix the tunnel with 'dnstc config edit'")
+	}
+
+	resolved, err := secrets.Resolve(*tc)
+	if err != nil {
+		return actions.NewActionError(fmt.Sprintf("config check failed: %v", err), "Check that the system keyring is unlocked")
+	}
+
+	if tc.Slipstream != nil && tc.Slipstream.Cert != "" {
+		if _, err := os.Stat(tc.Slipstream.Cert); err != nil {
+			return actions.NewActionError(fmt.Sprintf("config check failed: certificate: %v", err), "")
+		}
+	}
+	if resolved.SSH != nil && resolved.SSH.Key != "" {
+		if err := sshtunnel.CheckKeyFile(resolved.SSH.Key, resolved.SSH.Passphrase); err != nil {
+			hint := ""
+			if errors.Is(err, sshtunnel.ErrPassphraseRequired) {
+				hint = "Set the key's passphrase in the tunnel's SSH settings"
+			}
+			return actions.NewActionError(fmt.Sprintf("config check failed: SSH key: %v", err), hint)
+		}
+	}
+	return nil
+}
+
+// checkTunnelBinaries checks that the binaries the tunnel's transport runs are installed.
+func checkTunnelBinaries(tc *config.TunnelConfig) error {
+	t, err := transport.Get(tc.Transport)
+	if err != nil {
+		return actions.NewActionError(fmt.Sprintf("binary check failed: %v", err), "")
+	}
+	defs := binaries.Defs()
+	for _, name := range t.RequiredBinaries(tc.Backend) {
+		if !binaries.IsInstalled(defs[name]) {
+			return actions.NewActionError(
+				fmt.Sprintf("binary check failed: %s is not installed", name),
+				"Run 'dnstc install' to download it",
+			)
+		}
+	}
+	return nil
+}
+
+// checkResolver checks that resolver answers recursive queries, by asking
+// for the NS records of the zone above the tunnel domain.
+func checkResolver(ctx context.Context, resolver, domain string) (time.Duration, error) {
+	zone := domain
+	if _, parent, ok := strings.Cut(domain, "."); ok && strings.Contains(parent, ".") {
+		zone = parent
+	}
+
+	qctx, cancel := context.WithTimeout(ctx, checkQueryTimeout)
+	defer cancel()
+	resp, rtt, err := probe.QueryUDP(qctx, resolver, zone, probe.TypeNS)
+	if err != nil {
+		return 0, actions.NewActionError(
+			fmt.Sprintf("resolver check failed: %s did not answer: %v", resolver, err),
+			"The resolver may be blocked on this network; try another with --resolver",
+		)
+	}
+	if resp.RCode == probe.RCodeRefused {
+		return 0, actions.NewActionError(
+			fmt.Sprintf("resolver check failed: %s refused the query", resolver),
+			"It may not answer recursive queries from this network; try another with --resolver",
+		)
+	}
+	return rtt, nil
+}
+
+// checkDelegation looks up the tunnel domain's NS records and returns the
+// name servers found. A missing domain is an error; a SERVFAIL is left to
+// the server check, which tells apart an unreachable tunnel server.
+func checkDelegation(ctx context.Context, resolver, domain string) ([]string, error) {
+	qctx, cancel := context.WithTimeout(ctx, checkQueryTimeout)
+	defer cancel()
+	resp, _, err := probe.QueryUDP(qctx, resolver, domain, probe.TypeNS)
+	if err != nil {
+		return nil, actions.NewActionError(
+			fmt.Sprintf("delegation check failed: %s did not answer: %v", resolver, err),
+			"",
+		)
+	}
+	if resp.RCode == probe.RCodeNXDomain {
+		return nil, actions.NewActionError(
+			fmt.Sprintf("delegation check failed: %s does not exist", domain),
+			"Add an NS record delegating "+domain+" to the tunnel server",
+		)
+	}
+
+	var servers []string
+	for _, rr := range append(resp.Answers, resp.Authority...) {
+		if rr.Type == probe.TypeNS && strings.EqualFold(strings.TrimSuffix(rr.Name, "."), domain) {
+			servers = append(servers, strings.TrimSuffix(rr.Value, "."))
+		}
+	}
+	return servers, nil
+}
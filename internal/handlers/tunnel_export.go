@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/clientcfg"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/secrets"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionTunnelExport, HandleTunnelExport)
+}
+
+// HandleTunnelExport prints a dnstm:// URL for a tunnel, or its server bundle.
+func HandleTunnelExport(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag, err := RequireTag(ctx)
+	if err != nil {
+		return err
+	}
+
+	tc := cfg.GetTunnelByTag(tag)
+	if tc == nil {
+		return actions.TunnelNotFoundError(tag)
+	}
+
+	if ctx.GetBool("server-bundle") {
+		bundle, err := serverBundleFor(tc)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return err
+		}
+		ctx.Output.Println(string(data))
+		return nil
+	}
+
+	cc, err := ClientConfigFromTunnel(cfg, tc)
+	if err != nil {
+		return err
+	}
+	url, err := clientcfg.Encode(cc)
+	if err != nil {
+		return err
+	}
+
+	if ctx.IsInteractive {
+		ctx.Output.Box(fmt.Sprintf("Tunnel '%s'", tag), []string{url})
+		ctx.Output.Warning("The URL contains the tunnel's credentials")
+		return nil
+	}
+	ctx.Output.Println(url)
+	return nil
+}
+
+// ClientConfigFromTunnel builds the dnstm:// URL payload for a tunnel,
+// embedding the certificate and SSH key it refers to, the credentials kept in
+// the OS keyring and the DoH upstreams of cfg that its resolvers name. It is
+// the inverse of TunnelFromClientConfig and MergeDoH.
+func ClientConfigFromTunnel(cfg *config.Config, tunnel *config.TunnelConfig) (*clientcfg.ClientConfig, error) {
+	resolved, err := secrets.Resolve(*tunnel)
+	if err != nil {
+		return nil, actions.WrapError(err, "failed to read the tunnel's credentials from the OS keyring", "Check that the system keyring is unlocked")
+	}
+	tc := &resolved
+
+	cc := &clientcfg.ClientConfig{
+		Version: clientcfg.CurrentVersion,
+		Tag:     tc.Tag,
+		Transport: clientcfg.TransportConfig{
+			Type:   string(tc.Transport),
+			Domain: tc.Domain,
+		},
+		Backend: clientcfg.BackendConfig{
+			Type: string(tc.Backend),
+		},
+		Port: tc.Port,
+	}
+	if tc.Resolver != "" {
+		cc.Resolvers = []string{tc.Resolver}
+	}
+	if f := tc.Fallback; f != nil {
+		cc.Transport.Fallbacks = f.Domains
+		cc.Resolvers = append(cc.Resolvers, f.Resolvers...)
+	}
+	// A "doh:<name>" resolver means nothing without the upstream it names
+	for _, r := range cc.Resolvers {
+		name, ok := config.DoHName(r)
+		if !ok || slices.ContainsFunc(cc.DoH, func(u clientcfg.DoHUpstream) bool { return u.Name == name }) {
+			continue
+		}
+		d := cfg.GetDoH(name)
+		if d == nil {
+			return nil, fmt.Errorf("resolver %s: no doh upstream named '%s'", r, name)
+		}
+		cc.DoH = append(cc.DoH, clientcfg.DoHUpstream{Name: d.Name, URL: d.URL, SNI: d.SNI, IP: d.IP})
+	}
+
+	if tc.Slipstream != nil && tc.Slipstream.Cert != "" {
+		data, err := os.ReadFile(tc.Slipstream.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate: %w", err)
+		}
+		cc.Transport.Cert = string(data)
+	}
+	if tc.DNSTT != nil {
+		cc.Transport.PubKey = tc.DNSTT.Pubkey
+	}
+
+	if tc.Shadowsocks != nil {
+		cc.Backend.Password = tc.Shadowsocks.Password
+		cc.Backend.Method = tc.Shadowsocks.Method
+		cc.Backend.Server = tc.Shadowsocks.Server
+	}
+	if tc.SSH != nil {
+		cc.Backend.User = tc.SSH.User
+		cc.Backend.Password = tc.SSH.Password
+		cc.Backend.Passphrase = tc.SSH.Passphrase
+		if o := tc.SSH.Obfs; o != nil {
+			cc.Backend.ObfsKey = o.Key
+			cc.Backend.ObfsPad = o.Pad
+		}
+		if tc.SSH.Key != "" {
+			data, err := os.ReadFile(tc.SSH.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read SSH key: %w", err)
+			}
+			cc.Backend.Key = string(data)
+		}
+	}
+	return cc, nil
+}
+
+// serverBundle is what the dnstm server must match for a tunnel to work.
+type serverBundle struct {
+	Tag       string              `json:"tag"`
+	Transport string              `json:"transport"`
+	Domain    string              `json:"domain"`
+	Fallbacks []string            `json:"fallback_domains,omitempty"` // must be served too
+	Pubkey    string              `json:"pubkey,omitempty"`           // dnstt
+	CertPin   string              `json:"cert_fingerprint,omitempty"` // slipstream
+	Backend   serverBundleBackend `json:"backend"`
+}
+
+type serverBundleBackend struct {
+	Type   string `json:"type"`
+	Port   int    `json:"port,omitempty"`   // shadowsocks server port
+	Method string `json:"method,omitempty"` // shadowsocks
+	User   string `json:"user,omitempty"`   // ssh
+}
+
+// serverBundleFor builds the server-side expectations of a tunnel, without credentials.
+func serverBundleFor(tc *config.TunnelConfig) (*serverBundle, error) {
+	b := &serverBundle{
+		Tag:       tc.Tag,
+		Transport: string(tc.Transport),
+		Domain:    tc.Domain,
+		Backend:   serverBundleBackend{Type: string(tc.Backend)},
+	}
+	if tc.Fallback != nil {
+		b.Fallbacks = tc.Fallback.Domains
+	}
+	if tc.DNSTT != nil {
+		b.Pubkey = tc.DNSTT.Pubkey
+	}
+	if tc.Slipstream != nil && tc.Slipstream.Cert != "" {
+		data, err := os.ReadFile(tc.Slipstream.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate: %w", err)
+		}
+		if b.CertPin, err = clientcfg.CertPin(string(data)); err != nil {
+			return nil, err
+		}
+	}
+	if ss := tc.Shadowsocks; ss != nil {
+		b.Backend.Method = ss.Method
+		if _, p, err := net.SplitHostPort(ss.Server); err == nil {
+			b.Backend.Port, _ = strconv.Atoi(p)
+		}
+	}
+	if tc.SSH != nil {
+		b.Backend.User = tc.SSH.User
+	}
+	return b, nil
+}
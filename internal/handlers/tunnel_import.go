@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/clientcfg"
@@ -15,7 +16,7 @@ func init() {
 	actions.SetHandler(actions.ActionTunnelImport, HandleTunnelImport)
 }
 
-// HandleTunnelImport imports a tunnel from a dnstm:// URL.
+// HandleTunnelImport imports a tunnel from a dnstm:// or ss:// URL.
 func HandleTunnelImport(ctx *actions.Context) error {
 	cfg, err := LoadConfig(ctx)
 	if err != nil {
@@ -32,40 +33,128 @@ func HandleTunnelImport(ctx *actions.Context) error {
 		return fmt.Errorf("URL is required")
 	}
 
-	cc, err := clientcfg.Decode(url)
+	return importTunnel(ctx, cfg, url)
+}
+
+// importTunnel decodes a dnstm:// or ss:// URL and adds the tunnel it describes.
+func importTunnel(ctx *actions.Context, cfg *config.Config, url string) error {
+	cc, err := clientcfg.Parse(url)
 	if err != nil {
 		return fmt.Errorf("failed to decode URL: %w", err)
 	}
 
-	// Map transport type
-	transportType := config.TransportType(cc.Transport.Type)
-	if transportType != config.TransportSlipstream && transportType != config.TransportDNSTT {
-		return fmt.Errorf("unsupported transport type: %s", cc.Transport.Type)
+	choice := ctx.GetString("import-choice")
+	if choice == actions.ImportChoiceCancel {
+		ctx.Output.Info("Import cancelled")
+		return nil
 	}
+	overwrite := choice == actions.ImportChoiceOverwrite || ctx.GetBool("overwrite")
 
-	// Map backend type
-	backendType := config.BackendType(cc.Backend.Type)
-	if backendType != config.BackendSOCKS && backendType != config.BackendSSH && backendType != config.BackendShadowsocks {
-		return fmt.Errorf("unsupported backend type: %s", cc.Backend.Type)
+	tag := ctx.GetString("new-tag")
+	if tag == "" && !ctx.IsInteractive {
+		tag = ctx.GetString("tag")
 	}
-
-	// Generate unique tag
-	tag := cc.Tag
 	if tag == "" {
-		tag = config.GenerateUniqueTag(cfg.Tunnels)
-	} else {
-		tag = config.NormalizeTag(tag)
-		if cfg.GetTunnelByTag(tag) != nil {
-			tag = config.GenerateUniqueTag(cfg.Tunnels)
+		tag = actions.ImportTag(cc, cfg.Tunnels)
+	}
+	tag = config.NormalizeTag(tag)
+	if err := config.ValidateTag(tag); err != nil {
+		return fmt.Errorf("invalid tag: %w", err)
+	}
+
+	existing := slices.IndexFunc(cfg.Tunnels, func(t config.TunnelConfig) bool { return t.Tag == tag })
+	if existing >= 0 && !overwrite {
+		return &actions.ActionError{
+			Message: fmt.Sprintf("tunnel '%s' already exists", tag),
+			Hint:    "Use --overwrite to replace it or --tag to import under a different tag",
+			Err:     actions.ErrTunnelExists,
 		}
 	}
 
-	// Auto-assign port
-	localPort, err := port.GetAvailable()
-	if err != nil {
+	// Keep the port of a replaced tunnel so clients pointing at it keep working,
+	// otherwise prefer the port suggested by the URL
+	var localPort int
+	if existing >= 0 {
+		localPort = cfg.Tunnels[existing].Port
+	} else if cc.Port != 0 && port.IsAvailable(cc.Port) && !portTaken(cfg, cc.Port) {
+		localPort = cc.Port
+	} else if localPort, err = port.GetAvailable(); err != nil {
 		return fmt.Errorf("failed to find available port: %w", err)
 	}
 
+	tc, err := TunnelFromClientConfig(cc, tag, localPort, config.ConfigDir())
+	if err != nil {
+		return err
+	}
+	transportType, backendType := tc.Transport, tc.Backend
+
+	if err := storeSecrets(ctx, &tc); err != nil {
+		return err
+	}
+
+	// Validate
+	old := cfg.Clone()
+	if existing >= 0 {
+		cfg.Tunnels[existing] = tc
+	} else {
+		cfg.Tunnels = append(cfg.Tunnels, tc)
+	}
+	if err := MergeDoH(cfg, cc); err != nil {
+		cfg.Tunnels, cfg.DoH = old.Tunnels, old.DoH
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		cfg.Tunnels, cfg.DoH = old.Tunnels, old.DoH
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	if err := config.CheckPolicy(old, cfg); err != nil {
+		cfg.Tunnels, cfg.DoH = old.Tunnels, old.DoH
+		return actions.NewActionError(err.Error(), "The policy is set by your administrator in "+config.PolicyPath())
+	}
+
+	// Set as active if no active tunnel
+	if cfg.Route.Active == "" {
+		cfg.Route.Active = tag
+	}
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	NotifyDaemonReload()
+
+	if existing >= 0 {
+		ctx.Output.Success(fmt.Sprintf("Tunnel '%s' replaced!", tag))
+	} else {
+		ctx.Output.Success(fmt.Sprintf("Tunnel '%s' imported!", tag))
+	}
+	ctx.Output.Status(fmt.Sprintf("Transport: %s", config.GetTransportTypeDisplayName(transportType)))
+	ctx.Output.Status(fmt.Sprintf("Backend: %s", config.GetBackendTypeDisplayName(backendType)))
+	ctx.Output.Status(fmt.Sprintf("Domain: %s", tc.Domain))
+	ctx.Output.Status(fmt.Sprintf("Local port: %d", localPort))
+
+	if cfg.Route.Active == tag {
+		ctx.Output.Info("Set as active tunnel")
+	}
+
+	EnsureTunnelBinaries(ctx, &tc)
+	return nil
+}
+
+// TunnelFromClientConfig builds a tunnel config from a decoded dnstm:// URL.
+// Certificates and SSH keys embedded in the URL are written to dir.
+func TunnelFromClientConfig(cc *clientcfg.ClientConfig, tag string, localPort int, dir string) (config.TunnelConfig, error) {
+	// Map transport type
+	transportType := config.TransportType(cc.Transport.Type)
+	if transportType != config.TransportSlipstream && transportType != config.TransportDNSTT {
+		return config.TunnelConfig{}, fmt.Errorf("unsupported transport type: %s", cc.Transport.Type)
+	}
+
+	// Map backend type
+	backendType := config.BackendType(cc.Backend.Type)
+	if backendType != config.BackendSOCKS && backendType != config.BackendSSH && backendType != config.BackendShadowsocks {
+		return config.TunnelConfig{}, fmt.Errorf("unsupported backend type: %s", cc.Backend.Type)
+	}
+
 	tc := config.TunnelConfig{
 		Tag:       tag,
 		Transport: transportType,
@@ -73,22 +162,30 @@ func HandleTunnelImport(ctx *actions.Context) error {
 		Domain:    cc.Transport.Domain,
 		Port:      localPort,
 	}
-
-	configDir := config.ConfigDir()
+	if len(cc.Resolvers) > 0 {
+		tc.Resolver = cc.Resolvers[0]
+	}
+	if len(cc.Transport.Fallbacks) > 0 || len(cc.Resolvers) > 1 {
+		tc.Fallback = &config.FallbackConfig{Domains: cc.Transport.Fallbacks}
+		if len(cc.Resolvers) > 1 {
+			tc.Fallback.Resolvers = cc.Resolvers[1:]
+		}
+	}
 
 	// Transport-specific config
 	switch transportType {
 	case config.TransportSlipstream:
 		if cc.Transport.Cert != "" {
-			certPath := filepath.Join(configDir, tag+".cert.pem")
+			certPath := filepath.Join(dir, tag+".cert.pem")
 			if err := os.WriteFile(certPath, []byte(cc.Transport.Cert), 0644); err != nil {
-				return fmt.Errorf("failed to save certificate: %w", err)
+				return config.TunnelConfig{}, fmt.Errorf("failed to save certificate: %w", err)
 			}
 			tc.Slipstream = &config.SlipstreamConfig{Cert: certPath}
+			tc.Files = append(tc.Files, certPath)
 		}
 	case config.TransportDNSTT:
 		if cc.Transport.PubKey == "" {
-			return fmt.Errorf("DNSTT transport requires a public key")
+			return config.TunnelConfig{}, fmt.Errorf("DNSTT transport requires a public key")
 		}
 		tc.DNSTT = &config.DNSTTConfig{Pubkey: cc.Transport.PubKey}
 	}
@@ -97,18 +194,23 @@ func HandleTunnelImport(ctx *actions.Context) error {
 	switch backendType {
 	case config.BackendSSH:
 		if cc.Backend.User == "" {
-			return fmt.Errorf("SSH backend requires a user")
+			return config.TunnelConfig{}, fmt.Errorf("SSH backend requires a user")
 		}
 		sshCfg := &config.SSHConfig{
-			User:     cc.Backend.User,
-			Password: cc.Backend.Password,
+			User:       cc.Backend.User,
+			Password:   cc.Backend.Password,
+			Passphrase: cc.Backend.Passphrase,
+		}
+		if cc.Backend.ObfsKey != "" {
+			sshCfg.Obfs = &config.ObfsConfig{Key: cc.Backend.ObfsKey, Pad: cc.Backend.ObfsPad}
 		}
 		if cc.Backend.Key != "" {
-			keyPath := filepath.Join(configDir, tag+".key.pem")
+			keyPath := filepath.Join(dir, tag+".key.pem")
 			if err := os.WriteFile(keyPath, []byte(cc.Backend.Key), 0600); err != nil {
-				return fmt.Errorf("failed to save SSH key: %w", err)
+				return config.TunnelConfig{}, fmt.Errorf("failed to save SSH key: %w", err)
 			}
 			sshCfg.Key = keyPath
+			tc.Files = append(tc.Files, keyPath)
 		}
 		tc.SSH = sshCfg
 	case config.BackendShadowsocks:
@@ -116,40 +218,43 @@ func HandleTunnelImport(ctx *actions.Context) error {
 		if method == "" {
 			method = "aes-256-gcm"
 		}
+		server := cc.Backend.Server
+		if server == "" {
+			server = "127.0.0.1:8388"
+		}
 		tc.Shadowsocks = &config.ShadowsocksConfig{
-			Server:   "127.0.0.1:8388",
+			Server:   server,
 			Password: cc.Backend.Password,
 			Method:   method,
 		}
 	}
 
-	// Validate
-	cfg.Tunnels = append(cfg.Tunnels, tc)
-	if err := cfg.Validate(); err != nil {
-		// Remove the just-added tunnel on validation failure
-		cfg.Tunnels = cfg.Tunnels[:len(cfg.Tunnels)-1]
-		return fmt.Errorf("validation failed: %w", err)
-	}
-
-	// Set as active if no active tunnel
-	if cfg.Route.Active == "" {
-		cfg.Route.Active = tag
-	}
-
-	if err := cfg.Save(); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
-	}
-	NotifyDaemonReload()
-
-	ctx.Output.Success(fmt.Sprintf("Tunnel '%s' imported!", tag))
-	ctx.Output.Status(fmt.Sprintf("Transport: %s", config.GetTransportTypeDisplayName(transportType)))
-	ctx.Output.Status(fmt.Sprintf("Backend: %s", config.GetBackendTypeDisplayName(backendType)))
-	ctx.Output.Status(fmt.Sprintf("Domain: %s", cc.Transport.Domain))
-	ctx.Output.Status(fmt.Sprintf("Local port: %d", localPort))
+	return tc, nil
+}
 
-	if cfg.Route.Active == tag {
-		ctx.Output.Info("Set as active tunnel")
+// MergeDoH adds the DoH upstreams a decoded dnstm:// URL carries to cfg. One
+// that cfg already has under the same name must be identical, since other
+// tunnels may use it.
+func MergeDoH(cfg *config.Config, cc *clientcfg.ClientConfig) error {
+	for _, u := range cc.DoH {
+		d := config.DoHConfig{Name: u.Name, URL: u.URL, SNI: u.SNI, IP: u.IP}
+		if err := d.Validate(); err != nil {
+			return fmt.Errorf("doh upstream '%s': %w", u.Name, err)
+		}
+		existing := cfg.GetDoH(d.Name)
+		if existing == nil {
+			cfg.DoH = append(cfg.DoH, d)
+		} else if *existing != d {
+			return &actions.ActionError{
+				Message: fmt.Sprintf("the URL defines DoH upstream '%s' differently from your config", d.Name),
+				Hint:    "Update yours to match with 'dnstc resolver doh', then import again",
+			}
+		}
 	}
-
 	return nil
 }
+
+// portTaken reports whether a configured tunnel already uses p.
+func portTaken(cfg *config.Config, p int) bool {
+	return slices.ContainsFunc(cfg.Tunnels, func(t config.TunnelConfig) bool { return t.Port == p })
+}
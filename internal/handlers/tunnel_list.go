@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/net2share/dnstc/internal/actions"
@@ -12,6 +13,21 @@ func init() {
 	actions.SetHandler(actions.ActionTunnelList, HandleTunnelList)
 }
 
+// tunnelListEntry is a single tunnel in `tunnel list --json` output.
+type tunnelListEntry struct {
+	Tag       string               `json:"tag"`
+	Transport config.TransportType `json:"transport"`
+	Backend   config.BackendType   `json:"backend"`
+	Domain    string               `json:"domain"`
+	Using     string               `json:"using_domain,omitempty"` // fallback domain in use
+	Port      int                  `json:"port"`
+	Enabled   bool                 `json:"enabled"`
+	Running   bool                 `json:"running"`
+	Active    bool                 `json:"active"`
+	Standby   bool                 `json:"standby,omitempty"`
+	Health    *engine.Health       `json:"health,omitempty"`
+}
+
 // HandleTunnelList lists all configured tunnels.
 func HandleTunnelList(ctx *actions.Context) error {
 	cfg, err := LoadConfig(ctx)
@@ -19,51 +35,87 @@ func HandleTunnelList(ctx *actions.Context) error {
 		return err
 	}
 
-	if len(cfg.Tunnels) == 0 {
-		ctx.Output.Info("No tunnels configured. Use 'dnstc tunnel add' to create one.")
-		return nil
+	// Use engine or daemon for live status if available
+	tunnels := liveTunnelStatus()
+
+	entries := make([]tunnelListEntry, 0, len(cfg.Tunnels))
+	for _, tc := range cfg.Tunnels {
+		entry := tunnelListEntry{
+			Tag:       tc.Tag,
+			Transport: tc.Transport,
+			Backend:   tc.Backend,
+			Domain:    tc.Domain,
+			Port:      tc.Port,
+			Enabled:   tc.IsEnabled(),
+			Active:    tc.Tag == cfg.Route.Active,
+			Standby:   tc.Tag == cfg.Route.Standby,
+		}
+		if ts := tunnels[tc.Tag]; ts != nil {
+			// The daemon's choice, which may be a temporary switch
+			entry.Active = ts.Active
+			entry.Standby = ts.Standby
+		}
+		if ts := tunnels[tc.Tag]; ts != nil && ts.Running {
+			entry.Running = true
+			entry.Health = ts.Health
+			entry.Using = ts.UsingDomain
+		}
+		entries = append(entries, entry)
 	}
 
-	// Use engine for live status if available
-	var tunnelRunning map[string]bool
-	if eng := engine.Get(); eng != nil {
-		status := eng.Status()
-		tunnelRunning = make(map[string]bool)
-		for tag, ts := range status.Tunnels {
-			tunnelRunning[tag] = ts.Running
+	if ctx.GetBool("json") {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode tunnel list: %w", err)
 		}
+		ctx.Output.Println(string(data))
+		return nil
 	}
 
-	headers := []string{"TAG", "TRANSPORT", "BACKEND", "DOMAIN", "PORT", "STATUS"}
+	if len(entries) == 0 {
+		ctx.Output.Info("No tunnels configured. Use 'dnstc tunnel add' to create one.")
+		return nil
+	}
+
+	headers := []string{"TAG", "TRANSPORT/BACKEND", "DOMAIN", "PORT", "ENABLED", "RUNNING", "ACTIVE", "RTT", "LOSS"}
 	var rows [][]string
 
-	for _, tc := range cfg.Tunnels {
-		statusStr := "Stopped"
-		if tunnelRunning != nil && tunnelRunning[tc.Tag] {
-			statusStr = "Running"
+	for _, e := range entries {
+		portStr := "auto"
+		if e.Port > 0 {
+			portStr = fmt.Sprintf("%d", e.Port)
 		}
 
-		portStr := "auto"
-		if tc.Port > 0 {
-			portStr = fmt.Sprintf("%d", tc.Port)
+		domain := e.Domain
+		if e.Using != "" {
+			domain = e.Using + " (fallback)"
 		}
 
-		marker := ""
-		if tc.Tag == cfg.Route.Active {
-			marker = " *"
+		active := yesNo(e.Active)
+		if e.Standby {
+			active = "standby"
 		}
 
 		rows = append(rows, []string{
-			tc.Tag + marker,
-			config.GetTransportTypeDisplayName(tc.Transport),
-			config.GetBackendTypeDisplayName(tc.Backend),
-			tc.Domain,
+			e.Tag,
+			config.GetTransportTypeDisplayName(e.Transport) + "/" + config.GetBackendTypeDisplayName(e.Backend),
+			domain,
 			portStr,
-			statusStr,
+			yesNo(e.Enabled),
+			yesNo(e.Running),
+			active,
+			e.Health.FormatRTT(),
+			e.Health.FormatLoss(),
 		})
 	}
 
 	ctx.Output.Table(headers, rows)
-	ctx.Output.Println("\n* = active tunnel")
 	return nil
 }
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
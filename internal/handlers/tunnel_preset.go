@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionTunnelPreset, HandleTunnelPreset)
+}
+
+// HandleTunnelPreset sets or clears a tunnel's network preset.
+func HandleTunnelPreset(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag, err := RequireTag(ctx)
+	if err != nil {
+		return err
+	}
+	tc := cfg.GetTunnelByTag(tag)
+	if tc == nil {
+		return actions.TunnelNotFoundError(tag)
+	}
+
+	name := ctx.GetString("preset")
+	if name == "none" {
+		name = ""
+	}
+	if _, ok := config.Presets[name]; name != "" && !ok {
+		return actions.NewActionError(fmt.Sprintf("unknown preset %q", name),
+			fmt.Sprintf("Use one of: %s, none", strings.Join(config.PresetNames(), ", ")))
+	}
+	if tc.Preset == name {
+		ctx.Output.Info(fmt.Sprintf("Tunnel '%s' already uses this preset", tag))
+		return nil
+	}
+
+	tc.Preset = name
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	NotifyDaemonReload()
+
+	if name == "" {
+		ctx.Output.Success(fmt.Sprintf("Tunnel '%s' uses the default tuning", tag))
+		return nil
+	}
+	p := tc.Tuning()
+	ctx.Output.Success(fmt.Sprintf("Tunnel '%s' is tuned for %s networks", tag, name))
+	if ms := tc.KeepAliveMs(); ms > 0 {
+		keepAlive := fmt.Sprintf("Keep-alive every %dms", ms)
+		if ms != p.KeepAliveMs {
+			keepAlive += " (from traffic.keepalive_ms)"
+		}
+		ctx.Output.Info(keepAlive)
+	}
+	ctx.Output.Info(fmt.Sprintf("Gateway connects within %s; health probed every %s (%s timeout)",
+		p.DialTimeout, p.HealthInterval, p.HealthTimeout))
+	return nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/engine"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionTunnelTest, HandleTunnelTest)
+}
+
+// HandleTunnelTest runs an end-to-end probe through a running tunnel.
+func HandleTunnelTest(ctx *actions.Context) error {
+	tag, err := RequireTag(ctx)
+	if err != nil {
+		return err
+	}
+
+	tunnels := liveTunnelStatus()
+	if tunnels == nil {
+		return actions.NewCodedError(actions.CodeDaemonUnreachable, "daemon not running", "Start tunnels first: dnstc daemon start")
+	}
+	ts, ok := tunnels[tag]
+	if !ok {
+		return actions.TunnelNotFoundError(tag)
+	}
+	if !ts.Running {
+		return actions.NewActionError(
+			fmt.Sprintf("tunnel '%s' is not running", tag),
+			"Check 'dnstc tunnel status -t "+tag+"' for the last error",
+		)
+	}
+
+	beginProgress(ctx, fmt.Sprintf("Test Tunnel: %s", tag))
+	addr := fmt.Sprintf("127.0.0.1:%d", ts.Port)
+	ctx.Output.Status(fmt.Sprintf("Resolving a name through %s...", addr))
+
+	rtt, err := engine.ProbeTunnel(addr)
+	if err != nil {
+		return failProgress(ctx, fmt.Errorf("probe failed: %w", err))
+	}
+
+	ctx.Output.Success(fmt.Sprintf("Tunnel '%s' is working (%dms)", tag, rtt.Milliseconds()))
+	endProgress(ctx)
+	return nil
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/engine"
 	"github.com/net2share/dnstc/internal/ipc"
+	"github.com/net2share/dnstc/internal/secrets"
 )
 
 func init() {
@@ -25,23 +29,25 @@ func HandleTunnelRemove(ctx *actions.Context) error {
 		return err
 	}
 
-	if cfg.GetTunnelByTag(tag) == nil {
+	removed := cfg.GetTunnelByTag(tag)
+	if removed == nil {
 		return actions.TunnelNotFoundError(tag)
 	}
+	files := removed.OwnedFiles()
 
 	beginProgress(ctx, fmt.Sprintf("Remove Tunnel: %s", tag))
 
-	totalSteps := 3
+	totalSteps := 4
 	currentStep := 0
 
 	// Step 1: Stop if running (via engine or IPC)
 	currentStep++
 	ctx.Output.Step(currentStep, totalSteps, "Stopping tunnel...")
 	if eng := engine.Get(); eng != nil {
-		eng.StopTunnel(tag)
+		eng.StopTunnel(ctx.Ctx, tag)
 	} else if running, client := ipc.DetectDaemon(); running {
-		client.StopTunnel(tag)
-		client.ReloadConfig()
+		client.StopTunnel(ctx.Ctx, tag)
+		client.ReloadConfig(ctx.Ctx)
 		client.Close()
 	}
 	ctx.Output.Status("Tunnel stopped")
@@ -53,6 +59,8 @@ func HandleTunnelRemove(ctx *actions.Context) error {
 	for _, tc := range cfg.Tunnels {
 		if tc.Tag != tag {
 			tunnels = append(tunnels, tc)
+		} else {
+			secrets.Forget(&tc)
 		}
 	}
 	cfg.Tunnels = tunnels
@@ -60,6 +68,18 @@ func HandleTunnelRemove(ctx *actions.Context) error {
 	if cfg.Route.Active == tag {
 		cfg.Route.Active = ""
 	}
+	if cfg.Route.Standby == tag {
+		cfg.Route.Standby = ""
+	}
+
+	// Drop extra listeners pinned to the removed tunnel
+	var extra []config.ExtraListener
+	for _, l := range cfg.Listen.Extra {
+		if l.Via != tag {
+			extra = append(extra, l)
+		}
+	}
+	cfg.Listen.Extra = extra
 
 	// Step 3: Save
 	currentStep++
@@ -69,7 +89,42 @@ func HandleTunnelRemove(ctx *actions.Context) error {
 	}
 	ctx.Output.Status("Configuration saved")
 
+	// Step 4: Delete the certificate and key files written for the tunnel
+	currentStep++
+	ctx.Output.Step(currentStep, totalSteps, "Deleting tunnel files...")
+	if ctx.GetBool("keep-files") {
+		ctx.Output.Status("Kept")
+	} else {
+		deleted := 0
+		for _, f := range files {
+			if tunnelsUseFile(cfg.Tunnels, f) {
+				continue
+			}
+			if err := os.Remove(f); err == nil {
+				ctx.Output.Status(fmt.Sprintf("Deleted %s", f))
+				deleted++
+			} else if !os.IsNotExist(err) {
+				ctx.Output.Warning(fmt.Sprintf("Failed to delete %s: %v", f, err))
+			}
+		}
+		if deleted == 0 {
+			ctx.Output.Status("No files to delete")
+		}
+	}
+
 	ctx.Output.Success(fmt.Sprintf("Tunnel '%s' removed!", tag))
 	endProgress(ctx)
 	return nil
 }
+
+// tunnelsUseFile reports whether any of tunnels refers to path.
+func tunnelsUseFile(tunnels []config.TunnelConfig, path string) bool {
+	for _, tc := range tunnels {
+		if slices.Contains(tc.Files, path) ||
+			(tc.Slipstream != nil && filepath.Clean(tc.Slipstream.Cert) == path) ||
+			(tc.SSH != nil && filepath.Clean(tc.SSH.Key) == path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/clientcfg"
+	"github.com/net2share/dnstc/internal/qr"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionTunnelShare, HandleTunnelShare)
+}
+
+// defaultShareExpiry is how long the share page is served when --expire is not given.
+const defaultShareExpiry = 10 * time.Minute
+
+var sharePage = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>dnstc: {{.Tag}}</title>
+<style>
+body { font-family: sans-serif; max-width: 32em; margin: 2em auto; padding: 0 1em; text-align: center; }
+.qr svg { width: 100%; max-width: 24em; }
+textarea { width: 100%; height: 8em; font-family: monospace; font-size: 0.8em; }
+small { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Tag}}</h1>
+<p>Scan the QR code or copy the URL, then import it with <code>dnstc tunnel import</code>.</p>
+<div class="qr">{{.QR}}</div>
+<textarea readonly onclick="this.select()">{{.URL}}</textarea>
+<p><small>This page can only be opened once and contains the tunnel's credentials. Do not share screenshots of it.</small></p>
+</body>
+</html>
+`))
+
+// HandleTunnelShare serves a one-time page with the tunnel's dnstm:// URL and QR code.
+func HandleTunnelShare(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag, err := RequireTag(ctx)
+	if err != nil {
+		return err
+	}
+
+	tc := cfg.GetTunnelByTag(tag)
+	if tc == nil {
+		return actions.TunnelNotFoundError(tag)
+	}
+
+	cc, err := ClientConfigFromTunnel(cfg, tc)
+	if err != nil {
+		return err
+	}
+	url, err := clientcfg.Encode(cc)
+	if err != nil {
+		return err
+	}
+	code, err := qr.Encode([]byte(url))
+	if err != nil {
+		return actions.WrapError(err, "URL is too long for a QR code", "Use 'dnstc tunnel export' and copy the URL instead")
+	}
+
+	expiry := defaultShareExpiry
+	if m := ctx.GetInt("expire"); m > 0 {
+		expiry = time.Duration(m) * time.Minute
+	}
+
+	host := "0.0.0.0"
+	if ctx.GetBool("local") {
+		host = "127.0.0.1"
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(ctx.GetInt("port"))))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		ln.Close()
+		return err
+	}
+	path := "/" + hex.EncodeToString(token)
+
+	// The link only counts as used once the page was rendered and sent
+	served := make(chan struct{})
+	var mu sync.Mutex
+	used := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if used {
+			http.Error(w, "This link has already been used.", http.StatusGone)
+			return
+		}
+		var page bytes.Buffer
+		if err := sharePage.Execute(&page, struct {
+			Tag string
+			URL string
+			QR  template.HTML
+		}{tag, url, template.HTML(code.SVG())}); err != nil {
+			ctx.Output.Warning(fmt.Sprintf("Failed to render the page: %v", err))
+			http.Error(w, "Failed to render the page.", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+		if _, err := page.WriteTo(w); err != nil {
+			return
+		}
+		used = true
+		close(served)
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	var links []string
+	for _, ip := range shareAddrs(host) {
+		links = append(links, fmt.Sprintf("http://%s%s", net.JoinHostPort(ip, strconv.Itoa(port)), path))
+	}
+	ctx.Output.Box(fmt.Sprintf("Sharing '%s'", tag), links)
+	// A phone can scan this to open the page instead of typing the link
+	if linkCode, err := qr.Encode([]byte(links[0])); err == nil {
+		ctx.Output.Print(linkCode.String())
+	}
+	ctx.Output.Info(fmt.Sprintf("Open one of these links on the other device. The page can be opened once and expires in %s.", expiry))
+	ctx.Output.Warning("Anyone on the network who gets the link can import the tunnel")
+	ctx.Output.Status("Waiting... press Ctrl+C to stop sharing")
+
+	sigCtx, stop := signal.NotifyContext(ctx.Ctx, os.Interrupt)
+	defer stop()
+	timer := time.NewTimer(expiry)
+	defer timer.Stop()
+
+	select {
+	case <-served:
+		ctx.Output.Success("Page opened; sharing stopped")
+	case <-timer.C:
+		ctx.Output.Warning("Share link expired")
+	case <-sigCtx.Done():
+		ctx.Output.Info("Sharing stopped")
+	}
+
+	// Let the page finish sending before closing the server
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// shareAddrs returns the addresses the share page is reachable at: loopback
+// only for 127.0.0.1, otherwise every non-loopback IPv4 interface address.
+func shareAddrs(host string) []string {
+	if host == "127.0.0.1" {
+		return []string{host}
+	}
+	var addrs []string
+	ifaceAddrs, _ := net.InterfaceAddrs()
+	for _, a := range ifaceAddrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.To4() == nil {
+			continue
+		}
+		addrs = append(addrs, ipnet.IP.String())
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, "127.0.0.1")
+	}
+	return addrs
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/actions"
+)
+
+func init() {
+	actions.SetHandler(actions.ActionTunnelStandby, HandleTunnelStandby)
+}
+
+// HandleTunnelStandby sets or clears the standby tunnel of the route.
+func HandleTunnelStandby(ctx *actions.Context) error {
+	cfg, err := LoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ctx.GetBool("clear") {
+		if cfg.Route.Standby == "" {
+			ctx.Output.Info("No standby tunnel is set")
+			return nil
+		}
+		prev := cfg.Route.Standby
+		cfg.Route.Standby = ""
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		NotifyDaemonReload()
+		ctx.Output.Success(fmt.Sprintf("Tunnel '%s' is no longer the standby", prev))
+		return nil
+	}
+
+	tag, err := RequireTag(ctx)
+	if err != nil {
+		return err
+	}
+	tc := cfg.GetTunnelByTag(tag)
+	if tc == nil {
+		return actions.TunnelNotFoundError(tag)
+	}
+	if tag == cfg.Route.Active {
+		return actions.NewActionError(fmt.Sprintf("tunnel '%s' is the active tunnel", tag),
+			"Pick another tunnel as its standby")
+	}
+	if tag == cfg.Route.Standby {
+		ctx.Output.Info(fmt.Sprintf("Tunnel '%s' is already the standby", tag))
+		return nil
+	}
+
+	cfg.Route.Standby = tag
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	NotifyDaemonReload()
+
+	if cfg.Route.Active != "" {
+		ctx.Output.Success(fmt.Sprintf("Tunnel '%s' is now the standby for '%s'", tag, cfg.Route.Active))
+	} else {
+		ctx.Output.Success(fmt.Sprintf("Tunnel '%s' is now the standby", tag))
+	}
+	if !tc.IsEnabled() {
+		ctx.Output.Warning(fmt.Sprintf("Tunnel '%s' is disabled, so it won't be kept running", tag))
+	}
+	return nil
+}
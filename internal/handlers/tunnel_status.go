@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/config"
@@ -29,14 +31,24 @@ func HandleTunnelStatus(ctx *actions.Context) error {
 		return actions.TunnelNotFoundError(tag)
 	}
 
-	// Check live status from engine if running
+	// Check live status from the engine or daemon if running
 	statusStr := "Stopped"
+	var liveRows []actions.InfoRow
 	isActive := tc.Tag == cfg.Route.Active
-	if eng := engine.Get(); eng != nil {
-		status := eng.Status()
-		ts := status.Tunnels[tag]
-		if ts != nil && ts.Running {
+	if tunnels := liveTunnelStatus(); tunnels != nil {
+		ts := tunnels[tag]
+		switch {
+		case ts == nil:
+		case ts.Running && !ts.Ready:
+			statusStr = fmt.Sprintf("Starting (port %d)", ts.Port)
+		case ts.Running:
 			statusStr = fmt.Sprintf("Running (port %d)", ts.Port)
+		case ts.Error != "":
+			statusStr = "Failed"
+		}
+		if ts != nil {
+			liveRows = tunnelLiveRows(ts)
+			liveRows = append(liveRows, historyRows(liveTunnelHistory(tag))...)
 		}
 		isActive = ts != nil && ts.Active
 	}
@@ -71,6 +83,7 @@ func HandleTunnelStatus(ctx *actions.Context) error {
 		infoCfg.Sections[0].Rows = append(infoCfg.Sections[0].Rows,
 			actions.InfoRow{Key: "Resolver", Value: tc.Resolver})
 	}
+	infoCfg.Sections[0].Rows = append(infoCfg.Sections[0].Rows, liveRows...)
 
 	if ctx.IsInteractive {
 		return ctx.Output.ShowInfo(infoCfg)
@@ -89,6 +102,95 @@ func HandleTunnelStatus(ctx *actions.Context) error {
 	if tc.Resolver != "" {
 		lines = append(lines, fmt.Sprintf("Resolver: %s", tc.Resolver))
 	}
+	for _, row := range liveRows {
+		lines = append(lines, fmt.Sprintf("%s: %s", row.Key, row.Value))
+	}
+	lines = append(lines, fmt.Sprintf("Log: %s", config.TunnelLogPath(tag)))
 	ctx.Output.Box("Tunnel Status", lines)
 	return nil
 }
+
+// tunnelLiveRows returns the runtime details of a tunnel: uptime, restarts,
+// last probe, transport metrics and last error.
+func tunnelLiveRows(ts *engine.TunnelStatus) []actions.InfoRow {
+	var rows []actions.InfoRow
+	if ts.Running && !ts.Started.IsZero() {
+		rows = append(rows, actions.InfoRow{Key: "Uptime", Value: time.Since(ts.Started).Round(time.Second).String()})
+	}
+	if ts.Restarts > 0 {
+		rows = append(rows, actions.InfoRow{Key: "Restarts", Value: fmt.Sprintf("%d", ts.Restarts)})
+	}
+	if ts.Quota > 0 {
+		rows = append(rows, actions.InfoRow{Key: "Usage", Value: fmt.Sprintf("%s of %s this month (%d%%)",
+			formatBytes(ts.Usage), formatBytes(ts.Quota), ts.Usage*100/ts.Quota)})
+	} else if ts.Usage > 0 {
+		rows = append(rows, actions.InfoRow{Key: "Usage", Value: formatBytes(ts.Usage) + " this month"})
+	}
+	if ts.Economy {
+		rows = append(rows, actions.InfoRow{Key: "Traffic", Value: "economy (gateway idle)"})
+	}
+	if ts.UsingDomain != "" {
+		rows = append(rows, actions.InfoRow{Key: "Using domain", Value: ts.UsingDomain + " (fallback, primary appears blocked)"})
+	}
+	if ts.UsingResolver != "" {
+		rows = append(rows, actions.InfoRow{Key: "Using resolver", Value: ts.UsingResolver + " (fallback)"})
+	}
+	if h := ts.Health; h != nil && h.Probes > 0 {
+		probe := fmt.Sprintf("RTT %s, loss %s (%s ago)", h.FormatRTT(), h.FormatLoss(), time.Since(h.LastProbe).Round(time.Second))
+		if h.LastError != "" {
+			probe += ", last failure: " + h.LastError
+		}
+		rows = append(rows, actions.InfoRow{Key: "Last probe", Value: probe})
+	}
+	if m := ts.Metrics; m != nil && m.Sessions > 0 {
+		value := fmt.Sprintf("%d session(s), %d stream(s), %d open", m.Sessions, m.Streams, m.OpenStreams)
+		if m.MTU > 0 {
+			value = fmt.Sprintf("MTU %d bytes, %s", m.MTU, value)
+		}
+		rows = append(rows, actions.InfoRow{Key: "DNS tunnel", Value: value})
+	}
+	if ts.ConnErrors > 0 {
+		rows = append(rows, actions.InfoRow{Key: "Failed connections", Value: fmt.Sprintf("%d, last: %s", ts.ConnErrors, ts.LastConnError)})
+	}
+	if ts.Error != "" {
+		rows = append(rows, actions.InfoRow{Key: "Last error", Value: ts.Error})
+	}
+	return rows
+}
+
+// historyWidth is the width of the history graphs in tunnel status.
+const historyWidth = 60
+
+// historyRows returns sparkline graphs of a tunnel's recent throughput and
+// RTT, if anything was recorded.
+func historyRows(h engine.History) []actions.InfoRow {
+	if len(h) == 0 {
+		return nil
+	}
+	span := h[len(h)-1].Time.Sub(h[0].Time).Round(time.Minute) + time.Minute
+	var rows []actions.InfoRow
+	rows = append(rows, actions.InfoRow{Key: "Throughput", Value: fmt.Sprintf("%s peak %s/s (last %s)",
+		h.RateSparkline(historyWidth), formatBytes(int64(h.PeakRate())), formatSpan(span))})
+	if rtt := h.RTTSparkline(historyWidth); strings.TrimSpace(rtt) != "" {
+		lo, hi := time.Duration(0), time.Duration(0)
+		for _, s := range h {
+			if s.RTT > 0 {
+				if lo == 0 || s.RTT < lo {
+					lo = s.RTT
+				}
+				hi = max(hi, s.RTT)
+			}
+		}
+		rows = append(rows, actions.InfoRow{Key: "RTT history", Value: fmt.Sprintf("%s %d-%dms",
+			rtt, lo.Milliseconds(), hi.Milliseconds())})
+	}
+	return rows
+}
+
+// formatSpan formats a duration in whole minutes or hours, e.g. "45m", "3h".
+func formatSpan(d time.Duration) string {
+	if d < time.Hour || d%time.Hour != 0 {
+		return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	}
+	return fmt.Sprintf("%dh", int(d.Hours()))
+}
@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/binaries"
 	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/engine"
 	"github.com/net2share/dnstc/internal/ipc"
+	"github.com/net2share/dnstc/internal/secrets"
 )
 
 const (
@@ -22,10 +28,23 @@ func init() {
 	actions.SetHandler(actions.ActionUninstall, HandleUninstall)
 }
 
-// HandleUninstall performs a full system uninstall.
+// HandleUninstall removes dnstc components: everything, everything but the
+// configuration and keys, or only the downloaded binaries.
 func HandleUninstall(ctx *actions.Context) error {
 	beginProgress(ctx, "Uninstall dnstc")
 
+	scope := uninstallScope(ctx)
+	if err := checkUninstallPaths(scope); err != nil {
+		return failProgress(ctx, actions.NewActionError(err.Error(),
+			"Check HOME, XDG_CONFIG_HOME and XDG_DATA_HOME (APPDATA on Windows); nothing was removed"))
+	}
+	if ctx.GetBool("dry-run") {
+		printUninstallPlan(ctx, scope, "Dry run: the following would be removed")
+		endProgress(ctx)
+		return nil
+	}
+	printUninstallPlan(ctx, scope, "The following will be removed")
+
 	totalSteps := 5
 	currentStep := 0
 
@@ -33,12 +52,12 @@ func HandleUninstall(ctx *actions.Context) error {
 	currentStep++
 	ctx.Output.Step(currentStep, totalSteps, "Stopping daemon...")
 	if running, client := ipc.DetectDaemon(); running {
-		client.Stop()
-		client.Shutdown()
+		client.Stop(ctx.Ctx)
+		client.Shutdown(ctx.Ctx)
 		client.Close()
 		ctx.Output.Status("Daemon stopped")
 	} else if eng := engine.Get(); eng != nil {
-		eng.Stop()
+		eng.Stop(ctx.Ctx)
 		ctx.Output.Status("Engine stopped")
 	} else {
 		ctx.Output.Status("No daemon running")
@@ -47,27 +66,37 @@ func HandleUninstall(ctx *actions.Context) error {
 	// Step 2: Remove systemd unit if installed
 	currentStep++
 	ctx.Output.Step(currentStep, totalSteps, "Removing systemd service...")
-	if runtime.GOOS == "linux" {
-		if _, err := os.Stat(uninstallUnitPath); err == nil {
-			exec.Command("systemctl", "stop", uninstallServiceName).Run()
-			exec.Command("systemctl", "disable", uninstallServiceName).Run()
-			os.Remove(uninstallUnitPath)
-			exec.Command("systemctl", "daemon-reload").Run()
-			ctx.Output.Status("Systemd service removed")
-		} else {
-			ctx.Output.Status("No systemd service installed")
-		}
-	} else {
+	switch {
+	case scope == actions.UninstallBinaries:
+		ctx.Output.Status("Kept")
+	case runtime.GOOS != "linux":
 		ctx.Output.Status("Skipped (not Linux)")
+	case fileExists(uninstallUnitPath):
+		exec.Command("systemctl", "stop", uninstallServiceName).Run()
+		exec.Command("systemctl", "disable", uninstallServiceName).Run()
+		os.Remove(uninstallUnitPath)
+		exec.Command("systemctl", "daemon-reload").Run()
+		ctx.Output.Status("Systemd service removed")
+	default:
+		ctx.Output.Status("No systemd service installed")
 	}
 
 	// Step 3: Remove downloaded binaries
 	currentStep++
 	ctx.Output.Step(currentStep, totalSteps, "Removing downloaded binaries...")
-	binMgr := binaries.NewManager()
-	defs := binaries.Defs()
 	for _, name := range binaries.AllNames() {
-		binMgr.Remove(defs[name])
+		removed, err := binaries.RemoveBinary(name)
+		for _, path := range removed {
+			if filepath.Dir(path) == binaries.SystemBinDir {
+				ctx.Output.Status(fmt.Sprintf("Removed %s", path))
+			}
+		}
+		if err != nil {
+			ctx.Output.Warning(fmt.Sprintf("Failed to remove %s: %v", name, err))
+			if errors.Is(err, fs.ErrPermission) {
+				ctx.Output.Info("It was installed with --system; run 'sudo dnstc uninstall' to remove it")
+			}
+		}
 	}
 	os.Remove(config.BinDir())
 	ctx.Output.Status("Binaries removed")
@@ -75,18 +104,199 @@ func HandleUninstall(ctx *actions.Context) error {
 	// Step 4: Remove configuration directory
 	currentStep++
 	ctx.Output.Step(currentStep, totalSteps, "Removing configuration...")
-	os.RemoveAll(config.ConfigDir())
-	ctx.Output.Status("Configuration removed")
+	switch scope {
+	case actions.UninstallBinaries:
+		// The binaries are no longer installed as far as the version manifest goes
+		os.Remove(config.VersionsPath())
+		os.Remove(config.ChecksumsPath())
+		ctx.Output.Status("Kept")
+	case actions.UninstallKeepConfig:
+		for _, path := range configFilesToRemove() {
+			removeUninstallPath(path)
+		}
+		ctx.Output.Status(fmt.Sprintf("Removed state and logs, kept configuration and keys in %s", config.ConfigDir()))
+	default:
+		if cfg, err := config.Load(); err == nil {
+			for i := range cfg.Tunnels {
+				secrets.Forget(&cfg.Tunnels[i])
+			}
+		}
+		removeUninstallPath(config.ConfigDir())
+		ctx.Output.Status("Configuration removed")
+	}
 
 	// Step 5: Remove data directory
 	currentStep++
 	ctx.Output.Step(currentStep, totalSteps, "Removing data files...")
-	os.RemoveAll(filepath.Dir(config.BinDir()))
-	ctx.Output.Status("Data files removed")
+	if dataDir := uninstallDataDir(scope); dataDir != "" {
+		removeUninstallPath(dataDir)
+		ctx.Output.Status("Data files removed")
+	} else {
+		ctx.Output.Status("Kept")
+	}
 
 	ctx.Output.Success("Uninstallation complete!")
-	ctx.Output.Info("The dnstc binary is still available for reinstallation.")
+	switch scope {
+	case actions.UninstallAll:
+		ctx.Output.Info("The dnstc binary is still available for reinstallation.")
+	default:
+		ctx.Output.Info("Run 'dnstc install' to download the binaries again.")
+	}
 
 	endProgress(ctx)
 	return nil
 }
+
+// uninstallScope returns the chosen scope: the TUI's select, or the CLI flags.
+func uninstallScope(ctx *actions.Context) string {
+	if scope := ctx.GetString("scope"); scope != "" {
+		return scope
+	}
+	switch {
+	case ctx.GetBool("binaries-only"):
+		return actions.UninstallBinaries
+	case ctx.GetBool("keep-config"):
+		return actions.UninstallKeepConfig
+	}
+	return actions.UninstallAll
+}
+
+// configFilesToRemove returns the entries of the config directory that are
+// not configuration or key material, i.e. what --keep-config removes.
+func configFilesToRemove() []string {
+	entries, err := os.ReadDir(config.ConfigDir())
+	if err != nil {
+		return nil
+	}
+	keep := map[string]bool{
+		filepath.Base(config.Path()):          true,
+		filepath.Base(config.OldConfigPath()): true,
+	}
+	var paths []string
+	for _, e := range entries {
+		if keep[e.Name()] || strings.HasSuffix(e.Name(), ".pem") {
+			continue
+		}
+		path := filepath.Join(config.ConfigDir(), e.Name())
+		// On macOS and Windows the bin directory is inside the config directory
+		if path == filepath.Clean(config.BinDir()) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// uninstallDataDir returns the data directory to remove, or "" when the
+// scope keeps it or it is the config directory itself.
+func uninstallDataDir(scope string) string {
+	dataDir := filepath.Dir(config.BinDir())
+	if scope == actions.UninstallBinaries {
+		return ""
+	}
+	if scope == actions.UninstallKeepConfig && dataDir == filepath.Clean(config.ConfigDir()) {
+		return ""
+	}
+	return dataDir
+}
+
+// checkUninstallPath refuses paths that are not clearly dnstc's own: they must
+// be absolute and lie within a directory named after the app. A missing HOME
+// or a misconfigured XDG_DATA_HOME would otherwise point the recursive removal
+// at the working directory or at the user's data root.
+func checkUninstallPath(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("refusing to remove %q: not an absolute path", path)
+	}
+	if !slices.Contains(strings.Split(filepath.Clean(path), string(filepath.Separator)), config.AppName) {
+		return fmt.Errorf("refusing to remove %s: not inside a %s directory", path, config.AppName)
+	}
+	return nil
+}
+
+// checkUninstallPaths checks every directory an uninstall with the given
+// scope removes, before anything is removed.
+func checkUninstallPaths(scope string) error {
+	paths := []string{config.ConfigDir(), config.BinDir()}
+	if dataDir := uninstallDataDir(scope); dataDir != "" {
+		paths = append(paths, dataDir)
+	}
+	for _, path := range paths {
+		if err := checkUninstallPath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUninstallPath removes path recursively after checking it again.
+func removeUninstallPath(path string) {
+	if checkUninstallPath(path) != nil {
+		return
+	}
+	os.RemoveAll(path)
+}
+
+// printUninstallPlan lists what an uninstall with the given scope removes.
+func printUninstallPlan(ctx *actions.Context, scope, title string) {
+	var targets []string
+	if scope != actions.UninstallBinaries && runtime.GOOS == "linux" && fileExists(uninstallUnitPath) {
+		targets = append(targets, uninstallUnitPath+" (systemd service)")
+	}
+	for _, name := range binaries.AllNames() {
+		targets = append(targets, binaries.RemovablePaths(name)...)
+	}
+	switch scope {
+	case actions.UninstallBinaries:
+		for _, path := range []string{config.VersionsPath(), config.ChecksumsPath()} {
+			if fileExists(path) {
+				targets = append(targets, path)
+			}
+		}
+	case actions.UninstallKeepConfig:
+		targets = append(targets, configFilesToRemove()...)
+	default:
+		if cfg, err := config.Load(); err == nil {
+			n := 0
+			for i := range cfg.Tunnels {
+				for _, f := range secrets.Fields(&cfg.Tunnels[i]) {
+					if config.IsKeyringRef(*f.Value) {
+						n++
+					}
+				}
+			}
+			if n > 0 {
+				targets = append(targets, fmt.Sprintf("%d keyring secret(s)", n))
+			}
+		}
+		if fileExists(config.ConfigDir()) {
+			targets = append(targets, config.ConfigDir()+string(filepath.Separator))
+		}
+	}
+	if dataDir := uninstallDataDir(scope); dataDir != "" && fileExists(dataDir) &&
+		!slices.Contains(targets, dataDir+string(filepath.Separator)) {
+		targets = append(targets, dataDir+string(filepath.Separator))
+	}
+
+	if len(targets) == 0 {
+		ctx.Output.Info("Nothing to remove")
+		return
+	}
+	ctx.Output.Info(title)
+	for _, t := range targets {
+		ctx.Output.Status(t)
+	}
+	if !ctx.GetBool("dry-run") {
+		return
+	}
+	if running, client := ipc.DetectDaemon(); running {
+		client.Close()
+		ctx.Output.Info("The running daemon would be stopped first")
+	}
+}
+
+// fileExists reports whether path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCheckUninstallPath(t *testing.T) {
+	root := "/"
+	if runtime.GOOS == "windows" {
+		root = `C:\`
+	}
+	abs := func(elem ...string) string {
+		return filepath.Join(append([]string{root}, elem...)...)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"config dir", abs("home", "user", ".config", "dnstc"), false},
+		{"bin dir", abs("home", "user", ".local", "share", "dnstc", "bin"), false},
+		{"data dir", abs("var", "lib", "dnstc"), false},
+		{"empty", "", true},
+		{"relative", filepath.Join("dnstc", "bin"), true},
+		{"root", root, true},
+		{"home", abs("home", "user"), true},
+		{"name as a prefix", abs("home", "user", "dnstc-backup"), true},
+		{"name as a suffix", abs("opt", "my-dnstc"), true},
+		{"parent of app dir", abs("home", "user", ".config", "dnstc") + string(filepath.Separator) + "..", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUninstallPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkUninstallPath(%q) = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
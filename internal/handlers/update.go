@@ -1,75 +1,91 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"strings"
+	"time"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/binaries"
 	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/ipc"
 	"github.com/net2share/go-corelib/binman"
 )
 
 // AppVersion is set by cmd at startup for use by the update handler.
 var AppVersion = "dev"
 
+// maxNoteLines caps how much of each changelog is printed; the full notes
+// are linked below it.
+const maxNoteLines = 20
+
 func init() {
 	actions.SetHandler(actions.ActionUpdate, HandleUpdate)
 }
 
-// HandleUpdate checks for and applies updates.
+// pendingUpdate is an update found by HandleUpdate that has not been applied yet.
+type pendingUpdate struct {
+	name    string
+	current string
+	latest  string
+	repo    string
+	def     *binman.BinaryDef // nil for dnstc itself
+}
+
+// HandleUpdate checks for updates, shows their release notes and applies
+// them. Nothing is installed without --yes; the number of available updates
+// is left in the "updates-available" value for the interactive menu to
+// confirm against.
 func HandleUpdate(ctx *actions.Context) error {
 	beginProgress(ctx, "Check Updates")
 
 	checkOnly := ctx.GetBool("check")
 	selfOnly := ctx.GetBool("self")
 	binariesOnly := ctx.GetBool("binaries")
+	yes := ctx.GetBool("yes")
 
 	currentVersion := AppVersion
-	hasUpdates := false
+	var pending []pendingUpdate
 
 	// Self-update check
 	if !binariesOnly {
 		ctx.Output.Status("Checking for dnstc updates...")
 
-		latestVersion, available, err := binman.CheckSelfUpdate("net2share/dnstc", currentVersion)
+		latestVersion, available, err := binman.CheckSelfUpdate(binaries.SelfRepo, currentVersion)
+		if err == nil {
+			// Keeps the menu's update banner in step with this check
+			binaries.UpdateCheck{CheckedAt: time.Now(), Latest: latestVersion}.Save()
+		}
 		if err != nil {
 			ctx.Output.Warning(fmt.Sprintf("Failed to check dnstc version: %v", err))
 		} else if available {
-			hasUpdates = true
 			ctx.Output.Info(fmt.Sprintf("dnstc update available: %s → %s", currentVersion, latestVersion))
-
-			if !checkOnly {
-				err := binman.SelfUpdate(binman.SelfUpdateConfig{
-					Repo:       "net2share/dnstc",
-					URLPattern: "https://github.com/net2share/dnstc/releases/download/{version}/dnstc-{os}-{arch}",
-					StatusFn: func(msg string) {
-						ctx.Output.Status(msg)
-					},
-				}, latestVersion)
-				if err != nil {
-					ctx.Output.Error(fmt.Sprintf("Self-update failed: %v", err))
-				} else {
-					ctx.Output.Success(fmt.Sprintf("dnstc updated to %s", latestVersion))
-				}
-			}
+			pending = append(pending, pendingUpdate{
+				name:    "dnstc",
+				current: currentVersion,
+				latest:  latestVersion,
+				repo:    binaries.SelfRepo,
+			})
 		} else {
 			ctx.Output.Status(fmt.Sprintf("dnstc is up to date (%s)", currentVersion))
 		}
 	}
 
-	// Binary updates
+	// Binary update check
+	var manifest *binman.VersionManifest
 	if !selfOnly {
 		ctx.Output.Status("Checking binary updates...")
 
-		manifest, err := binman.LoadManifest(config.VersionsPath())
+		var err error
+		manifest, err = binman.LoadManifest(config.VersionsPath())
 		if err != nil {
 			ctx.Output.Warning(fmt.Sprintf("Failed to load version manifest: %v", err))
 			manifest = binman.NewManifest()
 		}
 
-		mgr := binaries.NewManager()
 		defs := binaries.Defs()
-
 		for _, name := range binaries.AllNames() {
 			def := defs[name]
 			if def.SkipUpdate {
@@ -80,36 +96,144 @@ func HandleUpdate(ctx *actions.Context) error {
 			pinnedVer := def.PinnedVersion
 
 			if binman.IsNewer(currentVer, pinnedVer) {
-				hasUpdates = true
 				ctx.Output.Info(fmt.Sprintf("%s: %s → %s", name, currentVer, pinnedVer))
-
-				if !checkOnly {
-					ctx.Output.Status(fmt.Sprintf("Updating %s...", name))
-					if err := mgr.Download(def, pinnedVer, nil); err != nil {
-						ctx.Output.Error(fmt.Sprintf("Failed to update %s: %v", name, err))
-						continue
-					}
-					manifest.SetVersion(name, pinnedVer)
-					ctx.Output.Success(fmt.Sprintf("%s updated to %s", name, pinnedVer))
-				}
+				pending = append(pending, pendingUpdate{
+					name:    name,
+					current: currentVer,
+					latest:  pinnedVer,
+					repo:    binaries.Repo(def),
+					def:     &def,
+				})
 			} else {
 				ctx.Output.Status(fmt.Sprintf("%s is up to date (%s)", name, currentVer))
 			}
 		}
+	}
+
+	ctx.Values["updates-available"] = len(pending)
+	if len(pending) == 0 {
+		ctx.Output.Success("Everything is up to date")
+		endProgress(ctx)
+		return nil
+	}
+
+	// The interactive menu confirms after showing the notes in a check run,
+	// so they are not repeated when it applies the updates.
+	if !ctx.IsInteractive || !yes {
+		for _, u := range pending {
+			showReleaseNotes(ctx, u)
+		}
+	}
+
+	if checkOnly {
+		if !ctx.IsInteractive {
+			ctx.Output.Info("Run 'dnstc update --yes' to apply updates")
+		}
+		endProgress(ctx)
+		return nil
+	}
+	if !yes {
+		return failProgress(ctx, actions.NewActionError(
+			"updates were not applied",
+			"Review the release notes above, then run 'dnstc update --yes' to install them",
+		))
+	}
+
+	// Apply
+	var checksums *binaries.ChecksumManifest
+	if manifest != nil {
+		var err error
+		checksums, err = binaries.LoadChecksums()
+		if err != nil {
+			checksums = &binaries.ChecksumManifest{Checksums: make(map[string]string)}
+		}
+	}
+
+	for _, u := range pending {
+		if u.def == nil {
+			applySelfUpdate(ctx, u.latest)
+			continue
+		}
+
+		// Replace the copy in use, which 'install --system' may have put in a shared directory
+		mgr := binaries.ManagerFor(*u.def)
+		system := mgr.BinDir() == binaries.SystemBinDir
 
-		if !checkOnly {
-			if err := manifest.Save(config.VersionsPath()); err != nil {
-				ctx.Output.Warning(fmt.Sprintf("Failed to save version manifest: %v", err))
+		ctx.Output.Status(fmt.Sprintf("Updating %s...", u.name))
+		if err := mgr.Download(*u.def, u.latest, nil); err != nil {
+			ctx.Output.Error(fmt.Sprintf("Failed to update %s: %v", u.name, err))
+			if system && errors.Is(err, fs.ErrPermission) {
+				ctx.Output.Info("It was installed with --system; run 'sudo dnstc update' instead")
 			}
+			continue
+		}
+		manifest.SetVersion(u.name, u.latest)
+		if path, err := mgr.ResolvePath(*u.def); err == nil {
+			checksums.Record(u.name, path)
 		}
+		if system {
+			if err := binaries.RecordSystemInstall(u.name); err != nil {
+				ctx.Output.Warning(fmt.Sprintf("Failed to record %s as installed by dnstc: %v", u.name, err))
+			}
+		}
+		ctx.Output.Success(fmt.Sprintf("%s updated to %s", u.name, u.latest))
 	}
 
-	if !hasUpdates {
-		ctx.Output.Success("Everything is up to date")
-	} else if checkOnly {
-		ctx.Output.Info("Run 'dnstc update' to apply updates")
+	if manifest != nil {
+		if err := manifest.Save(config.VersionsPath()); err != nil {
+			ctx.Output.Warning(fmt.Sprintf("Failed to save version manifest: %v", err))
+		}
+		if err := checksums.Save(); err != nil {
+			ctx.Output.Warning(fmt.Sprintf("Failed to save checksums: %v", err))
+		}
 	}
 
 	endProgress(ctx)
 	return nil
 }
+
+// applySelfUpdate replaces the dnstc binary with the given release.
+func applySelfUpdate(ctx *actions.Context, version string) {
+	err := binman.SelfUpdate(binman.SelfUpdateConfig{
+		Repo:       binaries.SelfRepo,
+		URLPattern: "https://github.com/net2share/dnstc/releases/download/{version}/dnstc-{os}-{arch}",
+		StatusFn: func(msg string) {
+			ctx.Output.Status(msg)
+		},
+	}, version)
+	if err != nil {
+		ctx.Output.Error(fmt.Sprintf("Self-update failed: %v", err))
+		return
+	}
+	ctx.Output.Success(fmt.Sprintf("dnstc updated to %s", version))
+	if running, client := ipc.DetectDaemon(); running {
+		client.Close()
+		ctx.Output.Info("Run 'dnstc daemon upgrade' to switch the running daemon to the new version without dropping connections")
+	}
+}
+
+// showReleaseNotes prints the changelog of an update, shortened to
+// maxNoteLines, with a link to the full release page.
+func showReleaseNotes(ctx *actions.Context, u pendingUpdate) {
+	title := fmt.Sprintf("%s %s", u.name, u.latest)
+	if u.repo == "" {
+		ctx.Output.Box(title, []string{"No release notes published"})
+		return
+	}
+
+	var lines []string
+	notes, err := binaries.ReleaseNotes(u.repo, u.latest)
+	switch {
+	case err != nil:
+		lines = append(lines, "Release notes could not be fetched")
+	case notes == "":
+		lines = append(lines, "No release notes published")
+	default:
+		lines = strings.Split(strings.ReplaceAll(notes, "\r\n", "\n"), "\n")
+		if len(lines) > maxNoteLines {
+			lines = append(lines[:maxNoteLines], fmt.Sprintf("... (%d more lines)", len(lines)-maxNoteLines))
+		}
+	}
+	lines = append(lines, "", binaries.ReleaseURL(u.repo, u.latest))
+	ctx.Output.Box(title, lines)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/ipc"
+)
+
+// widgetTimeout bounds the status query, so that a busy or hung daemon
+// doesn't stall the status bar.
+const widgetTimeout = 300 * time.Millisecond
+
+func init() {
+	actions.SetHandler(actions.ActionWidget, HandleWidget)
+}
+
+// widget is the output of `dnstc widget`, in waybar's custom module format.
+type widget struct {
+	Text    string `json:"text"`
+	Tooltip string `json:"tooltip"`
+	Class   string `json:"class"`
+}
+
+// HandleWidget prints a one-line status of the active (or given) tunnel.
+func HandleWidget(ctx *actions.Context) error {
+	w := buildWidget(widgetStatus(), ctx.GetArg(0))
+	if ctx.GetBool("json") {
+		data, err := json.Marshal(w)
+		if err != nil {
+			return fmt.Errorf("failed to encode widget: %w", err)
+		}
+		ctx.Output.Println(string(data))
+		return nil
+	}
+	ctx.Output.Println(w.Text)
+	return nil
+}
+
+// widgetStatus returns the daemon status from the status file if one is
+// configured, or from the daemon itself. It returns nil if neither is
+// available in time.
+func widgetStatus() *engine.Status {
+	if eng := engine.Get(); eng != nil {
+		return eng.Status(context.Background())
+	}
+	if cfg, err := config.Load(); err == nil && cfg.StatusFile != "" {
+		if data, err := os.ReadFile(cfg.StatusFile); err == nil {
+			var s engine.Status
+			if json.Unmarshal(data, &s) == nil {
+				return &s
+			}
+		}
+	}
+
+	client, err := ipc.Dial(config.SocketPath())
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+	qctx, cancel := context.WithTimeout(context.Background(), widgetTimeout)
+	defer cancel()
+	s, err := client.FetchStatus(qctx)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// buildWidget summarizes the status of tunnel tag, or of the active tunnel.
+func buildWidget(s *engine.Status, tag string) widget {
+	if s == nil {
+		return widget{Text: "○ off", Tooltip: "dnstc daemon not running", Class: "stopped"}
+	}
+	if tag == "" {
+		tag = s.Active
+	}
+	ts := s.Tunnels[tag]
+	switch {
+	case tag == "":
+		return widget{Text: "○ no tunnel", Tooltip: "No active tunnel", Class: "disconnected"}
+	case ts == nil:
+		return widget{Text: "○ " + tag + "?", Tooltip: fmt.Sprintf("Tunnel '%s' not found", tag), Class: "disconnected"}
+	case !ts.Running:
+		tooltip := fmt.Sprintf("Tunnel '%s' is not running", tag)
+		if ts.Error != "" {
+			tooltip += ": " + ts.Error
+		}
+		return widget{Text: "○ " + tag + " down", Tooltip: tooltip, Class: "disconnected"}
+	}
+
+	icon, class := "●", "connected"
+	if !ts.Ready || (ts.Health != nil && ts.Health.LastError != "") || ts.UsingDomain != "" || ts.UsingResolver != "" {
+		icon, class = "◐", "degraded"
+	}
+	parts := []string{icon, tag}
+	if rtt := ts.Health.FormatRTT(); rtt != "-" {
+		parts = append(parts, rtt)
+	}
+	parts = append(parts, "↑"+formatRate(ts.RateUp), "↓"+formatRate(ts.RateDown))
+
+	domain := ts.Domain
+	if ts.UsingDomain != "" {
+		domain = ts.UsingDomain
+	}
+	tooltip := []string{fmt.Sprintf("%s (%s)", tag, domain)}
+	if s.GatewayAddr != "" {
+		tooltip = append(tooltip, "Gateway: "+s.GatewayAddr)
+	}
+	if ts.Health != nil && ts.Health.Probes > 0 {
+		tooltip = append(tooltip, fmt.Sprintf("RTT %s, loss %s", ts.Health.FormatRTT(), ts.Health.FormatLoss()))
+	}
+	tooltip = append(tooltip, fmt.Sprintf("Up %s/s, down %s/s", formatBytes(ts.RateUp), formatBytes(ts.RateDown)))
+	if notice := ts.FallbackNotice(); notice != "" {
+		tooltip = append(tooltip, notice)
+	}
+	return widget{Text: strings.Join(parts, " "), Tooltip: strings.Join(tooltip, "\n"), Class: class}
+}
+
+// formatRate formats a rate in bytes per second compactly, e.g. "1.5M/s".
+func formatRate(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB/s", n)
+	}
+	v, exp := float64(n)/unit, 0
+	for v >= unit && exp < 4 {
+		v /= unit
+		exp++
+	}
+	if v < 10 {
+		return fmt.Sprintf("%.1f%c/s", v, "KMGT"[exp])
+	}
+	return fmt.Sprintf("%.0f%c/s", v, "KMGT"[exp])
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package handover
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Exec replaces the current process with binary running "daemon run",
+// passing the given files. It only returns on failure.
+func Exec(binary string, files *Files) error {
+	all := []*os.File{files.Gateway, files.IPC}
+	for _, pair := range files.Relays {
+		all = append(all, pair[0], pair[1])
+	}
+	for _, f := range all {
+		if f == nil {
+			continue
+		}
+		if err := clearCloseOnExec(f.Fd()); err != nil {
+			return fmt.Errorf("failed to prepare descriptor %d: %w", f.Fd(), err)
+		}
+	}
+
+	data, err := json.Marshal(files.State())
+	if err != nil {
+		return err
+	}
+	env := append(os.Environ(), EnvVar+"="+string(data))
+
+	return syscall.Exec(binary, []string{binary, "daemon", "run"}, env)
+}
+
+func clearCloseOnExec(fd uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
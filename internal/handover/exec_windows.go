@@ -0,0 +1,8 @@
+package handover
+
+import "errors"
+
+// Exec is not supported on Windows, which has no exec(2).
+func Exec(binary string, files *Files) error {
+	return errors.New("daemon upgrade is not supported on Windows")
+}
@@ -0,0 +1,146 @@
+// Package handover passes daemon listeners and in-flight connections to a
+// freshly exec'd daemon binary, so an upgrade doesn't drop connections.
+//
+// The old daemon clears close-on-exec on the file descriptors it wants to
+// keep, records their numbers in an environment variable and replaces its
+// own process image. Because the PID is unchanged, tunnel child processes
+// and the systemd service stay attached to the new daemon.
+package handover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
+
+// EnvVar carries the handover state to the new daemon.
+const EnvVar = "DNSTC_HANDOVER"
+
+// State describes the file descriptors inherited by the new daemon.
+type State struct {
+	Gateway int      `json:"gateway,omitempty"`
+	IPC     int      `json:"ipc,omitempty"`
+	Relays  [][2]int `json:"relays,omitempty"` // client, tunnel
+}
+
+// Files collects the open files whose descriptors are recorded in a State.
+// The files must stay referenced until Exec, or the GC may close them.
+type Files struct {
+	Gateway *os.File
+	IPC     *os.File
+	Relays  [][2]*os.File
+}
+
+// State returns the descriptor numbers of the collected files.
+func (f *Files) State() *State {
+	st := &State{}
+	if f.Gateway != nil {
+		st.Gateway = int(f.Gateway.Fd())
+	}
+	if f.IPC != nil {
+		st.IPC = int(f.IPC.Fd())
+	}
+	for _, pair := range f.Relays {
+		st.Relays = append(st.Relays, [2]int{int(pair[0].Fd()), int(pair[1].Fd())})
+	}
+	return st
+}
+
+// Close closes all collected files. Used when a handover is aborted.
+func (f *Files) Close() {
+	if f.Gateway != nil {
+		f.Gateway.Close()
+	}
+	if f.IPC != nil {
+		f.IPC.Close()
+	}
+	for _, pair := range f.Relays {
+		pair[0].Close()
+		pair[1].Close()
+	}
+}
+
+// RestoreGateway turns the collected gateway files back into a listener and
+// relay connections, for resuming in this process after a failed Exec.
+// The IPC file is closed; the IPC listener it was duplicated from is still open.
+func (f *Files) RestoreGateway() (net.Listener, [][2]net.Conn, error) {
+	defer f.Close()
+
+	if f.Gateway == nil {
+		return nil, nil, nil
+	}
+	ln, err := net.FileListener(f.Gateway)
+	if err != nil {
+		return nil, nil, err
+	}
+	var conns [][2]net.Conn
+	for _, pair := range f.Relays {
+		src, err := net.FileConn(pair[0])
+		if err != nil {
+			continue
+		}
+		dst, err := net.FileConn(pair[1])
+		if err != nil {
+			src.Close()
+			continue
+		}
+		conns = append(conns, [2]net.Conn{src, dst})
+	}
+	return ln, conns, nil
+}
+
+// FromEnv returns the inherited handover state, if any, and clears the
+// environment variable so it doesn't leak into child processes.
+func FromEnv() (*State, bool) {
+	raw := os.Getenv(EnvVar)
+	if raw == "" {
+		return nil, false
+	}
+	os.Unsetenv(EnvVar)
+
+	var st State
+	if err := json.Unmarshal([]byte(raw), &st); err != nil {
+		return nil, false
+	}
+	return &st, true
+}
+
+// Listener reconstructs an inherited listener from its descriptor.
+func Listener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid inherited descriptor %d for %s", fd, name)
+	}
+	defer f.Close() // FileListener dups the descriptor
+	return net.FileListener(f)
+}
+
+// Conn reconstructs an inherited connection from its descriptor.
+func Conn(fd int) (net.Conn, error) {
+	f := os.NewFile(uintptr(fd), "relay")
+	if f == nil {
+		return nil, fmt.Errorf("invalid inherited descriptor %d", fd)
+	}
+	defer f.Close() // FileConn dups the descriptor
+	return net.FileConn(f)
+}
+
+// RelayConns reconstructs inherited relay connection pairs, skipping any that
+// can't be restored.
+func (st *State) RelayConns() [][2]net.Conn {
+	var out [][2]net.Conn
+	for _, pair := range st.Relays {
+		src, err := Conn(pair[0])
+		if err != nil {
+			continue
+		}
+		dst, err := Conn(pair[1])
+		if err != nil {
+			src.Close()
+			continue
+		}
+		out = append(out, [2]net.Conn{src, dst})
+	}
+	return out
+}
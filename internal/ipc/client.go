@@ -2,25 +2,32 @@ package ipc
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"os"
-	"sync"
 	"time"
 
 	"github.com/net2share/dnstc/internal/config"
 	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/process"
 )
 
 // compile-time check
 var _ engine.EngineController = (*Client)(nil)
 
 // Client connects to the daemon over a Unix socket and implements EngineController.
+//
+// Calls without a deadline get the method's default from Timeout. A call
+// whose context ends before the reply arrives closes the connection, since a
+// late reply would otherwise be read as the answer to the next call.
 type Client struct {
 	conn    net.Conn
 	scanner *bufio.Scanner
-	mu      sync.Mutex
+	sem     chan struct{} // serializes calls; a channel so waiting for a turn honors ctx
 }
 
 // Dial connects to the daemon socket.
@@ -33,7 +40,7 @@ func Dial(socketPath string) (*Client, error) {
 	scanner := bufio.NewScanner(conn)
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 
-	return &Client{conn: conn, scanner: scanner}, nil
+	return &Client{conn: conn, scanner: scanner, sem: make(chan struct{}, 1)}, nil
 }
 
 // Close closes the connection.
@@ -42,8 +49,8 @@ func (c *Client) Close() error {
 }
 
 // Ping verifies the daemon is alive.
-func (c *Client) Ping() (*PingResult, error) {
-	resp, err := c.call(MethodPing, nil)
+func (c *Client) Ping(ctx context.Context) (*PingResult, error) {
+	resp, err := c.call(ctx, MethodPing, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -55,58 +62,80 @@ func (c *Client) Ping() (*PingResult, error) {
 }
 
 // Shutdown asks the daemon to exit.
-func (c *Client) Shutdown() error {
-	_, err := c.call(MethodShutdown, nil)
+func (c *Client) Shutdown(ctx context.Context) error {
+	_, err := c.call(ctx, MethodShutdown, nil)
 	return err
 }
 
-func (c *Client) Start() error {
-	_, err := c.call(MethodStart, nil)
+// Upgrade asks the daemon to re-exec itself from binary, handing over its
+// listeners, in-flight connections and tunnel processes.
+func (c *Client) Upgrade(ctx context.Context, binary string) error {
+	_, err := c.call(ctx, MethodUpgrade, UpgradeParam{Binary: binary})
 	return err
 }
 
-func (c *Client) Stop() error {
-	_, err := c.call(MethodStop, nil)
+func (c *Client) Start(ctx context.Context) error {
+	_, err := c.call(ctx, MethodStart, nil)
 	return err
 }
 
-func (c *Client) StartTunnel(tag string) error {
-	_, err := c.call(MethodStartTunnel, TagParam{Tag: tag})
+func (c *Client) Stop(ctx context.Context) error {
+	_, err := c.call(ctx, MethodStop, nil)
 	return err
 }
 
-func (c *Client) StopTunnel(tag string) error {
-	_, err := c.call(MethodStopTunnel, TagParam{Tag: tag})
+func (c *Client) StartTunnel(ctx context.Context, tag string) error {
+	_, err := c.call(ctx, MethodStartTunnel, TagParam{Tag: tag})
 	return err
 }
 
-func (c *Client) RestartTunnel(tag string) error {
-	_, err := c.call(MethodRestartTunnel, TagParam{Tag: tag})
+func (c *Client) StopTunnel(ctx context.Context, tag string) error {
+	_, err := c.call(ctx, MethodStopTunnel, TagParam{Tag: tag})
 	return err
 }
 
-func (c *Client) ActivateTunnel(tag string) error {
-	_, err := c.call(MethodActivateTunnel, TagParam{Tag: tag})
+func (c *Client) RestartTunnel(ctx context.Context, tag string) error {
+	_, err := c.call(ctx, MethodRestartTunnel, TagParam{Tag: tag})
 	return err
 }
 
-func (c *Client) Status() *engine.Status {
-	resp, err := c.call(MethodStatus, nil)
+func (c *Client) ActivateTunnel(ctx context.Context, tag string) error {
+	_, err := c.call(ctx, MethodActivateTunnel, TagParam{Tag: tag})
+	return err
+}
+
+func (c *Client) OverrideActive(ctx context.Context, tag string) error {
+	_, err := c.call(ctx, MethodOverrideActive, TagParam{Tag: tag})
+	return err
+}
+
+func (c *Client) Status(ctx context.Context) *engine.Status {
+	s, err := c.FetchStatus(ctx)
 	if err != nil {
 		return &engine.Status{Tunnels: make(map[string]*engine.TunnelStatus)}
 	}
+	return s
+}
+
+// FetchStatus is like Status but returns the error instead of an empty
+// status when the daemon does not answer.
+func (c *Client) FetchStatus(ctx context.Context) (*engine.Status, error) {
+	resp, err := c.call(ctx, MethodStatus, nil)
+	if err != nil {
+		return nil, err
+	}
 	var s engine.Status
 	if err := json.Unmarshal(resp.Result, &s); err != nil {
-		return &engine.Status{Tunnels: make(map[string]*engine.TunnelStatus)}
+		return nil, fmt.Errorf("invalid status response: %w", err)
 	}
 	if s.Tunnels == nil {
 		s.Tunnels = make(map[string]*engine.TunnelStatus)
 	}
-	return &s
+	return &s, nil
 }
 
-func (c *Client) GetConfig() *config.Config {
-	resp, err := c.call(MethodGetConfig, nil)
+func (c *Client) GetConfig(ctx context.Context) *config.Config {
+	resp, err := c.call(ctx, MethodGetConfig, nil)
 	if err != nil {
 		return config.Default()
 	}
@@ -117,13 +146,13 @@ func (c *Client) GetConfig() *config.Config {
 	return &cfg
 }
 
-func (c *Client) ReloadConfig() error {
-	_, err := c.call(MethodReloadConfig, nil)
+func (c *Client) ReloadConfig(ctx context.Context) error {
+	_, err := c.call(ctx, MethodReloadConfig, nil)
 	return err
 }
 
-func (c *Client) IsConnected() bool {
-	resp, err := c.call(MethodIsConnected, nil)
+func (c *Client) IsConnected(ctx context.Context) bool {
+	resp, err := c.call(ctx, MethodIsConnected, nil)
 	if err != nil {
 		return false
 	}
@@ -134,11 +163,105 @@ func (c *Client) IsConnected() bool {
 	return result.Value
 }
 
-func (c *Client) call(method string, params any) (*Response, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (c *Client) Gateway(ctx context.Context) (*engine.GatewayInfo, error) {
+	resp, err := c.call(ctx, MethodGateway, nil)
+	if err != nil {
+		return nil, err
+	}
+	var info engine.GatewayInfo
+	if err := json.Unmarshal(resp.Result, &info); err != nil {
+		return nil, fmt.Errorf("invalid gateway response: %w", err)
+	}
+	return &info, nil
+}
+
+func (c *Client) RestartGateway(ctx context.Context) error {
+	_, err := c.call(ctx, MethodRestartGateway, nil)
+	return err
+}
+
+func (c *Client) StopGateway(ctx context.Context) error {
+	_, err := c.call(ctx, MethodStopGateway, nil)
+	return err
+}
+
+func (c *Client) StartGateway(ctx context.Context) error {
+	_, err := c.call(ctx, MethodStartGateway, nil)
+	return err
+}
+
+func (c *Client) StopTunnels(ctx context.Context) error {
+	_, err := c.call(ctx, MethodStopTunnels, nil)
+	return err
+}
+
+func (c *Client) SetGatewayAddr(ctx context.Context, addr string) error {
+	_, err := c.call(ctx, MethodSetGatewayAddr, AddrParam{Addr: addr})
+	return err
+}
+
+func (c *Client) History(ctx context.Context, tag string) (engine.History, error) {
+	resp, err := c.call(ctx, MethodHistory, TagParam{Tag: tag})
+	if err != nil {
+		return nil, err
+	}
+	var h engine.History
+	if err := json.Unmarshal(resp.Result, &h); err != nil {
+		return nil, fmt.Errorf("invalid history response: %w", err)
+	}
+	return h, nil
+}
+
+func (c *Client) RotateLogs(ctx context.Context, keep bool) (process.Rotation, error) {
+	var r process.Rotation
+	resp, err := c.call(ctx, MethodRotateLogs, RotateLogsParam{Keep: keep})
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(resp.Result, &r); err != nil {
+		return r, fmt.Errorf("invalid rotate logs response: %w", err)
+	}
+	return r, nil
+}
 
-	req := Request{Method: method}
+func (c *Client) call(ctx context.Context, method string, params any) (*Response, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		var cancel context.CancelFunc
+		deadline = time.Now().Add(Timeout(method))
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("daemon busy with another request: %w", ctx.Err())
+	}
+	defer func() { <-c.sem }()
+
+	// Unblock the read or write below when ctx is cancelled or expires
+	c.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	started := time.Now()
+	resp, err := c.roundTrip(Request{Method: method, Deadline: deadline}, params)
+	slog.Debug("daemon call", "method", method, "took", time.Since(started).Round(time.Millisecond), "error", err)
+	if err != nil && (ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded)) {
+		c.conn.Close()
+		cause := ctx.Err()
+		if cause == nil {
+			// The socket deadline can fire just before ctx notices
+			cause = context.DeadlineExceeded
+		}
+		return nil, fmt.Errorf("daemon did not answer %s: %w", method, cause)
+	}
+	return resp, err
+}
+
+// roundTrip sends one request and reads its reply.
+func (c *Client) roundTrip(req Request, params any) (*Response, error) {
 	if params != nil {
 		data, err := json.Marshal(params)
 		if err != nil {
@@ -195,10 +318,13 @@ func DetectDaemon() (bool, *Client) {
 		return false, nil
 	}
 
-	// Verify daemon is alive
-	if _, err := client.Ping(); err != nil {
+	// Verify daemon is alive. One that accepts but doesn't answer in time
+	// is hung rather than gone, so its socket is left in place.
+	if _, err := client.Ping(context.Background()); err != nil {
 		client.Close()
-		os.Remove(socketPath)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			os.Remove(socketPath)
+		}
 		return false, nil
 	}
 
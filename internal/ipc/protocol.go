@@ -1,7 +1,10 @@
 // Package ipc provides the daemon IPC protocol over Unix sockets.
 package ipc
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // IPC method constants.
 const (
@@ -13,16 +16,44 @@ const (
 	MethodStopTunnel     = "stop_tunnel"
 	MethodRestartTunnel  = "restart_tunnel"
 	MethodActivateTunnel = "activate_tunnel"
+	MethodOverrideActive = "override_active"
 	MethodStatus         = "status"
 	MethodGetConfig      = "get_config"
 	MethodReloadConfig   = "reload_config"
 	MethodIsConnected    = "is_connected"
+	MethodUpgrade        = "upgrade"
+	MethodGateway        = "gateway"
+	MethodRestartGateway = "restart_gateway"
+	MethodSetGatewayAddr = "set_gateway_addr"
+	MethodStopGateway    = "stop_gateway"
+	MethodStartGateway   = "start_gateway"
+	MethodStopTunnels    = "stop_tunnels"
+	MethodHistory        = "history"
+	MethodRotateLogs     = "rotate_logs"
+)
+
+// Default deadlines for calls made with a context that has none. Methods
+// that start or stop processes wait on transports and SSH handshakes, so
+// they get longer than queries.
+const (
+	QueryTimeout   = 5 * time.Second
+	ControlTimeout = 30 * time.Second
 )
 
+// Timeout returns the default deadline for a method.
+func Timeout(method string) time.Duration {
+	switch method {
+	case MethodPing, MethodStatus, MethodGetConfig, MethodIsConnected, MethodGateway, MethodHistory:
+		return QueryTimeout
+	}
+	return ControlTimeout
+}
+
 // Request is an IPC request sent from client to server.
 type Request struct {
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params,omitempty"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Deadline time.Time       `json:"deadline,omitzero"` // the caller's deadline; the server stops waiting on the engine after it
 }
 
 // Response is an IPC response sent from server to client.
@@ -36,10 +67,26 @@ type TagParam struct {
 	Tag string `json:"tag"`
 }
 
+// AddrParam carries a listen address.
+type AddrParam struct {
+	Addr string `json:"addr"`
+}
+
+// RotateLogsParam carries whether to keep a copy of each log being cleared.
+type RotateLogsParam struct {
+	Keep bool `json:"keep,omitempty"`
+}
+
+// UpgradeParam carries the binary the daemon should re-exec into.
+type UpgradeParam struct {
+	Binary string `json:"binary"`
+}
+
 // PingResult is the response payload for the ping method.
 type PingResult struct {
-	Version string `json:"version"`
-	PID     int    `json:"pid"`
+	Version string    `json:"version"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
 }
 
 // BoolResult wraps a boolean response value.
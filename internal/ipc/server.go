@@ -2,12 +2,17 @@ package ipc
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"runtime"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/net2share/dnstc/internal/crash"
 	"github.com/net2share/dnstc/internal/engine"
 )
 
@@ -16,9 +21,11 @@ type Server struct {
 	socketPath string
 	eng        *engine.Engine
 	version    string
+	started    time.Time
 	listener   net.Listener
 	wg         sync.WaitGroup
 	ShutdownCh chan struct{}
+	UpgradeCh  chan string // receives the binary to re-exec into
 }
 
 // NewServer creates a new IPC server.
@@ -27,7 +34,9 @@ func NewServer(socketPath, version string, eng *engine.Engine) *Server {
 		socketPath: socketPath,
 		eng:        eng,
 		version:    version,
+		started:    time.Now(),
 		ShutdownCh: make(chan struct{}, 1),
+		UpgradeCh:  make(chan string, 1),
 	}
 }
 
@@ -46,15 +55,30 @@ func (s *Server) Start() error {
 	// Restrict socket permissions
 	os.Chmod(s.socketPath, 0600)
 
+	s.StartWithListener(ln)
+	return nil
+}
+
+// StartWithListener begins accepting connections on an existing listener,
+// e.g. one inherited from the previous daemon during an upgrade.
+func (s *Server) StartWithListener(ln net.Listener) {
 	s.listener = ln
 
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		s.acceptLoop()
+		// Accept fails for good once the listener is closed
+		crash.Supervise("IPC accept loop", s.acceptLoop, func() bool { return true })
 	}()
+}
 
-	return nil
+// ListenerFile returns a duplicate of the listening socket for handover.
+func (s *Server) ListenerFile() (*os.File, error) {
+	ul, ok := s.listener.(*net.UnixListener)
+	if !ok {
+		return nil, fmt.Errorf("IPC listener can't be handed over")
+	}
+	return ul.File()
 }
 
 // Stop closes the listener, waits for in-flight requests, and removes the socket.
@@ -76,6 +100,7 @@ func (s *Server) acceptLoop() {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
+			defer crash.Recover("IPC connection")
 			defer conn.Close()
 			s.handleConn(conn)
 		}()
@@ -83,27 +108,65 @@ func (s *Server) acceptLoop() {
 }
 
 func (s *Server) handleConn(conn net.Conn) {
-	scanner := bufio.NewScanner(conn)
-	// Allow large messages (e.g. config payload)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-	encoder := json.NewEncoder(conn)
+	// Requests are read in the background so that a client hanging up
+	// cancels the request being dispatched instead of leaving it running.
+	connCtx, cancelConn := context.WithCancel(context.Background())
+	defer cancelConn()
 
-	for scanner.Scan() {
+	lines := make(chan []byte)
+	go func() {
+		defer cancelConn()
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		// Allow large messages (e.g. config payload)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- slices.Clone(scanner.Bytes()):
+			case <-connCtx.Done():
+				return
+			}
+		}
+	}()
+
+	encoder := json.NewEncoder(conn)
+	for line := range lines {
 		var req Request
-		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+		if err := json.Unmarshal(line, &req); err != nil {
 			encoder.Encode(Response{Error: "invalid request"})
 			continue
 		}
 
-		resp := s.dispatch(&req)
+		ctx, cancel := requestContext(connCtx, &req)
+		resp := s.dispatch(ctx, &req)
+		cancel()
 		encoder.Encode(resp)
+
+		// Hand off only after the client got its reply: the exec tears down this connection
+		if req.Method == MethodUpgrade && resp.Error == "" {
+			var p UpgradeParam
+			json.Unmarshal(req.Params, &p)
+			select {
+			case s.UpgradeCh <- p.Binary:
+			default:
+			}
+		}
+	}
+}
+
+// requestContext returns a context for a request that ends when the client
+// disconnects or its deadline passes.
+func requestContext(parent context.Context, req *Request) (context.Context, context.CancelFunc) {
+	if req.Deadline.IsZero() {
+		return context.WithCancel(parent)
 	}
+	return context.WithDeadline(parent, req.Deadline)
 }
 
-func (s *Server) dispatch(req *Request) Response {
+func (s *Server) dispatch(ctx context.Context, req *Request) Response {
 	switch req.Method {
 	case MethodPing:
-		return s.resultJSON(PingResult{Version: s.version, PID: os.Getpid()})
+		return s.resultJSON(PingResult{Version: s.version, PID: os.Getpid(), Started: s.started})
 
 	case MethodShutdown:
 		select {
@@ -113,13 +176,13 @@ func (s *Server) dispatch(req *Request) Response {
 		return s.ok()
 
 	case MethodStart:
-		if err := s.eng.Start(); err != nil {
+		if err := s.eng.Start(ctx); err != nil {
 			return s.errResp(err)
 		}
 		return s.ok()
 
 	case MethodStop:
-		if err := s.eng.Stop(); err != nil {
+		if err := s.eng.Stop(ctx); err != nil {
 			return s.errResp(err)
 		}
 		return s.ok()
@@ -129,7 +192,7 @@ func (s *Server) dispatch(req *Request) Response {
 		if err != nil {
 			return s.errResp(err)
 		}
-		if err := s.eng.StartTunnel(tag); err != nil {
+		if err := s.eng.StartTunnel(ctx, tag); err != nil {
 			return s.errResp(err)
 		}
 		return s.ok()
@@ -139,7 +202,7 @@ func (s *Server) dispatch(req *Request) Response {
 		if err != nil {
 			return s.errResp(err)
 		}
-		if err := s.eng.StopTunnel(tag); err != nil {
+		if err := s.eng.StopTunnel(ctx, tag); err != nil {
 			return s.errResp(err)
 		}
 		return s.ok()
@@ -149,7 +212,7 @@ func (s *Server) dispatch(req *Request) Response {
 		if err != nil {
 			return s.errResp(err)
 		}
-		if err := s.eng.RestartTunnel(tag); err != nil {
+		if err := s.eng.RestartTunnel(ctx, tag); err != nil {
 			return s.errResp(err)
 		}
 		return s.ok()
@@ -159,27 +222,121 @@ func (s *Server) dispatch(req *Request) Response {
 		if err != nil {
 			return s.errResp(err)
 		}
-		if err := s.eng.ActivateTunnel(tag); err != nil {
+		if err := s.eng.ActivateTunnel(ctx, tag); err != nil {
+			return s.errResp(err)
+		}
+		// Saved before replying, so the client reads back what it set
+		s.eng.FlushConfig()
+		return s.ok()
+
+	case MethodOverrideActive:
+		// An empty tag removes the override, so it isn't required
+		var p TagParam
+		if req.Params != nil && json.Unmarshal(req.Params, &p) != nil {
+			return Response{Error: "invalid params"}
+		}
+		if err := s.eng.OverrideActive(ctx, p.Tag); err != nil {
 			return s.errResp(err)
 		}
 		return s.ok()
 
 	case MethodStatus:
-		status := s.eng.Status()
+		status := s.eng.Status(ctx)
 		return s.resultJSON(status)
 
 	case MethodGetConfig:
-		cfg := s.eng.GetConfig()
+		cfg := s.eng.GetConfig(ctx)
 		return s.resultJSON(cfg)
 
 	case MethodReloadConfig:
-		if err := s.eng.ReloadConfig(); err != nil {
+		if err := s.eng.ReloadConfig(ctx); err != nil {
 			return s.errResp(err)
 		}
 		return s.ok()
 
 	case MethodIsConnected:
-		return s.resultJSON(BoolResult{Value: s.eng.IsConnected()})
+		return s.resultJSON(BoolResult{Value: s.eng.IsConnected(ctx)})
+
+	case MethodGateway:
+		info, err := s.eng.Gateway(ctx)
+		if err != nil {
+			return s.errResp(err)
+		}
+		return s.resultJSON(info)
+
+	case MethodRestartGateway:
+		if err := s.eng.RestartGateway(ctx); err != nil {
+			return s.errResp(err)
+		}
+		return s.ok()
+
+	case MethodStopGateway:
+		if err := s.eng.StopGateway(ctx); err != nil {
+			return s.errResp(err)
+		}
+		return s.ok()
+
+	case MethodStartGateway:
+		if err := s.eng.StartGateway(ctx); err != nil {
+			return s.errResp(err)
+		}
+		return s.ok()
+
+	case MethodStopTunnels:
+		if err := s.eng.StopTunnels(ctx); err != nil {
+			return s.errResp(err)
+		}
+		return s.ok()
+
+	case MethodSetGatewayAddr:
+		var p AddrParam
+		if req.Params == nil || json.Unmarshal(req.Params, &p) != nil || p.Addr == "" {
+			return Response{Error: "addr is required"}
+		}
+		if err := s.eng.SetGatewayAddr(ctx, p.Addr); err != nil {
+			return s.errResp(err)
+		}
+		s.eng.FlushConfig()
+		return s.ok()
+
+	case MethodHistory:
+		tag, err := s.parseTag(req)
+		if err != nil {
+			return s.errResp(err)
+		}
+		h, err := s.eng.History(ctx, tag)
+		if err != nil {
+			return s.errResp(err)
+		}
+		return s.resultJSON(h)
+
+	case MethodRotateLogs:
+		var p RotateLogsParam
+		if req.Params != nil && json.Unmarshal(req.Params, &p) != nil {
+			return Response{Error: "invalid params"}
+		}
+		r, err := s.eng.RotateLogs(ctx, p.Keep)
+		if err != nil {
+			return s.errResp(err)
+		}
+		return s.resultJSON(r)
+
+	case MethodUpgrade:
+		var p UpgradeParam
+		if req.Params == nil || json.Unmarshal(req.Params, &p) != nil || p.Binary == "" {
+			return Response{Error: "binary is required"}
+		}
+		if runtime.GOOS == "windows" {
+			return Response{Error: "daemon upgrade is not supported on Windows"}
+		}
+		info, err := os.Stat(p.Binary)
+		if err != nil {
+			return s.errResp(err)
+		}
+		if info.IsDir() || info.Mode()&0111 == 0 {
+			return Response{Error: fmt.Sprintf("%s is not executable", p.Binary)}
+		}
+		return s.ok()
 
 	default:
 		return Response{Error: fmt.Sprintf("unknown method: %s", req.Method)}
@@ -10,6 +10,11 @@ import (
 	"github.com/net2share/go-corelib/tui"
 )
 
+// showError shows an action error with its hint in an error dialog.
+func showError(err error) {
+	_ = tui.ShowMessage(tui.AppMessage{Type: "error", Message: actions.FormatError(err, "", 0)})
+}
+
 // isInfoViewAction returns true for actions that manage their own TUI display
 // (dialogs, editors, etc.) and should NOT be wrapped in a progress view.
 func isInfoViewAction(actionID string) bool {
@@ -35,7 +40,7 @@ func newActionContext(args []string) *actions.Context {
 		IsInteractive: true,
 	}
 
-	cfg, _ := config.Load()
+	cfg, _ := handlers.LoadSavedConfig()
 	ctx.Config = cfg
 
 	return ctx
@@ -46,7 +51,7 @@ func BuildMenuOptions(parentID string) []tui.MenuOption {
 	var options []tui.MenuOption
 
 	var cfg *config.Config
-	cfg, _ = config.Load()
+	cfg, _ = handlers.LoadSavedConfig()
 
 	children := actions.GetChildren(parentID)
 	for _, action := range children {
@@ -93,7 +98,7 @@ func RunAction(actionID string) error {
 		IsInteractive: true,
 	}
 
-	cfg, _ := config.Load()
+	cfg, _ := handlers.LoadSavedConfig()
 	ctx.Config = cfg
 
 	// Handle argument collection
@@ -287,7 +292,7 @@ func RunAction(actionID string) error {
 	if action.Confirm != nil {
 		confirm, err := tui.RunConfirm(tui.ConfirmConfig{
 			Title:       action.Confirm.Message,
-			Description: action.Confirm.Description,
+			Description: confirmDescription(ctx, action),
 			Default:     !action.Confirm.DefaultNo,
 		})
 		if err != nil {
@@ -311,6 +316,14 @@ func RunAction(actionID string) error {
 	return action.Handler(ctx)
 }
 
+// confirmDescription returns the description shown when confirming action.
+func confirmDescription(ctx *actions.Context, action *actions.Action) string {
+	if action.Confirm.DescriptionFunc != nil {
+		return action.Confirm.DescriptionFunc(ctx)
+	}
+	return action.Confirm.Description
+}
+
 // runPickerForAction shows a picker for an action's argument.
 func runPickerForAction(ctx *actions.Context, action *actions.Action) (string, error) {
 	_, err := action.Args.PickerFunc(ctx)
@@ -350,12 +363,17 @@ func runActionWithArgs(actionID string, args []string) error {
 		return fmt.Errorf("unknown action: %s", actionID)
 	}
 
+	ctx := newActionContext(nil)
+	if action.Args != nil && action.Args.Name == "tag" && len(args) > 0 {
+		ctx.Values["tag"] = args[0]
+	}
+
 	// Handle confirmation with tag in message
 	if action.Confirm != nil && len(args) > 0 {
 		tag := args[0]
 		confirm, err := tui.RunConfirm(tui.ConfirmConfig{
 			Title:       fmt.Sprintf("%s '%s'?", action.Confirm.Message, tag),
-			Description: action.Confirm.Description,
+			Description: confirmDescription(ctx, action),
 			Default:     !action.Confirm.DefaultNo,
 		})
 		if err != nil {
@@ -366,11 +384,6 @@ func runActionWithArgs(actionID string, args []string) error {
 		}
 	}
 
-	ctx := newActionContext(nil)
-	if action.Args != nil && action.Args.Name == "tag" && len(args) > 0 {
-		ctx.Values["tag"] = args[0]
-	}
-
 	if action.Handler == nil {
 		return fmt.Errorf("no handler for action %s", actionID)
 	}
@@ -415,7 +428,7 @@ func RunSubmenu(parentID string) error {
 		}
 
 		if err := RunAction(choice); err != nil && err != errCancelled {
-			_ = tui.ShowMessage(tui.AppMessage{Type: "error", Message: err.Error()})
+			showError(err)
 		}
 	}
 }
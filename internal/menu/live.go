@@ -0,0 +1,195 @@
+package menu
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/net2share/go-corelib/tui"
+)
+
+// headerRefreshInterval is how often the main menu header is rebuilt while
+// the menu is idle, so tunnel drops show up without pressing a key.
+const headerRefreshInterval = 2 * time.Second
+
+// Bounds of the menu box width. Below minMenuWidth columns the box is not
+// shrunk further and the terminal wraps it instead.
+const (
+	minMenuWidth = 30
+	maxMenuWidth = 90
+)
+
+// headerMsg carries a freshly built menu header.
+type headerMsg string
+
+// liveMenuModel is a full-screen menu whose header is refreshed periodically.
+// It renders like tui.RunMenu, whose model is not exported and has no way to
+// update the header, so it cannot be wrapped.
+type liveMenuModel struct {
+	config   tui.MenuConfig
+	refresh  func() string
+	cursor   int
+	selected string
+	width    int
+	height   int
+	quitting bool
+}
+
+// runLiveMenu runs a full-screen menu whose header is rebuilt by refresh
+// every headerRefreshInterval. Without refresh it is tui.RunMenu. Returns ""
+// if the user cancels.
+func runLiveMenu(cfg tui.MenuConfig, refresh func() string) (string, error) {
+	if refresh == nil {
+		return tui.RunMenu(cfg)
+	}
+
+	m := liveMenuModel{config: cfg, refresh: refresh, cursor: cfg.Selected}
+	if !m.isSelectable(m.cursor) {
+		m.cursor = m.nextSelectable(m.cursor, 1)
+	}
+
+	var p *tea.Program
+	if tui.InSession() {
+		fmt.Fprint(os.Stdout, "\033[H\033[2J")
+		p = tea.NewProgram(m)
+	} else {
+		p = tea.NewProgram(m, tea.WithAltScreen())
+	}
+
+	final, err := p.Run()
+	if err != nil {
+		return "", err
+	}
+	return final.(liveMenuModel).selected, nil
+}
+
+func (m liveMenuModel) tick() tea.Cmd {
+	return tea.Tick(headerRefreshInterval, func(time.Time) tea.Msg {
+		return headerMsg(m.refresh())
+	})
+}
+
+func (m liveMenuModel) isSelectable(i int) bool {
+	return i >= 0 && i < len(m.config.Options) && !m.config.Options[i].Separator
+}
+
+func (m liveMenuModel) nextSelectable(from, direction int) int {
+	n := len(m.config.Options)
+	if n == 0 {
+		return from
+	}
+	pos := from
+	for range n {
+		pos = (pos + direction + n) % n
+		if m.isSelectable(pos) {
+			return pos
+		}
+	}
+	return from
+}
+
+func (m liveMenuModel) Init() tea.Cmd {
+	return m.tick()
+}
+
+func (m liveMenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case headerMsg:
+		m.config.Header = string(msg)
+		return m, m.tick()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.quitting = true
+			m.selected = ""
+			return m, tea.Quit
+		case "up", "k":
+			m.cursor = m.nextSelectable(m.cursor, -1)
+		case "down", "j":
+			m.cursor = m.nextSelectable(m.cursor, 1)
+		case "enter", " ":
+			if m.isSelectable(m.cursor) {
+				m.selected = m.config.Options[m.cursor].Value
+				return m, tea.Quit
+			}
+		case "home":
+			m.cursor = m.nextSelectable(-1, 1)
+		case "end":
+			m.cursor = m.nextSelectable(len(m.config.Options), -1)
+		}
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	}
+	return m, nil
+}
+
+func (m liveMenuModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	muted := lipgloss.NewStyle().Foreground(tui.Theme.Muted)
+	primary := lipgloss.NewStyle().Foreground(tui.Theme.Primary)
+	normal := lipgloss.NewStyle().Foreground(tui.Theme.Text)
+
+	var b strings.Builder
+	if m.config.Title != "" {
+		b.WriteString(primary.Bold(true).Render(m.config.Title) + "\n\n")
+	}
+	if m.config.Description != "" {
+		b.WriteString(muted.Render(m.config.Description) + "\n\n")
+	}
+	for i, opt := range m.config.Options {
+		if opt.Separator {
+			if opt.Label == "" {
+				b.WriteString(muted.Render("  "+strings.Repeat("─", 25)) + "\n")
+			} else {
+				b.WriteString("  " + muted.Bold(true).Render(opt.Label) + "\n")
+			}
+			continue
+		}
+		if i == m.cursor {
+			b.WriteString(primary.Render("> ") + primary.Bold(true).Render(opt.Label) + "\n")
+		} else {
+			b.WriteString("  " + normal.Render(opt.Label) + "\n")
+		}
+	}
+	b.WriteString(muted.Render("\n↑/↓: navigate • enter: select • q/esc: back"))
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(tui.Theme.Muted).
+		Padding(1, 2).
+		Width(menuBoxWidth(m.width)).
+		Render(b.String())
+	if m.config.Header != "" {
+		box = muted.Render(m.config.Header) + "\n\n" + box
+	}
+
+	if m.width <= 0 || m.height <= 0 {
+		return box
+	}
+	info := tui.GetAppInfo()
+	if info == nil || m.height <= 2 {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+	}
+	footer := fmt.Sprintf("%s %s", info.Name, info.Version)
+	if info.BuildTime != "" && info.BuildTime != "unknown" {
+		footer += fmt.Sprintf(" (%s)", info.BuildTime)
+	}
+	return lipgloss.Place(m.width, m.height-2, lipgloss.Center, lipgloss.Center, box) + "\n" +
+		lipgloss.PlaceHorizontal(m.width, lipgloss.Center, muted.Render(footer))
+}
+
+// menuBoxWidth returns the width of the menu box on a terminal termWidth
+// columns wide, leaving a margin on each side as tui.RunMenu does.
+func menuBoxWidth(termWidth int) int {
+	if termWidth <= 0 {
+		return 80
+	}
+	return min(max(termWidth-10, minMenuWidth), maxMenuWidth)
+}
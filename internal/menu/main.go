@@ -2,9 +2,11 @@
 package menu
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/net2share/dnstc/internal/actions"
 	"github.com/net2share/dnstc/internal/binaries"
@@ -46,7 +48,7 @@ func recheckDaemon() {
 	if daemonMode {
 		// We're in daemon mode — verify daemon is still alive
 		if daemonClient != nil {
-			if _, err := daemonClient.Ping(); err == nil {
+			if _, err := daemonClient.Ping(context.Background()); err == nil {
 				return // still alive
 			}
 			// Daemon died — switch to nil engine
@@ -105,7 +107,7 @@ func buildTunnelSummary() string {
 		return fmt.Sprintf("Service not running | Tunnels: %d", len(cfg.Tunnels))
 	}
 
-	cfg := eng.GetConfig()
+	cfg := eng.GetConfig(context.Background())
 	total := len(cfg.Tunnels)
 	if total == 0 {
 		if daemonMode {
@@ -114,7 +116,7 @@ func buildTunnelSummary() string {
 		return ""
 	}
 
-	status := eng.Status()
+	status := eng.Status(context.Background())
 
 	running := 0
 	for _, ts := range status.Tunnels {
@@ -131,16 +133,44 @@ func buildTunnelSummary() string {
 	summary := fmt.Sprintf("%s | Tunnels: %d | Running: %d", connState, total, running)
 	if status.GatewayAddr != "" {
 		summary += fmt.Sprintf(" | Gateway: %s", status.GatewayAddr)
+		if status.GatewayBusy != "" {
+			summary += fmt.Sprintf(" (%s was in use)", status.GatewayBusy)
+		}
+	} else if status.GatewayHeld {
+		summary += " | Gateway: stopped"
 	}
 	if status.Active != "" {
 		summary += fmt.Sprintf(" | Active: %s", status.Active)
+		if status.Routing != "" {
+			summary += fmt.Sprintf(" (down, via %s)", status.Routing)
+		}
 	}
 	if daemonMode {
 		summary += " | [daemon]"
 	}
+	if status.Active != "" {
+		if h, _ := eng.History(context.Background(), status.Active); len(h) > 0 {
+			h = h.Last(headerHistoryLen)
+			summary += fmt.Sprintf("\nThroughput %s  RTT %s", h.RateSparkline(headerHistoryLen), h.RTTSparkline(headerHistoryLen))
+		}
+	}
 	return summary
 }
 
+// headerHistoryLen is the number of history samples, one a minute, graphed in
+// the main menu header.
+const headerHistoryLen = 30
+
+// buildMainHeader returns the tunnel summary, followed by an update banner
+// when the last update check found a newer release.
+func buildMainHeader() string {
+	header := buildTunnelSummary()
+	if latest := binaries.AvailableUpdate(Version); latest != "" {
+		header += fmt.Sprintf("\nUpdate available (%s) — use Check Updates to install", latest)
+	}
+	return header
+}
+
 // RunInteractive shows the main interactive menu.
 func RunInteractive() error {
 	PrintBanner()
@@ -155,6 +185,9 @@ func RunInteractive() error {
 	arch := osdetect.GetArch()
 	tui.PrintInfo(fmt.Sprintf("Architecture: %s", arch))
 
+	// Picked up by the header on a later refresh; never blocks the menu
+	go binaries.RefreshUpdateCheck(Version)
+
 	return runMainMenu()
 }
 
@@ -163,7 +196,7 @@ func runMainMenu() error {
 		// Re-check for daemon each iteration
 		recheckDaemon()
 
-		header := buildTunnelSummary()
+		header := buildMainHeader()
 
 		var options []tui.MenuOption
 		installed := binaries.AreInstalled()
@@ -175,6 +208,7 @@ func runMainMenu() error {
 			}
 
 			options = append(options, tui.MenuOption{Label: "Tunnels →", Value: actions.ActionTunnel})
+			options = append(options, tui.MenuOption{Label: "Resolvers →", Value: actions.ActionResolver})
 			options = append(options, tui.MenuOption{Label: "Configure →", Value: actions.ActionConfig})
 			options = append(options, tui.MenuOption{Label: "Check Updates", Value: actions.ActionUpdate})
 		} else {
@@ -186,11 +220,11 @@ func runMainMenu() error {
 		}
 		options = append(options, tui.MenuOption{Label: "Exit", Value: "exit"})
 
-		choice, err := tui.RunMenu(tui.MenuConfig{
+		choice, err := runLiveMenu(tui.MenuConfig{
 			Header:  header,
 			Title:   "DNS Tunnel Client",
 			Options: options,
-		})
+		}, buildMainHeader)
 		if err != nil {
 			return err
 		}
@@ -204,7 +238,7 @@ func runMainMenu() error {
 			continue
 		}
 		if err != nil {
-			_ = tui.ShowMessage(tui.AppMessage{Type: "error", Message: err.Error()})
+			showError(err)
 		}
 	}
 }
@@ -215,6 +249,8 @@ func handleMainMenuChoice(choice string) error {
 		return handleServiceStatus()
 	case actions.ActionTunnel:
 		return runTunnelMenu()
+	case actions.ActionResolver:
+		return runResolverMenu()
 	case actions.ActionConfig:
 		return RunSubmenu(actions.ActionConfig)
 	case actions.ActionInstall:
@@ -223,10 +259,7 @@ func handleMainMenuChoice(choice string) error {
 		}
 		return nil
 	case actions.ActionUpdate:
-		if err := RunAction(actions.ActionUpdate); err != nil && err != errCancelled {
-			return err
-		}
-		return nil
+		return runUpdate()
 	case actions.ActionUninstall:
 		if err := RunAction(actions.ActionUninstall); err != nil {
 			if err == errCancelled {
@@ -247,7 +280,7 @@ func handleServiceStatus() error {
 		return nil
 	}
 
-	status := eng.Status()
+	status := eng.Status(context.Background())
 	running := 0
 	for _, ts := range status.Tunnels {
 		if ts.Running {
@@ -259,6 +292,24 @@ func handleServiceStatus() error {
 	if status.GatewayAddr != "" {
 		msg += fmt.Sprintf("\nGateway: %s", status.GatewayAddr)
 	}
+	if notice := status.GatewayNotice(); notice != "" {
+		msg += "\n⚠ " + notice
+	}
+	if notice := status.PanicNotice(); notice != "" {
+		msg += "\n⚠ " + notice
+	}
+	if notice := status.StandbyNotice(); notice != "" {
+		msg += "\n⚠ " + notice
+	}
+	for _, ts := range status.Tunnels {
+		if notice := ts.FallbackNotice(); notice != "" {
+			msg += "\n⚠ " + notice
+		}
+	}
+	msg += "\n\nBinaries:"
+	for _, v := range binaries.Versions() {
+		msg += "\n  " + v.FormatVersion()
+	}
 	_ = tui.ShowMessage(tui.AppMessage{Type: "info", Message: msg})
 	return nil
 }
@@ -285,21 +336,21 @@ func runTunnelMenu() error {
 		case actions.ActionTunnelAdd:
 			if err := RunAction(actions.ActionTunnelAdd); err != nil {
 				if err != errCancelled {
-					_ = tui.ShowMessage(tui.AppMessage{Type: "error", Message: err.Error()})
+					showError(err)
 				}
 			} else {
 				if eng := engine.Get(); eng != nil {
-					eng.ReloadConfig()
+					eng.ReloadConfig(context.Background())
 				}
 			}
 		case actions.ActionTunnelImport:
 			if err := RunAction(actions.ActionTunnelImport); err != nil {
 				if err != errCancelled {
-					_ = tui.ShowMessage(tui.AppMessage{Type: "error", Message: err.Error()})
+					showError(err)
 				}
 			} else {
 				if eng := engine.Get(); eng != nil {
-					eng.ReloadConfig()
+					eng.ReloadConfig(context.Background())
 				}
 			}
 		case "list":
@@ -318,8 +369,8 @@ func runTunnelListMenu() error {
 		var status *engine.Status
 
 		if eng != nil {
-			cfg = eng.GetConfig()
-			status = eng.Status()
+			cfg = eng.GetConfig(context.Background())
+			status = eng.Status(context.Background())
 		} else {
 			var err error
 			cfg, err = config.LoadOrDefault()
@@ -362,6 +413,9 @@ func runTunnelListMenu() error {
 			if tc.Tag == cfg.Route.Active {
 				label += " [active]"
 			}
+			if ts != nil && ts.Running && ts.Health != nil {
+				label += fmt.Sprintf(" %s, %s loss", ts.Health.FormatRTT(), ts.Health.FormatLoss())
+			}
 			options = append(options, tui.MenuOption{Label: label, Value: tc.Tag})
 		}
 		options = append(options, tui.MenuOption{Label: "Back", Value: "back"})
@@ -388,8 +442,8 @@ func runTunnelManageMenu(tag string) error {
 		var status *engine.Status
 
 		if eng != nil {
-			cfg = eng.GetConfig()
-			status = eng.Status()
+			cfg = eng.GetConfig(context.Background())
+			status = eng.Status(context.Background())
 		} else {
 			var err error
 			cfg, err = config.LoadOrDefault()
@@ -423,12 +477,26 @@ func runTunnelManageMenu(tag string) error {
 
 		var options []tui.MenuOption
 		options = append(options, tui.MenuOption{Label: "Status", Value: "status"})
+		if ts != nil && ts.Running {
+			options = append(options, tui.MenuOption{Label: "Test now", Value: "test"})
+		}
+		options = append(options, tui.MenuOption{Label: "Test config", Value: "test-config"})
 
 		if ts == nil || !ts.Active {
 			options = append(options, tui.MenuOption{Label: "Activate", Value: "activate"})
+			if tag != cfg.Route.Standby {
+				options = append(options, tui.MenuOption{Label: "Use as standby", Value: "standby"})
+			}
 		}
 
+		options = append(options, tui.MenuOption{Label: "Network preset", Value: "preset"})
+
+		index := slices.IndexFunc(cfg.Tunnels, func(t config.TunnelConfig) bool { return t.Tag == tag })
+		options = append(options, moveOptions(index, len(cfg.Tunnels))...)
+
 		options = append(options,
+			tui.MenuOption{Label: "Export", Value: "export"},
+			tui.MenuOption{Label: "Share", Value: "share"},
 			tui.MenuOption{Label: "Remove", Value: "remove"},
 			tui.MenuOption{Label: "Back", Value: "back"},
 		)
@@ -445,16 +513,33 @@ func runTunnelManageMenu(tag string) error {
 			return errCancelled
 		}
 
+		if choice == "preset" {
+			if err := runPresetMenu(tag, tc.Preset); err != nil && err != errCancelled {
+				showError(err)
+			}
+			continue
+		}
+		if choice == moveUp || choice == moveDown {
+			if err := runMove(actions.ActionTunnelMove, tag, choice); err != nil {
+				showError(err)
+			}
+			continue
+		}
+
 		actionID := "tunnel." + choice
 		if err := runTunnelAction(actionID, tag); err != nil {
 			if err == errCancelled {
 				continue
 			}
-			_ = tui.ShowMessage(tui.AppMessage{Type: "error", Message: err.Error()})
+			showError(err)
+		} else if choice == "standby" {
+			if eng := engine.Get(); eng != nil {
+				eng.ReloadConfig(context.Background())
+			}
 		} else if choice == "remove" {
 			// Reload engine config after removing a tunnel
 			if eng := engine.Get(); eng != nil {
-				eng.ReloadConfig()
+				eng.ReloadConfig(context.Background())
 			}
 			return errCancelled
 		}
@@ -462,10 +547,40 @@ func runTunnelManageMenu(tag string) error {
 }
 
 // runTunnelAction runs a tunnel action with the given tag as argument.
+// runUpdate checks for updates and shows their release notes, then installs
+// them once the user confirms.
+func runUpdate() error {
+	action := actions.Get(actions.ActionUpdate)
+
+	ctx := newActionContext(nil)
+	ctx.Values["check"] = true
+	if err := action.Handler(ctx); err != nil {
+		return err
+	}
+	if ctx.GetInt("updates-available") == 0 {
+		return nil
+	}
+
+	confirm, err := tui.RunConfirm(tui.ConfirmConfig{
+		Title:       "Install updates?",
+		Description: "Downloads the updates whose release notes were just shown.",
+	})
+	if err != nil {
+		return err
+	}
+	if !confirm {
+		return nil
+	}
+
+	ctx = newActionContext(nil)
+	ctx.Values["yes"] = true
+	return action.Handler(ctx)
+}
+
 func runTunnelAction(actionID, tunnelTag string) error {
 	switch actionID {
-	case actions.ActionTunnelStatus,
-		actions.ActionTunnelRemove, actions.ActionTunnelActivate:
+	case actions.ActionTunnelStatus, actions.ActionTunnelTest, actions.ActionTunnelCheck, actions.ActionTunnelExport,
+		actions.ActionTunnelShare, actions.ActionTunnelRemove, actions.ActionTunnelActivate, actions.ActionTunnelStandby:
 		return runActionWithArgs(actionID, []string{tunnelTag})
 	default:
 		return RunAction(actionID)
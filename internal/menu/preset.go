@@ -0,0 +1,52 @@
+package menu
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/handlers"
+	"github.com/net2share/go-corelib/tui"
+)
+
+// runPresetMenu picks a network preset for a tunnel and applies it.
+func runPresetMenu(tag, current string) error {
+	action := actions.Get(actions.ActionTunnelPreset)
+	if current == "" {
+		current = "none"
+	}
+
+	var options []tui.MenuOption
+	for _, opt := range action.Inputs[0].Options {
+		label := fmt.Sprintf("%s — %s", opt.Label, opt.Description)
+		if opt.Value == current {
+			label += " (current)"
+		}
+		options = append(options, tui.MenuOption{Label: label, Value: opt.Value})
+	}
+	options = append(options, tui.MenuOption{Label: "Back", Value: "back"})
+
+	choice, err := tui.RunMenu(tui.MenuConfig{
+		Title:       fmt.Sprintf("Network preset: %s", tag),
+		Description: "Tunes keep-alive, gateway dial timeout and health probes together",
+		Options:     options,
+	})
+	if err != nil || choice == "" || choice == "back" {
+		return errCancelled
+	}
+
+	ctx := newActionContext([]string{tag})
+	ctx.Values["preset"] = choice
+	tuiOut := ctx.Output.(*handlers.TUIOutput)
+	tuiOut.BeginProgress(action.Short)
+	err = action.Handler(ctx)
+	tuiOut.EndProgress()
+	if err != nil {
+		return err
+	}
+	if eng := engine.Get(); eng != nil {
+		eng.ReloadConfig(context.Background())
+	}
+	return nil
+}
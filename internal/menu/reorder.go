@@ -0,0 +1,112 @@
+package menu
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/net2share/dnstc/internal/actions"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/handlers"
+	"github.com/net2share/go-corelib/tui"
+)
+
+// Menu values of the move options.
+const (
+	moveUp   = "up"
+	moveDown = "down"
+)
+
+// moveOptions returns the move up and down options for item i of a list of n.
+func moveOptions(i, n int) []tui.MenuOption {
+	var options []tui.MenuOption
+	if i > 0 {
+		options = append(options, tui.MenuOption{Label: "Move up", Value: moveUp})
+	}
+	if i < n-1 {
+		options = append(options, tui.MenuOption{Label: "Move down", Value: moveDown})
+	}
+	return options
+}
+
+// runMove moves item, a tunnel tag or a resolver address, one place in
+// direction dir with a move action. It runs quietly so that the list just
+// redraws in its new order, and has an in-process engine pick the order up.
+func runMove(actionID, item, dir string) error {
+	action := actions.Get(actionID)
+	ctx := newActionContext([]string{item})
+	out := handlers.NewTUIOutput()
+	out.SetVerbosity(actions.VerbosityQuiet)
+	ctx.Output = out
+	ctx.Values[dir] = true
+	if err := action.Handler(ctx); err != nil {
+		return err
+	}
+	if eng := engine.Get(); eng != nil {
+		eng.ReloadConfig(context.Background())
+	}
+	return nil
+}
+
+// runResolverMenu lists the global resolvers, in the order tunnels try them,
+// to reorder them or import more.
+func runResolverMenu() error {
+	for {
+		cfg, err := handlers.LoadSavedConfig()
+		if err != nil {
+			cfg = config.Default()
+		}
+
+		var options []tui.MenuOption
+		for i, r := range cfg.Resolvers {
+			label := r
+			if i == 0 {
+				label += " [default]"
+			}
+			options = append(options, tui.MenuOption{Label: label, Value: r})
+		}
+		options = append(options,
+			tui.MenuOption{Label: "Import by region", Value: actions.ActionResolverImport},
+			tui.MenuOption{Label: "Add DoH upstream", Value: actions.ActionResolverDoH},
+			tui.MenuOption{Label: "Back", Value: "back"},
+		)
+
+		choice, err := tui.RunMenu(tui.MenuConfig{
+			Title:       "Resolvers",
+			Description: "Tunnels without a resolver of their own use the first one",
+			Options:     options,
+		})
+		if err != nil || choice == "" || choice == "back" {
+			return errCancelled
+		}
+
+		if choice == actions.ActionResolverImport || choice == actions.ActionResolverDoH {
+			if err := RunAction(choice); err != nil && err != errCancelled {
+				showError(err)
+			}
+			continue
+		}
+		if err := runResolverManageMenu(cfg.Resolvers, choice); err != nil && err != errCancelled {
+			showError(err)
+		}
+	}
+}
+
+// runResolverManageMenu offers to move resolver addr within list.
+func runResolverManageMenu(list []string, addr string) error {
+	i := 0
+	for i < len(list) && list[i] != addr {
+		i++
+	}
+	options := append(moveOptions(i, len(list)), tui.MenuOption{Label: "Back", Value: "back"})
+
+	choice, err := tui.RunMenu(tui.MenuConfig{
+		Title:       addr,
+		Description: fmt.Sprintf("Resolver %d of %d", i+1, len(list)),
+		Options:     options,
+	})
+	if err != nil || choice == "" || choice == "back" {
+		return errCancelled
+	}
+	return runMove(actions.ActionResolverMove, addr, choice)
+}
@@ -0,0 +1,119 @@
+package obfs
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// banner is what an SSH server sends first, which the scrambling must hide.
+var banner = []byte("SSH-2.0-OpenSSH_9.6\r\n")
+
+// send writes each chunk to c in turn, then closes it.
+func send(c net.Conn, chunks ...[]byte) {
+	for _, p := range chunks {
+		if _, err := c.Write(p); err != nil {
+			break
+		}
+	}
+	c.Close()
+}
+
+func TestRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	tests := []struct {
+		name    string
+		pad     bool
+		readLen int // bytes asked for per Read
+	}{
+		{"no padding", false, 4096},
+		{"padding", true, 4096},
+		{"no padding, byte at a time", false, 1},
+		{"padding, byte at a time", true, 1},
+		{"padding, odd reads", true, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			client := Wrap(a, "secret", tt.pad)
+			server := Wrap(b, "secret", tt.pad)
+			go send(client, banner, payload[:500], payload[500:])
+
+			var got []byte
+			buf := make([]byte, tt.readLen)
+			for {
+				n, err := server.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := append(append([]byte(nil), banner...), payload...)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got %d bytes, want %d, or content differs", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestBothDirections(t *testing.T) {
+	a, b := net.Pipe()
+	client := Wrap(a, "secret", true)
+	server := Wrap(b, "secret", true)
+	defer client.Close()
+	defer server.Close()
+
+	go server.Write(banner)
+	got := make([]byte, len(banner))
+	if _, err := io.ReadFull(client, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, banner) {
+		t.Fatalf("client read %q, want %q", got, banner)
+	}
+
+	go client.Write([]byte("reply"))
+	got = make([]byte, 5)
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "reply" {
+		t.Fatalf("server read %q, want %q", got, "reply")
+	}
+}
+
+func TestWireHidesData(t *testing.T) {
+	for _, pad := range []bool{false, true} {
+		a, b := net.Pipe()
+		go send(Wrap(a, "secret", pad), banner)
+		wire, err := io.ReadAll(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(wire, []byte("SSH-")) {
+			t.Errorf("pad=%v: banner visible on the wire: %q", pad, wire)
+		}
+		if want := nonceSize + len(banner); len(wire) < want {
+			t.Errorf("pad=%v: %d bytes on the wire, want at least %d", pad, len(wire), want)
+		}
+	}
+}
+
+func TestMismatchedKey(t *testing.T) {
+	a, b := net.Pipe()
+	go send(Wrap(a, "secret", false), banner)
+	got, err := io.ReadAll(Wrap(b, "other", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(banner) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(banner))
+	}
+	if bytes.Equal(got, banner) {
+		t.Fatal("a different key read the data")
+	}
+}
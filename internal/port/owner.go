@@ -0,0 +1,46 @@
+package port
+
+import "fmt"
+
+// Owner identifies the process listening on a port.
+type Owner struct {
+	PID  int
+	Name string
+}
+
+// knownProxies names local proxy software commonly found on port 1080 or
+// the gateway port, keyed by process name.
+var knownProxies = map[string]string{
+	"tor":        "Tor",
+	"ssh":        "an SSH dynamic forward (ssh -D)",
+	"sslocal":    "a Shadowsocks client",
+	"ss-local":   "a Shadowsocks client",
+	"v2ray":      "a V2Ray client",
+	"xray":       "an Xray client",
+	"sing-box":   "a sing-box client",
+	"clash":      "a Clash client",
+	"mihomo":     "a Clash client",
+	"psiphon":    "Psiphon",
+	"privoxy":    "Privoxy",
+	"dnstc":      "another dnstc instance",
+	"microsocks": "a SOCKS server",
+	"dante":      "a SOCKS server",
+	"sockd":      "a SOCKS server",
+}
+
+// String describes the owner, e.g. "tor (pid 812, Tor)".
+func (o *Owner) String() string {
+	if o == nil {
+		return "another process"
+	}
+	if kind, ok := knownProxies[o.Name]; ok {
+		return fmt.Sprintf("%s (pid %d, %s)", o.Name, o.PID, kind)
+	}
+	return fmt.Sprintf("%s (pid %d)", o.Name, o.PID)
+}
+
+// FindOwner returns the process listening on a TCP port, or nil if there is
+// none or it can't be determined (e.g. it belongs to another user).
+func FindOwner(port int) *Owner {
+	return findOwner(port)
+}
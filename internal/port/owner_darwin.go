@@ -0,0 +1,28 @@
+package port
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func findOwner(port int) *Owner {
+	out, err := exec.Command("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-Fpc").Output()
+	if err != nil {
+		return nil
+	}
+	var o Owner
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "p") && o.PID == 0:
+			o.PID, _ = strconv.Atoi(line[1:])
+		case strings.HasPrefix(line, "c") && o.Name == "":
+			o.Name = line[1:]
+		}
+	}
+	if o.PID == 0 {
+		return nil
+	}
+	return &o
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !windows
+
+package port
+
+func findOwner(port int) *Owner {
+	return nil
+}
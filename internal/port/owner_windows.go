@@ -0,0 +1,39 @@
+package port
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func findOwner(port int) *Owner {
+	out, err := exec.Command("netstat", "-ano", "-p", "TCP").Output()
+	if err != nil {
+		return nil
+	}
+	suffix := fmt.Sprintf(":%d", port)
+	pid := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		// TCP    127.0.0.1:1080    0.0.0.0:0    LISTENING    1234
+		fields := strings.Fields(line)
+		if len(fields) == 5 && fields[3] == "LISTENING" && strings.HasSuffix(fields[1], suffix) {
+			pid, _ = strconv.Atoi(fields[4])
+			break
+		}
+	}
+	if pid == 0 {
+		return nil
+	}
+
+	o := &Owner{PID: pid, Name: "unknown"}
+	out, err = exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return o
+	}
+	if rec, err := csv.NewReader(strings.NewReader(string(out))).Read(); err == nil && len(rec) > 0 {
+		o.Name = strings.TrimSuffix(rec[0], ".exe")
+	}
+	return o
+}
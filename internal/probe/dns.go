@@ -0,0 +1,287 @@
+// Package probe provides lightweight DNS and SOCKS5 probes used for diagnostics.
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNS record types used by probes.
+const (
+	TypeA    uint16 = 1
+	TypeNS   uint16 = 2
+	TypeTXT  uint16 = 16
+	TypeAAAA uint16 = 28
+)
+
+// DNS response codes.
+const (
+	RCodeSuccess  = 0
+	RCodeServFail = 2
+	RCodeNXDomain = 3
+	RCodeRefused  = 5
+)
+
+// RR is a decoded resource record.
+type RR struct {
+	Name  string
+	Type  uint16
+	TTL   uint32
+	Value string // IP for A/AAAA, joined strings for TXT, target name for NS/CNAME
+}
+
+// Response is a decoded DNS response.
+type Response struct {
+	ID        uint16
+	RCode     int
+	Truncated bool
+	Answers   []RR
+	Authority []RR
+}
+
+// Values returns the values of all answers of the given type.
+func (r *Response) Values(qtype uint16) []string {
+	var out []string
+	for _, rr := range r.Answers {
+		if rr.Type == qtype {
+			out = append(out, rr.Value)
+		}
+	}
+	return out
+}
+
+// RCodeName returns a human-readable name for a response code.
+func RCodeName(rcode int) string {
+	switch rcode {
+	case RCodeSuccess:
+		return "NOERROR"
+	case 1:
+		return "FORMERR"
+	case RCodeServFail:
+		return "SERVFAIL"
+	case RCodeNXDomain:
+		return "NXDOMAIN"
+	case 4:
+		return "NOTIMP"
+	case RCodeRefused:
+		return "REFUSED"
+	default:
+		return fmt.Sprintf("RCODE%d", rcode)
+	}
+}
+
+// BuildQuery builds a recursive DNS query for name and qtype.
+func BuildQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // RD
+	binary.BigEndian.PutUint16(msg[4:], 1)      // QDCOUNT
+
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid DNS name %q", name)
+			}
+			msg = append(msg, byte(len(label)))
+			msg = append(msg, label...)
+		}
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // IN
+	return msg, nil
+}
+
+// ParseResponse decodes a DNS response and checks that it matches the query ID.
+func ParseResponse(msg []byte, id uint16) (*Response, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("short DNS response")
+	}
+	resp := &Response{
+		ID:        binary.BigEndian.Uint16(msg[0:]),
+		RCode:     int(msg[3] & 0x0f),
+		Truncated: msg[2]&0x02 != 0,
+	}
+	if resp.ID != id {
+		return nil, fmt.Errorf("DNS response ID mismatch")
+	}
+	if msg[2]&0x80 == 0 {
+		return nil, errors.New("DNS message is not a response")
+	}
+
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	an := int(binary.BigEndian.Uint16(msg[6:]))
+	ns := int(binary.BigEndian.Uint16(msg[8:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		_, n, err := readName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n + 4
+	}
+
+	var err error
+	if resp.Answers, off, err = readRRs(msg, off, an); err != nil {
+		return nil, err
+	}
+	if resp.Authority, _, err = readRRs(msg, off, ns); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func readRRs(msg []byte, off, count int) ([]RR, int, error) {
+	var rrs []RR
+	for i := 0; i < count; i++ {
+		name, n, err := readName(msg, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		off = n
+		if off+10 > len(msg) {
+			return nil, 0, errors.New("truncated resource record")
+		}
+		rr := RR{
+			Name: name,
+			Type: binary.BigEndian.Uint16(msg[off:]),
+			TTL:  binary.BigEndian.Uint32(msg[off+4:]),
+		}
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, 0, errors.New("truncated resource data")
+		}
+		rdata := msg[off : off+rdlen]
+
+		switch rr.Type {
+		case TypeA, TypeAAAA:
+			rr.Value = net.IP(rdata).String()
+		case TypeTXT:
+			var parts []string
+			for j := 0; j < len(rdata); {
+				l := int(rdata[j])
+				if j+1+l > len(rdata) {
+					break
+				}
+				parts = append(parts, string(rdata[j+1:j+1+l]))
+				j += 1 + l
+			}
+			rr.Value = strings.Join(parts, "")
+		case TypeNS, 5: // NS, CNAME
+			if target, _, err := readName(msg, off); err == nil {
+				rr.Value = target
+			}
+		}
+		rrs = append(rrs, rr)
+		off += rdlen
+	}
+	return rrs, off, nil
+}
+
+// readName decodes a possibly-compressed name at off and returns the offset after it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("truncated DNS name")
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("truncated DNS name pointer")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			jumps++
+			if jumps > 16 {
+				return "", 0, errors.New("DNS name compression loop")
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, errors.New("truncated DNS label")
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
+
+// QueryUDP sends a DNS query over UDP to server ("host:port") and returns the response and RTT.
+func QueryUDP(ctx context.Context, server, name string, qtype uint16) (*Response, time.Duration, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	id := uint16(rand.IntN(0x10000))
+	query, err := BuildQuery(id, name, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+	if _, err := conn.Write(query); err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := ParseResponse(buf[:n], id)
+		if err != nil {
+			continue // ignore stray or malformed packets
+		}
+		return resp, time.Since(start), nil
+	}
+}
+
+// QueryConn sends a DNS query over an established stream connection (DNS over TCP framing).
+func QueryConn(conn net.Conn, name string, qtype uint16) (*Response, error) {
+	id := uint16(rand.IntN(0x10000))
+	query, err := BuildQuery(id, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(frame, query...)); err != nil {
+		return nil, err
+	}
+
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return ParseResponse(buf, id)
+}
@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ResolverResult is the outcome of probing one resolver.
+type ResolverResult struct {
+	Server string
+	RTT    time.Duration
+	Err    error
+}
+
+// ProbeResolver checks that server forwards queries for names under domain,
+// by asking for a random (uncached) subdomain. Any answer from the tunnel's
+// authoritative server counts, including NXDOMAIN; SERVFAIL and REFUSED mean
+// the resolver can't or won't reach it.
+func ProbeResolver(ctx context.Context, server, domain string) (time.Duration, error) {
+	name := fmt.Sprintf("probe-%08x.%s", rand.Uint32(), domain)
+	resp, rtt, err := QueryUDP(ctx, server, name, TypeTXT)
+	if err != nil {
+		return 0, err
+	}
+	if resp.RCode == RCodeServFail || resp.RCode == RCodeRefused {
+		return 0, fmt.Errorf("resolver returned %s", RCodeName(resp.RCode))
+	}
+	return rtt, nil
+}
+
+// ProbeResolvers probes all servers in parallel, each bounded by timeout.
+// Results are returned in the order of servers.
+func ProbeResolvers(servers []string, domain string, timeout time.Duration) []ResolverResult {
+	results := make([]ResolverResult, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			rtt, err := ProbeResolver(ctx, server, domain)
+			results[i] = ResolverResult{Server: server, RTT: rtt, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
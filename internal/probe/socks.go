@@ -0,0 +1,122 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// socksReplyMessages maps SOCKS5 reply codes to messages.
+var socksReplyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// DialSOCKS5 connects to target ("host:port") through the SOCKS5 proxy at proxyAddr.
+// The context deadline bounds the whole handshake.
+func DialSOCKS5(ctx context.Context, proxyAddr, target string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := socks5Connect(conn, host, port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func socks5Connect(conn net.Conn, host string, port int) error {
+	// Greeting: no authentication
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return fmt.Errorf("socks greeting: %w", err)
+	}
+	var greet [2]byte
+	if _, err := io.ReadFull(conn, greet[:]); err != nil {
+		return fmt.Errorf("socks greeting: %w", err)
+	}
+	if greet[0] != 0x05 || greet[1] != 0x00 {
+		return fmt.Errorf("socks server rejected authentication method")
+	}
+
+	// CONNECT request
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, 0x01)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, 0x04)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("hostname too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks connect: %w", err)
+	}
+
+	// Reply: VER REP RSV ATYP BND.ADDR BND.PORT
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return fmt.Errorf("socks reply: %w", err)
+	}
+	if hdr[1] != 0x00 {
+		msg, ok := socksReplyMessages[hdr[1]]
+		if !ok {
+			msg = fmt.Sprintf("reply code %d", hdr[1])
+		}
+		return fmt.Errorf("socks connect failed: %s", msg)
+	}
+
+	var skip int
+	switch hdr[3] {
+	case 0x01:
+		skip = 4
+	case 0x04:
+		skip = 16
+	case 0x03:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return fmt.Errorf("socks reply: %w", err)
+		}
+		skip = int(l[0])
+	default:
+		return fmt.Errorf("socks reply: unknown address type %d", hdr[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return fmt.Errorf("socks reply: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupFS is where the cgroup v2 hierarchy is mounted.
+const cgroupFS = "/sys/fs/cgroup"
+
+// cpuPeriod is the cpu.max period, in microseconds.
+const cpuPeriod = 100000
+
+var (
+	cgroupMu   sync.Mutex
+	cgroupDone bool   // set once delegatedCgroup has looked
+	cgroupBase string // parent of the processes' cgroups, "" if not delegated
+	cgroupErr  error
+)
+
+// startLimited starts the command built by newCmd with the resource limits
+// in opts.
+//
+// Nice level and CPU affinity are set on the thread that forks the process,
+// so the process and every thread and child it creates inherit them from the
+// start. The CPU quota and memory limit use a cgroup v2 group of the process's
+// own, which it is created in, when the daemon's cgroup is delegated to it
+// (Delegate= in the systemd unit). Without one, the memory limit falls back
+// to RLIMIT_DATA, set right after the process starts, and a CPU quota is an
+// error.
+func startLimited(newCmd func() *exec.Cmd, name string, opts Options) (*exec.Cmd, error) {
+	cg, err := limitCgroup(name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := newCmd()
+	if cg != nil {
+		defer cg.Close()
+		cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: int(cg.Fd())}
+	}
+	err = startOnLimitedThread(cmd, opts)
+	if cg != nil && errors.Is(err, unix.ENOSYS) {
+		// clone3 needs Linux 5.7; move the process right after it starts
+		cmd = newCmd()
+		if err = startOnLimitedThread(cmd, opts); err == nil {
+			err = os.WriteFile(filepath.Join(cg.Name(), "cgroup.procs"), []byte(strconv.Itoa(cmd.Process.Pid)), 0)
+			if err != nil {
+				err = fmt.Errorf("cgroup: %w", err)
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	} else if cg == nil && opts.MemoryLimit > 0 {
+		lim := &unix.Rlimit{Cur: opts.MemoryLimit, Max: opts.MemoryLimit}
+		if err = unix.Prlimit(cmd.Process.Pid, unix.RLIMIT_DATA, lim, nil); err != nil {
+			err = fmt.Errorf("memory limit: %w", err)
+		}
+	}
+	if err != nil {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// startOnLimitedThread starts cmd from a thread with the nice level and CPU
+// affinity in opts. The thread is locked to a goroutine that exits without
+// unlocking it, so it ends instead of running other goroutines with them.
+func startOnLimitedThread(cmd *exec.Cmd, opts Options) error {
+	if opts.Nice == 0 && len(opts.CPUs) == 0 {
+		return cmd.Start()
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		tid := unix.Gettid()
+		if opts.Nice != 0 {
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, opts.Nice); err != nil {
+				errc <- fmt.Errorf("nice: %w", err)
+				return
+			}
+		}
+		if len(opts.CPUs) > 0 {
+			var set unix.CPUSet
+			for _, cpu := range opts.CPUs {
+				set.Set(cpu)
+			}
+			if err := unix.SchedSetaffinity(tid, &set); err != nil {
+				errc <- fmt.Errorf("cpu affinity: %w", err)
+				return
+			}
+		}
+		errc <- cmd.Start()
+	}()
+	return <-errc
+}
+
+// limitCgroup returns the cgroup directory, opened, that the process name is
+// started in, with its memory.max and cpu.max set. It returns nil if opts
+// needs no cgroup or, for a memory limit alone, if none is available.
+func limitCgroup(name string, opts Options) (*os.File, error) {
+	if opts.CPUQuota == 0 && opts.MemoryLimit == 0 {
+		return nil, nil
+	}
+	base, err := delegatedCgroup()
+	if err != nil {
+		if opts.CPUQuota > 0 {
+			return nil, fmt.Errorf("a CPU quota needs a delegated cgroup v2 hierarchy: %w", err)
+		}
+		return nil, nil
+	}
+
+	dir := filepath.Join(base, name)
+	if err := os.Mkdir(dir, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("cgroup: %w", err)
+	}
+	memMax, cpuMax := "max", "max"
+	if opts.MemoryLimit > 0 {
+		memMax = strconv.FormatUint(opts.MemoryLimit, 10)
+	}
+	if opts.CPUQuota > 0 {
+		cpuMax = strconv.Itoa(opts.CPUQuota * cpuPeriod / 100)
+	}
+	for file, value := range map[string]string{
+		"memory.max": memMax,
+		"cpu.max":    cpuMax + " " + strconv.Itoa(cpuPeriod),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0); err != nil {
+			return nil, fmt.Errorf("cgroup %s: %w", file, err)
+		}
+	}
+	return os.Open(dir)
+}
+
+// delegatedCgroup returns the cgroup the tunnels' cgroups are created in:
+// the daemon's own, if it may manage it. cgroup v2 only lets controllers be
+// enabled for a group's children while the group holds no processes, so the
+// daemon first moves itself into a "daemon" child group.
+func delegatedCgroup() (string, error) {
+	cgroupMu.Lock()
+	defer cgroupMu.Unlock()
+	if !cgroupDone {
+		cgroupDone = true
+		cgroupBase, cgroupErr = delegateCgroup()
+	}
+	return cgroupBase, cgroupErr
+}
+
+func delegateCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	path, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "0::")
+	if !ok || strings.Contains(path, "\n") {
+		return "", errors.New("not a cgroup v2 hierarchy")
+	}
+	if path == "/" {
+		return "", errors.New("running in the root cgroup")
+	}
+	dir := filepath.Join(cgroupFS, path)
+	if filepath.Base(dir) == "daemon" {
+		dir = filepath.Dir(dir) // moved there by a previous daemon
+	}
+	// systemd marks delegated cgroups; root could write to any of them
+	_, errTrusted := unix.Getxattr(dir, "trusted.delegate", nil)
+	_, errUser := unix.Getxattr(dir, "user.delegate", nil)
+	if errTrusted != nil && errUser != nil {
+		return "", fmt.Errorf("%s is not delegated", dir)
+	}
+	if err := unix.Access(filepath.Join(dir, "cgroup.subtree_control"), unix.W_OK); err != nil {
+		return "", fmt.Errorf("%s is not writable", dir)
+	}
+
+	leaf := filepath.Join(dir, "daemon")
+	if err := os.Mkdir(leaf, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+memory +cpu"), 0); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// releaseLimits removes the cgroup of an exited process, if it had one.
+func releaseLimits(name string) {
+	cgroupMu.Lock()
+	base := cgroupBase
+	cgroupMu.Unlock()
+	if base != "" {
+		os.Remove(filepath.Join(base, name))
+	}
+}
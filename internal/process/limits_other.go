@@ -0,0 +1,24 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// startLimited starts the command built by newCmd. Resource limits are only
+// supported on Linux.
+func startLimited(newCmd func() *exec.Cmd, name string, opts Options) (*exec.Cmd, error) {
+	if opts.Nice != 0 || len(opts.CPUs) > 0 || opts.MemoryLimit > 0 || opts.CPUQuota > 0 {
+		return nil, fmt.Errorf("resource limits are only supported on Linux")
+	}
+	cmd := newCmd()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// releaseLimits releases the resources held for the limits of an exited process.
+func releaseLimits(name string) {}
@@ -7,10 +7,15 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/net2share/dnstc/internal/crash"
 )
 
 // ProcessInfo holds information about a managed process.
@@ -20,13 +25,29 @@ type ProcessInfo struct {
 	Binary  string    `json:"binary"`
 	Args    []string  `json:"args"`
 	Started time.Time `json:"started"`
+	LogPath string    `json:"log_path,omitempty"`
 }
 
+// reconcileInterval is how often adopted processes (which we can't Wait on)
+// are checked for liveness.
+const reconcileInterval = 5 * time.Second
+
+// LivenessFunc is called when a managed process exits on its own, i.e. not
+// through Stop or StopAll. It is called without the manager lock held.
+type LivenessFunc func(name string, running bool)
+
 // Manager handles process lifecycle.
+//
+// Liveness is event-driven: processes started by the manager are tracked by a
+// monitor goroutine that Waits on them. Processes adopted from the state file
+// are checked periodically instead.
 type Manager struct {
 	statePath string
 	processes map[string]*ProcessInfo
 	cmds      map[string]*exec.Cmd
+	startups  map[string]*startup
+	exitErrs  map[string]string
+	onChange  LivenessFunc
 	mu        sync.RWMutex
 }
 
@@ -36,13 +57,51 @@ func NewManager(statePath string) *Manager {
 		statePath: statePath,
 		processes: make(map[string]*ProcessInfo),
 		cmds:      make(map[string]*exec.Cmd),
+		startups:  make(map[string]*startup),
+		exitErrs:  make(map[string]string),
 	}
 	m.loadState()
+	if len(m.processes) > 0 {
+		for name, info := range m.processes {
+			crash.Go("process watcher", func() { m.watchAdopted(name, info.PID) })
+		}
+		crash.Go("process reconciler", m.reconcileLoop)
+	}
 	return m
 }
 
+// SetLivenessCallback registers fn to be called when a process exits on its own.
+func (m *Manager) SetLivenessCallback(fn LivenessFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+// Options configures how a process is started.
+type Options struct {
+	// Env holds KEY=VALUE pairs added to the inherited environment.
+	Env []string
+	// Nice is the scheduling priority, from -20 (highest) to 19 (lowest).
+	Nice int
+	// CPUs pins the process to these CPUs.
+	CPUs []int
+	// MemoryLimit caps the process's memory in bytes: its cgroup's memory.max
+	// where cgroups are delegated, else its data segment.
+	MemoryLimit uint64
+	// CPUQuota caps the process's CPU time in percent of one CPU. It needs a
+	// delegated cgroup v2 hierarchy.
+	CPUQuota int
+	// LogPath receives the process's stdout and stderr. A file rather than a
+	// pipe, so the process survives the manager exiting.
+	LogPath string
+	// ReadyAddr is polled until it accepts TCP connections.
+	ReadyAddr string
+	// ReadyPattern matches the output line printed once the process is ready.
+	ReadyPattern *regexp.Regexp
+}
+
 // Start starts a process with the given name and command.
-func (m *Manager) Start(name, binary string, args []string) error {
+func (m *Manager) Start(name, binary string, args []string, opts Options) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -50,11 +109,36 @@ func (m *Manager) Start(name, binary string, args []string) error {
 		return fmt.Errorf("process %s is already running", name)
 	}
 
-	cmd := exec.Command(binary, args...)
-	cmd.Stdout = nil
-	cmd.Stderr = nil
+	var stdout *os.File
+	newCmd := func() *exec.Cmd {
+		cmd := exec.Command(binary, args...)
+		if stdout != nil {
+			cmd.Stdout = stdout
+			cmd.Stderr = stdout
+		}
+		if len(opts.Env) > 0 {
+			cmd.Env = append(os.Environ(), opts.Env...)
+		}
+		return cmd
+	}
+
+	s := &startup{
+		logPath: opts.LogPath,
+		ready:   make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	if opts.LogPath != "" {
+		logFile, offset, err := openLog(opts.LogPath)
+		if err != nil {
+			return fmt.Errorf("failed to open log for %s: %w", name, err)
+		}
+		defer logFile.Close()
+		stdout = logFile
+		s.offset = offset
+	}
 
-	if err := cmd.Start(); err != nil {
+	cmd, err := startLimited(newCmd, name, opts)
+	if err != nil {
 		return fmt.Errorf("failed to start %s: %w", name, err)
 	}
 
@@ -64,12 +148,16 @@ func (m *Manager) Start(name, binary string, args []string) error {
 		Binary:  binary,
 		Args:    args,
 		Started: time.Now(),
+		LogPath: opts.LogPath,
 	}
 
 	m.processes[name] = info
 	m.cmds[name] = cmd
+	m.startups[name] = s
+	delete(m.exitErrs, name)
 
-	go m.monitor(name, cmd)
+	crash.Go("process monitor", func() { m.monitor(name, cmd, s) })
+	crash.Go("readiness check", func() { watchReady(s, opts) })
 
 	return m.saveState()
 }
@@ -92,6 +180,7 @@ func (m *Manager) stopLocked(name string) error {
 	if err != nil {
 		delete(m.processes, name)
 		delete(m.cmds, name)
+		delete(m.startups, name)
 		return m.saveState()
 	}
 
@@ -116,6 +205,7 @@ func (m *Manager) stopLocked(name string) error {
 
 	delete(m.processes, name)
 	delete(m.cmds, name)
+	delete(m.startups, name)
 	return m.saveState()
 }
 
@@ -141,23 +231,65 @@ func (m *Manager) IsRunning(name string) bool {
 	return m.isRunningLocked(name)
 }
 
+// isRunningLocked reports whether a process is tracked. Exited processes are
+// removed by their monitor goroutine or by reconciliation, so no syscall is needed.
 func (m *Manager) isRunningLocked(name string) bool {
-	info, ok := m.processes[name]
+	_, ok := m.processes[name]
+	return ok
+}
+
+// IsReady reports whether a process is running and has signalled readiness.
+// Adopted processes are assumed ready.
+func (m *Manager) IsReady(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.isRunningLocked(name) {
+		return false
+	}
+	s, ok := m.startups[name]
 	if !ok {
+		return true
+	}
+	select {
+	case <-s.ready:
+		return true
+	default:
 		return false
 	}
+}
 
-	process, err := os.FindProcess(info.PID)
-	if err != nil {
-		return false
+// WaitReady waits up to timeout for a process to become ready. It returns
+// ErrNotReady if the process is still starting, or an error including the
+// tail of its log if it exited.
+func (m *Manager) WaitReady(name string, timeout time.Duration) error {
+	m.mu.RLock()
+	s, ok := m.startups[name]
+	running := m.isRunningLocked(name)
+	m.mu.RUnlock()
+	if !ok {
+		if running {
+			return nil
+		}
+		return fmt.Errorf("process %s is not running", name)
 	}
 
-	if runtime.GOOS != "windows" {
-		err = process.Signal(syscall.Signal(0))
-		return err == nil
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-s.exited:
+		return s.exitErr
+	case <-s.ready:
+		return nil
+	case <-timer.C:
+		return ErrNotReady
 	}
+}
 
-	return true
+// ExitError returns why a process last exited on its own, or "" if it didn't.
+func (m *Manager) ExitError(name string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.exitErrs[name]
 }
 
 // GetStatus returns status of all processes.
@@ -172,6 +304,104 @@ func (m *Manager) GetStatus() map[string]bool {
 	return status
 }
 
+// Adopted returns the processes loaded from the state file that are still alive
+// but were not started by this manager (e.g. left by a previous daemon).
+func (m *Manager) Adopted() []ProcessInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []ProcessInfo
+	for name, info := range m.processes {
+		if _, ok := m.cmds[name]; !ok {
+			out = append(out, *info)
+		}
+	}
+	return out
+}
+
+// Orphans returns the processes recorded in the state file at statePath that
+// are still alive, sorted by name, without adopting them. With no daemon
+// running these were left behind by one that exited uncleanly. On Linux a
+// reused PID is not counted.
+func Orphans(statePath string) ([]ProcessInfo, error) {
+	m := &Manager{statePath: statePath, processes: make(map[string]*ProcessInfo)}
+	if err := m.loadState(); err != nil {
+		return nil, err
+	}
+	var out []ProcessInfo
+	for _, info := range m.processes {
+		if runtime.GOOS == "linux" && !MatchesCommand(*info) {
+			continue
+		}
+		out = append(out, *info)
+	}
+	slices.SortFunc(out, func(a, b ProcessInfo) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+// StopOrphans stops the processes Orphans returns and removes the state file
+// at statePath, dropping the entries of processes that have since exited.
+// It must only be called while no daemon is running.
+func StopOrphans(statePath string) ([]ProcessInfo, error) {
+	orphans, err := Orphans(statePath)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{statePath: statePath, processes: make(map[string]*ProcessInfo)}
+	for i := range orphans {
+		m.processes[orphans[i].Name] = &orphans[i]
+	}
+	if err := m.StopAll(); err != nil {
+		return orphans, err
+	}
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return orphans, err
+	}
+	return orphans, nil
+}
+
+// StaleEntries returns the processes recorded in the state file at statePath
+// that are no longer running.
+func StaleEntries(statePath string) ([]ProcessInfo, error) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var state struct {
+		Processes []*ProcessInfo `json:"processes"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	var out []ProcessInfo
+	for _, info := range state.Processes {
+		if !pidAlive(info.PID) || (runtime.GOOS == "linux" && !MatchesCommand(*info)) {
+			out = append(out, *info)
+		}
+	}
+	return out, nil
+}
+
+// MatchesCommand reports whether the live process with info.PID is still
+// running info.Binary with info.Args, guarding against PID reuse.
+// Only supported on Linux; elsewhere it returns false.
+func MatchesCommand(info ProcessInfo) bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", info.PID))
+	if err != nil {
+		return false
+	}
+	argv := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+	want := append([]string{info.Binary}, info.Args...)
+	// Scripts show up with their interpreter prepended
+	return len(argv) >= len(want) && slices.Equal(argv[len(argv)-len(want):], want)
+}
+
 // GetProcessInfo returns info about a specific process.
 func (m *Manager) GetProcessInfo(name string) *ProcessInfo {
 	m.mu.RLock()
@@ -184,15 +414,113 @@ func (m *Manager) GetProcessInfo(name string) *ProcessInfo {
 	return nil
 }
 
-func (m *Manager) monitor(name string, cmd *exec.Cmd) {
-	cmd.Wait()
+func (m *Manager) monitor(name string, cmd *exec.Cmd, s *startup) {
+	s.exitErr = s.exitError(cmd.Wait())
+	close(s.exited)
+	releaseLimits(name)
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
+	// Stop already removed it, or it was restarted under the same name
+	if m.cmds[name] != cmd {
+		m.mu.Unlock()
+		return
+	}
 	delete(m.processes, name)
 	delete(m.cmds, name)
+	delete(m.startups, name)
+	m.exitErrs[name] = s.exitErr.Error()
+	m.saveState()
+	onChange := m.onChange
+	m.mu.Unlock()
+
+	if onChange != nil {
+		onChange(name, false)
+	}
+}
+
+// watchAdopted waits on an adopted process. This only succeeds if it is our
+// child, which is the case after the daemon re-execs itself during an upgrade;
+// it also reaps the process so it doesn't linger as a zombie. Other adopted
+// processes are left to reconcileLoop.
+func (m *Manager) watchAdopted(name string, pid int) {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return
+	}
+	if _, err := process.Wait(); err != nil {
+		return // not our child
+	}
+
+	m.mu.Lock()
+	info, ok := m.processes[name]
+	if !ok || info.PID != pid || m.cmds[name] != nil {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.processes, name)
 	m.saveState()
+	onChange := m.onChange
+	m.mu.Unlock()
+
+	if onChange != nil {
+		onChange(name, false)
+	}
+}
+
+// reconcileLoop periodically checks adopted processes, which have no monitor
+// goroutine, and exits once none are left.
+func (m *Manager) reconcileLoop() {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !m.reconcile() {
+			return
+		}
+	}
+}
+
+// reconcile removes adopted processes that are no longer alive.
+// Returns false when there are no adopted processes left to watch.
+func (m *Manager) reconcile() bool {
+	m.mu.Lock()
+	var exited []string
+	adopted := 0
+	for name, info := range m.processes {
+		if _, ok := m.cmds[name]; ok {
+			continue
+		}
+		if pidAlive(info.PID) {
+			adopted++
+			continue
+		}
+		delete(m.processes, name)
+		exited = append(exited, name)
+	}
+	if len(exited) > 0 {
+		m.saveState()
+	}
+	onChange := m.onChange
+	m.mu.Unlock()
+
+	if onChange != nil {
+		for _, name := range exited {
+			onChange(name, false)
+		}
+	}
+	return adopted > 0
+}
+
+// pidAlive checks whether a process with the given PID exists.
+func pidAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS != "windows" {
+		return process.Signal(syscall.Signal(0)) == nil
+	}
+	return true
 }
 
 func (m *Manager) loadState() error {
@@ -213,17 +541,9 @@ func (m *Manager) loadState() error {
 	}
 
 	for _, info := range state.Processes {
-		process, err := os.FindProcess(info.PID)
-		if err != nil {
+		if !pidAlive(info.PID) {
 			continue
 		}
-
-		if runtime.GOOS != "windows" {
-			if err := process.Signal(syscall.Signal(0)); err != nil {
-				continue
-			}
-		}
-
 		m.processes[info.Name] = info
 	}
 
@@ -0,0 +1,147 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// readyPollInterval is how often a starting process's log and address are checked.
+	readyPollInterval = 100 * time.Millisecond
+	// readyWatchLimit stops the readiness watcher for processes that never
+	// become ready; they are reported as starting until they exit.
+	readyWatchLimit = 5 * time.Minute
+	// tailBytes is how much of the log is read to report why a process exited.
+	tailBytes = 4096
+	// tailLines is the number of log lines included in an exit error.
+	tailLines = 5
+)
+
+// ErrNotReady is returned by WaitReady when a process is still starting.
+var ErrNotReady = errors.New("not ready yet")
+
+// startup tracks a process from Start until it becomes ready or exits.
+type startup struct {
+	logPath string
+	offset  int64         // log size before the process started
+	ready   chan struct{} // closed once ready
+	exited  chan struct{} // closed once the process exited
+	exitErr error         // set before exited is closed
+}
+
+// openLog opens the process log for appending and returns it with its current size.
+func openLog(path string) (*os.File, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// watchReady marks s ready once opts.ReadyAddr accepts connections or the
+// process prints a line matching opts.ReadyPattern.
+func watchReady(s *startup, opts Options) {
+	if opts.ReadyAddr == "" && opts.ReadyPattern == nil {
+		close(s.ready)
+		return
+	}
+
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	limit := time.After(readyWatchLimit)
+	for {
+		select {
+		case <-s.exited:
+			return
+		case <-limit:
+			return
+		case <-ticker.C:
+		}
+
+		if opts.ReadyPattern != nil && s.logPath != "" {
+			if out, err := readFrom(s.logPath, s.offset, 0); err == nil && opts.ReadyPattern.MatchString(out) {
+				close(s.ready)
+				return
+			}
+		}
+		if opts.ReadyAddr != "" {
+			if conn, err := net.DialTimeout("tcp", opts.ReadyAddr, readyPollInterval); err == nil {
+				conn.Close()
+				close(s.ready)
+				return
+			}
+		}
+	}
+}
+
+// exitError describes why a process exited, including the tail of its log.
+func (s *startup) exitError(waitErr error) error {
+	reason := "exited"
+	if waitErr != nil {
+		reason = waitErr.Error()
+	}
+	if s.logPath == "" {
+		return errors.New(reason)
+	}
+	out, err := readFrom(s.logPath, s.offset, tailBytes)
+	if err != nil {
+		return errors.New(reason)
+	}
+	if tail := lastLines(out, tailLines); tail != "" {
+		return fmt.Errorf("%s: %s", reason, tail)
+	}
+	return errors.New(reason)
+}
+
+// readFrom reads the log from offset. If limit > 0, only the last limit bytes are read.
+func readFrom(path string, offset, limit int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() < offset {
+		offset = 0 // truncated since
+	}
+	if limit > 0 && fi.Size()-offset > limit {
+		offset = fi.Size() - limit
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(f)
+	return string(data), err
+}
+
+// lastLines returns the last n non-empty lines of s joined with "; ".
+func lastLines(s string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,83 @@
+package process
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Rotation reports what RotateLogs did.
+type Rotation struct {
+	Files int   `json:"files"` // logs truncated
+	Freed int64 `json:"freed"` // bytes freed, less what was kept
+}
+
+// RotateLogs truncates every *.log file in dir in place. Processes write
+// their logs opened for appending, so they carry on at the new end without
+// being restarted. With keep, each log's old content is first copied to
+// <name>.log.1, replacing the previous copy; without it, previous copies
+// are removed as well.
+func RotateLogs(dir string, keep bool) (Rotation, error) {
+	var r Rotation
+	logs, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return r, err
+	}
+	var errs []error
+	for _, path := range logs {
+		n, err := rotateLog(path, keep)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.Files++
+		r.Freed += n
+	}
+	return r, errors.Join(errs...)
+}
+
+// rotateLog truncates one log, returning the bytes freed.
+func rotateLog(path string, keep bool) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	freed := info.Size()
+	old := path + ".1"
+	if prev, err := os.Stat(old); err == nil {
+		freed += prev.Size()
+	}
+
+	if keep {
+		if err := copyFile(path, old); err != nil {
+			return 0, err
+		}
+		// the copy takes up what the log did
+		freed -= info.Size()
+	} else if err := os.Remove(old); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if err := os.Truncate(path, 0); err != nil {
+		return 0, err
+	}
+	return freed, nil
+}
+
+// copyFile copies src to dst, replacing it.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
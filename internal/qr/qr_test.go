@@ -0,0 +1,451 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// The expected values below are from ISO/IEC 18004: the Reed-Solomon example
+// of Annex I, the format information table (Annex C) and the version
+// information table (Annex D).
+
+func TestRSRemainder(t *testing.T) {
+	// "01234567" as a 1-M symbol
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	if got := rsRemainder(data, rsDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = % X, want % X", got, want)
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	want := map[level][8]string{
+		levelL: {
+			"111011111000100", "111001011110011", "111110110101010", "111100010011101",
+			"110011000101111", "110001100011000", "110110001000001", "110100101110110",
+		},
+		levelM: {
+			"101010000010010", "101000100100101", "101111001111100", "101101101001011",
+			"100010111111001", "100000011001110", "100111110010111", "100101010100000",
+		},
+	}
+	for lvl, masks := range want {
+		for mask, s := range masks {
+			c := blankCode(1, lvl)
+			c.drawFormatBits(mask)
+			first, second := readFormat(c)
+			if first != second {
+				t.Errorf("level %d mask %d: copies differ: %015b, %015b", lvl, mask, first, second)
+			}
+			if got := fmt.Sprintf("%015b", first); got != s {
+				t.Errorf("level %d mask %d: format = %s, want %s", lvl, mask, got, s)
+			}
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	want := map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3, 20: 0x149A6, 40: 0x28C69}
+	for ver, bits := range want {
+		c := blankCode(ver, levelM)
+		c.drawVersion()
+		var below, right int
+		for i := range 18 {
+			a, b := c.Size-11+i%3, i/3
+			if c.modules[b][a] {
+				below |= 1 << i
+			}
+			if c.modules[a][b] {
+				right |= 1 << i
+			}
+		}
+		if below != bits || right != bits {
+			t.Errorf("version %d: version info = %#x, %#x; want %#x", ver, below, right, bits)
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	want := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for ver, pos := range want {
+		if got := alignmentPositions(ver); !slices.Equal(got, pos) {
+			t.Errorf("alignmentPositions(%d) = %v, want %v", ver, got, pos)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	tests := []struct {
+		ver   int
+		lvl   level
+		total int // data and ECC codewords
+		data  int
+	}{
+		{1, levelL, 26, 19},
+		{1, levelM, 26, 16},
+		{7, levelL, 196, 156},
+		{7, levelM, 196, 124},
+		{10, levelM, 346, 216},
+		{40, levelL, 3706, 2956},
+		{40, levelM, 3706, 2334},
+	}
+	for _, tt := range tests {
+		if got := numRawDataModules(tt.ver) / 8; got != tt.total {
+			t.Errorf("version %d: %d codewords, want %d", tt.ver, got, tt.total)
+		}
+		if got := numDataCodewords(tt.ver, tt.lvl); got != tt.data {
+			t.Errorf("version %d level %d: %d data codewords, want %d", tt.ver, tt.lvl, got, tt.data)
+		}
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		n   int
+		ver int
+		lvl level
+	}{
+		{0, 1, levelM},
+		{14, 1, levelM},
+		{15, 2, levelM},
+		{2331, 40, levelM},
+		{2332, 36, levelL}, // 35-L holds 2303 bytes, 36-L 2409
+		{2953, 40, levelL},
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte{'a'}, tt.n))
+		if err != nil {
+			t.Errorf("%d bytes: %v", tt.n, err)
+			continue
+		}
+		if c.version != tt.ver || c.level != tt.lvl || c.Size != tt.ver*4+17 {
+			t.Errorf("%d bytes: version %d level %d size %d; want version %d level %d",
+				tt.n, c.version, c.level, c.Size, tt.ver, tt.lvl)
+		}
+	}
+	if _, err := Encode(make([]byte, 2954)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("2954 bytes: err = %v, want ErrTooLong", err)
+	}
+}
+
+// TestEncodeDecode reads encoded symbols back with a decoder written from the
+// specification, checking the function patterns, masking, interleaving and
+// error correction of every block.
+func TestEncodeDecode(t *testing.T) {
+	payloads := [][]byte{
+		[]byte("x"),
+		[]byte("dnstm://"),
+		bytes.Repeat([]byte{0x00, 0xff}, 30),
+		[]byte("dnstm://eyJ2IjoyLCJ0YWciOiJ0dW5uZWwiLCJ0cmFuc3BvcnQiOnsidHlwZSI6InNsaXBzdHJlYW0ifX0"),
+	}
+	for _, n := range []int{150, 300, 700, 1200, 2000, 2953} {
+		p := make([]byte, n)
+		for i := range p {
+			p[i] = byte(i*7 + n)
+		}
+		payloads = append(payloads, p)
+	}
+
+	for _, data := range payloads {
+		t.Run(strconv.Itoa(len(data)), func(t *testing.T) {
+			c, err := Encode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decode(c)
+			if err != nil {
+				t.Fatalf("version %d level %d: %v", c.version, c.level, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("version %d level %d: decoded %d bytes that differ from the %d encoded",
+					c.version, c.level, len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	c, err := Encode([]byte("dnstm://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix([]byte(c.String()), []byte("\n")), []byte("\n"))
+	if want := (c.Size + 4 + 1) / 2; len(lines) != want {
+		t.Errorf("%d lines, want %d", len(lines), want)
+	}
+	for i, line := range lines {
+		if n := len([]rune(string(line))); n != c.Size+4 {
+			t.Errorf("line %d is %d characters, want %d", i, n, c.Size+4)
+		}
+	}
+}
+
+// blankCode returns an empty symbol to draw individual patterns on.
+func blankCode(ver int, lvl level) *Code {
+	size := ver*4 + 17
+	c := &Code{Size: size, version: ver, level: lvl}
+	c.modules = make([][]bool, size)
+	c.fixed = make([][]bool, size)
+	for i := range size {
+		c.modules[i] = make([]bool, size)
+		c.fixed[i] = make([]bool, size)
+	}
+	return c
+}
+
+// readFormat returns both copies of the format information. Bit 0 is next to
+// the top-left finder's corner in the first copy and at the right edge in the
+// second.
+func readFormat(c *Code) (first, second int) {
+	// First copy: down column 8 then left along row 8, around the top-left
+	// finder, skipping the timing patterns.
+	var coords [][2]int
+	for y := 0; y <= 8; y++ {
+		if y != 6 {
+			coords = append(coords, [2]int{8, y})
+		}
+	}
+	for x := 7; x >= 0; x-- {
+		if x != 6 {
+			coords = append(coords, [2]int{x, 8})
+		}
+	}
+	for i, p := range coords {
+		if c.modules[p[1]][p[0]] {
+			first |= 1 << i
+		}
+	}
+
+	// Second copy: right to left along row 8 under the top-right finder,
+	// then down column 8 beside the bottom-left one.
+	for i := range 8 {
+		if c.modules[8][c.Size-1-i] {
+			second |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if c.modules[c.Size-15+i][8] {
+			second |= 1 << i
+		}
+	}
+	return first, second
+}
+
+// isFunction reports whether (x, y) belongs to a function pattern or the
+// format and version information of a symbol.
+func isFunction(ver, x, y int) bool {
+	size := ver*4 + 17
+	switch {
+	case x <= 8 && y <= 8, x >= size-8 && y <= 8, x <= 8 && y >= size-8:
+		return true // finders, separators, format information, dark module
+	case x == 6 || y == 6:
+		return true // timing patterns
+	case ver >= 7 && ((x >= size-11 && x < size-8 && y < 6) || (y >= size-11 && y < size-8 && x < 6)):
+		return true // version information
+	}
+	pos := alignmentPositions(ver)
+	for i, cy := range pos {
+		for j, cx := range pos {
+			last := len(pos) - 1
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			if abs(x-cx) <= 2 && abs(y-cy) <= 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (y+x)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (y+x)%3 == 0
+	case 4:
+		return (y/2+x/3)%2 == 0
+	case 5:
+		return (y*x)%2+(y*x)%3 == 0
+	case 6:
+		return ((y*x)%2+(y*x)%3)%2 == 0
+	default:
+		return ((y+x)%2+(y*x)%3)%2 == 0
+	}
+}
+
+// decode reads the byte-mode payload of a symbol.
+func decode(c *Code) ([]byte, error) {
+	ver := (c.Size - 17) / 4
+	if ver < 1 || ver > 40 || ver*4+17 != c.Size {
+		return nil, fmt.Errorf("invalid size %d", c.Size)
+	}
+
+	first, second := readFormat(c)
+	if first != second {
+		return nil, fmt.Errorf("format copies differ")
+	}
+	format := first ^ 0x5412
+	rem := format >> 10
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	if format&0x3ff != rem&0x3ff {
+		return nil, fmt.Errorf("format information fails its BCH check")
+	}
+	var lvl level
+	switch format >> 13 {
+	case 1:
+		lvl = levelL
+	case 0:
+		lvl = levelM
+	default:
+		return nil, fmt.Errorf("unexpected error correction level %d", format>>13)
+	}
+	mask := format >> 10 & 7
+	if !c.modules[c.Size-8][8] {
+		return nil, fmt.Errorf("dark module missing")
+	}
+
+	// Codewords in placement order: two-module columns from the right,
+	// alternately upwards and downwards, skipping the vertical timing pattern.
+	var bits []bool
+	upward := true
+	for right := c.Size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for i := range c.Size {
+			y := i
+			if upward {
+				y = c.Size - 1 - i
+			}
+			for _, x := range []int{right, right - 1} {
+				if !isFunction(ver, x, y) {
+					bits = append(bits, c.modules[y][x] != maskBit(mask, x, y))
+				}
+			}
+		}
+		upward = !upward
+	}
+	total := numRawDataModules(ver) / 8
+	if len(bits)/8 != total {
+		return nil, fmt.Errorf("%d data modules, want %d codewords", len(bits), total)
+	}
+	raw := make([]byte, total)
+	for i := range total * 8 {
+		if bits[i] {
+			raw[i/8] |= 1 << (7 - i%8)
+		}
+	}
+
+	// De-interleave: data codewords of all blocks round-robin (short blocks
+	// end one early), then the error correction codewords.
+	numBlocks, eccLen := eccBlocks[lvl][ver], eccPerBlock[lvl][ver]
+	numLong := total % numBlocks
+	shortData := total/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range shortData + 1 {
+		for b := range numBlocks {
+			if i < shortData || b >= numBlocks-numLong {
+				blocks[b] = append(blocks[b], raw[k])
+				k++
+			}
+		}
+	}
+	for range eccLen {
+		for b := range numBlocks {
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+	var data []byte
+	for b, block := range blocks {
+		if err := checkSyndromes(block, eccLen); err != nil {
+			return nil, fmt.Errorf("block %d: %w", b, err)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	// Byte mode segment
+	if data[0]>>4 != 4 {
+		return nil, fmt.Errorf("mode %d, want byte mode", data[0]>>4)
+	}
+	readBits := func(pos, n int) int {
+		v := 0
+		for i := pos; i < pos+n; i++ {
+			v = v<<1 | int(data[i/8]>>(7-i%8)&1)
+		}
+		return v
+	}
+	countBits := 8
+	if ver > 9 {
+		countBits = 16
+	}
+	n := readBits(4, countBits)
+	pos := 4 + countBits
+	if pos+n*8 > len(data)*8 {
+		return nil, fmt.Errorf("length %d exceeds the symbol", n)
+	}
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(readBits(pos+i*8, 8))
+	}
+	return out, nil
+}
+
+// checkSyndromes verifies that a block is a Reed-Solomon codeword: the
+// block polynomial must vanish at the generator's roots 2^0 .. 2^(eccLen-1).
+func checkSyndromes(block []byte, eccLen int) error {
+	var exp [255]byte
+	x := 1
+	for i := range exp {
+		exp[i] = byte(x)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	mul := func(a, b byte) byte {
+		var p byte
+		for b != 0 {
+			if b&1 != 0 {
+				p ^= a
+			}
+			carry := a & 0x80
+			a <<= 1
+			if carry != 0 {
+				a ^= 0x1D
+			}
+			b >>= 1
+		}
+		return p
+	}
+	for i := range eccLen {
+		var s byte
+		for _, c := range block {
+			s = mul(s, exp[i]) ^ c
+		}
+		if s != 0 {
+			return fmt.Errorf("syndrome %d is %#x", i, s)
+		}
+	}
+	return nil
+}
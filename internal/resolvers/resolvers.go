@@ -0,0 +1,75 @@
+// Package resolvers holds curated lists of public DNS resolvers, grouped by
+// the region they are likely to work well from.
+package resolvers
+
+// Resolver is a public DNS resolver.
+type Resolver struct {
+	Name string
+	Addr string
+}
+
+// Regions accepted by ForRegion.
+const (
+	RegionGlobal = "global"
+	RegionIran   = "ir"
+	RegionRussia = "ru"
+	RegionChina  = "cn"
+)
+
+// Regions lists the regions with a curated list, in display order.
+var Regions = []struct{ ID, Name string }{
+	{RegionGlobal, "Global"},
+	{RegionIran, "Iran"},
+	{RegionRussia, "Russia"},
+	{RegionChina, "China"},
+}
+
+// Global resolvers are anycast and reachable from most networks, though
+// often throttled or blocked where DNS tunnels are most needed.
+var Global = []Resolver{
+	{"Cloudflare", "1.1.1.1:53"},
+	{"Google", "8.8.8.8:53"},
+	{"Quad9", "9.9.9.9:53"},
+	{"OpenDNS", "208.67.222.222:53"},
+	{"AdGuard", "94.140.14.14:53"},
+	{"Cloudflare (secondary)", "1.0.0.1:53"},
+	{"Google (secondary)", "8.8.4.4:53"},
+}
+
+// lists holds the resolvers hosted in each region, which local networks
+// rarely filter. The global ones are added to every region as a fallback.
+var lists = map[string][]Resolver{
+	RegionIran: {
+		{"Shecan", "178.22.122.100:53"},
+		{"Shecan (secondary)", "185.51.200.2:53"},
+		{"Electro", "78.157.42.100:53"},
+		{"Electro (secondary)", "78.157.42.101:53"},
+		{"Begzar", "185.55.226.26:53"},
+		{"Begzar (secondary)", "185.55.225.25:53"},
+	},
+	RegionRussia: {
+		{"Yandex", "77.88.8.8:53"},
+		{"Yandex (secondary)", "77.88.8.1:53"},
+	},
+	RegionChina: {
+		{"AliDNS", "223.5.5.5:53"},
+		{"AliDNS (secondary)", "223.6.6.6:53"},
+		{"DNSPod", "119.29.29.29:53"},
+		{"114DNS", "114.114.114.114:53"},
+		{"114DNS (secondary)", "114.114.115.115:53"},
+		{"Baidu", "180.76.76.76:53"},
+	},
+}
+
+// ForRegion returns the resolvers to try from region: those hosted there,
+// then the global ones. It reports false for an unknown region.
+func ForRegion(region string) ([]Resolver, bool) {
+	if region == RegionGlobal {
+		return Global, true
+	}
+	local, ok := lists[region]
+	if !ok {
+		return nil, false
+	}
+	return append(append([]Resolver(nil), local...), Global...), true
+}
@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The login Keychain is reached through security(1).
+
+// errItemNotFound is the exit status of security(1) for a missing item.
+const errItemNotFound = 44
+
+// Available reports whether the OS keyring can be used.
+func Available() bool {
+	_, err := exec.LookPath("security")
+	return err == nil
+}
+
+// Get returns the secret stored for account.
+func Get(account string) (string, error) {
+	out, err := security(nil, "find-generic-password", "-s", service, "-a", account, "-w")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// Set stores secret for account, replacing any previous one. The secret is
+// not passed as an argument, where other users could see it with ps: with -w
+// last, security(1) prompts for it twice and reads the answers from stdin.
+func Set(account, secret string) error {
+	if strings.ContainsAny(secret, "\r\n") {
+		return fmt.Errorf("secrets containing line breaks can't be stored in the Keychain")
+	}
+	stdin := strings.NewReader(secret + "\n" + secret + "\n")
+	_, err := security(stdin, "add-generic-password", "-U", "-s", service, "-a", account, "-l", "dnstc "+account, "-w")
+	return err
+}
+
+// Delete removes the secret stored for account.
+func Delete(account string) error {
+	_, err := security(nil, "delete-generic-password", "-s", service, "-a", account)
+	return err
+}
+
+func security(stdin *strings.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("security", args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if exitErr.ExitCode() == errItemNotFound {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("security: %s", bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service is reached through secret-tool (libsecret-tools).
+
+// Available reports whether the OS keyring can be used.
+func Available() bool {
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+// Get returns the secret stored for account.
+func Get(account string) (string, error) {
+	out, err := secretTool(nil, "lookup", "service", service, "account", account)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) == 0 {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Set stores secret for account, replacing any previous one.
+func Set(account, secret string) error {
+	_, err := secretTool(strings.NewReader(secret), "store", "--label", "dnstc "+account, "service", service, "account", account)
+	return err
+}
+
+// Delete removes the secret stored for account.
+func Delete(account string) error {
+	_, err := secretTool(nil, "clear", "service", service, "account", account)
+	return err
+}
+
+func secretTool(stdin *strings.Reader, args ...string) ([]byte, error) {
+	if !Available() {
+		return nil, ErrUnsupported
+	}
+	cmd := exec.Command("secret-tool", args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	// The daemon runs as a systemd service without the login session's
+	// environment; point it at the user's session bus.
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		bus := fmt.Sprintf("/run/user/%d/bus", os.Getuid())
+		if _, err := os.Stat(bus); err == nil {
+			cmd.Env = append(os.Environ(), "DBUS_SESSION_BUS_ADDRESS=unix:path="+bus)
+		}
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+			return nil, fmt.Errorf("secret-tool: %s", bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !windows
+
+package secrets
+
+// Available reports whether the OS keyring can be used.
+func Available() bool {
+	return false
+}
+
+// Get returns the secret stored for account.
+func Get(account string) (string, error) {
+	return "", ErrUnsupported
+}
+
+// Set stores secret for account, replacing any previous one.
+func Set(account, secret string) error {
+	return ErrUnsupported
+}
+
+// Delete removes the secret stored for account.
+func Delete(account string) error {
+	return ErrUnsupported
+}
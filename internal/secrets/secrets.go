@@ -0,0 +1,128 @@
+// Package secrets keeps tunnel credentials in the OS keyring (Secret Service
+// on Linux, Keychain on macOS, Credential Manager on Windows). The config then
+// holds a "keyring:<account>" reference instead of the secret.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/net2share/dnstc/internal/config"
+)
+
+// service is the keyring service name secrets are stored under.
+const service = "dnstc"
+
+var (
+	// ErrNotFound is returned when the keyring has no secret for an account.
+	ErrNotFound = errors.New("secret not found in keyring")
+	// ErrUnsupported is returned when no OS keyring is available.
+	ErrUnsupported = errors.New("OS keyring not available")
+)
+
+// Field is a secret field of a tunnel.
+type Field struct {
+	Name  string  // e.g. "ss-password"
+	Value *string // points into the tunnel config
+}
+
+// Fields returns the non-empty secret fields of a tunnel.
+func Fields(tc *config.TunnelConfig) []Field {
+	var fields []Field
+	add := func(name string, v *string) {
+		if *v != "" {
+			fields = append(fields, Field{Name: name, Value: v})
+		}
+	}
+	if tc.Shadowsocks != nil {
+		add("ss-password", &tc.Shadowsocks.Password)
+	}
+	if tc.SSH != nil {
+		add("ssh-password", &tc.SSH.Password)
+		add("ssh-passphrase", &tc.SSH.Passphrase)
+		if tc.SSH.Obfs != nil {
+			add("ssh-obfs-key", &tc.SSH.Obfs.Key)
+		}
+	}
+	return fields
+}
+
+// Account returns the keyring account of a tunnel's secret field.
+func Account(tag, field string) string {
+	return tag + "/" + field
+}
+
+// Resolve returns a copy of tc with keyring references replaced by the secrets.
+func Resolve(tc config.TunnelConfig) (config.TunnelConfig, error) {
+	if tc.Shadowsocks != nil {
+		ss := *tc.Shadowsocks
+		tc.Shadowsocks = &ss
+	}
+	if tc.SSH != nil {
+		sshCfg := *tc.SSH
+		if sshCfg.Obfs != nil {
+			obfs := *sshCfg.Obfs
+			sshCfg.Obfs = &obfs
+		}
+		tc.SSH = &sshCfg
+	}
+	for _, f := range Fields(&tc) {
+		if !config.IsKeyringRef(*f.Value) {
+			continue
+		}
+		secret, err := Get(strings.TrimPrefix(*f.Value, config.KeyringPrefix))
+		if err != nil {
+			return tc, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		*f.Value = secret
+	}
+	return tc, nil
+}
+
+// Store moves the plaintext secrets of tc into the keyring, replacing them
+// with references. It returns the number of secrets moved.
+func Store(tc *config.TunnelConfig) (int, error) {
+	n := 0
+	for _, f := range Fields(tc) {
+		if config.IsKeyringRef(*f.Value) {
+			continue
+		}
+		account := Account(tc.Tag, f.Name)
+		if err := Set(account, *f.Value); err != nil {
+			return n, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		*f.Value = config.KeyringPrefix + account
+		n++
+	}
+	return n, nil
+}
+
+// Restore moves the keyring secrets of tc back into the config and deletes
+// them from the keyring. It returns the number of secrets moved.
+func Restore(tc *config.TunnelConfig) (int, error) {
+	n := 0
+	for _, f := range Fields(tc) {
+		if !config.IsKeyringRef(*f.Value) {
+			continue
+		}
+		account := strings.TrimPrefix(*f.Value, config.KeyringPrefix)
+		secret, err := Get(account)
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		*f.Value = secret
+		Delete(account)
+		n++
+	}
+	return n, nil
+}
+
+// Forget deletes the keyring secrets referenced by tc, ignoring errors.
+func Forget(tc *config.TunnelConfig) {
+	for _, f := range Fields(tc) {
+		if config.IsKeyringRef(*f.Value) {
+			Delete(strings.TrimPrefix(*f.Value, config.KeyringPrefix))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/net2share/dnstc/internal/config"
+)
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name string
+		tc   config.TunnelConfig
+		want []string
+	}{
+		{"socks", config.TunnelConfig{Backend: config.BackendSOCKS}, nil},
+		{
+			"shadowsocks",
+			config.TunnelConfig{Shadowsocks: &config.ShadowsocksConfig{Password: "pw"}},
+			[]string{"ss-password"},
+		},
+		{
+			"ssh with key only",
+			config.TunnelConfig{SSH: &config.SSHConfig{User: "u", Key: "/k"}},
+			nil,
+		},
+		{
+			"ssh with everything",
+			config.TunnelConfig{SSH: &config.SSHConfig{
+				Password:   "pw",
+				Passphrase: "pp",
+				Obfs:       &config.ObfsConfig{Key: "obfs"},
+			}},
+			[]string{"ssh-password", "ssh-passphrase", "ssh-obfs-key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range Fields(&tt.tc) {
+				got = append(got, f.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Fields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCopies(t *testing.T) {
+	tc := config.TunnelConfig{
+		Shadowsocks: &config.ShadowsocksConfig{Password: "ss"},
+		SSH: &config.SSHConfig{
+			Password: "pw",
+			Obfs:     &config.ObfsConfig{Key: "obfs"},
+		},
+	}
+	resolved, err := Resolve(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range Fields(&resolved) {
+		*f.Value = "changed"
+	}
+	if tc.Shadowsocks.Password != "ss" || tc.SSH.Password != "pw" || tc.SSH.Obfs.Key != "obfs" {
+		t.Errorf("changing the resolved copy changed the tunnel: %+v %+v %+v", tc.Shadowsocks, tc.SSH, tc.SSH.Obfs)
+	}
+}
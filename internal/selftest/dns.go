@@ -0,0 +1,129 @@
+package selftest
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+// mockTXT is the TXT record the mock DNS server answers with.
+const mockTXT = "dnstc-selftest"
+
+// dnsServer is a minimal DNS responder on a loopback UDP port. It answers
+// A queries with 127.0.0.1, TXT queries with mockTXT and everything else
+// with an empty NOERROR, and remembers the names it was asked for.
+type dnsServer struct {
+	conn net.PacketConn
+
+	mu    sync.Mutex
+	names []string
+}
+
+func startDNSServer() (*dnsServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &dnsServer{conn: conn}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the "host:port" the server listens on.
+func (s *dnsServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Queried reports whether a name at or under domain was asked for.
+func (s *dnsServer) Queried(domain string) bool {
+	domain = strings.ToLower(domain)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.names {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *dnsServer) Close() error {
+	return s.conn.Close()
+}
+
+func (s *dnsServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		resp, name, ok := answer(buf[:n])
+		if !ok {
+			continue
+		}
+		s.mu.Lock()
+		s.names = append(s.names, name)
+		s.mu.Unlock()
+		s.conn.WriteTo(resp, addr)
+	}
+}
+
+// answer builds the response to a single-question query. It returns the
+// queried name in lower case, and false for packets that are not queries.
+func answer(query []byte) ([]byte, string, bool) {
+	if len(query) < 12 || query[2]&0x80 != 0 || binary.BigEndian.Uint16(query[4:6]) != 1 {
+		return nil, "", false
+	}
+
+	// Walk the question name; queries never use compression
+	off := 12
+	var labels []string
+	for {
+		if off >= len(query) {
+			return nil, "", false
+		}
+		l := int(query[off])
+		if l == 0 {
+			off++
+			break
+		}
+		if l > 63 || off+1+l > len(query) {
+			return nil, "", false
+		}
+		labels = append(labels, string(query[off+1:off+1+l]))
+		off += 1 + l
+	}
+	if off+4 > len(query) {
+		return nil, "", false
+	}
+	qtype := binary.BigEndian.Uint16(query[off : off+2])
+	question := query[12 : off+4]
+
+	var rdata []byte
+	switch qtype {
+	case probe.TypeA:
+		rdata = []byte{127, 0, 0, 1}
+	case probe.TypeTXT:
+		rdata = append([]byte{byte(len(mockTXT))}, mockTXT...)
+	}
+
+	resp := make([]byte, 12, 12+len(question)+16+len(rdata))
+	copy(resp[0:2], query[0:2])                                            // ID
+	binary.BigEndian.PutUint16(resp[2:4], 0x8480|uint16(query[2]&0x01)<<8) // QR, AA, RA, copy RD
+	binary.BigEndian.PutUint16(resp[4:6], 1)                               // QDCOUNT
+	resp = append(resp, question...)
+	if rdata != nil {
+		binary.BigEndian.PutUint16(resp[6:8], 1) // ANCOUNT
+		resp = append(resp, 0xC0, 12)            // name: pointer to the question
+		resp = binary.BigEndian.AppendUint16(resp, qtype)
+		resp = binary.BigEndian.AppendUint16(resp, 1) // class IN
+		resp = binary.BigEndian.AppendUint32(resp, 0) // TTL
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+		resp = append(resp, rdata...)
+	}
+	return resp, strings.ToLower(strings.Join(labels, ".")), true
+}
@@ -0,0 +1,276 @@
+// Package selftest exercises the engine, gateway and process manager end to
+// end against an in-process mock DNS server and a mock transport, without
+// any real tunnel server.
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/dnstc/internal/config"
+	"github.com/net2share/dnstc/internal/engine"
+	"github.com/net2share/dnstc/internal/port"
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+const (
+	tunnelTag    = "selftest"
+	tunnelDomain = "t.selftest.invalid"
+
+	// readyTimeout is how long the mock tunnel has to come up.
+	readyTimeout = 15 * time.Second
+)
+
+// Run runs the self-test, writing progress to w. It changes the process
+// environment so that the engine uses a temporary config directory, and
+// is meant to be the only thing the process does.
+func Run(w io.Writer) error {
+	var logs bytes.Buffer
+	prevLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(prevLogger)
+
+	t := &test{w: w, total: 6}
+	err := t.run()
+	if err != nil {
+		fmt.Fprintf(w, "FAILED: %v\n", err)
+		if logs.Len() > 0 {
+			fmt.Fprintf(w, "\nEngine log:\n%s", logs.String())
+		}
+		return fmt.Errorf("self-test failed: %w", err)
+	}
+	fmt.Fprintln(w, "Self-test passed")
+	return nil
+}
+
+type test struct {
+	w     io.Writer
+	total int
+	step  int
+}
+
+func (t *test) begin(msg string) {
+	t.step++
+	fmt.Fprintf(t.w, "[%d/%d] %s... ", t.step, t.total, msg)
+}
+
+func (t *test) ok(detail string) {
+	if detail != "" {
+		fmt.Fprintf(t.w, "ok (%s)\n", detail)
+		return
+	}
+	fmt.Fprintln(t.w, "ok")
+}
+
+func (t *test) run() error {
+	// Step 1: Mock DNS server and SOCKS target
+	t.begin("Starting mock DNS server and SOCKS target")
+	dns, err := startDNSServer()
+	if err != nil {
+		return fmt.Errorf("mock DNS server: %w", err)
+	}
+	defer dns.Close()
+	echo, err := startEchoServer()
+	if err != nil {
+		return fmt.Errorf("SOCKS target: %w", err)
+	}
+	defer echo.Close()
+	t.ok("")
+
+	// Step 2: Engine and gateway
+	t.begin("Starting engine and gateway")
+	dir, err := os.MkdirTemp("", "dnstc-selftest-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	cfg, err := isolate(dir, dns.Addr())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// The system policy is not for the test's own resolver and tunnel
+	eng := engine.NewWithOptions(cfg, engine.Options{
+		Policy: func() (*config.Policy, error) { return nil, nil },
+	})
+	stopped := false
+	defer func() {
+		if !stopped {
+			eng.Stop(context.Background())
+		}
+	}()
+	if err := eng.Start(ctx); err != nil {
+		return err
+	}
+	status := eng.Status(ctx)
+	if status.GatewayAddr == "" {
+		return fmt.Errorf("gateway is not running")
+	}
+	t.ok(status.GatewayAddr)
+
+	// Step 3: Transport process
+	t.begin("Starting mock transport")
+	ts, err := waitReady(ctx, eng)
+	if err != nil {
+		return err
+	}
+	t.ok(fmt.Sprintf("port %d", ts.Port))
+
+	// Step 4: DNS path
+	t.begin("Checking the transport's DNS queries")
+	if !dns.Queried(tunnelDomain) {
+		return fmt.Errorf("no query for %s reached the resolver", tunnelDomain)
+	}
+	t.ok("")
+
+	// Step 5: Data path
+	t.begin("Relaying data through the gateway")
+	rtt, err := relay(ctx, status.GatewayAddr, echo.Addr().String())
+	if err != nil {
+		return err
+	}
+	t.ok(fmt.Sprintf("%dms", rtt.Milliseconds()))
+
+	// Step 6: Shutdown
+	t.begin("Stopping engine")
+	stopped = true
+	if err := eng.Stop(ctx); err != nil {
+		return err
+	}
+	tunnelAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(ts.Port))
+	if conn, err := net.DialTimeout("tcp", tunnelAddr, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("transport process still listening on %s", tunnelAddr)
+	}
+	t.ok("")
+	return nil
+}
+
+// isolate points the config directory at dir, so the test neither reads nor
+// touches the user's config and state, and returns a config with a single
+// mock tunnel whose transport is this executable.
+func isolate(dir, resolver string) (*config.Config, error) {
+	config.SetPortable(false)
+	switch runtime.GOOS {
+	case "darwin":
+		os.Setenv("HOME", dir)
+	case "windows":
+		os.Setenv("APPDATA", dir)
+	default:
+		os.Setenv("XDG_CONFIG_HOME", dir)
+	}
+	if err := os.MkdirAll(config.ConfigDir(), 0750); err != nil {
+		return nil, err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	os.Setenv(binaries.Defs()[binaries.NameSlipstream].EnvOverride, exe)
+
+	gatewayPort, err := port.GetAvailable()
+	if err != nil {
+		return nil, err
+	}
+	tunnelPort, err := port.GetAvailable()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.Default()
+	cfg.Listen.SOCKS = net.JoinHostPort("127.0.0.1", strconv.Itoa(gatewayPort))
+	cfg.Resolvers = []string{resolver}
+	cfg.Tunnels = []config.TunnelConfig{{
+		Tag:       tunnelTag,
+		Transport: config.TransportSlipstream,
+		Backend:   config.BackendSOCKS,
+		Domain:    tunnelDomain,
+		Port:      tunnelPort,
+		Env:       map[string]string{TransportEnv: "1"},
+	}}
+	cfg.Route.Active = tunnelTag
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// waitReady waits for the mock tunnel to accept connections.
+func waitReady(ctx context.Context, eng *engine.Engine) (*engine.TunnelStatus, error) {
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		ts := eng.Status(ctx).Tunnels[tunnelTag]
+		if ts != nil && ts.Running && ts.Ready {
+			return ts, nil
+		}
+		if ts != nil && ts.Error != "" {
+			return nil, fmt.Errorf("transport exited: %s", ts.Error)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("transport not ready after %s", readyTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// relay connects to target through the gateway and checks that data sent
+// comes back unchanged.
+func relay(ctx context.Context, gatewayAddr, target string) (time.Duration, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := probe.DialSOCKS5(dialCtx, gatewayAddr, target)
+	if err != nil {
+		return 0, fmt.Errorf("SOCKS5 connect through gateway: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	sent := make([]byte, 64)
+	rand.Read(sent)
+	start := time.Now()
+	if _, err := conn.Write(sent); err != nil {
+		return 0, err
+	}
+	got := make([]byte, len(sent))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return 0, fmt.Errorf("no echo through gateway: %w", err)
+	}
+	if !bytes.Equal(sent, got) {
+		return 0, fmt.Errorf("data was corrupted through the gateway")
+	}
+	return time.Since(start), nil
+}
+
+// startEchoServer starts the loopback target reached through the tunnel.
+func startEchoServer() (net.Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln, nil
+}
@@ -0,0 +1,146 @@
+package selftest
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/net2share/dnstc/internal/probe"
+)
+
+// TransportEnv is set in the environment of the mock transport process. The
+// self-test points the Slipstream binary at the dnstc executable itself, so
+// main must hand over to RunTransport when it is set.
+const TransportEnv = "DNSTC_SELFTEST_TRANSPORT"
+
+// IsTransport reports whether this process was started as the mock transport.
+func IsTransport() bool {
+	return os.Getenv(TransportEnv) != ""
+}
+
+// RunTransport stands in for slipstream-client: it accepts the same SOCKS
+// mode arguments, checks that the resolver answers for the tunnel domain and
+// then serves SOCKS5 on the listen port, connecting to loopback targets only.
+// It returns the process exit code.
+func RunTransport(args []string) int {
+	fs := flag.NewFlagSet("selftest-transport", flag.ContinueOnError)
+	domain := fs.String("domain", "", "tunnel domain")
+	resolver := fs.String("resolver", "", "DNS resolver")
+	listenPort := fs.Int("tcp-listen-port", 0, "SOCKS listen port")
+	fs.String("cert", "", "ignored")
+	fs.Int("keep-alive-interval", 0, "ignored")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	resp, _, err := probe.QueryUDP(ctx, *resolver, "selftest."+*domain, probe.TypeTXT)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolver %s did not answer: %v\n", *resolver, err)
+		return 1
+	}
+	if !slices.Contains(resp.Values(probe.TypeTXT), mockTXT) {
+		fmt.Fprintf(os.Stderr, "unexpected answer from resolver %s\n", *resolver)
+		return 1
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(*listenPort)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to listen: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Listening on %s\n", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return 1
+		}
+		go serveSOCKS(conn)
+	}
+}
+
+// serveSOCKS handles one SOCKS5 CONNECT without authentication.
+func serveSOCKS(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil || hdr[0] != 0x05 {
+		return
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+		return
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil || req[1] != 0x01 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 0x01: // IPv4
+		var ip [4]byte
+		if _, err := io.ReadFull(conn, ip[:]); err != nil {
+			return
+		}
+		host = net.IP(ip[:]).String()
+	case 0x03: // domain name
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return
+		}
+		name := make([]byte, l[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	case 0x04: // IPv6
+		var ip [16]byte
+		if _, err := io.ReadFull(conn, ip[:]); err != nil {
+			return
+		}
+		host = net.IP(ip[:]).String()
+	default:
+		conn.Write([]byte{0x05, 0x08, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	var portBuf [2]byte
+	if _, err := io.ReadFull(conn, portBuf[:]); err != nil {
+		return
+	}
+	port := binary.BigEndian.Uint16(portBuf[:])
+
+	// Never reach out of the machine, e.g. for the engine's health probes
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		conn.Write([]byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	target, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))), 5*time.Second)
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	if _, err := conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(target, conn); done <- struct{}{} }()
+	go func() { io.Copy(conn, target); done <- struct{}{} }()
+	<-done
+}
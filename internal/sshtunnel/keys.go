@@ -0,0 +1,92 @@
+package sshtunnel
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// pemBlock matches a PEM block whose line breaks may have been lost when
+// pasted into a single-line input.
+var pemBlock = regexp.MustCompile(`^(-----BEGIN [A-Z ]+-----)(.*?)(-----END [A-Z ]+-----)$`)
+
+// CheckKey verifies that data is a private key usable by the tunnel with
+// the given passphrase (empty for unencrypted keys).
+func CheckKey(data []byte, passphrase string) error {
+	_, err := parseKey(data, passphrase)
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case errors.As(err, &missing):
+		return ErrPassphraseRequired
+	case errors.Is(err, x509.IncorrectPasswordError):
+		return fmt.Errorf("wrong passphrase")
+	case err != nil:
+		return fmt.Errorf("not a valid private key: %w", err)
+	}
+	return nil
+}
+
+// CheckKeyFile reads path and verifies it with CheckKey.
+func CheckKeyFile(path, passphrase string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return CheckKey(data, passphrase)
+}
+
+// ErrPassphraseRequired is returned by CheckKey for an encrypted key without a passphrase.
+var ErrPassphraseRequired = errors.New("key is protected by a passphrase")
+
+func parseKey(data []byte, passphrase string) (ssh.Signer, error) {
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// NormalizeKey restores the line breaks of a PEM private key pasted as a
+// single line. Keys that already span several lines are returned unchanged.
+func NormalizeKey(pasted string) []byte {
+	s := strings.TrimSpace(pasted)
+	if strings.Contains(s, "\n") {
+		return []byte(s + "\n")
+	}
+	m := pemBlock.FindStringSubmatch(s)
+	if m == nil {
+		return []byte(s)
+	}
+	body := strings.Join(strings.Fields(m[2]), "")
+	var b strings.Builder
+	b.WriteString(m[1] + "\n")
+	for len(body) > 70 {
+		b.WriteString(body[:70] + "\n")
+		body = body[70:]
+	}
+	if body != "" {
+		b.WriteString(body + "\n")
+	}
+	b.WriteString(m[3] + "\n")
+	return []byte(b.String())
+}
+
+// DefaultKeyPath returns the first usual private key found in ~/.ssh, or "".
+func DefaultKeyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package sshtunnel
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sharedClient is an SSH connection used by several tunnels.
+type sharedClient struct {
+	client *ssh.Client
+	refs   int
+}
+
+var (
+	sharedMu sync.Mutex
+	shared   = make(map[string]*sharedClient)
+)
+
+// acquire returns an SSH connection for cfg and the function that gives it
+// up. With cfg.Share set, a live connection opened for another tunnel is
+// reused, and joined is true. Such a connection runs over the transport of
+// the tunnel that opened it, so it ends when that transport stops.
+func acquire(cfg Config) (client *ssh.Client, release func(), joined bool, err error) {
+	if cfg.Share == "" {
+		client, err := connect(cfg)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return client, func() { client.Close() }, false, nil
+	}
+
+	key := cfg.Share + "\x00" + cfg.User
+	sharedMu.Lock()
+	if s := shared[key]; s != nil {
+		s.refs++
+		sharedMu.Unlock()
+		return s.client, releaser(key, s), true, nil
+	}
+	sharedMu.Unlock()
+
+	client, err = connect(cfg)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if shared[key] != nil {
+		// Another tunnel connected meanwhile; keep this connection private
+		return client, func() { client.Close() }, false, nil
+	}
+	s := &sharedClient{client: client, refs: 1}
+	shared[key] = s
+	go func() {
+		client.Wait()
+		sharedMu.Lock()
+		if shared[key] == s {
+			delete(shared, key)
+		}
+		sharedMu.Unlock()
+	}()
+	return client, releaser(key, s), false, nil
+}
+
+// releaser returns the function that drops one tunnel's use of s, closing
+// the connection once no tunnel uses it.
+func releaser(key string, s *sharedClient) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sharedMu.Lock()
+			s.refs--
+			last := s.refs == 0
+			if last && shared[key] == s {
+				delete(shared, key)
+			}
+			sharedMu.Unlock()
+			if last {
+				s.client.Close()
+			}
+		})
+	}
+}
@@ -5,38 +5,152 @@
 package sshtunnel
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
+
+	"github.com/net2share/dnstc/internal/crash"
+	"github.com/net2share/dnstc/internal/obfs"
 )
 
 // Config configures an SSH tunnel.
 type Config struct {
+	Tag              string        // tunnel tag, for logs
 	TransportAddr    string        // local address of the DNS transport (e.g., "127.0.0.1:12345")
 	SOCKSAddr        string        // local SOCKS5 listen address (e.g., "127.0.0.1:1080")
 	User             string
 	Password         string
 	KeyPath          string        // path to PEM private key file
+	KeyPassphrase    string        // passphrase of an encrypted key
 	HandshakeTimeout time.Duration // SSH handshake timeout (default 10s)
+	IdleTimeout      time.Duration // close connections with no data either way for this long; 0 never
 	MaxRetries       int           // connection attempts (default 2)
+	ObfsKey          string        // if set, the SSH stream is scrambled with package obfs
+	ObfsPad          bool          // pad the start of the scrambled stream
+
+	// Share, if set, lets tunnels with the same Share and User use one SSH
+	// connection: the first to start opens it and the others forward over it
+	// instead of handshaking again over their own transport.
+	Share string
 }
 
 // Tunnel manages an SSH connection and local SOCKS5 proxy.
 type Tunnel struct {
 	cfg      Config
+	mu       sync.Mutex
 	client   *ssh.Client
+	release  func() // closes client, or drops this tunnel's share of it
 	listener net.Listener
 	wg       sync.WaitGroup
 	done     chan struct{}
+
+	connErrors atomic.Int64
+	lastErr    string // guarded by mu
 }
 
-// Start establishes the SSH connection and starts the SOCKS5 listener.
+// Start establishes the SSH connection, or joins a shared one, and starts
+// the SOCKS5 listener.
 func Start(cfg Config) (*Tunnel, error) {
+	client, release, joined, err := acquire(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start local SOCKS5 listener
+	listener, err := net.Listen("tcp", cfg.SOCKSAddr)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("listen SOCKS: %w", err)
+	}
+
+	t := &Tunnel{
+		cfg:      cfg,
+		client:   client,
+		release:  release,
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		crash.Supervise("SSH tunnel accept loop", t.acceptLoop, t.running)
+	}()
+	if joined {
+		go t.reconnect(client)
+	}
+
+	return t, nil
+}
+
+// reconnect replaces a shared connection opened by another tunnel, which
+// ends when that tunnel's transport stops, with one over this tunnel's own
+// transport.
+func (t *Tunnel) reconnect(shared *ssh.Client) {
+	closed := make(chan struct{})
+	go func() {
+		shared.Wait()
+		close(closed)
+	}()
+	select {
+	case <-t.done:
+		return
+	case <-closed:
+	}
+
+	cfg := t.cfg
+	cfg.Share = ""
+	client, err := connect(cfg)
+	if err != nil {
+		return // IsAlive reports the tunnel down
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.done:
+		client.Close()
+		return
+	default:
+	}
+	t.release()
+	t.client = client
+	t.release = func() { client.Close() }
+}
+
+// connFailed records a connection the tunnel could not serve.
+func (t *Tunnel) connFailed(err error) {
+	t.connErrors.Add(1)
+	t.mu.Lock()
+	t.lastErr = err.Error()
+	t.mu.Unlock()
+	slog.Warn("SSH tunnel connection failed", "tag", t.cfg.Tag, "error", err)
+}
+
+// ConnErrors returns how many connections failed their SOCKS handshake or
+// could not be opened through SSH, and the last such error.
+func (t *Tunnel) ConnErrors() (int64, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connErrors.Load(), t.lastErr
+}
+
+// sshClient returns the tunnel's current SSH connection.
+func (t *Tunnel) sshClient() *ssh.Client {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.client
+}
+
+// connect establishes an SSH connection over the DNS transport.
+func connect(cfg Config) (*ssh.Client, error) {
 	// Build SSH auth methods
 	var auths []ssh.AuthMethod
 	if cfg.KeyPath != "" {
@@ -44,7 +158,7 @@ func Start(cfg Config) (*Tunnel, error) {
 		if err != nil {
 			return nil, fmt.Errorf("read SSH key: %w", err)
 		}
-		signer, err := ssh.ParsePrivateKey(keyData)
+		signer, err := parseKey(keyData, cfg.KeyPassphrase)
 		if err != nil {
 			return nil, fmt.Errorf("parse SSH key: %w", err)
 		}
@@ -96,6 +210,9 @@ func Start(cfg Config) (*Tunnel, error) {
 			lastErr = fmt.Errorf("dial transport: %w", err)
 			continue
 		}
+		if cfg.ObfsKey != "" {
+			tcpConn = obfs.Wrap(tcpConn, cfg.ObfsKey, cfg.ObfsPad)
+		}
 		sshConn, chans, reqs, err := ssh.NewClientConn(tcpConn, cfg.TransportAddr, sshCfg)
 		if err != nil {
 			tcpConn.Close()
@@ -108,25 +225,7 @@ func Start(cfg Config) (*Tunnel, error) {
 	if client == nil {
 		return nil, lastErr
 	}
-
-	// Start local SOCKS5 listener
-	listener, err := net.Listen("tcp", cfg.SOCKSAddr)
-	if err != nil {
-		client.Close()
-		return nil, fmt.Errorf("listen SOCKS: %w", err)
-	}
-
-	t := &Tunnel{
-		cfg:      cfg,
-		client:   client,
-		listener: listener,
-		done:     make(chan struct{}),
-	}
-
-	t.wg.Add(1)
-	go t.acceptLoop()
-
-	return t, nil
+	return client, nil
 }
 
 // Addr returns the SOCKS5 listener address.
@@ -138,18 +237,29 @@ func (t *Tunnel) Addr() string {
 func (t *Tunnel) Stop() {
 	close(t.done)
 	t.listener.Close()
-	t.client.Close()
+	t.mu.Lock()
+	t.release()
+	t.mu.Unlock()
 	t.wg.Wait()
 }
 
 // IsAlive returns true if the SSH connection is still responding.
 func (t *Tunnel) IsAlive() bool {
-	_, _, err := t.client.SendRequest("keepalive@openssh.com", true, nil)
+	_, _, err := t.sshClient().SendRequest("keepalive@openssh.com", true, nil)
 	return err == nil
 }
 
+// running reports whether the tunnel has not been stopped.
+func (t *Tunnel) running() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
 func (t *Tunnel) acceptLoop() {
-	defer t.wg.Done()
 	for {
 		conn, err := t.listener.Accept()
 		if err != nil {
@@ -167,17 +277,23 @@ func (t *Tunnel) acceptLoop() {
 
 func (t *Tunnel) handleConn(conn net.Conn) {
 	defer t.wg.Done()
+	defer crash.Recover("SSH tunnel connection")
 	defer conn.Close()
 
 	target, err := socks5Handshake(conn)
 	if err != nil {
+		// A client closing before sending anything, e.g. a port check, is not an error
+		if !errors.Is(err, io.EOF) {
+			t.connFailed(fmt.Errorf("SOCKS handshake: %w", err))
+		}
 		return
 	}
 
 	// Dial through SSH
-	remote, err := t.client.Dial("tcp", target)
+	remote, err := t.sshClient().Dial("tcp", target)
 	if err != nil {
 		socks5Reply(conn, 0x05) // connection refused
+		t.connFailed(fmt.Errorf("connect to %s: %w", target, err))
 		return
 	}
 	defer remote.Close()
@@ -185,16 +301,74 @@ func (t *Tunnel) handleConn(conn net.Conn) {
 	// Success reply
 	socks5Reply(conn, 0x00)
 
-	// Bidirectional relay
-	var relayWg sync.WaitGroup
-	relayWg.Add(2)
-	go func() {
-		defer relayWg.Done()
-		io.Copy(remote, conn)
-	}()
-	go func() {
-		defer relayWg.Done()
-		io.Copy(conn, remote)
-	}()
-	relayWg.Wait()
+	t.relay(conn, remote)
+}
+
+const (
+	// halfClosedIdle closes a connection one side of which has finished
+	// sending once the other has been quiet this long.
+	halfClosedIdle = time.Minute
+	// reapInterval is how often a connection is checked for being idle.
+	reapInterval = 5 * time.Second
+)
+
+// relay copies data between conn and remote until both have finished
+// sending, either fails, the connection is idle for too long or the tunnel
+// stops. When one side finishes sending, the other is told so and may still
+// answer.
+func (t *Tunnel) relay(conn, remote net.Conn) {
+	var active atomic.Int64
+	active.Store(time.Now().UnixNano())
+	closeBoth := func() {
+		conn.Close()
+		remote.Close()
+	}
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		defer func() {
+			if v := recover(); v != nil {
+				crash.Report("SSH tunnel relay", v)
+				closeBoth()
+				done <- struct{}{}
+			}
+		}()
+		if _, err := io.Copy(&activityWriter{w: dst, active: &active}, src); err != nil {
+			closeBoth()
+		} else if cw, ok := dst.(interface{ CloseWrite() error }); !ok || cw.CloseWrite() != nil {
+			closeBoth()
+		}
+		done <- struct{}{}
+	}
+	go pipe(remote, conn)
+	go pipe(conn, remote)
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	stop := t.done
+	for finished := 0; finished < 2; {
+		select {
+		case <-done:
+			finished++
+		case <-ticker.C:
+			quiet := time.Since(time.Unix(0, active.Load()))
+			if (t.cfg.IdleTimeout > 0 && quiet > t.cfg.IdleTimeout) || (finished == 1 && quiet > halfClosedIdle) {
+				closeBoth()
+			}
+		case <-stop:
+			closeBoth()
+			stop = nil
+		}
+	}
+}
+
+// activityWriter records when data last went through a relay.
+type activityWriter struct {
+	w      io.Writer
+	active *atomic.Int64
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	a.active.Store(time.Now().UnixNano())
+	return a.w.Write(p)
 }
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// probeTimeout bounds a binary's --help run.
+const probeTimeout = 5 * time.Second
+
+// flagPattern matches the options listed in --help output: GNU style long
+// options and the single-dash ones of Go's flag package.
+var flagPattern = regexp.MustCompile(`(?m)(?:^|[\s,\[])(--?[a-zA-Z][a-zA-Z0-9-]*)`)
+
+// probed identifies a binary file, so a replaced binary is probed again.
+type probed struct {
+	path string
+	mod  time.Time
+	size int64
+}
+
+var (
+	capMu    sync.Mutex
+	capCache = make(map[probed]map[string]bool)
+)
+
+// Flags returns the options the binary at path lists in its --help output,
+// or nil if it cannot be run or lists none. The result is cached until the
+// file changes.
+func Flags(path string) map[string]bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	key := probed{path: path, mod: info.ModTime(), size: info.Size()}
+
+	capMu.Lock()
+	flags, ok := capCache[key]
+	capMu.Unlock()
+	if ok {
+		return flags
+	}
+
+	flags = probeFlags(path)
+	capMu.Lock()
+	capCache[key] = flags
+	capMu.Unlock()
+	return flags
+}
+
+// probeFlags runs the binary with --help. Exit status is ignored: Go's flag
+// package and some clap builds exit non-zero after printing usage.
+func probeFlags(path string) map[string]bool {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	out, _ := exec.CommandContext(ctx, path, "--help").CombinedOutput()
+
+	var flags map[string]bool
+	for _, m := range flagPattern.FindAllStringSubmatch(string(out), -1) {
+		if flags == nil {
+			flags = make(map[string]bool)
+		}
+		flags[m[1]] = true
+	}
+	return flags
+}
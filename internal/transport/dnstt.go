@@ -2,6 +2,8 @@ package transport
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 
 	"github.com/net2share/dnstc/internal/binaries"
 	"github.com/net2share/dnstc/internal/config"
@@ -48,6 +50,11 @@ func (p *DNSTTProvider) ValidateConfig(tc *config.TunnelConfig) error {
 	return nil
 }
 
+// ReadyPattern returns the pattern of the line printed once the transport is listening.
+func (p *DNSTTProvider) ReadyPattern(_ config.BackendType) *regexp.Regexp {
+	return listeningPattern
+}
+
 // BuildArgs builds command line arguments for dnstt-client.
 func (p *DNSTTProvider) BuildArgs(tc *config.TunnelConfig, listenPort int, resolver string) (string, []string, error) {
 	if err := p.ValidateConfig(tc); err != nil {
@@ -67,3 +74,24 @@ func (p *DNSTTProvider) BuildArgs(tc *config.TunnelConfig, listenPort int, resol
 	}
 	return binary, args, nil
 }
+
+// ParseMetrics counts the sessions and streams dnstt-client logs.
+func (p *DNSTTProvider) ParseMetrics(line string, m *Metrics) {
+	if sm := dnsttStreamPattern.FindStringSubmatch(line); sm != nil {
+		if sm[1] == "begin" {
+			m.Streams++
+			m.OpenStreams++
+		} else if m.OpenStreams > 0 {
+			m.OpenStreams--
+		}
+		return
+	}
+	if dnsttSessionPattern.MatchString(line) {
+		m.Sessions++
+		m.OpenStreams = 0 // a new session starts without the old one's streams
+		return
+	}
+	if sm := dnsttMTUPattern.FindStringSubmatch(line); sm != nil {
+		m.MTU, _ = strconv.Atoi(sm[1])
+	}
+}
@@ -0,0 +1,28 @@
+package transport
+
+import "regexp"
+
+// Metrics is what a transport client's log tells about the DNS tunnel
+// itself, counted since the client started.
+type Metrics struct {
+	MTU         int   `json:"mtu,omitempty"`          // payload bytes per DNS query
+	Sessions    int   `json:"sessions,omitempty"`     // tunnel sessions begun; more than one means it reconnected
+	Streams     int64 `json:"streams,omitempty"`      // streams opened, one per relayed connection
+	OpenStreams int   `json:"open_streams,omitempty"` // streams open now
+}
+
+// MetricsParser is implemented by transports whose client logs its sessions
+// and streams. Neither client reports queries, response sizes or
+// retransmissions, so those are not counted.
+type MetricsParser interface {
+	// ParseMetrics updates m from a line of the client's log.
+	ParseMetrics(line string, m *Metrics)
+}
+
+// dnstt-client logs with Go's log package, e.g.
+// "2025/01/02 15:04:05 begin stream 1f2e3d4c:3".
+var (
+	dnsttMTUPattern     = regexp.MustCompile(`\beffective MTU (\d+)`)
+	dnsttSessionPattern = regexp.MustCompile(`\bbegin session [0-9a-f]+`)
+	dnsttStreamPattern  = regexp.MustCompile(`\b(begin|end) stream [0-9a-f]+:\d+`)
+)
@@ -47,13 +47,51 @@ func Types() []config.TransportType {
 	return config.GetTransportTypes()
 }
 
-// resolveBinary resolves a binary path via the binaries manager.
+// resolveBinary resolves a binary path via the binaries resolver.
 func resolveBinary(name string) (string, error) {
-	mgr := binaries.NewManager()
 	defs := binaries.Defs()
 	def, ok := defs[name]
 	if !ok {
 		return "", fmt.Errorf("unknown binary: %s", name)
 	}
-	return mgr.ResolvePath(def)
+	return binaries.Resolve(def)
+}
+
+// RequiredBinariesFor returns the binaries needed by the given tunnels,
+// in the canonical order of binaries.AllNames.
+func RequiredBinariesFor(tunnels []config.TunnelConfig) []string {
+	needed := make(map[string]bool)
+	for _, tc := range tunnels {
+		t, err := Get(tc.Transport)
+		if err != nil {
+			continue
+		}
+		for _, name := range t.RequiredBinaries(tc.Backend) {
+			needed[name] = true
+		}
+	}
+
+	var names []string
+	for _, name := range binaries.AllNames() {
+		if needed[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// OptionalBinariesFor returns the managed binaries not needed by the given tunnels.
+func OptionalBinariesFor(tunnels []config.TunnelConfig) []string {
+	needed := make(map[string]bool)
+	for _, name := range RequiredBinariesFor(tunnels) {
+		needed[name] = true
+	}
+
+	var names []string
+	for _, name := range binaries.AllNames() {
+		if !needed[name] {
+			names = append(names, name)
+		}
+	}
+	return names
 }
@@ -2,6 +2,7 @@ package transport
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/net2share/dnstc/internal/binaries"
@@ -64,6 +65,11 @@ func (p *SlipstreamProvider) ValidateConfig(tc *config.TunnelConfig) error {
 	return nil
 }
 
+// ReadyPattern returns the pattern of the line printed once the transport is listening.
+func (p *SlipstreamProvider) ReadyPattern(_ config.BackendType) *regexp.Regexp {
+	return listeningPattern
+}
+
 // BuildArgs builds command line arguments for slipstream.
 func (p *SlipstreamProvider) BuildArgs(tc *config.TunnelConfig, listenPort int, resolver string) (string, []string, error) {
 	if err := p.ValidateConfig(tc); err != nil {
@@ -80,6 +86,11 @@ func (p *SlipstreamProvider) BuildArgs(tc *config.TunnelConfig, listenPort int,
 
 // buildSOCKSArgs builds args for slipstream-client standalone SOCKS mode.
 func (p *SlipstreamProvider) buildSOCKSArgs(tc *config.TunnelConfig, listenPort int, resolver string) (string, []string, error) {
+	binary, err := resolveBinary(binaries.NameSlipstream)
+	if err != nil {
+		return "", nil, err
+	}
+
 	args := []string{
 		"--domain", tc.Domain,
 		"--resolver", resolver,
@@ -87,13 +98,21 @@ func (p *SlipstreamProvider) buildSOCKSArgs(tc *config.TunnelConfig, listenPort
 	}
 
 	if tc.Slipstream != nil && tc.Slipstream.Cert != "" {
+		if _, err := useFeature(FeatureSlipstreamPin, binary); err != nil {
+			return "", nil, err
+		}
 		args = append(args, "--cert", tc.Slipstream.Cert)
 	}
-
-	binary, err := resolveBinary(binaries.NameSlipstream)
-	if err != nil {
-		return "", nil, err
+	if ms := tc.KeepAliveMs(); ms > 0 {
+		ok, err := useFeature(FeatureSlipstreamKeepAlive, binary)
+		if err != nil {
+			return "", nil, err
+		}
+		if ok {
+			args = append(args, "--keep-alive-interval", fmt.Sprintf("%d", ms))
+		}
 	}
+
 	return binary, args, nil
 }
 
@@ -2,9 +2,15 @@
 package transport
 
 import (
+	"regexp"
+
 	"github.com/net2share/dnstc/internal/config"
 )
 
+// listeningPattern matches the "listening on <addr>" line that the transport
+// clients and sslocal print once they accept connections.
+var listeningPattern = regexp.MustCompile(`(?i)\blistening on\b`)
+
 // Transport defines the interface that all transport providers must implement.
 type Transport interface {
 	// Type returns the transport type identifier.
@@ -26,4 +32,8 @@ type Transport interface {
 	// BuildArgs builds the command line arguments for the transport.
 	// Returns the binary path and arguments.
 	BuildArgs(tc *config.TunnelConfig, listenPort int, resolver string) (binary string, args []string, err error)
+
+	// ReadyPattern returns a pattern matching the output line printed once the
+	// transport accepts connections, or nil to rely on port polling only.
+	ReadyPattern(backend config.BackendType) *regexp.Regexp
 }
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/net2share/dnstc/internal/binaries"
+	"github.com/net2share/go-corelib/binman"
+)
+
+// Feature is an option a transport passes to one of its binaries that older
+// releases of the binary do not understand.
+type Feature struct {
+	Binary     string
+	Flag       string // the option, as listed by --help
+	Name       string // what the option does, for error messages
+	MinVersion string // oldest release that supports it
+	Optional   bool   // left out, rather than failing, if unsupported
+}
+
+// Features used by the transports, with the oldest release they were tested
+// against.
+var (
+	FeatureSlipstreamPin = Feature{
+		Binary:     binaries.NameSlipstream,
+		Flag:       "--cert",
+		Name:       "certificate pinning",
+		MinVersion: "v2026.02.22.1",
+	}
+	FeatureSlipstreamKeepAlive = Feature{
+		Binary:     binaries.NameSlipstream,
+		Flag:       "--keep-alive-interval",
+		Name:       "keep-alive interval",
+		MinVersion: "v2026.02.22.1",
+		Optional:   true,
+	}
+)
+
+// useFeature reports whether to pass the feature's option to the binary at
+// path. The binary lacks it if its recorded version is older than the
+// feature needs or, for binaries dnstc did not install, if --help does not
+// list it; when --help lists nothing, the binary is assumed to have it. A
+// binary lacking a required feature is an error.
+func useFeature(f Feature, path string) (bool, error) {
+	var missing string
+	if installed := binaries.InstalledVersion(f.Binary); installed != "" {
+		if binman.IsNewer(installed, f.MinVersion) {
+			missing = fmt.Sprintf("%s %s does not support %s (needs %s or later)",
+				f.Binary, installed, f.Name, f.MinVersion)
+		}
+	} else if flags := Flags(path); flags != nil && !flags[f.Flag] {
+		missing = fmt.Sprintf("%s at %s does not support %s (no %s option)",
+			f.Binary, path, f.Name, f.Flag)
+	}
+	if missing == "" {
+		return true, nil
+	}
+	if f.Optional {
+		slog.Warn("leaving out unsupported option", "binary", f.Binary, "option", f.Flag, "reason", missing)
+		return false, nil
+	}
+	return false, fmt.Errorf("%s; run 'dnstc update' to update %s", missing, f.Binary)
+}